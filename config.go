@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"muxic/internal/player/components"
+	"muxic/internal/util"
+
+	"github.com/charmbracelet/log"
+)
+
+// loadConfig reads the config file at path, or config.toml in muxic's config
+// directory if path is empty. Without a config file, the defaults are used.
+func loadConfig(path string) (components.Config, error) {
+	if path == "" {
+		var err error
+		if path, err = components.DefaultConfigPath(); err != nil {
+			log.Warn("Config file not read:", "error", err)
+			return components.DefaultConfig(), nil
+		}
+	}
+	return components.LoadConfig(path)
+}
+
+// playlistsPath returns the playlists file set in cfg, or the default one in
+// muxic's data directory.
+func playlistsPath(cfg components.Config) (string, error) {
+	if cfg.PlaylistsPath != "" {
+		return cfg.PlaylistsPath, nil
+	}
+	return components.DefaultPlaylistsPath()
+}
+
+// runConfig implements "muxic config". Its only subcommand, "init", writes a
+// commented config file with every setting at its default.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "init" {
+		_, _ = os.Stderr.WriteString("Usage: muxic config init [flags]\n")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	path := fs.String("path", "", "file to write (default: config.toml in muxic's config directory)")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Usage = func() {
+		_, _ = os.Stderr.WriteString("Usage: muxic config init [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args[1:])
+
+	if *path == "" {
+		dir, err := util.ConfigDir()
+		if err != nil {
+			return err
+		}
+		*path = filepath.Join(dir, "config.toml")
+	}
+	if _, err := os.Stat(*path); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", *path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(*path, components.DefaultConfigTOML(), 0o644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", *path)
+	return nil
+}
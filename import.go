@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"muxic/internal/player/components"
+)
+
+// runImport implements "muxic import": it adds M3U/M3U8 files to the saved
+// playlists without starting the player. Tracks are matched against the library
+// the next time muxic starts.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configFile := fs.String("config", "", "config file to read (default: config.toml in muxic's config directory)")
+	playlistsFile := fs.String("playlists", "",
+		"playlists file to import into (default: the config file's playlists_file, or muxic's data directory)")
+	fs.Usage = func() {
+		_, _ = os.Stderr.WriteString("Usage: muxic import [flags] playlist.m3u ...\n\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path := *playlistsFile
+	if path == "" {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		if path, err = playlistsPath(cfg); err != nil {
+			return err
+		}
+	}
+
+	store := components.NewPlaylistStore(path)
+	pm, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range fs.Args() {
+		playlist, err := pm.ImportM3U(file)
+		if err != nil {
+			return err
+		}
+		missing := 0
+		for _, track := range playlist.Tracks {
+			if _, err := os.Stat(track.Path); err != nil {
+				missing++
+			}
+		}
+		fmt.Printf("Imported %q: %d tracks", playlist.Name, playlist.Length())
+		if missing > 0 {
+			fmt.Printf(" (%d not found on disk)", missing)
+		}
+		fmt.Println()
+	}
+	return store.Save(pm)
+}
@@ -0,0 +1,176 @@
+package player
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"muxic/internal/player/components"
+	"muxic/internal/ui"
+)
+
+// bookmarkRow is what a row of the bookmarks table stands for.
+type bookmarkRow struct {
+	path  string // Track the bookmark is in
+	index int    // Index of the bookmark among the track's
+	mark  components.Bookmark
+}
+
+// bookmarkColumns lays out the columns of the bookmarks table.
+func bookmarkColumns(width int) []table.Column {
+	return ui.LayoutColumns(width, []ui.ColumnSpec{
+		{Title: "Track", Weight: 3},
+		{Title: "Bookmark", Weight: 2},
+		{Title: "Position", Width: 10},
+	})
+}
+
+// UpdateBookmarkTable rebuilds the bookmarks table, listing the bookmarks of
+// each track in turn.
+func (m *Model) UpdateBookmarkTable() {
+	m.bookmarkRows = m.bookmarkRows[:0]
+	var rows []table.Row
+	for _, t := range m.bookmarks.All() {
+		title := trackTitle(t.Path)
+		for i, mark := range t.Bookmarks {
+			m.bookmarkRows = append(m.bookmarkRows, bookmarkRow{path: t.Path, index: i, mark: mark})
+			rows = append(rows, table.Row{title, mark.Name, formatDuration(mark.Position)})
+			title = "" // The track is named on its first bookmark only.
+		}
+	}
+	m.BookmarkTable.SetRows(rows)
+	m.UpdateCursorPosition(&m.BookmarkTable)
+}
+
+// trackTitle returns the title of the library's track at path, or the name
+// of the file if the library doesn't have it.
+func trackTitle(path string) string {
+	if track, ok := components.GetLibrary().FindByPath(path); ok && track.Title != "" {
+		return track.Title
+	}
+	return filepath.Base(path)
+}
+
+// selectedBookmark returns the row under the cursor of the bookmarks table.
+func (m *Model) selectedBookmark() (bookmarkRow, bool) {
+	cursor := m.BookmarkTable.Cursor()
+	if cursor < 0 || cursor >= len(m.bookmarkRows) {
+		return bookmarkRow{}, false
+	}
+	return m.bookmarkRows[cursor], true
+}
+
+// openBookmarkPrompt asks for the name of a bookmark at the playback
+// position, unless nothing is playing.
+func (m *Model) openBookmarkPrompt() (tea.Model, tea.Cmd) {
+	if m.playback.State == components.StateStopped {
+		return m, nil
+	}
+	m.refreshPlayback()
+	m.bookmarkTrack, m.bookmarkPos = m.playback.CurrentTrack, m.playback.CurrentTime
+	m.naming = true
+	m.bookmarkInput.Reset()
+	m.bookmarkInput.Placeholder = formatDuration(m.bookmarkPos)
+	return m, m.bookmarkInput.Focus()
+}
+
+// handleBookmarkPromptKey types a key into the bookmark name prompt. Enter
+// adds the bookmark, named after its position if no name was typed, and
+// escape closes the prompt without adding it.
+func (m *Model) handleBookmarkPromptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.closeBookmarkPrompt()
+		name := strings.TrimSpace(m.bookmarkInput.Value())
+		if name == "" {
+			name = formatDuration(m.bookmarkPos)
+		}
+		m.bookmarks.Add(m.bookmarkTrack, name, m.bookmarkPos)
+		m.UpdateBookmarkTable()
+		m.Status, m.Error = "Bookmarked "+name+" at "+formatDuration(m.bookmarkPos), nil
+		return m, m.saveBookmarksCmd()
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.closeBookmarkPrompt()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.bookmarkInput, cmd = m.bookmarkInput.Update(msg)
+	return m, cmd
+}
+
+func (m *Model) closeBookmarkPrompt() {
+	m.naming = false
+	m.bookmarkInput.Blur()
+}
+
+// jumpToBookmark seeks to the next bookmark of the playing track, or to the
+// previous one.
+func (m *Model) jumpToBookmark(next bool) (tea.Model, tea.Cmd) {
+	if m.playback.State == components.StateStopped {
+		return m, nil
+	}
+	m.refreshPlayback()
+	marks := m.bookmarks.For(m.playback.CurrentTrack)
+	find := components.PreviousBookmark
+	if next {
+		find = components.NextBookmark
+	}
+	mark, ok := find(marks, m.playback.CurrentTime)
+	if !ok {
+		m.Status, m.Error = "No more bookmarks", nil
+		return m, nil
+	}
+	m.Status, m.Error = mark.Name, nil
+	return m.control(m.engine.Seek(mark.Position))
+}
+
+// playBookmark plays from the bookmark under the cursor of the bookmarks
+// view, starting its track if another one is playing.
+func (m *Model) playBookmark() (tea.Model, tea.Cmd) {
+	row, ok := m.selectedBookmark()
+	if !ok {
+		return m, nil
+	}
+	if track := m.playback.CurrentTrack; track == nil || track.Path != row.path ||
+		m.playback.State == components.StateStopped {
+		track, ok := components.GetLibrary().FindByPath(row.path)
+		if !ok {
+			m.Error = components.ErrTrackNotFound
+			return m, nil
+		}
+		m.engine.PlayNow(track)
+	}
+	m.Status, m.Error = row.mark.Name, nil
+	return m.control(m.engine.Seek(row.mark.Position))
+}
+
+// removeBookmark removes the bookmark under the cursor of the bookmarks view.
+func (m *Model) removeBookmark() (tea.Model, tea.Cmd) {
+	row, ok := m.selectedBookmark()
+	if !ok {
+		return m, nil
+	}
+	if err := m.bookmarks.Remove(row.path, row.index); err != nil {
+		m.Error = err
+		return m, nil
+	}
+	m.UpdateBookmarkTable()
+	m.Status, m.Error = "Removed bookmark "+row.mark.Name, nil
+	return m, m.saveBookmarksCmd()
+}
+
+// saveBookmarksCmd writes the bookmarks to disk. Saves are serialised by the
+// bookmarks themselves, so the file always ends up with the latest ones.
+func (m *Model) saveBookmarksCmd() tea.Cmd {
+	b := m.bookmarks
+	return func() tea.Msg {
+		if err := b.Save(); err != nil {
+			log.Printf("Failed to save bookmarks: %v", err)
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package player
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"muxic/internal/player/components"
+	"muxic/internal/ui"
+	"muxic/internal/util"
+)
+
+// chapterColumns lays out the columns of the chapters table.
+func chapterColumns(width int) []table.Column {
+	return ui.LayoutColumns(width, []ui.ColumnSpec{
+		{Title: "#", Width: 4},
+		{Title: "Chapter", Weight: 1},
+		{Title: "Start", Width: 10},
+		{Title: "Length", Width: 10},
+	})
+}
+
+// chapters returns the chapters of the track playing.
+func (m *Model) chapters() []util.Chapter {
+	if m.playback.CurrentTrack == nil || m.playback.State == components.StateStopped {
+		return nil
+	}
+	return m.playback.CurrentTrack.Chapters
+}
+
+// chapterTitle returns the title of chapters[i], or its number if it has none.
+func chapterTitle(chapters []util.Chapter, i int) string {
+	if chapters[i].Title != "" {
+		return chapters[i].Title
+	}
+	return fmt.Sprintf("Chapter %d", i+1)
+}
+
+// currentChapter returns the title of the chapter playing, if the track has
+// chapters.
+func (m *Model) currentChapter() (string, bool) {
+	chapters := m.chapters()
+	i, ok := util.ChapterAt(chapters, m.playback.CurrentTime)
+	if !ok {
+		return "", false
+	}
+	return chapterTitle(chapters, i), true
+}
+
+// UpdateChapterTable rebuilds the chapters table from the chapters of the
+// track playing.
+func (m *Model) UpdateChapterTable() {
+	chapters := m.chapters()
+	rows := make([]table.Row, len(chapters))
+	for i, c := range chapters {
+		length := util.ChapterEnd(chapters, i, m.playback.Duration) - c.Start
+		rows[i] = table.Row{fmt.Sprint(i + 1), chapterTitle(chapters, i), formatDuration(c.Start), formatDuration(length)}
+	}
+	m.ChapterTable.SetRows(rows)
+	m.UpdateCursorPosition(&m.ChapterTable)
+}
+
+// chapterMarks returns the ticks marking the start of each chapter on the
+// progress bar, but the first one's.
+func (m *Model) chapterMarks() []ui.ProgressMark {
+	chapters, total := m.chapters(), m.playback.Duration
+	if total <= 0 {
+		return nil
+	}
+	var marks []ui.ProgressMark
+	for _, c := range chapters {
+		if c.Start > 0 && c.Start < total {
+			marks = append(marks, ui.ProgressMark{At: float64(c.Start) / float64(total), Label: "|", Tick: true})
+		}
+	}
+	return marks
+}
+
+// jumpToChapter seeks to the start of the next chapter of the track playing,
+// or back to the start of the chapter playing or the one before it.
+func (m *Model) jumpToChapter(next bool) (tea.Model, tea.Cmd) {
+	m.refreshPlayback()
+	chapters := m.chapters()
+	if len(chapters) == 0 {
+		return m, nil
+	}
+	find := components.PreviousChapter
+	if next {
+		find = components.NextChapter
+	}
+	i, ok := find(chapters, m.playback.CurrentTime)
+	if !ok {
+		m.Status, m.Error = "No more chapters", nil
+		return m, nil
+	}
+	return m.playChapter(i)
+}
+
+// playChapter plays chapters[i] of the track playing from its start.
+func (m *Model) playChapter(i int) (tea.Model, tea.Cmd) {
+	chapters := m.chapters()
+	if i < 0 || i >= len(chapters) {
+		return m, nil
+	}
+	m.Status, m.Error = chapterTitle(chapters, i), nil
+	return m.control(m.engine.Seek(chapters[i].Start))
+}
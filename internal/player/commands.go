@@ -13,13 +13,10 @@ package player
 import (
 	"errors"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/gopxl/beep/speaker"
 	"muxic/internal/player/components"
 	"muxic/internal/util"
 )
@@ -34,6 +31,14 @@ type searchResultMsg struct {
 	tracks []*util.AudioFile
 }
 
+// tracksMeasuredMsg carries track durations and loudness measured by the
+// background measurement pass. Until done is set, more updates follow on source.
+type tracksMeasuredMsg struct {
+	updates []util.TrackUpdate
+	source  <-chan util.TrackUpdate
+	done    bool
+}
+
 // --- Queue Messages ---
 
 // addTrackToQueueMsg is a message that signals a request to add a specific track
@@ -86,30 +91,21 @@ type trackRemovedFromPlaylistMsg struct {
 	trackIndex int
 }
 
-// playlistShuffledMsg is sent when a playlist has been successfully shuffled.
+// playlistShuffledMsg is sent when shuffled playback of a playlist has been toggled.
 type playlistShuffledMsg struct {
 	playlistID int
 }
 
-// --- Player Messages ---
-
-// pauseMsg is sent when the audio player has been successfully paused.
-type pauseMsg struct{}
-
-// stopMsg is sent when the audio player has been successfully stopped.
-type stopMsg struct{}
-
-// playbackSeekedMsg is sent after a successful seek operation (e.g., skip forward/backward).
-// It carries the new stream position and the calculated human-readable time.
-type playbackSeekedMsg struct {
-	newPosition   int
-	newPlayedTime time.Duration
+// playlistExportedMsg is sent when a playlist has been exported to an M3U8 file.
+type playlistExportedMsg struct {
+	path string
 }
 
-// volumeChangedMsg is sent after the volume has been successfully changed.
-// It carries the new volume level.
-type volumeChangedMsg struct {
-	newVolume float64
+// --- Player Messages ---
+
+// playerEventMsg carries an event of the playback engine.
+type playerEventMsg struct {
+	event components.Event
 }
 
 // --- Command Factories ---
@@ -179,6 +175,27 @@ func CreatePlaylistCmd(pm *components.PlaylistManager, name string) tea.Cmd {
 	}
 }
 
+// savePlaylistsCmd persists the playlists. The snapshot is taken immediately,
+// on the Update goroutine, and written to disk by the returned command. It
+// returns nil when playlist persistence is disabled.
+func (m *Model) savePlaylistsCmd() tea.Cmd {
+	if m.playlistStore == nil || m.PlaylistManager == nil {
+		return nil
+	}
+	snap, err := m.playlistStore.Snapshot(m.PlaylistManager)
+	if err != nil {
+		return func() tea.Msg { return err }
+	}
+	store := m.playlistStore
+	return func() tea.Msg {
+		if err := store.Write(snap); err != nil {
+			log.Printf("Failed to save playlists: %v", err)
+			return err
+		}
+		return nil
+	}
+}
+
 // AddToPlaylistCmd performs the side effect of adding a track to a specified playlist.
 func AddToPlaylistCmd(pm *components.PlaylistManager, playlistID int, track *util.AudioFile) tea.Cmd {
 	return func() tea.Msg {
@@ -220,6 +237,8 @@ func RemoveFromPlaylistCmd(pm *components.PlaylistManager, playlistID int, track
 	}
 }
 
+// ShufflePlaylistCmd toggles shuffled playback of a playlist. The playlist's
+// track order itself is not changed.
 func ShufflePlaylistCmd(pm *components.PlaylistManager, playlistID int) tea.Cmd {
 	return func() tea.Msg {
 		if pm == nil {
@@ -235,103 +254,30 @@ func ShufflePlaylistCmd(pm *components.PlaylistManager, playlistID int) tea.Cmd
 	}
 }
 
-// PauseCmd performs the side effect of pausing playback via the audio speaker.
-// It locks the speaker to ensure thread safety.
-func PauseCmd(player *components.AudioPlayer) tea.Cmd {
+// ExportPlaylistCmd performs the side effect of writing a playlist to dir as
+// "<name>.m3u8", with paths relative to dir if relative is set.
+func ExportPlaylistCmd(pm *components.PlaylistManager, playlistID int, dir string, relative bool) tea.Cmd {
 	return func() tea.Msg {
-		if player.Ctrl == nil {
-			return errors.New("no active playback to pause")
-		}
-		speaker.Lock()
-		player.Ctrl.Paused = true
-		speaker.Unlock()
-
-		return pauseMsg{}
-	}
-}
-
-// StopCmd performs the side effects of clearing the speaker and closing the audio stream.
-func StopCmd(player *components.AudioPlayer) tea.Cmd {
-	return func() tea.Msg {
-		speaker.Clear()
-
-		if player.CurrentStreamer != nil {
-			// Closing the stream is the core I/O operation that can fail.
-			if err := player.CurrentStreamer.Close(); err != nil {
-				log.Printf("Error closing audio streamer: %v", err)
-				return err
-			}
-		}
-
-		return stopMsg{}
-	}
-}
-
-// SkipForwardCmd performs the side effect of seeking the audio stream forward by 10 seconds.
-// It calculates the new position and returns the result in a message.
-func SkipForwardCmd(player *components.AudioPlayer) tea.Cmd {
-	return func() tea.Msg {
-		if player.CurrentStreamer == nil {
-			return errors.New("no active playback to skip forward")
-		}
-
-		// Defer unlock to ensure it's always called, even if an error occurs.
-		speaker.Lock()
-		defer speaker.Unlock()
-
-		currentPos := player.CurrentStreamer.Position()
-		sampleRate := int(player.SampleRate)
-		newPos := currentPos + (10 * sampleRate) // 10 seconds forward
-		streamerLen := player.CurrentStreamer.Len()
-
-		if newPos > streamerLen {
-			newPos = streamerLen
+		if pm == nil {
+			return errors.New("cannot export playlist: playlist manager is nil")
 		}
-		if err := player.CurrentStreamer.Seek(newPos); err != nil {
+		playlist, err := pm.GetPlaylist(playlistID)
+		if err != nil {
 			return err
 		}
-		// Calculate the new human-readable time to send back to the model.
-		newPlayedTime := time.Duration(newPos) * time.Second / time.Duration(sampleRate)
 
-		return playbackSeekedMsg{newPosition: newPos, newPlayedTime: newPlayedTime}
-	}
-}
-
-// SkipBackwardCmd performs the side effect of seeking the audio stream backward by 10 seconds.
-func SkipBackwardCmd(player *components.AudioPlayer) tea.Cmd {
-	return func() tea.Msg {
-		if player.CurrentStreamer == nil {
-			return errors.New("no active playback to skip backward")
-		}
-
-		speaker.Lock()
-		defer speaker.Unlock()
-
-		currentPos := player.CurrentStreamer.Position()
-		sampleRate := int(player.SampleRate)
-		newPos := currentPos - (10 * sampleRate)
-
-		if newPos < 0 {
-			newPos = 0
-		}
-		if err := player.CurrentStreamer.Seek(newPos); err != nil {
+		name := strings.Map(func(r rune) rune {
+			if r == '/' || r == '\\' || r == 0 {
+				return '_'
+			}
+			return r
+		}, playlist.Name)
+		path := filepath.Join(dir, name+".m3u8")
+		if err := pm.ExportM3U(playlistID, path, relative); err != nil {
+			log.Printf("Failed to export playlist: %v", err)
 			return err
 		}
-		newPlayedTime := time.Duration(newPos) * time.Second / time.Duration(sampleRate)
-
-		return playbackSeekedMsg{newPosition: newPos, newPlayedTime: newPlayedTime}
-	}
-}
-
-// SetVolumeCmd is a reusable command that performs the side effect of setting the player volume.
-// It's used by Volume Up, Volume Down, etc., which calculate the target level in the Update loop.
-func SetVolumeCmd(player *components.AudioPlayer, newVolume float64) tea.Cmd {
-	return func() tea.Msg {
-		if player == nil || player.Volume == nil {
-			return errors.New("cannot set volume: player or volume controller is nil")
-		}
-		player.SetVolume(newVolume)
-		return volumeChangedMsg{newVolume: newVolume}
+		return playlistExportedMsg{path: path}
 	}
 }
 
@@ -360,23 +306,59 @@ func SearchCmd(query string) tea.Cmd {
 }
 
 // LoadLibraryCmd performs the initial, potentially long-running I/O operation of
-// scanning the user's Music directory for audio files.
-func LoadLibraryCmd() tea.Cmd {
+// scanning the configured library roots for audio files.
+func LoadLibraryCmd(opts util.ScanOptions) tea.Cmd {
 	return func() tea.Msg {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Printf("Failed to get home directory: %v", err)
-			return err // Return the error as a message for the Update loop.
-		}
-		musicDir := filepath.Join(homeDir, "Music")
-
-		tracks, err := util.GetAudioFiles(musicDir)
+		tracks, err := util.ScanLibrary(opts)
 		if err != nil {
 			log.Printf("Failed to scan audio files: %v", err)
-			return err
+			return err // Return the error as a message for the Update loop.
 		}
 
 		// On success, return a message with the loaded tracks.
 		return LibraryLoadedMsg{Tracks: tracks}
 	}
 }
+
+// MeasureTracksCmd starts the optional background pass that decodes tracks
+// whose durations were only estimated from their headers, or whose loudness is
+// needed for normalization. Results arrive in batches as tracksMeasuredMsg, so
+// the tables update while the pass runs.
+func MeasureTracksCmd(tracks []*util.AudioFile, opts util.ScanOptions, what util.MeasureOptions) tea.Cmd {
+	return func() tea.Msg {
+		updates := make(chan util.TrackUpdate)
+		go util.MeasureTracks(tracks, opts, what, updates)
+		return waitForMeasurementsCmd(updates)()
+	}
+}
+
+// waitForMeasurementsCmd waits for the next measured track, collecting any
+// others that are already available into the same message.
+func waitForMeasurementsCmd(updates <-chan util.TrackUpdate) tea.Cmd {
+	return func() tea.Msg {
+		u, ok := <-updates
+		if !ok {
+			return tracksMeasuredMsg{done: true}
+		}
+		msg := tracksMeasuredMsg{updates: []util.TrackUpdate{u}, source: updates}
+		for {
+			select {
+			case u, ok := <-updates:
+				if !ok {
+					msg.done = true
+					return msg
+				}
+				msg.updates = append(msg.updates, u)
+			default:
+				return msg
+			}
+		}
+	}
+}
+
+// waitForEventCmd waits for the next event of the playback engine.
+func waitForEventCmd(events <-chan components.Event) tea.Cmd {
+	return func() tea.Msg {
+		return playerEventMsg{event: <-events}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"github.com/gopxl/beep"
 	"github.com/gopxl/beep/effects"
-	"github.com/gopxl/beep/speaker"
 	"math"
 	"muxic/internal/util"
 	"sync"
@@ -20,122 +19,530 @@ const (
 	volumeBase = 2.0
 	// Max gain in decibels
 	maxGainDB = 12.0
+	// Resampling quality bounds accepted by beep.Resample
+	minResampleQuality = 1
+	maxResampleQuality = 64
 )
 
-// AudioPlayer represents the state of the audio player
+const (
+	// OutputSampleRate is the sample rate outputs are opened with. Tracks
+	// with a different rate are resampled to it during playback.
+	OutputSampleRate = beep.SampleRate(44100)
+	// DefaultResampleQuality is a good balance between CPU usage and quality
+	// for on-the-fly resampling.
+	DefaultResampleQuality = 4
+)
+
+// ErrNotPlaying is returned when seeking or preloading with no track loaded.
+var ErrNotPlaying = errors.New("no track is playing")
+
+// errForeignTrack is returned for a track opened by another player.
+var errForeignTrack = errors.New("track was opened by another player")
+
+// AudioPlayer plays tracks through an Output. A track can be preloaded to
+// follow the current one: it is opened ahead of time and streamed straight
+// after the current track's last sample, so there is no gap between them, or
+// crossfaded into it as set by SetCrossfade.
+//
+// SetLoop loops a section of the current track: when it reaches the end of
+// the section it carries on from the start, on the next sample.
+//
+// Tracks play at the speed set by SetSpeed, stretched in time to keep their
+// pitch or resampled. Their progress is counted in the tracks' own time, so
+// at double speed a minute of a track passes in half a minute.
+//
+// The output's goroutine streams the tracks and updates their progress, so
+// everything it touches, the Ctrl, Equalizer and Volume included, is only read
+// or written with the output locked. All methods are safe for concurrent use;
+// State returns a consistent snapshot for display.
 type AudioPlayer struct {
-	CurrentStreamer      beep.StreamSeekCloser // Current audio stream
-	Playing              bool                  // Whether audio is playing
-	Looping              bool                  // Whether audio is looping
-	SamplesPlayed        int                   // Samples played so far
-	TotalSamples         int                   // Total samples in current track
-	SampleRate           beep.SampleRate       // Audio sample rate
-	PlayedTime           time.Duration         // Formatted play time
-	TotalTime            time.Duration         // Total track duration
-	Ctrl                 *beep.Ctrl            // Playback controller
-	Volume               *effects.Volume       // Volume controller
-	CurrentVolumePercent float64               // 0-100
-
-	// doneChan signals that playback has finished.
-	doneChan chan struct{}
-	// closeOnce ensures the doneChan is closed only once.
+	OutputSampleRate beep.SampleRate // Sample rate of the output; it doesn't change
+
+	output Output
+	eq     *Equalizer   // Equalizes the tracks before the volume is applied
+	speed  *speedStage  // Changes the speed of the tracks before they are equalized
+	speeds *SpeedMemory // Speeds remembered for tracks or albums; may be nil
+
+	// Guarded by the output lock.
+	current         *playback       // Track playing or paused; nil when stopped
+	next            *playback       // Track preloaded to follow current; may be nil
+	ctrl            *beep.Ctrl      // Pauses the stream; nil once the output has dropped it
+	volume          *effects.Volume // Volume controller
+	volumePercent   float64         // 0-100, carried over from track to track
+	resampleQuality int             // Quality used when resampling to the output rate
+	crossfade       Crossfade
+	fading          *fade        // Track fading out under current; may be nil
+	fadeBuf         [][2]float64 // Scratch buffer for the fading track
+	normalization   Normalization
+	shuffled        bool // Whether the tracks come from a shuffled queue
+	speedSettings   SpeedSettings
+}
+
+// playback is a track opened by the player. Once it is playing, its streamer
+// and progress belong to the output's goroutine.
+type playback struct {
+	track        *util.AudioFile
+	streamer     beep.StreamSeekCloser // Decoded track
+	source       beep.Streamer         // streamer counted and resampled to the output rate
+	sampleRate   beep.SampleRate       // Sample rate of the track
+	samplesDone  int                   // Samples played so far, in the track's rate
+	totalSamples int                   // Length of the track
+	loopStart    int                   // Start of the A-B loop, in the track's samples
+	loopEnd      int                   // End of the A-B loop; 0 if there is none
+
+	done      chan struct{} // Closed once the track finishes or is stopped
+	endOnce   sync.Once
 	closeOnce sync.Once
 }
 
-func NewAudioPlayer() *AudioPlayer {
-	return &AudioPlayer{
-		// Initialize with default values
-		CurrentStreamer:      nil,
-		Playing:              false,
-		SamplesPlayed:        0,
-		TotalSamples:         0,
-		SampleRate:           0,
-		PlayedTime:           0,
-		TotalTime:            0,
-		Ctrl:                 nil,
-		Volume:               nil,
-		CurrentVolumePercent: 50.0,
+// end signals that the track has finished. A track fading out has ended
+// although it is still heard. It is safe to call more than once.
+func (p *playback) end() {
+	p.endOnce.Do(func() { close(p.done) })
+}
+
+// Track returns the track that was opened.
+func (p *playback) Track() *util.AudioFile {
+	return p.track
+}
+
+// Close closes a track that was opened but won't be played.
+func (p *playback) Close() {
+	p.close()
+}
+
+// close ends the track and closes its decoder. It is safe to call more than
+// once, and with the output locked.
+func (p *playback) close() {
+	p.end()
+	p.closeOnce.Do(func() {
+		go p.streamer.Close() // Don't hold up the output while the decoder closes.
+	})
+}
+
+// remaining returns the number of samples left in the track at rate.
+func (p *playback) remaining(rate beep.SampleRate) int {
+	left := max(0, p.totalSamples-p.samplesDone)
+	if p.sampleRate == rate {
+		return left
 	}
+	return int(int64(left) * int64(rate) / int64(p.sampleRate))
 }
 
-func (a *AudioPlayer) Play(track *util.AudioFile) error {
-	if a.IsPlaying() {
-		a.Stop()
+// duration converts a number of the track's samples to time.
+func (p *playback) duration(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(p.sampleRate)
+}
+
+// samples converts a position in the track to its samples, clamped to the
+// track.
+func (p *playback) samples(pos time.Duration) int {
+	return max(0, min(int(pos.Seconds()*float64(p.sampleRate)), p.totalSamples))
+}
+
+// loopBack returns to the start of the A-B loop. If the decoder can't seek,
+// the loop is dropped and the track plays on.
+func (p *playback) loopBack() {
+	if err := p.streamer.Seek(p.loopStart); err != nil {
+		p.loopEnd = 0
+		return
 	}
+	p.samplesDone = p.loopStart
+}
 
-	streamer, format, totalSamples, err := util.OpenAudioFile(track.Path)
-	if err != nil {
-		return err
+// PlayerState is a snapshot of an AudioPlayer.
+type PlayerState struct {
+	Track         *util.AudioFile // Track playing or paused; nil when stopped
+	Paused        bool            // Whether the track is paused
+	SamplesPlayed int             // Samples of the track played so far
+	TotalSamples  int             // Total samples in the track
+	PlayedTime    time.Duration   // Time played so far
+	TotalTime     time.Duration   // Duration of the track
+	LoopStart     time.Duration   // Start of the A-B loop
+	LoopEnd       time.Duration   // End of the A-B loop; 0 if there is none
+	Volume        float64         // Volume percentage (0-100)
+	Speed         float64         // Speed the track plays at, 1 being normal
+}
+
+// NewAudioPlayer returns a player that plays through output.
+func NewAudioPlayer(output Output) *AudioPlayer {
+	a := &AudioPlayer{
+		OutputSampleRate: output.SampleRate(),
+		output:           output,
+		eq:               newEqualizer(output, output.SampleRate()),
+		volumePercent:    50.0,
+		resampleQuality:  DefaultResampleQuality,
+		speedSettings:    SpeedSettings{Speed: 1, PreservePitch: true},
 	}
+	a.speed = newSpeedStage(beep.StreamerFunc(a.stream), a.OutputSampleRate)
+	a.eq.Streamer = a.speed
+	return a
+}
 
-	a.CurrentStreamer = streamer
-	a.SampleRate = format.SampleRate
-	a.TotalSamples = totalSamples
-	a.SamplesPlayed = 0
-	a.PlayedTime = 0
-	a.TotalTime = time.Duration(totalSamples) * time.Second / time.Duration(format.SampleRate)
+// Equalizer returns the player's equalizer. It is off until set otherwise.
+func (a *AudioPlayer) Equalizer() *Equalizer {
+	return a.eq
+}
 
-	a.doneChan = make(chan struct{})
-	a.closeOnce = sync.Once{}
+// SetResampleQuality sets the quality used to resample tracks whose sample rate
+// differs from the output rate. It takes effect from the next track opened.
+func (a *AudioPlayer) SetResampleQuality(quality int) {
+	if quality < minResampleQuality {
+		quality = minResampleQuality
+	} else if quality > maxResampleQuality {
+		quality = maxResampleQuality
+	}
+	a.output.Lock()
+	a.resampleQuality = quality
+	a.speed.quality = quality
+	a.output.Unlock()
+}
 
-	callbackStreamer := beep.Callback(func() {
-		// LOGGING: This is the natural end of the song.
-		a.Playing = false
-		a.closeOnce.Do(func() { close(a.doneChan) })
-	})
+func (a *AudioPlayer) Play(track *util.AudioFile) error {
+	return a.PlayFrom(track, 0, false)
+}
 
-	progressStreamer := beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+// PlayFrom plays the track starting at pos, blocking until it finishes or is
+// stopped. If paused is set the track is loaded but waits for Resume.
+func (a *AudioPlayer) PlayFrom(track *util.AudioFile, pos time.Duration, paused bool) error {
+	done, err := a.Start(track, pos, paused)
+	if err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// open opens and decodes track, ready to play from pos.
+func (a *AudioPlayer) open(track *util.AudioFile, pos time.Duration) (*playback, error) {
+	streamer, format, totalSamples, err := util.OpenTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	startSample := 0
+	if pos > 0 {
+		startSample = min(int(pos.Seconds()*float64(format.SampleRate)), totalSamples)
+		if err := streamer.Seek(startSample); err != nil {
+			_ = streamer.Close()
+			return nil, err
+		}
+	}
+
+	p := &playback{
+		track:        track,
+		streamer:     streamer,
+		sampleRate:   format.SampleRate,
+		samplesDone:  startSample,
+		totalSamples: totalSamples,
+		done:         make(chan struct{}),
+	}
+	// Progress is counted before resampling, so samplesDone and seeking both
+	// stay in the source's sample rate. The A-B loop is kept here too, so it
+	// jumps back on the exact sample whatever comes after.
+	p.source = beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		if p.loopEnd > p.samplesDone {
+			samples = samples[:min(len(samples), p.loopEnd-p.samplesDone)]
+		}
 		n, ok = streamer.Stream(samples)
-		a.SamplesPlayed += n
-		a.PlayedTime = time.Duration(a.SamplesPlayed) * time.Second /
-			time.Duration(a.SampleRate)
+		p.samplesDone += n
+		if n > 0 && p.samplesDone == p.loopEnd {
+			p.loopBack()
+		}
 		return n, ok
 	})
+	a.output.Lock()
+	quality := a.resampleQuality
+	gain := a.normalization.gain(track, a.shuffled)
+	a.output.Unlock()
+	if gain != 1 {
+		p.source = &effects.Gain{Streamer: p.source, Gain: gain - 1}
+	}
+	if a.OutputSampleRate > 0 && format.SampleRate != a.OutputSampleRate {
+		p.source = beep.Resample(quality, format.SampleRate, a.OutputSampleRate, p.source)
+	}
+	return p, nil
+}
 
-	currentVolume := 0.0
-	if a.Volume != nil {
-		currentVolume = a.Volume.Volume
+// Open opens and decodes track, ready to play from pos with StartOpened or
+// PreloadOpened, leaving playback alone. Opening may take a while, as some
+// decoders scan the whole file.
+func (a *AudioPlayer) Open(track *util.AudioFile, pos time.Duration) (OpenedTrack, error) {
+	p, err := a.open(track, pos)
+	if err != nil {
+		return nil, err
 	}
+	return p, nil
+}
 
-	a.Volume = &effects.Volume{
-		Streamer: progressStreamer,
-		Base:     2,
-		Volume:   currentVolume,
-		Silent:   false,
+// Start replaces the current track with track, playing from pos, and returns
+// a channel that is closed when it finishes or is stopped. It is Open
+// followed by StartOpened; on error, nothing is left playing.
+func (a *AudioPlayer) Start(track *util.AudioFile, pos time.Duration, paused bool) (<-chan struct{}, error) {
+	p, err := a.open(track, pos)
+	if err != nil {
+		a.Stop()
+		return nil, err
 	}
-	a.Ctrl = &beep.Ctrl{Streamer: a.Volume}
+	return a.StartOpened(p, paused)
+}
 
-	speaker.Play(beep.Seq(a.Ctrl, callbackStreamer))
-	a.Playing = true
-	a.Ctrl.Paused = false
+// StartOpened replaces the current track with opened, a track opened by Open,
+// and returns a channel that is closed when it finishes or is stopped. A
+// playing track fades out briefly rather than being cut off. If paused is set
+// the track is loaded but waits for Resume. Once StartOpened has returned,
+// Stop always stops this track.
+func (a *AudioPlayer) StartOpened(opened OpenedTrack, paused bool) (<-chan struct{}, error) {
+	p, ok := opened.(*playback)
+	if !ok {
+		return nil, errForeignTrack
+	}
 
-	<-a.doneChan // Block here
+	a.output.Lock()
+	var tail *fade
+	if a.current != nil && !a.ctrl.Paused && !paused {
+		tail = &fade{p: a.current, curve: FadeLinear, n: a.OutputSampleRate.N(skipFade)}
+		a.current.end()
+		a.current = nil
+	}
+	// Another track may have been started since this one was opened; the
+	// last one to get here wins.
+	a.dropTracks()
+	a.current, a.fading = p, tail
+	a.applySpeed()
+	if a.ctrl != nil {
+		// Carry on in the same stream, so the fade follows on seamlessly.
+		a.ctrl.Paused = paused
+		a.output.Unlock()
+		return p.done, nil
+	}
+	a.speed.reset() // Don't play what was left over from the last stream.
+	a.volume = &effects.Volume{Streamer: a.eq, Base: volumeBase}
+	a.ctrl = &beep.Ctrl{Streamer: a.volume, Paused: paused}
+	applyVolume(a.volume, a.volumePercent) // Carry the volume over from the last track
+	ctrl := a.ctrl
+	a.output.Unlock()
+
+	a.output.Play(ctrl)
+	return p.done, nil
+}
 
-	return nil
+// Preload opens track to be played straight after the current one, replacing
+// any track preloaded before. It is Open followed by PreloadOpened.
+func (a *AudioPlayer) Preload(track *util.AudioFile) (<-chan struct{}, error) {
+	p, err := a.open(track, 0)
+	if err != nil {
+		return nil, err
+	}
+	return a.PreloadOpened(p)
 }
 
+// PreloadOpened has opened, a track opened by Open, play straight after the
+// current one, replacing any track preloaded before, and returns a channel
+// that is closed when it finishes or is stopped. The current track's channel
+// is closed at the moment the preloaded one takes over. If nothing is
+// playing, opened is closed.
+func (a *AudioPlayer) PreloadOpened(opened OpenedTrack) (<-chan struct{}, error) {
+	p, ok := opened.(*playback)
+	if !ok {
+		return nil, errForeignTrack
+	}
+
+	a.output.Lock()
+	defer a.output.Unlock()
+	if a.current == nil {
+		p.close()
+		return nil, ErrNotPlaying
+	}
+	if a.next != nil {
+		a.next.close()
+	}
+	a.next = p
+	return p.done, nil
+}
+
+// CancelPreload drops the preloaded track, if any, so playback stops after
+// the current one.
+func (a *AudioPlayer) CancelPreload() {
+	a.output.Lock()
+	defer a.output.Unlock()
+	if a.next != nil {
+		a.next.close()
+		a.next = nil
+	}
+}
+
+// SetCrossfade sets how the current track is joined to the preloaded one. It
+// applies from the next transition.
+func (a *AudioPlayer) SetCrossfade(c Crossfade) {
+	c.Duration = max(0, min(c.Duration, MaxCrossfade))
+	a.output.Lock()
+	defer a.output.Unlock()
+	a.crossfade = c
+}
+
+// SetNormalization sets how the loudness of tracks is normalized. It applies
+// from the next track opened.
+func (a *AudioPlayer) SetNormalization(n Normalization) {
+	a.output.Lock()
+	defer a.output.Unlock()
+	a.normalization = n
+}
+
+// SetShuffled tells the player whether tracks come from a shuffled queue,
+// which picks between album and track gains in auto ReplayGain mode.
+func (a *AudioPlayer) SetShuffled(on bool) {
+	a.output.Lock()
+	defer a.output.Unlock()
+	a.shuffled = on
+}
+
+// stream fills samples from the current track, moving on to the preloaded
+// track when it ends, within the same buffer. With a crossfade, the preloaded
+// track takes over that long before the end, and the current one fades out
+// under it. It runs on the output's goroutine with the output locked.
+func (a *AudioPlayer) stream(samples [][2]float64) (int, bool) {
+	filled := 0
+	for filled < len(samples) && a.current != nil {
+		buf := samples[filled:]
+		// A looping track doesn't reach its end, so it isn't crossfaded.
+		if a.fading == nil && a.next != nil && a.current.loopEnd == 0 &&
+			a.crossfade.applies(a.current.track, a.next.track) {
+			n := a.OutputSampleRate.N(a.crossfade.Duration)
+			left := a.current.remaining(a.OutputSampleRate)
+			if left <= n {
+				a.fading = &fade{p: a.current, curve: a.crossfade.Curve, n: left, fadeIn: true}
+				a.current.end()
+				a.current, a.next = a.next, nil
+				a.applySpeed()
+				continue
+			}
+			buf = buf[:min(len(buf), left-n)] // Stop where the crossfade starts.
+		}
+
+		n, ok := a.current.source.Stream(buf)
+		if a.fading != nil {
+			if len(a.fadeBuf) < len(buf) {
+				a.fadeBuf = make([][2]float64, len(buf))
+			}
+			if a.fading.mix(buf[:n], a.fadeBuf) {
+				a.dropFade()
+			}
+		}
+		filled += n
+		if ok && n > 0 {
+			continue
+		}
+		// The track has ended. A fade still going is cut short.
+		a.dropFade()
+		a.current.close()
+		a.current, a.next = a.next, nil
+		a.applySpeed()
+	}
+	if filled == 0 {
+		a.ctrl, a.volume = nil, nil // The output drops the stream once it ends.
+	}
+	return filled, filled > 0
+}
+
+// SetSpeedSettings sets the speed of tracks without a remembered one, and how
+// the speed is changed. The current track changes speed straight away.
+func (a *AudioPlayer) SetSpeedSettings(s SpeedSettings) {
+	s.Speed = clampSpeed(s.Speed)
+	a.output.Lock()
+	defer a.output.Unlock()
+	if s.PreservePitch != a.speedSettings.PreservePitch {
+		a.speed.setPreservePitch(s.PreservePitch)
+	}
+	a.speedSettings = s
+	a.applySpeed()
+}
+
+// SetSpeedMemory sets where speeds are remembered. Nil forgets them.
+func (a *AudioPlayer) SetSpeedMemory(m *SpeedMemory) {
+	a.output.Lock()
+	defer a.output.Unlock()
+	a.speeds = m
+	a.applySpeed()
+}
+
+// SetSpeed changes the speed of the current track, clamped to MinSpeed and
+// MaxSpeed. The speed is remembered for the track or its album if the speed
+// memory says so; otherwise, or with no track playing, it becomes the speed
+// of every track.
+func (a *AudioPlayer) SetSpeed(speed float64) {
+	speed = clampSpeed(speed)
+	a.output.Lock()
+	defer a.output.Unlock()
+	var track *util.AudioFile
+	if a.current != nil {
+		track = a.current.track
+	}
+	if !a.speeds.Remember(track, speed, a.speedSettings.Speed) {
+		a.speedSettings.Speed = speed
+	}
+	a.speed.setSpeed(speed)
+}
+
+// applySpeed plays the current track at its remembered speed, or the set
+// one. The output must be locked.
+func (a *AudioPlayer) applySpeed() {
+	speed := a.speedSettings.Speed
+	if a.current != nil {
+		if s, ok := a.speeds.Lookup(a.current.track); ok {
+			speed = s
+		}
+	}
+	a.speed.setSpeed(speed)
+}
+
+// dropFade ends the fade-out, if any. The output must be locked.
+func (a *AudioPlayer) dropFade() {
+	if a.fading != nil {
+		a.fading.p.close()
+		a.fading = nil
+	}
+}
+
+// Pause pauses the current track.
 func (a *AudioPlayer) Pause() {
-	if a.Ctrl != nil {
-		a.Ctrl.Paused = true
-		a.Playing = false
+	a.setPaused(true)
+}
+
+// Resume continues a paused track.
+func (a *AudioPlayer) Resume() {
+	a.setPaused(false)
+}
+
+func (a *AudioPlayer) setPaused(paused bool) {
+	a.output.Lock()
+	defer a.output.Unlock()
+	if a.ctrl != nil {
+		a.ctrl.Paused = paused
 	}
 }
 
+// Stop ends the current track and drops the preloaded one, releasing whoever
+// waits for them.
 func (a *AudioPlayer) Stop() {
-	if a.CurrentStreamer != nil {
-		speaker.Clear()
-		_ = a.CurrentStreamer.Close()
-		a.CurrentStreamer = nil
+	a.output.Lock()
+	defer a.output.Unlock()
+	a.dropTracks()
+	if a.ctrl != nil {
+		// The output drops a Ctrl without a streamer the next time it reads it.
+		a.ctrl.Streamer = nil
+		a.ctrl, a.volume = nil, nil
 	}
-	a.Playing = false
-	a.SamplesPlayed = 0
-	a.TotalSamples = 0
-	a.PlayedTime = 0
+}
 
-	// If a track was playing, signal it to unblock the waiting Play command.
-	if a.doneChan != nil {
-		a.closeOnce.Do(func() { close(a.doneChan) })
+// dropTracks ends and closes every track. The output must be locked.
+func (a *AudioPlayer) dropTracks() {
+	for _, p := range []*playback{a.current, a.next} {
+		if p != nil {
+			p.close()
+		}
 	}
+	a.current, a.next = nil, nil
+	a.dropFade()
 }
 
 // SetVolume sets the volume as a percentage (0-100)
@@ -147,82 +554,123 @@ func (a *AudioPlayer) SetVolume(percent float64) {
 		percent = maxVolume
 	}
 
-	a.CurrentVolumePercent = percent
+	a.output.Lock()
+	defer a.output.Unlock()
 
-	if a.Volume == nil {
-		return
+	a.volumePercent = percent
+	if a.volume != nil {
+		applyVolume(a.volume, percent)
 	}
+}
 
-	// Lock the speaker to prevent race conditions
-	speaker.Lock()
-	defer speaker.Unlock()
-
+// applyVolume sets v to a volume percentage. The output must be locked if v
+// is playing.
+func applyVolume(v *effects.Volume, percent float64) {
 	if percent <= 0 {
 		// Mute if volume is 0 or less
-		a.Volume.Silent = true
-	} else {
-		// Convert percentage to exponential gain
-		a.Volume.Silent = false
-		if percent == 100 {
-			// At 100%, use max gain
-			a.Volume.Volume = maxGainDB / 10 // Convert dB to beep's scale
-		} else {
-			// Convert percentage to gain in decibels
-			scaledPercent := percent / 100
-			db := 10 * math.Log10(scaledPercent)
-			a.Volume.Volume = db / 2 // Convert to beep's scale
-		}
+		v.Silent = true
+		return
 	}
-
-	// Update the streamer to apply changes
-	if a.Ctrl != nil {
-		a.Ctrl.Streamer = a.Volume
+	// Convert percentage to exponential gain
+	v.Silent = false
+	if percent == 100 {
+		// At 100%, use max gain
+		v.Volume = maxGainDB / 10 // Convert dB to beep's scale
+	} else {
+		// Convert percentage to gain in decibels
+		scaledPercent := percent / 100
+		db := 10 * math.Log10(scaledPercent)
+		v.Volume = db / 2 // Convert to beep's scale
 	}
 }
 
 // GetVolume returns the current volume percentage (0-100)
 func (a *AudioPlayer) GetVolume() float64 {
-	return a.CurrentVolumePercent
+	return a.State().Volume
 }
 
+// SeekTo moves the current track to pos.
 func (a *AudioPlayer) SeekTo(pos time.Duration) error {
-	// Check if a track is playing
-	if a.CurrentStreamer == nil {
-		return errors.New("no track is playing")
-	}
-	
-	speaker.Lock()
-	defer speaker.Unlock()
+	a.output.Lock()
+	defer a.output.Unlock()
 
-	// Convert position to sample position
-	samplePos := int(pos.Seconds() * float64(a.SampleRate))
-	if err := a.CurrentStreamer.Seek(samplePos); err != nil {
+	p := a.current
+	if p == nil {
+		return ErrNotPlaying
+	}
+	samplePos := p.samples(pos)
+	if err := p.streamer.Seek(samplePos); err != nil {
 		return err
 	}
+	p.samplesDone = samplePos
+	a.speed.reset() // Jump straight there, rather than after what is buffered.
+	return nil
+}
 
-	a.SamplesPlayed = samplePos
-	a.PlayedTime = pos
+// SetLoop loops the current track between start and end, an A-B loop that
+// lasts until the track ends or another loop is set. If the track is already
+// past end, it jumps back to start. A zero end clears the loop.
+func (a *AudioPlayer) SetLoop(start, end time.Duration) error {
+	a.output.Lock()
+	defer a.output.Unlock()
+
+	p := a.current
+	if p == nil {
+		return ErrNotPlaying
+	}
+	if end == 0 {
+		p.loopStart, p.loopEnd = 0, 0
+		return nil
+	}
+	s, e := p.samples(start), p.samples(end)
+	if e <= s {
+		return ErrInvalidLoop
+	}
+	p.loopStart, p.loopEnd = s, e
+	if p.samplesDone >= e {
+		p.loopBack()
+		a.speed.reset()
+	}
 	return nil
 }
 
+// State returns a snapshot of the player, taken with the output locked.
+func (a *AudioPlayer) State() PlayerState {
+	a.output.Lock()
+	defer a.output.Unlock()
+
+	s := PlayerState{Volume: a.volumePercent, Speed: a.speed.speed}
+	if p := a.current; p != nil {
+		s.Track = p.track
+		s.Paused = a.ctrl != nil && a.ctrl.Paused
+		s.SamplesPlayed = p.samplesDone
+		s.TotalSamples = p.totalSamples
+		s.PlayedTime = p.duration(p.samplesDone)
+		s.TotalTime = p.duration(p.totalSamples)
+		if p.loopEnd > 0 {
+			s.LoopStart, s.LoopEnd = p.duration(p.loopStart), p.duration(p.loopEnd)
+		}
+	}
+	return s
+}
+
 func (a *AudioPlayer) GetProgress() float64 {
-	if a.TotalSamples <= 0 {
+	s := a.State()
+	if s.TotalSamples <= 0 {
 		return 0
 	}
-	return float64(a.SamplesPlayed) / float64(a.TotalSamples)
+	return float64(s.SamplesPlayed) / float64(s.TotalSamples)
 }
+
 func (a *AudioPlayer) GetPlayedTime() time.Duration {
-	return a.PlayedTime
+	return a.State().PlayedTime
 }
 
 func (a *AudioPlayer) GetTotalTime() time.Duration {
-	return a.TotalTime
+	return a.State().TotalTime
 }
 
 func (a *AudioPlayer) IsPlaying() bool {
-	return a.Playing && a.Ctrl != nil && !a.Ctrl.Paused
-}
-
-func (a *AudioPlayer) isLooping() bool {
-	return a.Looping
+	s := a.State()
+	return s.Track != nil && !s.Paused
 }
@@ -0,0 +1,589 @@
+package components
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+// toneTracks writes n tracks of a constant tone lasting d and returns them.
+func toneTracks(t *testing.T, n int, d time.Duration) []*util.AudioFile {
+	t.Helper()
+	dir := t.TempDir()
+	tracks := make([]*util.AudioFile, n)
+	for i := range tracks {
+		title := string(rune('A' + i))
+		path := filepath.Join(dir, title+".wav")
+		writeTone(t, path, OutputSampleRate, d, 0.25)
+		tracks[i] = &util.AudioFile{Title: title, Path: path, Duration: d}
+	}
+	return tracks
+}
+
+// waitClosed fails the test unless done is closed within a second.
+func waitClosed(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s never finished", what)
+	}
+}
+
+// recordedLevels returns the samples of the left channel of a recording made
+// by a WAV output.
+func recordedLevels(t *testing.T, path string) []int16 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels []int16
+	for i := wavHeaderSize; i+3 < len(data); i += 4 {
+		levels = append(levels, int16(binary.LittleEndian.Uint16(data[i:])))
+	}
+	return levels
+}
+
+// defaultGain is the gain of the player's default volume.
+var defaultGain = math.Pow(volumeBase, (10*math.Log10(0.5))/2)
+
+func TestAudioPlayerStartStop(t *testing.T) {
+	tracks := toneTracks(t, 2, time.Minute)
+	output := NewNullOutput(OutputSampleRate, 1)
+	defer output.Close()
+	a := NewAudioPlayer(output)
+
+	first, err := a.Start(tracks[0], 30*time.Second, true)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if s := a.State(); s.Track != tracks[0] || !s.Paused || s.PlayedTime != 30*time.Second || s.TotalTime != time.Minute {
+		t.Errorf("state after a paused start = %+v", s)
+	}
+
+	// Starting another track ends the first.
+	second, err := a.Start(tracks[1], 0, false)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitClosed(t, first, "the replaced track")
+	if err := a.SeekTo(10 * time.Second); err != nil {
+		t.Fatalf("SeekTo: %v", err)
+	}
+	if s := a.State(); s.Paused || s.PlayedTime < 10*time.Second {
+		t.Errorf("state after seeking = %+v", s)
+	}
+
+	a.Stop()
+	waitClosed(t, second, "the stopped track")
+	if s := a.State(); s.Track != nil || a.IsPlaying() {
+		t.Errorf("state after Stop = %+v", s)
+	}
+	if err := a.SeekTo(time.Second); err != ErrNotPlaying {
+		t.Errorf("SeekTo while stopped = %v, want ErrNotPlaying", err)
+	}
+
+	if _, err := a.Start(&util.AudioFile{Path: filepath.Join(t.TempDir(), "missing.wav")}, 0, false); err == nil {
+		t.Error("Start of a missing file succeeded")
+	}
+}
+
+// writeSteps writes a track that holds each of levels in turn for d.
+func writeSteps(t *testing.T, path string, d time.Duration, levels ...float64) {
+	t.Helper()
+	n := OutputSampleRate.N(d)
+	data := wavHeader(OutputSampleRate, uint32(len(levels)*n*4))
+	for _, level := range levels {
+		for range n {
+			data = binary.LittleEndian.AppendUint16(data, uint16(pcm16(level)))
+			data = binary.LittleEndian.AppendUint16(data, uint16(pcm16(level)))
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAudioPlayerLoop(t *testing.T) {
+	dir := t.TempDir()
+	track := filepath.Join(dir, "A.wav")
+	const step = 50 * time.Millisecond
+	writeSteps(t, track, step, 0.1, 0.2, 0.3)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+
+	if err := a.SetLoop(step, 2*step); err != ErrNotPlaying {
+		t.Errorf("SetLoop while stopped = %v, want ErrNotPlaying", err)
+	}
+	done, err := a.Start(&util.AudioFile{Path: track}, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetLoop(2*step, step); err != ErrInvalidLoop {
+		t.Errorf("SetLoop ending before it starts = %v, want ErrInvalidLoop", err)
+	}
+	if err := a.SetLoop(step, 2*step); err != nil {
+		t.Fatalf("SetLoop: %v", err)
+	}
+	if s := a.State(); s.LoopStart != step || s.LoopEnd != 2*step {
+		t.Errorf("loop = %v-%v, want %v-%v", s.LoopStart, s.LoopEnd, step, 2*step)
+	}
+	a.Resume()
+	time.Sleep(20 * time.Millisecond) // Round the loop a few times.
+	if err := a.SetLoop(0, 0); err != nil {
+		t.Fatalf("clearing the loop: %v", err)
+	}
+	waitClosed(t, done, "the track")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first step plays once, then the second over and over, each time
+	// whole and without a gap, then the last once the loop is cleared.
+	var runs [][2]int // Level and length of each run of equal samples
+	for _, v := range recordedLevels(t, out) {
+		if len(runs) > 0 && runs[len(runs)-1][0] == int(v) {
+			runs[len(runs)-1][1]++
+		} else {
+			runs = append(runs, [2]int{int(v), 1})
+		}
+	}
+	if len(runs) > 0 && runs[0][0] == 0 {
+		runs = runs[1:] // Silence streamed while paused
+	}
+	if len(runs) > 0 && runs[len(runs)-1][0] == 0 {
+		runs = runs[:len(runs)-1]
+	}
+	n := OutputSampleRate.N(step)
+	if len(runs) != 3 || runs[0][1] != n || runs[1][1]%n != 0 || runs[1][1] < 2*n || runs[2][1] != n {
+		t.Fatalf("recorded runs of (level, samples) %v; want %d samples, a multiple of them at least twice over, then %d", runs, n, n)
+	}
+}
+
+func TestAudioPlayerPlaysPartOfFile(t *testing.T) {
+	dir := t.TempDir()
+	album := filepath.Join(dir, "album.wav")
+	const step = 50 * time.Millisecond
+	writeSteps(t, album, step, 0.1, 0.2, 0.3, 0.4)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+
+	// Tracks split from the album by a CUE sheet, the last one running to
+	// the end of the file.
+	second := &util.AudioFile{Path: album + ".cue#02", Source: album, Start: step, End: 3 * step}
+	last := &util.AudioFile{Path: album + ".cue#03", Source: album, Start: 3 * step}
+
+	done, err := a.Start(second, step/2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := a.State(); s.PlayedTime.Round(time.Millisecond) != step/2 || s.TotalTime != 2*step {
+		t.Errorf("position = %v of %v, want %v of %v", s.PlayedTime, s.TotalTime, step/2, 2*step)
+	}
+	a.Resume()
+	waitClosed(t, done, "the second track")
+	if err := a.PlayFrom(last, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs [][2]int // Level and length of each run of equal samples, besides silence
+	for _, v := range recordedLevels(t, out) {
+		if v == 0 {
+			continue
+		}
+		if len(runs) > 0 && runs[len(runs)-1][0] == int(v) {
+			runs[len(runs)-1][1]++
+		} else {
+			runs = append(runs, [2]int{int(v), 1})
+		}
+	}
+	// The rest of the second step plays, then the third, then the last one,
+	// each one louder than the one before.
+	n := OutputSampleRate.N(step)
+	if len(runs) != 3 || runs[0][1] != n-OutputSampleRate.N(step/2) || runs[1][1] != n || runs[2][1] != n ||
+		runs[0][0] >= runs[1][0] || runs[1][0] >= runs[2][0] {
+		t.Fatalf("recorded runs of (level, samples) %v; want %d, %d and %d samples of rising levels", runs, n-OutputSampleRate.N(step/2), n, n)
+	}
+}
+
+func TestAudioPlayerGapless(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "A.wav"), filepath.Join(dir, "B.wav")
+	// Lengths that don't line up with the output's buffer.
+	writeTone(t, first, OutputSampleRate, 123*time.Millisecond, 0.25)
+	writeTone(t, second, OutputSampleRate, 77*time.Millisecond, 0.5)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+	a.SetVolume(100)
+
+	a.Stop() // Nothing to preload after.
+	if _, err := a.Preload(&util.AudioFile{Path: second}); err != ErrNotPlaying {
+		t.Fatalf("Preload while stopped = %v, want ErrNotPlaying", err)
+	}
+	doneA, err := a.Start(&util.AudioFile{Title: "A", Path: first}, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &util.AudioFile{Title: "B", Path: second}
+	doneB, err := a.Preload(b)
+	if err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	a.Resume()
+	waitClosed(t, doneA, "A")
+	if s := a.State(); s.Track != nil && s.Track != b {
+		t.Errorf("playing %v after A ended, want B", s.Track)
+	}
+	waitClosed(t, doneB, "B")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	levels := recordedLevels(t, out)
+	// Skip the silence streamed while A was paused.
+	start := 0
+	for start < len(levels) && levels[start] == 0 {
+		start++
+	}
+	nA, nB := OutputSampleRate.N(123*time.Millisecond), OutputSampleRate.N(77*time.Millisecond)
+	if len(levels) < start+nA+nB {
+		t.Fatalf("recorded %d samples of audio, want %d", len(levels)-start, nA+nB)
+	}
+	for i, v := range levels[start : start+nA+nB] {
+		if want := i < nA; (v == levels[start]) != want {
+			t.Fatalf("sample %d of the recording is %d; A lasts %d samples and B follows straight after", i, v, nA)
+		}
+	}
+	for _, v := range levels[start+nA+nB:] {
+		if v != 0 {
+			t.Fatalf("audio after B ended: %d", v)
+		}
+	}
+}
+
+func TestAudioPlayerCrossfade(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "A.wav"), filepath.Join(dir, "B.wav")
+	writeTone(t, first, OutputSampleRate, 300*time.Millisecond, 0.25)
+	writeTone(t, second, OutputSampleRate, 200*time.Millisecond, 0.5)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+	// Smart crossfade doesn't apply to tracks without an album.
+	a.SetCrossfade(Crossfade{Duration: 100 * time.Millisecond, Curve: FadeLinear, Smart: true})
+
+	if _, err := a.Start(&util.AudioFile{Title: "A", Path: first}, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	doneB, err := a.Preload(&util.AudioFile{Title: "B", Path: second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Resume()
+	waitClosed(t, doneB, "B")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	levels := recordedLevels(t, out)
+	start := 0
+	for start < len(levels) && levels[start] == 0 {
+		start++
+	}
+	levels = levels[start:]
+	nA, nB := OutputSampleRate.N(300*time.Millisecond), OutputSampleRate.N(200*time.Millisecond)
+	nFade := OutputSampleRate.N(100 * time.Millisecond)
+	if len(levels) < nA+nB-nFade {
+		t.Fatalf("recorded %d samples of audio, want %d", len(levels), nA+nB-nFade)
+	}
+	a0, b0 := toneLevel(0.25)*defaultGain, toneLevel(0.5)*defaultGain
+	for i, v := range levels {
+		var want float64
+		switch {
+		case i < nA-nFade:
+			want = a0
+		case i < nA:
+			x := float64(i-(nA-nFade)) / float64(nFade)
+			want = a0*(1-x) + b0*x
+		case i < nA+nB-nFade:
+			want = b0
+		}
+		if got := float64(v) / math.MaxInt16; math.Abs(got-want) > 0.001 {
+			t.Fatalf("sample %d of the recording is %.4f, want %.4f; A lasts %d samples, fading into B over the last %d",
+				i, got, want, nA, nFade)
+		}
+	}
+}
+
+func TestAudioPlayerNormalization(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "A.wav")
+	writeTone(t, path, OutputSampleRate, 50*time.Millisecond, 0.25)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+	a.SetNormalization(Normalization{Mode: ReplayGainTrack})
+
+	track := &util.AudioFile{Path: path, ReplayGain: util.ReplayGain{TrackGain: 20 * math.Log10(0.5), HasTrack: true}}
+	done, err := a.Start(track, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, done, "the track")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	levels := recordedLevels(t, out)
+	if want := toneLevel(0.25) * defaultGain / 2; math.Abs(float64(levels[0])/math.MaxInt16-want) > 0.001 {
+		t.Errorf("track played at %.4f, want %.4f", float64(levels[0])/math.MaxInt16, want)
+	}
+}
+
+func TestAudioPlayerSkipFadesOut(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "A.wav"), filepath.Join(dir, "B.wav")
+	writeTone(t, first, OutputSampleRate, 10*time.Second, 0.25)
+	writeTone(t, second, OutputSampleRate, 300*time.Millisecond, 0.5)
+	out := filepath.Join(dir, "out.wav")
+	output, err := NewWAVOutput(out, OutputSampleRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+
+	doneA, err := a.Start(&util.AudioFile{Title: "A", Path: first}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	doneB, err := a.Start(&util.AudioFile{Title: "B", Path: second}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, doneA, "A")
+	waitClosed(t, doneB, "B")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A carries on under B, fading out, instead of stopping dead.
+	a0, b0 := toneLevel(0.25)*defaultGain, toneLevel(0.5)*defaultGain
+	levels := recordedLevels(t, out)
+	i := 0
+	for i < len(levels) && float64(levels[i])/math.MaxInt16 < b0 {
+		i++
+	}
+	if i == 0 || i == len(levels) {
+		t.Fatal("B never played after A")
+	}
+	if got := float64(levels[i-1]) / math.MaxInt16; math.Abs(got-a0) > 0.001 {
+		t.Errorf("sample before B is %.4f, want A at %.4f", got, a0)
+	}
+	fade := 0
+	for ; i < len(levels) && float64(levels[i])/math.MaxInt16 > b0+0.001; i++ {
+		if got := float64(levels[i]) / math.MaxInt16; got > a0+b0+0.001 {
+			t.Fatalf("sample %d is %.4f, louder than A and B together", i, got)
+		}
+		fade++
+	}
+	if min, max := OutputSampleRate.N(skipFade*2/3), OutputSampleRate.N(skipFade); fade < min || fade > max {
+		t.Errorf("A faded out over %d samples, want %d-%d", fade, min, max)
+	}
+}
+
+func TestAudioPlayerPlaysOneTrackAtATime(t *testing.T) {
+	tracks := toneTracks(t, 4, 300*time.Millisecond)
+	path := filepath.Join(t.TempDir(), "out.wav")
+	output, err := NewWAVOutput(path, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAudioPlayer(output)
+
+	// Tracks started at the same time replace each other rather than mix.
+	// They are started paused, as a playing track would fade out under the
+	// next.
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Start(tracks[i%len(tracks)], 0, true); err != nil {
+				t.Errorf("Start: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	a.Resume()
+	time.Sleep(50 * time.Millisecond)
+	a.Stop()
+	if err := output.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every track is the same tone at the same volume, so any sample louder
+	// than the tone means two tracks played at once.
+	limit := toneLevel(0.25)*defaultGain + 0.001
+	for i := wavHeaderSize; i+1 < len(data); i += 2 {
+		if v := float64(int16(binary.LittleEndian.Uint16(data[i:]))) / math.MaxInt16; math.Abs(v) > limit {
+			t.Fatalf("sample %v at byte %d is louder than one track (%v)", v, i, limit)
+		}
+	}
+}
+
+func TestAudioPlayerConcurrentControl(t *testing.T) {
+	tracks := toneTracks(t, 3, 200*time.Millisecond)
+	output := NewNullOutput(OutputSampleRate, 0)
+	defer output.Close()
+	a := NewAudioPlayer(output)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		dones []<-chan struct{}
+	)
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				f(i)
+			}
+		}()
+	}
+	run(func(i int) {
+		done, err := a.Start(tracks[i%len(tracks)], 0, i%5 == 0)
+		if err != nil {
+			t.Errorf("Start: %v", err)
+			return
+		}
+		mu.Lock()
+		dones = append(dones, done)
+		mu.Unlock()
+	})
+	run(func(i int) {
+		if i%3 == 0 {
+			a.Stop()
+		}
+	})
+	run(func(i int) { _ = a.SeekTo(time.Duration(i) * time.Millisecond) })
+	run(func(i int) {
+		start := time.Duration(i%4) * 40 * time.Millisecond // A zero start clears the loop
+		_ = a.SetLoop(start, start/2*3)
+	})
+	run(func(i int) { a.SetVolume(float64(i % 101)) })
+	run(func(i int) { a.SetSpeed(MinSpeed + float64(i%6)/2) })
+	run(func(i int) {
+		preset := builtinEQPresets[i%len(builtinEQPresets)]
+		a.Equalizer().Set(preset.Settings(i%4 != 0))
+	})
+	run(func(i int) {
+		if i%2 == 0 {
+			a.Pause()
+		} else {
+			a.Resume()
+		}
+	})
+	run(func(int) {
+		s := a.State()
+		if s.SamplesPlayed > s.TotalSamples {
+			t.Errorf("played %d of %d samples", s.SamplesPlayed, s.TotalSamples)
+		}
+		_ = a.GetProgress()
+	})
+	wg.Wait()
+
+	// Every track must have been released once the player is stopped.
+	a.Stop()
+	for i, done := range dones {
+		waitClosed(t, done, fmt.Sprintf("track %d", i))
+	}
+}
+
+func TestEngineConcurrentControl(t *testing.T) {
+	tracks := toneTracks(t, 3, 100*time.Millisecond)
+	output := NewNullOutput(OutputSampleRate, 0)
+	defer output.Close()
+	e := NewEngine(NewAudioPlayer(output))
+	e.SetRepeat(RepeatAll)
+	e.Enqueue(tracks...)
+
+	// Drain the events as a front-end would.
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-e.Events():
+			case <-quit:
+				return
+			}
+		}
+	}()
+	defer close(quit)
+
+	controls := []func(i int){
+		func(int) { _ = e.Next() },
+		func(int) { _ = e.Previous() },
+		func(int) { _ = e.TogglePause() },
+		func(i int) { _ = e.Seek(time.Duration(i) * time.Millisecond) },
+		func(i int) { _ = e.SetVolume(float64(i % 101)) },
+		func(i int) { _ = e.PlayIndex(i % len(tracks)) },
+		func(int) { _, _ = e.GetPlaybackInfo() },
+		func(i int) {
+			if i%10 == 0 {
+				_ = e.Stop()
+			} else {
+				_ = e.Play()
+			}
+		},
+	}
+	var wg sync.WaitGroup
+	for _, control := range controls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				control(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_ = e.Stop()
+	if info, _ := e.GetPlaybackInfo(); info.State != StateStopped || info.CurrentTrack != nil {
+		t.Errorf("state %v playing %v after Stop", info.State, info.CurrentTrack)
+	}
+}
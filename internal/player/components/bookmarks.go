@@ -0,0 +1,312 @@
+package components
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"muxic/internal/util"
+)
+
+// bookmarksVersion must be bumped whenever the layout of the bookmarks file
+// changes incompatibly.
+const bookmarksVersion = 1
+
+// bookmarksFileName is the name of the bookmarks file in the data directory.
+const bookmarksFileName = "bookmarks.json"
+
+const (
+	// DefaultResumeThreshold is how long a track must be to resume where it
+	// was left, unless the config says otherwise.
+	DefaultResumeThreshold = 20 * time.Minute
+	// maxResumeThreshold bounds the configured threshold.
+	maxResumeThreshold = 24 * time.Hour
+	// resumeMargin is how close to either end of a track a position is
+	// forgotten rather than resumed, so a track left as it began or ended
+	// plays from the start.
+	resumeMargin = 10 * time.Second
+	// bookmarkGrace is how far past a bookmark playback may be for jumping
+	// back to skip it, as it was probably just jumped to.
+	bookmarkGrace = 3 * time.Second
+)
+
+// ErrBookmarkNotFound is returned for a bookmark index out of range.
+var ErrBookmarkNotFound = errors.New("bookmark not found")
+
+// Bookmark is a named position in a track.
+type Bookmark struct {
+	Name     string        `json:"name"`
+	Position time.Duration `json:"position"`
+}
+
+// TrackBookmarks are the bookmarks of one track, by its path.
+type TrackBookmarks struct {
+	Path      string
+	Bookmarks []Bookmark // Sorted by position
+}
+
+// trackMarks is what is kept for one track.
+type trackMarks struct {
+	Resume    time.Duration `json:"resume,omitempty"`    // Where the track was left; 0 plays it from the start
+	Bookmarks []Bookmark    `json:"bookmarks,omitempty"` // Sorted by position
+}
+
+// bookmarksFile is the on-disk layout of the bookmarks file. Tracks are
+// stored by path only, as in the playlists file.
+type bookmarksFile struct {
+	Version int                    `json:"version"`
+	Tracks  map[string]*trackMarks `json:"tracks"`
+}
+
+// Bookmarks holds the named bookmarks of tracks and where long tracks were
+// left, by track path, and saves them to a JSON file. It is safe for
+// concurrent use, and a nil *Bookmarks keeps nothing.
+type Bookmarks struct {
+	mu        sync.Mutex
+	path      string        // File the bookmarks are saved to; empty keeps them in memory
+	threshold time.Duration // Tracks at least this long resume where they were left; 0 turns it off
+	tracks    map[string]*trackMarks
+}
+
+// DefaultBookmarksPath returns the location of the bookmarks file in muxic's
+// data directory.
+func DefaultBookmarksPath() (string, error) {
+	dir, err := util.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, bookmarksFileName), nil
+}
+
+// NewBookmarks returns empty bookmarks saved to path, or kept in memory only
+// if path is empty.
+func NewBookmarks(path string) *Bookmarks {
+	return &Bookmarks{path: path, threshold: DefaultResumeThreshold, tracks: make(map[string]*trackMarks)}
+}
+
+// LoadBookmarks reads the bookmarks saved at path. A missing file yields
+// empty bookmarks.
+func LoadBookmarks(path string) (*Bookmarks, error) {
+	b := NewBookmarks(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f bookmarksFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("reading bookmarks from %s: %w", path, err)
+	}
+	if f.Version != bookmarksVersion {
+		return nil, fmt.Errorf("reading bookmarks from %s: unsupported version %d", path, f.Version)
+	}
+	for p, t := range f.Tracks {
+		if t == nil {
+			continue
+		}
+		sortBookmarks(t.Bookmarks)
+		b.tracks[p] = t
+	}
+	return b, nil
+}
+
+// Save atomically replaces the bookmarks file. Bookmarks kept in memory only
+// aren't saved. Saves are serialised, so the file always ends up with the
+// latest bookmarks.
+func (b *Bookmarks) Save() error {
+	if b == nil || b.path == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := json.MarshalIndent(bookmarksFile{Version: bookmarksVersion, Tracks: b.tracks}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(b.path, data, 0o644); err != nil {
+		return fmt.Errorf("saving bookmarks: %w", err)
+	}
+	return nil
+}
+
+// SetResumeThreshold sets how long a track must be to resume where it was
+// left. 0 turns resuming off.
+func (b *Bookmarks) SetResumeThreshold(d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold = max(0, d)
+}
+
+// ResumePosition returns where track was left, or 0 to play it from the
+// start.
+func (b *Bookmarks) ResumePosition(track *util.AudioFile) time.Duration {
+	if b == nil || track == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t := b.tracks[track.Path]; t != nil && b.threshold > 0 {
+		return t.Resume
+	}
+	return 0
+}
+
+// RememberPosition records that track was left at pos, for it to resume there
+// when it plays again. total is the length of the track, or 0 if the track's
+// own duration is to be used. Tracks shorter than the threshold, and
+// positions near either end, are forgotten instead.
+func (b *Bookmarks) RememberPosition(track *util.AudioFile, pos, total time.Duration) {
+	if b == nil || track == nil {
+		return
+	}
+	if total <= 0 {
+		total = track.Duration
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || total < b.threshold || pos < resumeMargin || pos > total-resumeMargin {
+		b.setResume(track.Path, 0)
+		return
+	}
+	b.setResume(track.Path, pos)
+}
+
+// ForgetPosition forgets where track was left, as it played to the end.
+func (b *Bookmarks) ForgetPosition(track *util.AudioFile) {
+	if b == nil || track == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setResume(track.Path, 0)
+}
+
+// setResume sets the resume position of the track at path, dropping the
+// track if nothing is left to keep for it. It must be called with b.mu held.
+func (b *Bookmarks) setResume(path string, pos time.Duration) {
+	t := b.tracks[path]
+	if t == nil {
+		if pos == 0 {
+			return
+		}
+		t = &trackMarks{}
+		b.tracks[path] = t
+	}
+	t.Resume = pos
+	b.drop(path)
+}
+
+// drop removes the track at path if it has neither a resume position nor
+// bookmarks. It must be called with b.mu held.
+func (b *Bookmarks) drop(path string) {
+	if t := b.tracks[path]; t != nil && t.Resume == 0 && len(t.Bookmarks) == 0 {
+		delete(b.tracks, path)
+	}
+}
+
+// Add bookmarks track at pos, and returns the index of the new bookmark
+// among the track's.
+func (b *Bookmarks) Add(track *util.AudioFile, name string, pos time.Duration) int {
+	if b == nil || track == nil {
+		return -1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.tracks[track.Path]
+	if t == nil {
+		t = &trackMarks{}
+		b.tracks[track.Path] = t
+	}
+	// Insert after any bookmark at the same position, keeping the order stable.
+	pos = max(0, pos)
+	i := sort.Search(len(t.Bookmarks), func(i int) bool { return t.Bookmarks[i].Position > pos })
+	t.Bookmarks = append(t.Bookmarks, Bookmark{})
+	copy(t.Bookmarks[i+1:], t.Bookmarks[i:])
+	t.Bookmarks[i] = Bookmark{Name: name, Position: pos}
+	return i
+}
+
+// Remove removes the bookmark at index among those of the track at path.
+func (b *Bookmarks) Remove(path string, index int) error {
+	if b == nil {
+		return ErrBookmarkNotFound
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.tracks[path]
+	if t == nil || index < 0 || index >= len(t.Bookmarks) {
+		return ErrBookmarkNotFound
+	}
+	t.Bookmarks = append(t.Bookmarks[:index], t.Bookmarks[index+1:]...)
+	b.drop(path)
+	return nil
+}
+
+// For returns a copy of the bookmarks of track, sorted by position.
+func (b *Bookmarks) For(track *util.AudioFile) []Bookmark {
+	if b == nil || track == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t := b.tracks[track.Path]; t != nil {
+		return append([]Bookmark(nil), t.Bookmarks...)
+	}
+	return nil
+}
+
+// All returns a copy of the bookmarks of every track that has any, sorted by
+// path.
+func (b *Bookmarks) All() []TrackBookmarks {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var all []TrackBookmarks
+	for path, t := range b.tracks {
+		if len(t.Bookmarks) > 0 {
+			all = append(all, TrackBookmarks{Path: path, Bookmarks: append([]Bookmark(nil), t.Bookmarks...)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Path < all[j].Path })
+	return all
+}
+
+func sortBookmarks(marks []Bookmark) {
+	sort.SliceStable(marks, func(i, j int) bool { return marks[i].Position < marks[j].Position })
+}
+
+// NextBookmark returns the first of marks, sorted by position, after pos.
+func NextBookmark(marks []Bookmark, pos time.Duration) (Bookmark, bool) {
+	for _, m := range marks {
+		if m.Position > pos {
+			return m, true
+		}
+	}
+	return Bookmark{}, false
+}
+
+// PreviousBookmark returns the last of marks, sorted by position, before pos.
+// A bookmark playback has only just passed is skipped, so repeated jumps go
+// further back rather than to the same bookmark.
+func PreviousBookmark(marks []Bookmark, pos time.Duration) (Bookmark, bool) {
+	for i := len(marks) - 1; i >= 0; i-- {
+		if marks[i].Position < pos-bookmarkGrace {
+			return marks[i], true
+		}
+	}
+	return Bookmark{}, false
+}
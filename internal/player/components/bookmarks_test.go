@@ -0,0 +1,145 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+func TestBookmarksRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "bookmarks.json")
+	book := &util.AudioFile{Path: "/books/a.m4b", Duration: 10 * time.Hour}
+	song := &util.AudioFile{Path: "/music/b.mp3", Duration: 3 * time.Minute}
+
+	b := NewBookmarks(path)
+	b.Add(book, "Chapter 2", 40*time.Minute)
+	b.Add(book, "Chapter 1", 5*time.Minute)
+	if i := b.Add(book, "Chapter 1 again", 5*time.Minute); i != 1 {
+		t.Errorf("bookmark at the same position added at %d, want after the first, at 1", i)
+	}
+	b.Add(song, "Solo", 2*time.Minute)
+	b.RememberPosition(book, 3*time.Hour, 0)
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := LoadBookmarks(path)
+	if err != nil {
+		t.Fatalf("LoadBookmarks: %v", err)
+	}
+	want := []TrackBookmarks{
+		{Path: book.Path, Bookmarks: []Bookmark{
+			{"Chapter 1", 5 * time.Minute}, {"Chapter 1 again", 5 * time.Minute}, {"Chapter 2", 40 * time.Minute},
+		}},
+		{Path: song.Path, Bookmarks: []Bookmark{{"Solo", 2 * time.Minute}}},
+	}
+	if got := loaded.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+	if pos := loaded.ResumePosition(book); pos != 3*time.Hour {
+		t.Errorf("resumes at %v, want 3h", pos)
+	}
+
+	if err := loaded.Remove(song.Path, 0); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := loaded.Remove(song.Path, 0); err != ErrBookmarkNotFound {
+		t.Errorf("removing a bookmark twice = %v, want ErrBookmarkNotFound", err)
+	}
+	if got := loaded.All(); len(got) != 1 || got[0].Path != book.Path {
+		t.Errorf("tracks with bookmarks = %+v, want just the book", got)
+	}
+}
+
+func TestLoadBookmarks(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := LoadBookmarks(filepath.Join(dir, "none.json"))
+	if err != nil || b == nil || len(b.All()) != 0 {
+		t.Errorf("missing file = %v, %v; want empty bookmarks", b, err)
+	}
+
+	for name, contents := range map[string]string{
+		"corrupt.json": "{",
+		"newer.json":   `{"version": 99, "tracks": {}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadBookmarks(path); err == nil {
+			t.Errorf("%s loaded without error", name)
+		}
+	}
+}
+
+func TestResumePositions(t *testing.T) {
+	long := &util.AudioFile{Path: "/books/long.mp3", Duration: time.Hour}
+	short := &util.AudioFile{Path: "/music/short.mp3", Duration: 4 * time.Minute}
+	b := NewBookmarks("")
+	b.SetResumeThreshold(30 * time.Minute)
+
+	tests := []struct {
+		name       string
+		track      *util.AudioFile
+		pos, total time.Duration
+		want       time.Duration
+	}{
+		{"long track", long, 25 * time.Minute, 0, 25 * time.Minute},
+		{"length from the backend", short, 2 * time.Minute, 2 * time.Hour, 2 * time.Minute},
+		{"short track", short, 2 * time.Minute, 0, 0},
+		{"left near the start", long, 5 * time.Second, 0, 0},
+		{"left near the end", long, time.Hour - 5*time.Second, 0, 0},
+	}
+	for _, tt := range tests {
+		b.RememberPosition(tt.track, tt.pos, tt.total)
+		if got := b.ResumePosition(tt.track); got != tt.want {
+			t.Errorf("%s: resumes at %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	b.RememberPosition(long, 10*time.Minute, 0)
+	b.SetResumeThreshold(0)
+	if got := b.ResumePosition(long); got != 0 {
+		t.Errorf("resumes at %v with resuming off, want the start", got)
+	}
+	b.SetResumeThreshold(30 * time.Minute)
+	b.ForgetPosition(long)
+	if got := b.ResumePosition(long); got != 0 {
+		t.Errorf("resumes at %v after playing to the end, want the start", got)
+	}
+}
+
+func TestJumpBetweenBookmarks(t *testing.T) {
+	marks := []Bookmark{{"A", time.Minute}, {"B", 2 * time.Minute}, {"C", 3 * time.Minute}}
+	next := func(pos time.Duration) string {
+		m, _ := NextBookmark(marks, pos)
+		return m.Name
+	}
+	prev := func(pos time.Duration) string {
+		m, _ := PreviousBookmark(marks, pos)
+		return m.Name
+	}
+	if got := next(0); got != "A" {
+		t.Errorf("next from the start = %q, want A", got)
+	}
+	if got := next(2 * time.Minute); got != "C" {
+		t.Errorf("next from B = %q, want C", got)
+	}
+	if got := next(3 * time.Minute); got != "" {
+		t.Errorf("next from C = %q, want none", got)
+	}
+	if got := prev(2*time.Minute + time.Second); got != "A" {
+		t.Errorf("previous just after B = %q, want A", got)
+	}
+	if got := prev(2*time.Minute + 10*time.Second); got != "B" {
+		t.Errorf("previous well after B = %q, want B", got)
+	}
+	if got := prev(time.Minute); got != "" {
+		t.Errorf("previous from A = %q, want none", got)
+	}
+}
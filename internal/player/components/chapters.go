@@ -0,0 +1,36 @@
+package components
+
+import (
+	"time"
+
+	"muxic/internal/util"
+)
+
+// chapterGrace is how far into a chapter playback may be for jumping back to
+// go to the previous chapter rather than to the start of this one, as with
+// tracks.
+const chapterGrace = 3 * time.Second
+
+// NextChapter returns the index of the first of chapters, sorted by start,
+// that starts after pos.
+func NextChapter(chapters []util.Chapter, pos time.Duration) (int, bool) {
+	i, _ := util.ChapterAt(chapters, pos)
+	if i+1 < len(chapters) {
+		return i + 1, true
+	}
+	return -1, false
+}
+
+// PreviousChapter returns the index of the chapter to jump back to from pos:
+// the one playing, unless playback has only just passed its start, in which
+// case the one before.
+func PreviousChapter(chapters []util.Chapter, pos time.Duration) (int, bool) {
+	i, ok := util.ChapterAt(chapters, pos)
+	if !ok {
+		return -1, false
+	}
+	if pos-chapters[i].Start < chapterGrace && i > 0 {
+		return i - 1, true
+	}
+	return i, true
+}
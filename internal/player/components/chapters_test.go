@@ -0,0 +1,48 @@
+package components
+
+import (
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+func TestJumpBetweenChapters(t *testing.T) {
+	chapters := []util.Chapter{
+		{Title: "One", Start: time.Second},
+		{Title: "Two", Start: time.Minute},
+		{Title: "Three", Start: 2 * time.Minute},
+	}
+	title := func(i int, ok bool) string {
+		if !ok {
+			return ""
+		}
+		return chapters[i].Title
+	}
+	tests := []struct {
+		name       string
+		pos        time.Duration
+		next, prev string
+	}{
+		{"before the first chapter", 0, "One", ""},
+		{"in the first chapter", 30 * time.Second, "Two", "One"},
+		{"just into the second", time.Minute + time.Second, "Three", "One"},
+		{"well into the second", time.Minute + 10*time.Second, "Three", "Two"},
+		{"in the last chapter", 3 * time.Minute, "", "Three"},
+	}
+	for _, tt := range tests {
+		if got := title(NextChapter(chapters, tt.pos)); got != tt.next {
+			t.Errorf("%s: next chapter = %q, want %q", tt.name, got, tt.next)
+		}
+		if got := title(PreviousChapter(chapters, tt.pos)); got != tt.prev {
+			t.Errorf("%s: previous chapter = %q, want %q", tt.name, got, tt.prev)
+		}
+	}
+
+	if end := util.ChapterEnd(chapters, 1, 5*time.Minute); end != 2*time.Minute {
+		t.Errorf("second chapter ends at %v, want where the third starts", end)
+	}
+	if end := util.ChapterEnd(chapters, 2, 5*time.Minute); end != 5*time.Minute {
+		t.Errorf("last chapter ends at %v, want the end of the track", end)
+	}
+}
@@ -0,0 +1,248 @@
+package components
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"muxic/internal/util"
+)
+
+// TrackColumn identifies a piece of track metadata that can be shown as a table column.
+type TrackColumn int
+
+const (
+	ColumnIndex TrackColumn = iota // Position of the track in the list
+	ColumnTitle
+	ColumnArtist
+	ColumnAlbum
+	ColumnAlbumArtist
+	ColumnComposer
+	ColumnGenre
+	ColumnYear
+	ColumnTrack
+	ColumnDisc
+	ColumnDuration
+	ColumnBitrate
+	ColumnSampleRate
+	ColumnSize
+)
+
+// trackColumnInfo holds the presentation details of a column.
+type trackColumnInfo struct {
+	name   string // Identifier used on the command line and in config files
+	header string
+	width  int // Fixed width, used when weight is 0
+	weight int // Share of the remaining width for flexible columns
+}
+
+var trackColumns = map[TrackColumn]trackColumnInfo{
+	ColumnIndex:       {name: "index", header: "#", width: 5},
+	ColumnTitle:       {name: "title", header: "Title", weight: 40},
+	ColumnArtist:      {name: "artist", header: "Artist", weight: 40},
+	ColumnAlbum:       {name: "album", header: "Album", weight: 20},
+	ColumnAlbumArtist: {name: "albumartist", header: "Album Artist", weight: 20},
+	ColumnComposer:    {name: "composer", header: "Composer", weight: 20},
+	ColumnGenre:       {name: "genre", header: "Genre", weight: 15},
+	ColumnYear:        {name: "year", header: "Year", width: 6},
+	ColumnTrack:       {name: "track", header: "Track", width: 7},
+	ColumnDisc:        {name: "disc", header: "Disc", width: 6},
+	ColumnDuration:    {name: "duration", header: "Duration", width: 10},
+	ColumnBitrate:     {name: "bitrate", header: "Bitrate", width: 10},
+	ColumnSampleRate:  {name: "samplerate", header: "Rate", width: 10},
+	ColumnSize:        {name: "size", header: "Size", width: 10},
+}
+
+// String returns the column's identifier, e.g. "albumartist".
+func (c TrackColumn) String() string {
+	return trackColumns[c].name
+}
+
+// Header returns the column's table header.
+func (c TrackColumn) Header() string {
+	return trackColumns[c].header
+}
+
+// Width returns the column's fixed width, or 0 for flexible columns.
+func (c TrackColumn) Width() int {
+	return trackColumns[c].width
+}
+
+// Weight returns the column's share of the remaining width, or 0 for fixed columns.
+func (c TrackColumn) Weight() int {
+	return trackColumns[c].weight
+}
+
+// Value returns the cell text for the track at position index in its list.
+func (c TrackColumn) Value(index int, t *util.AudioFile) string {
+	switch c {
+	case ColumnIndex:
+		return strconv.Itoa(index + 1)
+	case ColumnTitle:
+		if t.Missing {
+			return "[missing] " + t.Title
+		}
+		return t.Title
+	case ColumnArtist:
+		return t.Artist
+	case ColumnAlbum:
+		return t.Album
+	case ColumnAlbumArtist:
+		return t.AlbumArtist
+	case ColumnComposer:
+		return t.Composer
+	case ColumnGenre:
+		return t.Genre
+	case ColumnYear:
+		return optionalInt(t.Year)
+	case ColumnTrack:
+		return formatPosition(t.TrackNumber, t.TrackTotal)
+	case ColumnDisc:
+		return formatPosition(t.DiscNumber, t.DiscTotal)
+	case ColumnDuration:
+		return t.DurationString()
+	case ColumnBitrate:
+		if t.Bitrate <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d kbps", t.Bitrate)
+	case ColumnSampleRate:
+		if t.SampleRate <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.1f kHz", float64(t.SampleRate)/1000)
+	case ColumnSize:
+		return fmt.Sprintf("%.1f MB", float64(t.Size)/(1<<20))
+	default:
+		return ""
+	}
+}
+
+// optionalInt formats n, leaving unknown (zero) values blank.
+func optionalInt(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// formatPosition formats a track or disc position as "n" or "n/total".
+func formatPosition(n, total int) string {
+	if n <= 0 {
+		return ""
+	}
+	if total <= 0 {
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%d/%d", n, total)
+}
+
+// ParseTrackColumns parses a comma-separated list of column identifiers such
+// as "title,artist,year,duration".
+func ParseTrackColumns(list string) ([]TrackColumn, error) {
+	byName := make(map[string]TrackColumn, len(trackColumns))
+	for c, info := range trackColumns {
+		byName[info.name] = c
+	}
+
+	var columns []TrackColumn
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		c, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(TrackColumnNames(), ", "))
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	return columns, nil
+}
+
+// TrackColumnNames returns the identifiers of every available column.
+func TrackColumnNames() []string {
+	names := make([]string, 0, len(trackColumns))
+	for c := ColumnIndex; c <= ColumnSize; c++ {
+		names = append(names, c.String())
+	}
+	return names
+}
+
+// TableColumns holds the columns shown by each track table.
+type TableColumns struct {
+	Library  []TrackColumn
+	Playlist []TrackColumn
+	Queue    []TrackColumn
+	Search   []TrackColumn
+}
+
+// DefaultTableColumns returns the default columns for every track table.
+func DefaultTableColumns() TableColumns {
+	base := []TrackColumn{ColumnTitle, ColumnArtist, ColumnAlbum, ColumnDuration}
+	indexed := append([]TrackColumn{ColumnIndex}, base...)
+	return TableColumns{
+		Library:  base,
+		Playlist: indexed,
+		Queue:    indexed,
+		Search:   indexed,
+	}
+}
+
+// TableColumnsFor uses the same columns for every table, adding an index
+// column to the numbered ones (playlist, queue and search).
+func TableColumnsFor(columns []TrackColumn) TableColumns {
+	indexed := columns
+	if len(columns) > 0 && columns[0] != ColumnIndex {
+		indexed = append([]TrackColumn{ColumnIndex}, columns...)
+	}
+	return TableColumns{
+		Library:  columns,
+		Playlist: indexed,
+		Queue:    indexed,
+		Search:   indexed,
+	}
+}
+
+// TrackRows converts tracks to table rows with the given columns.
+func TrackRows(tracks []*util.AudioFile, columns []TrackColumn) []table.Row {
+	rows := make([]table.Row, len(tracks))
+	for i, t := range tracks {
+		row := make(table.Row, len(columns))
+		for j, c := range columns {
+			row[j] = c.Value(i, t)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// albumLess orders tracks the way they appear on their album: by album artist,
+// album, disc and track number, falling back to the file name.
+func albumLess(a, b *util.AudioFile) bool {
+	if a.AlbumArtist != b.AlbumArtist {
+		return a.AlbumArtist < b.AlbumArtist
+	}
+	if a.Album != b.Album {
+		return a.Album < b.Album
+	}
+	if a.DiscNumber != b.DiscNumber {
+		return a.DiscNumber < b.DiscNumber
+	}
+	if a.TrackNumber != b.TrackNumber {
+		return a.TrackNumber < b.TrackNumber
+	}
+	return a.FileName < b.FileName
+}
+
+// SortByAlbum sorts tracks in album order (album artist, album, disc, track).
+func SortByAlbum(tracks []*util.AudioFile) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return albumLess(tracks[i], tracks[j])
+	})
+}
@@ -0,0 +1,855 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"muxic/internal/util"
+)
+
+// Config file names in the config directory. The TOML file is preferred when
+// both exist.
+const (
+	configFileName     = "config.toml"
+	configJSONFileName = "config.json"
+)
+
+// configFile is the layout of the config file. Both formats use the same
+// names; a key that is left out keeps its default.
+type configFile struct {
+	Library   libraryConfig   `toml:"library" json:"library"`
+	Playback  playbackConfig  `toml:"playback" json:"playback"`
+	UI        uiConfig        `toml:"ui" json:"ui"`
+	Equalizer equalizerConfig `toml:"equalizer" json:"equalizer"`
+	Theme     Theme           `toml:"theme" json:"theme"`
+	Keys      KeyMap          `toml:"-" json:"-"` // Parsed separately by parseKeys
+}
+
+type libraryConfig struct {
+	Roots          []string `toml:"roots" json:"roots"`
+	Exclude        []string `toml:"exclude" json:"exclude"`
+	FollowSymlinks bool     `toml:"follow_symlinks" json:"follow_symlinks"`
+	PlaylistsFile  string   `toml:"playlists_file" json:"playlists_file"`
+}
+
+type playbackConfig struct {
+	Volume          float64 `toml:"volume" json:"volume"`
+	Repeat          string  `toml:"repeat" json:"repeat"`
+	Shuffle         bool    `toml:"shuffle" json:"shuffle"`
+	AutoPlay        bool    `toml:"auto_play" json:"auto_play"`
+	Crossfade       float64 `toml:"crossfade" json:"crossfade"` // Seconds
+	CrossfadeCurve  string  `toml:"crossfade_curve" json:"crossfade_curve"`
+	SmartCrossfade  bool    `toml:"smart_crossfade" json:"smart_crossfade"`
+	ReplayGain      string  `toml:"replaygain" json:"replaygain"`
+	PreAmp          float64 `toml:"replaygain_preamp" json:"replaygain_preamp"` // dB
+	PreventClipping bool    `toml:"prevent_clipping" json:"prevent_clipping"`
+	Speed           float64 `toml:"speed" json:"speed"`
+	PreservePitch   bool    `toml:"preserve_pitch" json:"preserve_pitch"`
+	RememberSpeed   string  `toml:"remember_speed" json:"remember_speed"`
+	SkipStep        float64 `toml:"skip_step" json:"skip_step"`               // Seconds
+	LongSkipStep    float64 `toml:"long_skip_step" json:"long_skip_step"`     // Seconds
+	ResumeThreshold float64 `toml:"resume_threshold" json:"resume_threshold"` // Minutes
+}
+
+type uiConfig struct {
+	DefaultView string   `toml:"default_view" json:"default_view"`
+	Columns     []string `toml:"columns" json:"columns"`
+}
+
+// equalizerConfig selects the equalizer's gains: those of a preset, or the
+// bands and pre-amp given, which override the preset's.
+type equalizerConfig struct {
+	Enabled bool                 `toml:"enabled" json:"enabled"`
+	Preset  string               `toml:"preset" json:"preset"`
+	PreAmp  *float64             `toml:"preamp" json:"preamp"` // dB
+	Bands   []float64            `toml:"bands" json:"bands"`   // dB, one per band
+	Presets map[string][]float64 `toml:"presets" json:"presets"`
+}
+
+// viewNames maps the names accepted by ui.default_view to views.
+var viewNames = map[string]ViewMode{
+	"library":   ViewLibrary,
+	"search":    ViewSearch,
+	"playlist":  ViewPlaylistTracks,
+	"queue":     ViewQueue,
+	"equalizer": ViewEqualizer,
+	"bookmarks": ViewBookmarks,
+	"chapters":  ViewChapters,
+}
+
+// borderStyles lists the border styles accepted by theme.border_style. It
+// must match the borders known to the ui package.
+var borderStyles = []string{"normal", "rounded", "thick", "double", "hidden"}
+
+// defaultConfigFile returns the settings used for keys missing from the config file.
+func defaultConfigFile() configFile {
+	return configFile{
+		Library: libraryConfig{Roots: []string{"~/Music"}},
+		Playback: playbackConfig{
+			Volume:          50,
+			Repeat:          RepeatOff.String(),
+			AutoPlay:        true,
+			CrossfadeCurve:  FadeLinear.String(),
+			SmartCrossfade:  true,
+			ReplayGain:      ReplayGainOff.String(),
+			PreventClipping: true,
+			Speed:           1,
+			PreservePitch:   true,
+			RememberSpeed:   RememberSpeedOff.String(),
+			SkipStep:        DefaultSkipStep.Seconds(),
+			LongSkipStep:    DefaultLongSkipStep.Seconds(),
+			ResumeThreshold: DefaultResumeThreshold.Minutes(),
+		},
+		UI:        uiConfig{DefaultView: "library"},
+		Equalizer: equalizerConfig{Preset: "flat"},
+		Theme:     DefaultTheme(),
+	}
+}
+
+// DefaultConfig returns the configuration used when there is no config file.
+func DefaultConfig() Config {
+	cfg, errs := defaultConfigFile().config()
+	if len(errs) > 0 {
+		panic(fmt.Sprintf("invalid default config: %v", errs))
+	}
+	return cfg
+}
+
+// DefaultConfigPath returns the location of the config file in muxic's config
+// directory: config.toml, or config.json if only that exists.
+func DefaultConfigPath() (string, error) {
+	dir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, configFileName)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		jsonPath := filepath.Join(dir, configJSONFileName)
+		if _, err := os.Stat(jsonPath); err == nil {
+			return jsonPath, nil
+		}
+	}
+	return path, nil
+}
+
+// ConfigError is a problem found in the config file.
+type ConfigError struct {
+	Line int // 1-based line of the offending key; 0 if unknown
+	Msg  string
+}
+
+// ConfigErrors lists every problem found in a config file.
+type ConfigErrors struct {
+	Path   string
+	Errors []ConfigError
+}
+
+// Error formats the problems one per line as "path:line: message".
+func (e *ConfigErrors) Error() string {
+	var b strings.Builder
+	for i, ce := range e.Errors {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if ce.Line > 0 {
+			fmt.Fprintf(&b, "%s:%d: %s", e.Path, ce.Line, ce.Msg)
+		} else {
+			fmt.Fprintf(&b, "%s: %s", e.Path, ce.Msg)
+		}
+	}
+	return b.String()
+}
+
+// LoadConfig reads and validates the config file at path. A missing file
+// yields DefaultConfig. Files ending in .json are read as JSON, anything else
+// as TOML. Problems with the file's contents, such as unknown keys, invalid
+// values or keys bound to two actions, are all reported together as a
+// *ConfigErrors with the line of each problem.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, errs := parseConfig(data, strings.EqualFold(filepath.Ext(path), ".json"))
+	if len(errs) > 0 {
+		return Config{}, &ConfigErrors{Path: path, Errors: errs}
+	}
+	cfg.ConfigPath = path
+	return cfg, nil
+}
+
+// parseConfig decodes and validates a config file.
+func parseConfig(data []byte, isJSON bool) (Config, []ConfigError) {
+	src := configSource{data: data, json: isJSON}
+
+	// Decode into a generic map first, to report syntax errors and unknown keys.
+	var raw map[string]any
+	if err := src.unmarshal(&raw); err != nil {
+		return Config{}, []ConfigError{src.decodeError(err)}
+	}
+	errs := src.unknownKeys(raw)
+
+	file := defaultConfigFile()
+	if err := src.unmarshal(&file); err != nil {
+		return Config{}, append(errs, src.decodeError(err))
+	}
+	keys, keyErrs := src.parseKeys(raw)
+	errs = append(errs, keyErrs...)
+	file.Keys = keys
+	cfg, valueErrs := file.config()
+	for i := range valueErrs {
+		valueErrs[i].Line = src.line(valueErrs[i].table, valueErrs[i].key)
+	}
+	for _, ve := range valueErrs {
+		errs = append(errs, ve.ConfigError)
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return cfg, errs
+}
+
+// valueError is an invalid setting, located later by its table and key.
+type valueError struct {
+	ConfigError
+	table, key string
+}
+
+// config validates the settings and converts them to a Config.
+func (f configFile) config() (Config, []valueError) {
+	var errs []valueError
+	fail := func(table, key, format string, args ...any) {
+		errs = append(errs, valueError{ConfigError: ConfigError{Msg: fmt.Sprintf(format, args...)}, table: table, key: key})
+	}
+
+	cfg := Config{
+		FollowSymlinks: f.Library.FollowSymlinks,
+		Shuffle:        f.Playback.Shuffle,
+		AutoPlay:       f.Playback.AutoPlay,
+		Theme:          f.Theme,
+		Keys:           f.Keys,
+	}
+
+	if len(f.Library.Exclude) > 0 {
+		cfg.Exclude = f.Library.Exclude
+	}
+	for _, root := range f.Library.Roots {
+		cfg.LibraryRoots = append(cfg.LibraryRoots, expandHome(root))
+	}
+	if f.Library.PlaylistsFile != "" {
+		cfg.PlaylistsPath = expandHome(f.Library.PlaylistsFile)
+	}
+
+	if v := f.Playback.Volume; v < 0 || v > 100 {
+		fail("playback", "volume", "volume %g is out of range (0-100)", v)
+	}
+	cfg.Volume = f.Playback.Volume
+	if mode, ok := ParseRepeatMode(f.Playback.Repeat); ok {
+		cfg.RepeatMode = mode
+	} else {
+		fail("playback", "repeat", "unknown repeat mode %q (available: off, one, all)", f.Playback.Repeat)
+	}
+	if v := f.Playback.Crossfade; v < 0 || v > MaxCrossfade.Seconds() {
+		fail("playback", "crossfade", "crossfade %g is out of range (0-%g seconds)", v, MaxCrossfade.Seconds())
+	}
+	cfg.Crossfade.Duration = time.Duration(f.Playback.Crossfade * float64(time.Second))
+	if curve, ok := ParseFadeCurve(f.Playback.CrossfadeCurve); ok {
+		cfg.Crossfade.Curve = curve
+	} else {
+		fail("playback", "crossfade_curve", "unknown crossfade curve %q (available: %s)",
+			f.Playback.CrossfadeCurve, strings.Join(FadeCurveNames(), ", "))
+	}
+	cfg.Crossfade.Smart = f.Playback.SmartCrossfade
+	if mode, ok := ParseReplayGainMode(f.Playback.ReplayGain); ok {
+		cfg.Normalization.Mode = mode
+	} else {
+		fail("playback", "replaygain", "unknown ReplayGain mode %q (available: %s)",
+			f.Playback.ReplayGain, strings.Join(ReplayGainModeNames(), ", "))
+	}
+	if v := f.Playback.PreAmp; v < -MaxPreAmp || v > MaxPreAmp {
+		fail("playback", "replaygain_preamp", "pre-amp %g is out of range (%g to %g dB)", v, -MaxPreAmp, MaxPreAmp)
+	}
+	cfg.Normalization.PreAmp = f.Playback.PreAmp
+	cfg.Normalization.PreventClipping = f.Playback.PreventClipping
+	if v := f.Playback.Speed; !(v >= MinSpeed && v <= MaxSpeed) {
+		fail("playback", "speed", "speed %g is out of range (%g-%g)", v, MinSpeed, MaxSpeed)
+	}
+	cfg.Speed.Speed = clampSpeed(f.Playback.Speed)
+	cfg.Speed.PreservePitch = f.Playback.PreservePitch
+	if mode, ok := ParseRememberSpeed(f.Playback.RememberSpeed); ok {
+		cfg.Speed.Remember = mode
+	} else {
+		fail("playback", "remember_speed", "unknown remember_speed %q (available: %s)",
+			f.Playback.RememberSpeed, strings.Join(RememberSpeedNames(), ", "))
+	}
+	if v := f.Playback.SkipStep; !(v > 0 && v <= MaxSkipStep.Seconds()) {
+		fail("playback", "skip_step", "skip step %g is out of range (0-%g seconds)", v, MaxSkipStep.Seconds())
+	}
+	cfg.SkipStep = time.Duration(f.Playback.SkipStep * float64(time.Second))
+	if v := f.Playback.LongSkipStep; !(v > 0 && v <= MaxSkipStep.Seconds()) {
+		fail("playback", "long_skip_step", "long skip step %g is out of range (0-%g seconds)", v, MaxSkipStep.Seconds())
+	}
+	cfg.LongSkipStep = time.Duration(f.Playback.LongSkipStep * float64(time.Second))
+	if v := f.Playback.ResumeThreshold; !(v >= 0 && v <= maxResumeThreshold.Minutes()) {
+		fail("playback", "resume_threshold", "resume threshold %g is out of range (0-%g minutes)", v, maxResumeThreshold.Minutes())
+	}
+	cfg.ResumeThreshold = time.Duration(f.Playback.ResumeThreshold * float64(time.Minute))
+
+	cfg.EQPresets = BuiltinEQPresets()
+	for _, name := range sortedKeys(f.Equalizer.Presets) {
+		gains, ok := eqGains(f.Equalizer.Presets[name])
+		switch {
+		case !ok:
+			fail("equalizer.presets", name, "preset %s must have %d gains between %g and %g dB", name, len(EQBands), -MaxEQGain, MaxEQGain)
+		case containsPreset(builtinEQPresets, name):
+			fail("equalizer.presets", name, "preset %s is built in", name)
+		default:
+			cfg.EQPresets = append(cfg.EQPresets, EQPreset{Name: name, Gains: gains})
+		}
+	}
+	if preset, ok := FindEQPreset(cfg.EQPresets, f.Equalizer.Preset); ok {
+		cfg.Equalizer = preset.Settings(f.Equalizer.Enabled)
+	} else {
+		fail("equalizer", "preset", "unknown preset %q (available: %s)", f.Equalizer.Preset, strings.Join(eqPresetNames(cfg.EQPresets), ", "))
+		cfg.Equalizer.Enabled = f.Equalizer.Enabled
+	}
+	if f.Equalizer.Bands != nil {
+		if gains, ok := eqGains(f.Equalizer.Bands); ok {
+			cfg.Equalizer.Gains, cfg.Equalizer.Preset = gains, ""
+		} else {
+			fail("equalizer", "bands", "bands must be %d gains between %g and %g dB", len(EQBands), -MaxEQGain, MaxEQGain)
+		}
+	}
+	if v := f.Equalizer.PreAmp; v != nil {
+		if *v < -MaxEQGain || *v > MaxEQGain {
+			fail("equalizer", "preamp", "pre-amp %g is out of range (%g to %g dB)", *v, -MaxEQGain, MaxEQGain)
+		} else {
+			cfg.Equalizer.PreAmp, cfg.Equalizer.Preset = *v, ""
+		}
+	}
+
+	if view, ok := viewNames[f.UI.DefaultView]; ok {
+		cfg.DefaultView = view
+	} else {
+		fail("ui", "default_view", "unknown view %q (available: library, search, playlist, queue, equalizer, bookmarks, chapters)", f.UI.DefaultView)
+	}
+	if len(f.UI.Columns) > 0 {
+		columns, err := ParseTrackColumns(strings.Join(f.UI.Columns, ","))
+		if err != nil {
+			fail("ui", "columns", "%v", err)
+		}
+		cfg.Columns = columns
+	}
+
+	for _, c := range []struct{ key, value string }{
+		{"primary", f.Theme.PrimaryColor},
+		{"secondary", f.Theme.SecondaryColor},
+		{"accent", f.Theme.AccentColor},
+		{"text", f.Theme.TextColor},
+		{"muted", f.Theme.MutedColor},
+		{"border", f.Theme.BorderColor},
+		{"status_text", f.Theme.StatusTextColor},
+		{"progress", f.Theme.ProgressColor},
+	} {
+		if !validColor(c.value) {
+			fail("theme", c.key, "invalid color %q (want an ANSI color number 0-255 or #rrggbb)", c.value)
+		}
+	}
+	if !containsString(borderStyles, f.Theme.BorderStyle) {
+		fail("theme", "border_style", "unknown border style %q (available: %s)",
+			f.Theme.BorderStyle, strings.Join(borderStyles, ", "))
+	}
+
+	// Sequences were checked by parseKeys, so only ambiguities are left to
+	// report. A pair that clashes in several views is reported once.
+	bindings, _ := NewKeyBindings(f.Keys)
+	type clash struct {
+		set, other string // Descriptions of the two bindings
+		table, key string // Where the first one was set
+	}
+	var (
+		clashes []clash
+		views   = make(map[clash][]string)
+	)
+	for _, c := range bindings.Conflicts() {
+		// Describe the binding set in the file first, and point at it.
+		set, other := c.Bindings[1], c.Bindings[0]
+		if t, _ := f.Keys.origin(c.View, set.Action); t == "" {
+			set, other = other, set
+		}
+		cl := clash{
+			set:   fmt.Sprintf("%q (%s)", set.String(), set.Action),
+			other: fmt.Sprintf("%q (%s)", other.String(), other.Action),
+		}
+		cl.table, cl.key = f.Keys.origin(c.View, set.Action)
+		if _, seen := views[cl]; !seen {
+			clashes = append(clashes, cl)
+		}
+		views[cl] = append(views[cl], ViewName(c.View))
+	}
+	for _, cl := range clashes {
+		where := "the " + strings.Join(views[cl], ", ") + " view"
+		if len(views[cl]) > 1 {
+			where += "s"
+		}
+		fail(cl.table, cl.key, "%s is ambiguous with %s in %s", cl.set, cl.other, where)
+	}
+	return cfg, errs
+}
+
+// origin returns the config table and key that set the keys of action in
+// view, or empty strings if they are the defaults.
+func (k KeyMap) origin(view ViewMode, action Action) (table, key string) {
+	if _, ok := k.Views[view][action]; ok {
+		return "keys." + ViewName(view), string(action)
+	}
+	if _, ok := k.Actions[action]; ok {
+		return "keys", string(action)
+	}
+	return "", ""
+}
+
+// validColor reports whether s is empty, an ANSI color number or a hex color.
+func validColor(s string) bool {
+	if s == "" {
+		return true
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n >= 0 && n <= 255
+	}
+	if strings.HasPrefix(s, "#") && (len(s) == 4 || len(s) == 7) {
+		_, err := strconv.ParseUint(s[1:], 16, 32)
+		return err == nil
+	}
+	return false
+}
+
+// eqGains converts the gains of a preset or of equalizer.bands, reporting
+// whether there is one for each band and all are within range.
+func eqGains(list []float64) (EQGains, bool) {
+	var gains EQGains
+	if len(list) != len(gains) {
+		return gains, false
+	}
+	for i, g := range list {
+		if !(g >= -MaxEQGain && g <= MaxEQGain) {
+			return gains, false
+		}
+		gains[i] = g
+	}
+	return gains, true
+}
+
+func containsPreset(presets []EQPreset, name string) bool {
+	_, ok := FindEQPreset(presets, name)
+	return ok
+}
+
+func eqPresetNames(presets []EQPreset) []string {
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// expandHome replaces a leading "~" in path with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// configSource is the text of a config file, used to decode it and to find
+// the lines that errors refer to.
+type configSource struct {
+	data []byte
+	json bool
+}
+
+func (s configSource) unmarshal(v any) error {
+	if s.json {
+		return json.Unmarshal(s.data, v)
+	}
+	return toml.Unmarshal(s.data, v)
+}
+
+// decodeError converts a decoding error to a ConfigError with its line.
+func (s configSource) decodeError(err error) ConfigError {
+	var (
+		tomlErr   *toml.DecodeError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &tomlErr):
+		line, _ := tomlErr.Position()
+		return ConfigError{Line: line, Msg: strings.TrimPrefix(tomlErr.Error(), "toml: ")}
+	case errors.As(err, &syntaxErr):
+		return ConfigError{Line: s.offsetLine(syntaxErr.Offset), Msg: syntaxErr.Error()}
+	case errors.As(err, &typeErr):
+		return ConfigError{
+			Line: s.offsetLine(typeErr.Offset),
+			Msg:  fmt.Sprintf("%s: cannot use %s as %s", typeErr.Field, typeErr.Value, typeErr.Type),
+		}
+	}
+	return ConfigError{Msg: err.Error()}
+}
+
+// offsetLine returns the line containing the byte at offset.
+func (s configSource) offsetLine(offset int64) int {
+	if offset > int64(len(s.data)) {
+		offset = int64(len(s.data))
+	}
+	return bytes.Count(s.data[:offset], []byte("\n")) + 1
+}
+
+// unknownKeys reports every table and key in raw that isn't part of configFile.
+func (s configSource) unknownKeys(raw map[string]any) []ConfigError {
+	var errs []ConfigError
+	tables := fieldsByName(reflect.TypeOf(configFile{}))
+	for _, name := range sortedKeys(raw) {
+		if name == "keys" {
+			continue // Checked by parseKeys
+		}
+		field, ok := tables[name]
+		if !ok {
+			errs = append(errs, ConfigError{Line: s.line(name, ""), Msg: fmt.Sprintf("unknown table %q", name)})
+			continue
+		}
+		values, ok := raw[name].(map[string]any)
+		if !ok {
+			continue // Reported as a type error when decoding
+		}
+		for _, key := range sortedKeys(values) {
+			if _, known := fieldsByName(field.Type)[key]; !known {
+				errs = append(errs, ConfigError{Line: s.line(name, key), Msg: fmt.Sprintf("unknown key %q in [%s]", key, name)})
+			}
+		}
+	}
+	return errs
+}
+
+// parseKeys reads the [keys] table: an optional leader key, the keys of each
+// action, and tables of per-view keys named after the views.
+func (s configSource) parseKeys(raw map[string]any) (KeyMap, []ConfigError) {
+	var (
+		k    KeyMap
+		errs []ConfigError
+	)
+	fail := func(table, key, format string, args ...any) {
+		errs = append(errs, ConfigError{Line: s.line(table, key), Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if _, ok := raw["keys"]; !ok {
+		return k, nil
+	}
+	values, ok := raw["keys"].(map[string]any)
+	if !ok {
+		fail("keys", "", "keys must be a table")
+		return k, errs
+	}
+
+	if leader, ok := values["leader"]; ok {
+		if k.Leader, ok = leader.(string); !ok || strings.Fields(k.Leader) == nil {
+			fail("keys", "leader", "leader must be a single key name")
+			k.Leader = ""
+		}
+	}
+
+	// parseList reads the list of sequences bound to an action.
+	parseList := func(table, name string, value any) ([]string, bool) {
+		list, ok := value.([]any)
+		if !ok {
+			fail(table, name, "keys of %s must be a list of strings", name)
+			return nil, false
+		}
+		keys := make([]string, 0, len(list))
+		for _, item := range list {
+			str, ok := item.(string)
+			if !ok {
+				fail(table, name, "keys of %s must be a list of strings", name)
+				return nil, false
+			}
+			if _, err := ParseKeySequence(str, k.Leader); err != nil {
+				fail(table, name, "%s: %v", name, err)
+				return nil, false
+			}
+			keys = append(keys, str)
+		}
+		return keys, true
+	}
+
+	for _, name := range sortedKeys(values) {
+		if name == "leader" {
+			continue
+		}
+		// Tables hold the keys of a single view.
+		if viewValues, ok := values[name].(map[string]any); ok {
+			table := "keys." + name
+			view, ok := viewNames[name]
+			if !ok {
+				fail(table, "", "unknown view %q in [keys]", name)
+				continue
+			}
+			for _, actionName := range sortedKeys(viewValues) {
+				a, ok := findKeyAction(actionName)
+				if !ok {
+					fail(table, actionName, "unknown action %q in [%s]", actionName, table)
+					continue
+				}
+				if !a.appliesTo(view) {
+					fail(table, actionName, "%s isn't available in the %s view", actionName, name)
+					continue
+				}
+				if keys, ok := parseList(table, actionName, viewValues[actionName]); ok {
+					if k.Views == nil {
+						k.Views = make(map[ViewMode]map[Action][]string)
+					}
+					if k.Views[view] == nil {
+						k.Views[view] = make(map[Action][]string)
+					}
+					k.Views[view][a.action] = keys
+				}
+			}
+			continue
+		}
+
+		a, ok := findKeyAction(name)
+		if !ok {
+			fail("keys", name, "unknown action %q in [keys]", name)
+			continue
+		}
+		if keys, ok := parseList("keys", name, values[name]); ok {
+			if k.Actions == nil {
+				k.Actions = make(map[Action][]string)
+			}
+			k.Actions[a.action] = keys
+		}
+	}
+	return k, errs
+}
+
+// fieldsByName returns the fields of a struct type by their toml tag.
+func fieldsByName(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("toml"), ","); name != "" {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// line returns the line on which key is set in table, or of the table itself
+// if key is empty. Nested tables are named with dots, as in "keys.queue". It
+// returns 0 if it can't be found. This is a line-based scan rather than a full
+// parse, which is enough for the files muxic writes and for hand-edited ones
+// in the same layout.
+func (s configSource) line(table, key string) int {
+	if s.json {
+		return s.jsonLine(table, key)
+	}
+
+	inTable := false
+	tableLine := 0
+	scanner := bufio.NewScanner(bytes.NewReader(s.data))
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "[") {
+			name := strings.Trim(strings.TrimSpace(strings.Trim(text, "[]")), `"`)
+			inTable = name == table
+			if inTable {
+				tableLine = n
+				if key == "" {
+					return n
+				}
+			}
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		name, _, ok := strings.Cut(text, "=")
+		if ok && strings.Trim(strings.TrimSpace(name), `"'`) == key {
+			return n
+		}
+	}
+	return tableLine
+}
+
+// jsonLine is line for JSON files: it looks for each name of the path to the
+// key in turn, each on a later line than the previous one.
+func (s configSource) jsonLine(table, key string) int {
+	path := strings.Split(table, ".")
+	if key != "" {
+		path = append(path, key)
+	}
+	found, lastLine := 0, 0
+	scanner := bufio.NewScanner(bytes.NewReader(s.data))
+	for n := 1; scanner.Scan() && found < len(path); n++ {
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), strconv.Quote(path[found])) {
+			found, lastLine = found+1, n
+		}
+	}
+	if found < len(path) && (key == "" || found < len(path)-1) {
+		return 0 // Not even the table was found
+	}
+	return lastLine
+}
+
+// DefaultConfigTOML returns a commented config file with every setting at its
+// default, as written by "muxic config init".
+func DefaultConfigTOML() []byte {
+	def := defaultConfigFile()
+	var b bytes.Buffer
+
+	b.WriteString("# muxic configuration. Every setting is shown with its default value;\n")
+	b.WriteString("# delete or comment out the ones you don't want to change.\n\n")
+
+	b.WriteString("[library]\n")
+	b.WriteString("# Directories scanned for music. Directories given on the command line\n# replace this list.\n")
+	fmt.Fprintf(&b, "roots = %s\n", tomlStrings(def.Library.Roots))
+	b.WriteString("# Glob patterns of files and directories to skip, e.g. \"*.wav\".\n")
+	fmt.Fprintf(&b, "exclude = %s\n", tomlStrings(def.Library.Exclude))
+	fmt.Fprintf(&b, "follow_symlinks = %t\n", def.Library.FollowSymlinks)
+	b.WriteString("# Where playlists are saved. Empty uses the data directory.\n")
+	fmt.Fprintf(&b, "playlists_file = %s\n\n", strconv.Quote(def.Library.PlaylistsFile))
+
+	b.WriteString("[playback]\n")
+	b.WriteString("# Initial volume, 0-100.\n")
+	fmt.Fprintf(&b, "volume = %g\n", def.Playback.Volume)
+	b.WriteString("# Repeat mode of the queue: off, one or all.\n")
+	fmt.Fprintf(&b, "repeat = %s\n", strconv.Quote(def.Playback.Repeat))
+	fmt.Fprintf(&b, "shuffle = %t\n", def.Playback.Shuffle)
+	b.WriteString("# Start playing when a track is added while nothing is playing.\n")
+	fmt.Fprintf(&b, "auto_play = %t\n", def.Playback.AutoPlay)
+	b.WriteString("# Seconds each track fades into the next, 0-12. 0 plays them gaplessly.\n")
+	fmt.Fprintf(&b, "crossfade = %g\n", def.Playback.Crossfade)
+	fmt.Fprintf(&b, "# Shape of the crossfade: %s.\n", strings.Join(FadeCurveNames(), " or "))
+	fmt.Fprintf(&b, "crossfade_curve = %s\n", strconv.Quote(def.Playback.CrossfadeCurve))
+	b.WriteString("# Play consecutive tracks of the same album gaplessly instead of crossfading.\n")
+	fmt.Fprintf(&b, "smart_crossfade = %t\n", def.Playback.SmartCrossfade)
+	b.WriteString("# Loudness normalization: off, track, album or auto (album gain unless\n" +
+		"# shuffled). Tracks without ReplayGain tags are measured in the background.\n")
+	fmt.Fprintf(&b, "replaygain = %s\n", strconv.Quote(def.Playback.ReplayGain))
+	b.WriteString("# Gain added to every track when normalizing, in dB.\n")
+	fmt.Fprintf(&b, "replaygain_preamp = %g\n", def.Playback.PreAmp)
+	b.WriteString("# Lower the gain of tracks that would clip.\n")
+	fmt.Fprintf(&b, "prevent_clipping = %t\n", def.Playback.PreventClipping)
+	fmt.Fprintf(&b, "# Playback speed, %g-%g.\n", MinSpeed, MaxSpeed)
+	fmt.Fprintf(&b, "speed = %.1f\n", def.Playback.Speed)
+	b.WriteString("# Keep the pitch when changing speed, rather than resampling like a tape.\n")
+	fmt.Fprintf(&b, "preserve_pitch = %t\n", def.Playback.PreservePitch)
+	b.WriteString("# Remember the speed set while a track plays: off, for the track, or for\n# its album.\n")
+	fmt.Fprintf(&b, "remember_speed = %s\n", strconv.Quote(def.Playback.RememberSpeed))
+	b.WriteString("# Seconds the skip actions seek, and the long skip actions.\n")
+	fmt.Fprintf(&b, "skip_step = %g\n", def.Playback.SkipStep)
+	fmt.Fprintf(&b, "long_skip_step = %g\n", def.Playback.LongSkipStep)
+	b.WriteString("# Tracks at least this many minutes long, such as audiobooks and podcasts,\n" +
+		"# resume where they were left. 0 plays every track from the start.\n")
+	fmt.Fprintf(&b, "resume_threshold = %g\n\n", def.Playback.ResumeThreshold)
+
+	b.WriteString("[ui]\n")
+	b.WriteString("# View shown at startup: library, search, playlist, queue, equalizer,\n# bookmarks or chapters.\n")
+	fmt.Fprintf(&b, "default_view = %s\n", strconv.Quote(def.UI.DefaultView))
+	fmt.Fprintf(&b, "# Track columns to show. Empty keeps the defaults. Available:\n# %s\n",
+		strings.Join(TrackColumnNames(), ", "))
+	fmt.Fprintf(&b, "columns = %s\n\n", tomlStrings(def.UI.Columns))
+
+	b.WriteString("[equalizer]\n")
+	fmt.Fprintf(&b, "enabled = %t\n", def.Equalizer.Enabled)
+	fmt.Fprintf(&b, "# Gains to start with: %s,\n# or one of [equalizer.presets].\n",
+		strings.Join(eqPresetNames(builtinEQPresets), ", "))
+	fmt.Fprintf(&b, "preset = %s\n", strconv.Quote(def.Equalizer.Preset))
+	fmt.Fprintf(&b, "# Gains in dB, %g to %g, overriding the preset's: the pre-amp, and one for\n", -MaxEQGain, MaxEQGain)
+	b.WriteString("# each band from 31 Hz to 16 kHz.\n")
+	b.WriteString("# preamp = 0.0\n")
+	fmt.Fprintf(&b, "# bands = %s\n\n", tomlFloats(make([]float64, len(EQBands))))
+	b.WriteString("# Presets of your own, with a gain for each band, e.g.:\n")
+	b.WriteString("[equalizer.presets]\n")
+	fmt.Fprintf(&b, "# loudness = %s\n\n", tomlFloats([]float64{4, 3, 1, 0, -1, -1, 0, 1, 3, 4}))
+
+	b.WriteString("[theme]\n")
+	b.WriteString("# ANSI color numbers (\"62\") or hex colors (\"#5f5fd7\"). Empty uses the\n# terminal's default color.\n")
+	theme := reflect.ValueOf(def.Theme)
+	for i := 0; i < theme.NumField(); i++ {
+		field := theme.Type().Field(i)
+		if field.Name == "BorderStyle" {
+			fmt.Fprintf(&b, "# One of: %s.\n", strings.Join(borderStyles, ", "))
+		}
+		fmt.Fprintf(&b, "%s = %s\n", field.Tag.Get("toml"), strconv.Quote(theme.Field(i).String()))
+	}
+
+	b.WriteString("\n[keys]\n")
+	b.WriteString("# Keys for each action, in every view the action is available in. A binding\n")
+	b.WriteString("# may be a sequence of keys separated by spaces, such as \"g g\", and\n")
+	b.WriteString("# \"<leader>\" in a sequence stands for the leader key. An empty list unbinds\n")
+	b.WriteString("# the action. Within a view, no binding may equal or start another one.\n")
+	b.WriteString("# leader = \",\"\n")
+	defaults := DefaultKeyMap()
+	for _, a := range keyActions {
+		fmt.Fprintf(&b, "%s = %s\n", a.action, tomlStrings(defaults.Actions[a.action]))
+	}
+	b.WriteString("\n# Keys for a single view go in [keys.library], [keys.search],\n")
+	b.WriteString("# [keys.playlist], [keys.queue], [keys.equalizer], [keys.bookmarks] or\n")
+	b.WriteString("# [keys.chapters], e.g.:\n")
+	b.WriteString("# [keys.queue]\n")
+	b.WriteString("# remove_from_queue = [\"delete\", \"<leader> r\"]\n")
+	return b.Bytes()
+}
+
+// tomlFloats formats a list of numbers as a TOML array.
+func tomlFloats(list []float64) string {
+	formatted := make([]string, len(list))
+	for i, v := range list {
+		formatted[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+// tomlStrings formats a list of strings as a TOML array.
+func tomlStrings(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,341 @@
+package components
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultConfigTOMLLoadsAsDefaults(t *testing.T) {
+	path := writeConfig(t, "config.toml", string(DefaultConfigTOML()))
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(default file): %v", err)
+	}
+
+	want := DefaultConfig()
+	want.ConfigPath = path
+	// The file lists every key, so every action is overridden with its default.
+	want.Keys = DefaultKeyMap()
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("default file loads as\n%+v\nwant\n%+v", cfg, want)
+	}
+}
+
+func TestDefaultConfigTOMLNamesEveryViewTable(t *testing.T) {
+	// The tables appear in comments, wrapped across lines.
+	template := strings.Join(strings.Fields(strings.ReplaceAll(string(DefaultConfigTOML()), "#", "")), " ")
+	for name := range viewNames {
+		if !strings.Contains(template, "[keys."+name+"]") {
+			t.Errorf("default file doesn't mention [keys.%s]", name)
+		}
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("LoadConfig(missing): %v", err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("missing file loads as %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+[playback]
+volume = 80
+repeat = "all"
+shuffle = true
+crossfade = 4.5
+crossfade_curve = "equal-power"
+smart_crossfade = false
+replaygain = "auto"
+replaygain_preamp = -2
+prevent_clipping = false
+speed = 1.25
+preserve_pitch = false
+remember_speed = "album"
+skip_step = 2.5
+resume_threshold = 45
+
+[ui]
+default_view = "queue"
+columns = ["title", "year"]
+
+[theme]
+primary = "#ff8800"
+border_style = "rounded"
+
+[keys]
+pause = ["p"]
+previous_track = ["P"]
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Volume != 80 || cfg.RepeatMode != RepeatAll || !cfg.Shuffle || !cfg.AutoPlay {
+		t.Errorf("playback = %v %v %v %v, want 80 all true true", cfg.Volume, cfg.RepeatMode, cfg.Shuffle, cfg.AutoPlay)
+	}
+	if want := (Crossfade{Duration: 4500 * time.Millisecond, Curve: FadeEqualPower}); cfg.Crossfade != want {
+		t.Errorf("Crossfade = %+v, want %+v", cfg.Crossfade, want)
+	}
+	if want := (Normalization{Mode: ReplayGainAuto, PreAmp: -2}); cfg.Normalization != want {
+		t.Errorf("Normalization = %+v, want %+v", cfg.Normalization, want)
+	}
+	if want := (SpeedSettings{Speed: 1.25, Remember: RememberSpeedAlbum}); cfg.Speed != want {
+		t.Errorf("Speed = %+v, want %+v", cfg.Speed, want)
+	}
+	if cfg.SkipStep != 2500*time.Millisecond || cfg.LongSkipStep != DefaultLongSkipStep {
+		t.Errorf("skip steps = %v and %v, want 2.5s and the default", cfg.SkipStep, cfg.LongSkipStep)
+	}
+	if cfg.ResumeThreshold != 45*time.Minute {
+		t.Errorf("ResumeThreshold = %v, want 45m", cfg.ResumeThreshold)
+	}
+	if cfg.DefaultView != ViewQueue {
+		t.Errorf("DefaultView = %v, want ViewQueue", cfg.DefaultView)
+	}
+	if want := []TrackColumn{ColumnTitle, ColumnYear}; !reflect.DeepEqual(cfg.Columns, want) {
+		t.Errorf("Columns = %v, want %v", cfg.Columns, want)
+	}
+	if cfg.Theme.PrimaryColor != "#ff8800" || cfg.Theme.BorderStyle != "rounded" {
+		t.Errorf("Theme = %+v", cfg.Theme)
+	}
+	if cfg.Theme.SecondaryColor != DefaultTheme().SecondaryColor {
+		t.Errorf("unset theme color = %q, want the default", cfg.Theme.SecondaryColor)
+	}
+
+	keys, _ := NewKeyBindings(cfg.Keys)
+	if action, _ := keys.Lookup(ViewLibrary, []string{"p"}); action != ActionPause {
+		t.Errorf("p resolves to %q, want pause", action)
+	}
+	if action, _ := keys.Lookup(ViewLibrary, []string{"space"}); action != "" {
+		t.Errorf("space resolves to %q after pause was rebound, want nothing", action)
+	}
+	if action, _ := keys.Lookup(ViewLibrary, []string{"x"}); action != ActionStop {
+		t.Errorf("x resolves to %q, want the default stop binding", action)
+	}
+}
+
+func TestLoadConfigEqualizer(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+[equalizer]
+enabled = true
+preset = "mine"
+
+[equalizer.presets]
+mine = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10.5]
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := EQSettings{Enabled: true, Preset: "mine", Gains: EQGains{1, 2, 3, 4, 5, 6, 7, 8, 9, 10.5}}
+	if cfg.Equalizer != want {
+		t.Errorf("Equalizer = %+v, want %+v", cfg.Equalizer, want)
+	}
+	if n := len(cfg.EQPresets); n != len(builtinEQPresets)+1 || cfg.EQPresets[n-1].Name != "mine" {
+		t.Errorf("EQPresets = %+v, want the built-in ones and mine", cfg.EQPresets)
+	}
+
+	// Bands and pre-amp override the preset's.
+	path = writeConfig(t, "config.toml", `
+[equalizer]
+preset = "rock"
+preamp = -2
+bands = [0, 0, 0, 0, 0, 0, 0, 0, 0, -12]
+`)
+	if cfg, err = LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want = EQSettings{PreAmp: -2, Gains: EQGains{9: -12}}
+	if cfg.Equalizer != want {
+		t.Errorf("Equalizer = %+v, want %+v", cfg.Equalizer, want)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+  "playback": {"volume": 30, "repeat": "one"},
+  "keys": {"quit": ["ctrl+q"], "queue": {"remove_from_queue": ["delete"]}}
+}`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Volume != 30 || cfg.RepeatMode != RepeatOne {
+		t.Errorf("playback = %v %v, want 30 one", cfg.Volume, cfg.RepeatMode)
+	}
+	if got := cfg.Keys.Actions[ActionQuit]; !reflect.DeepEqual(got, []string{"ctrl+q"}) {
+		t.Errorf("quit keys = %v", got)
+	}
+	if got := cfg.Keys.Views[ViewQueue][ActionRemoveFromQueue]; !reflect.DeepEqual(got, []string{"delete"}) {
+		t.Errorf("queue remove_from_queue keys = %v", got)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		want     []string // "line: message substring", in order
+	}{
+		{
+			name: "unknown keys and tables",
+			file: "config.toml",
+			contents: `[playback]
+volume = 50
+volum = 60
+
+[keys]
+pause = ["space"]
+jump = ["j"]
+
+[colours]
+primary = "1"
+`,
+			want: []string{"3: unknown key \"volum\" in [playback]", "7: unknown action \"jump\" in [keys]", "9: unknown table \"colours\""},
+		},
+		{
+			name: "invalid values",
+			file: "config.toml",
+			contents: `[playback]
+volume = 150
+repeat = "sometimes"
+crossfade = 20
+crossfade_curve = "s-curve"
+replaygain = "loud"
+replaygain_preamp = 20
+speed = 4
+remember_speed = "forever"
+skip_step = 0
+resume_threshold = -1
+
+[theme]
+accent = "purple"
+border_style = "wavy"
+`,
+			want: []string{
+				"2: volume 150", "3: unknown repeat mode", "4: crossfade 20 is out of range", "5: unknown crossfade curve",
+				"6: unknown ReplayGain mode", "7: pre-amp 20 is out of range",
+				"8: speed 4 is out of range", "9: unknown remember_speed", "10: skip step 0 is out of range",
+				"11: resume threshold -1 is out of range", "14: invalid color \"purple\"", "15: unknown border style",
+			},
+		},
+		{
+			name: "invalid equalizer",
+			file: "config.toml",
+			contents: `[equalizer]
+preset = "loud"
+preamp = -20
+bands = [1, 2, 3]
+
+[equalizer.presets]
+flat = [0, 0, 0, 0, 0, 0, 0, 0, 0, 0]
+huge = [0, 0, 0, 0, 0, 0, 0, 0, 0, 13]
+`,
+			want: []string{
+				"2: unknown preset \"loud\"", "3: pre-amp -20 is out of range", "4: bands must be 10 gains",
+				"7: preset flat is built in", "8: preset huge must have 10 gains",
+			},
+		},
+		{
+			name: "conflicting keys",
+			file: "config.toml",
+			contents: `[keys]
+stop = ["x"]
+quit = ["x"]
+`,
+			want: []string{"3: \"x\" (quit) is ambiguous with \"x\" (stop) in the library, search, playlist, queue, equalizer, bookmarks, chapters views"},
+		},
+		{
+			name: "conflict with a default binding",
+			file: "config.toml",
+			contents: `
+
+[keys]
+view_queue = ["a"]
+`,
+			want: []string{"4: \"a\" (view_queue) is ambiguous with \"a\" (add_to_queue) in the library view"},
+		},
+		{
+			name: "sequence starting with another binding",
+			file: "config.toml",
+			contents: `[keys]
+leader = ","
+[keys.queue]
+clear_queue = ["r r"]
+`,
+			want: []string{"4: \"r r\" (clear_queue) is ambiguous with \"r\" (remove_from_queue) in the queue view"},
+		},
+		{
+			name: "bad key tables",
+			file: "config.toml",
+			contents: `[keys]
+stop = "x"
+quit = ["<leader> q"]
+
+[keys.library]
+remove_from_queue = ["d"]
+`,
+			want: []string{
+				"2: keys of stop must be a list of strings",
+				"3: quit: \"<leader> q\" uses <leader>, but no leader key is set",
+				"6: remove_from_queue isn't available in the library view",
+			},
+		},
+		{
+			name:     "syntax error",
+			file:     "config.toml",
+			contents: "[playback]\nvolume = \n",
+			want:     []string{"2: "},
+		},
+		{
+			name:     "type error",
+			file:     "config.toml",
+			contents: "[playback]\nshuffle = true\nvolume = \"loud\"\n",
+			want:     []string{"3: "},
+		},
+		{
+			name:     "json unknown key",
+			file:     "config.json",
+			contents: "{\n  \"ui\": {\n    \"theme\": \"dark\"\n  }\n}\n",
+			want:     []string{"3: unknown key \"theme\" in [ui]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.contents)
+			_, err := LoadConfig(path)
+			var cerr *ConfigErrors
+			if !errors.As(err, &cerr) {
+				t.Fatalf("LoadConfig error = %v, want *ConfigErrors", err)
+			}
+			if len(cerr.Errors) != len(tt.want) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(cerr.Errors), len(tt.want), err)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], path+":") || !strings.Contains(lines[i], ":"+want) {
+					t.Errorf("error %d = %q, want %q", i, lines[i], path+":"+want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package components
+
+import (
+	"math"
+	"time"
+
+	"muxic/internal/util"
+)
+
+const (
+	// MaxCrossfade is the longest crossfade allowed.
+	MaxCrossfade = 12 * time.Second
+	// skipFade is how long a playing track fades out for when another one is
+	// started over it, e.g. by skipping to the next track.
+	skipFade = 150 * time.Millisecond
+)
+
+// FadeCurve is the shape of the gains of a crossfade.
+type FadeCurve int
+
+const (
+	FadeLinear     FadeCurve = iota // Gains change linearly; loudness dips midway
+	FadeEqualPower                  // Gains follow a quarter sine, keeping loudness steady
+)
+
+var fadeCurveNames = []string{"linear", "equal-power"}
+
+func (c FadeCurve) String() string {
+	if c < 0 || int(c) >= len(fadeCurveNames) {
+		return "unknown"
+	}
+	return fadeCurveNames[c]
+}
+
+// ParseFadeCurve parses a curve name as returned by FadeCurve.String.
+func ParseFadeCurve(s string) (FadeCurve, bool) {
+	for i, name := range fadeCurveNames {
+		if s == name {
+			return FadeCurve(i), true
+		}
+	}
+	return FadeLinear, false
+}
+
+// FadeCurveNames returns the names of the curves, for help texts.
+func FadeCurveNames() []string {
+	return append([]string(nil), fadeCurveNames...)
+}
+
+// gains returns the gains of the outgoing and incoming tracks at x, which goes
+// from 0 at the start of the fade to 1 at its end.
+func (c FadeCurve) gains(x float64) (out, in float64) {
+	x = max(0, min(x, 1))
+	if c == FadeEqualPower {
+		return math.Cos(x * math.Pi / 2), math.Sin(x * math.Pi / 2)
+	}
+	return 1 - x, x
+}
+
+// Crossfade configures how consecutive tracks are joined.
+type Crossfade struct {
+	Duration time.Duration // How long tracks overlap, up to MaxCrossfade; 0 plays them gaplessly
+	Curve    FadeCurve
+	// Smart plays a track gaplessly instead when it continues the album of
+	// the one before, so live albums and DJ mixes flow as recorded.
+	Smart bool
+}
+
+// applies reports whether to crossfade from one track into the next.
+func (c Crossfade) applies(from, to *util.AudioFile) bool {
+	if c.Duration <= 0 {
+		return false
+	}
+	return !c.Smart || !continuesAlbum(from, to)
+}
+
+// continuesAlbum reports whether to is the track after from on the same
+// album. Tracks without track numbers are taken to be in album order.
+func continuesAlbum(from, to *util.AudioFile) bool {
+	// Files without an album tag are all given "Unknown".
+	if from.Album == "" || from.Album == "Unknown" || from.Album != to.Album || albumArtist(from) != albumArtist(to) {
+		return false
+	}
+	if from.TrackNumber == 0 || to.TrackNumber == 0 {
+		return true
+	}
+	if from.DiscNumber == to.DiscNumber {
+		return to.TrackNumber == from.TrackNumber+1
+	}
+	return to.DiscNumber == from.DiscNumber+1 && to.TrackNumber == 1
+}
+
+// albumArtist returns the artist an album is filed under.
+func albumArtist(f *util.AudioFile) string {
+	if f.AlbumArtist != "" {
+		return f.AlbumArtist
+	}
+	return f.Artist
+}
+
+// fade is a track fading out under the current one.
+type fade struct {
+	p      *playback
+	curve  FadeCurve
+	pos, n int  // Samples of the fade done and its length, at the output rate
+	fadeIn bool // Whether the current track fades in over the same samples
+}
+
+// mix mixes the next samples of the fading track into buf, which holds the
+// current track's, scratch being a buffer at least as long. It reports
+// whether the fade is over.
+func (f *fade) mix(buf, scratch [][2]float64) bool {
+	m := min(len(buf), f.n-f.pos)
+	tail := scratch[:m]
+	n, ok := f.p.source.Stream(tail)
+	for i := range buf[:m] {
+		out, in := f.curve.gains(float64(f.pos+i) / float64(f.n))
+		if !f.fadeIn {
+			in = 1
+		}
+		var t [2]float64
+		if i < n {
+			t = tail[i]
+		}
+		buf[i][0] = buf[i][0]*in + t[0]*out
+		buf[i][1] = buf[i][1]*in + t[1]*out
+	}
+	f.pos += m
+	return f.pos >= f.n || !ok
+}
@@ -0,0 +1,77 @@
+package components
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+func TestFadeCurveGains(t *testing.T) {
+	for _, x := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		out, in := FadeLinear.gains(x)
+		if math.Abs(out+in-1) > 1e-9 {
+			t.Errorf("linear gains at %v = %v, %v; want them to sum to 1", x, out, in)
+		}
+		out, in = FadeEqualPower.gains(x)
+		if math.Abs(out*out+in*in-1) > 1e-9 {
+			t.Errorf("equal-power gains at %v = %v, %v; want their powers to sum to 1", x, out, in)
+		}
+	}
+	if out, in := FadeEqualPower.gains(0); out != 1 || in != 0 {
+		t.Errorf("equal-power gains at the start = %v, %v; want 1, 0", out, in)
+	}
+	if out, in := FadeLinear.gains(2); out != 0 || in != 1 {
+		t.Errorf("linear gains past the end = %v, %v; want 0, 1", out, in)
+	}
+
+	for _, name := range FadeCurveNames() {
+		if c, ok := ParseFadeCurve(name); !ok || c.String() != name {
+			t.Errorf("ParseFadeCurve(%q) = %v, %v", name, c, ok)
+		}
+	}
+	if _, ok := ParseFadeCurve("logarithmic"); ok {
+		t.Error("ParseFadeCurve accepted an unknown curve")
+	}
+}
+
+func TestCrossfadeApplies(t *testing.T) {
+	track := func(artist, album string, disc, number int) *util.AudioFile {
+		return &util.AudioFile{Artist: artist, Album: album, DiscNumber: disc, TrackNumber: number}
+	}
+	tests := []struct {
+		name     string
+		from, to *util.AudioFile
+		smart    bool // Whether smart crossfade skips the fade
+	}{
+		{"next track", track("A", "X", 1, 3), track("A", "X", 1, 4), true},
+		{"next disc", track("A", "X", 1, 12), track("A", "X", 2, 1), true},
+		{"no track numbers", track("A", "X", 0, 0), track("A", "X", 0, 0), true},
+		{"skipped a track", track("A", "X", 1, 3), track("A", "X", 1, 5), false},
+		{"same track again", track("A", "X", 1, 3), track("A", "X", 1, 3), false},
+		{"other album", track("A", "X", 1, 3), track("A", "Y", 1, 4), false},
+		{"other artist", track("A", "X", 1, 3), track("B", "X", 1, 4), false},
+		{"untagged album", track("A", "Unknown", 1, 3), track("A", "Unknown", 1, 4), false},
+		{
+			"compilation",
+			&util.AudioFile{Artist: "A", AlbumArtist: "Various", Album: "X", TrackNumber: 1},
+			&util.AudioFile{Artist: "B", AlbumArtist: "Various", Album: "X", TrackNumber: 2},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		c := Crossfade{Duration: 5 * time.Second}
+		if !c.applies(tt.from, tt.to) {
+			t.Errorf("%s: no crossfade without smart crossfade", tt.name)
+		}
+		c.Smart = true
+		if got := c.applies(tt.from, tt.to); got == tt.smart {
+			t.Errorf("%s: smart crossfade applies = %v, want %v", tt.name, got, !tt.smart)
+		}
+		c.Duration = 0
+		if c.applies(tt.from, tt.to) {
+			t.Errorf("%s: a crossfade of 0 applies", tt.name)
+		}
+	}
+}
@@ -0,0 +1,739 @@
+package components
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"muxic/internal/util"
+)
+
+// Types of the events an Engine emits.
+const (
+	EventTrackStarted     = "track_started"      // Data: the *util.AudioFile now playing or cued
+	EventPaused           = "paused"             // Data: the *util.AudioFile paused
+	EventResumed          = "resumed"            // Data: the *util.AudioFile resumed
+	EventStopped          = "stopped"            // Playback stopped, or the queue ended
+	EventSeeked           = "seeked"             // Data: the new position, a time.Duration
+	EventLoopChanged      = "loop_changed"       // An A-B loop was set or cleared
+	EventVolumeChanged    = "volume_changed"     // Data: the volume, a float64; muting changes it too
+	EventSpeedChanged     = "speed_changed"      // Data: the speed, a float64
+	EventPlayOrderChanged = "play_order_changed" // Repeat mode or shuffle changed
+	EventQueueChanged     = "queue_changed"      // Tracks were added, removed, or cleared
+	EventError            = "error"              // Data: the error; playback has stopped
+)
+
+// eventBuffer is the number of events an Engine holds for a slow subscriber
+// before dropping new ones.
+const eventBuffer = 64
+
+// ErrQueueEmpty is returned when playback is asked for with nothing queued.
+var ErrQueueEmpty = errors.New("queue is empty")
+
+// Backend is the audio output an Engine plays through. The AudioPlayer is the
+// real implementation; tests substitute a fake so playback logic can run
+// without an audio device.
+type Backend interface {
+	// Open opens track, ready to play from pos, leaving playback alone. It may
+	// take a while, so the engine calls it without holding its lock.
+	Open(track *util.AudioFile, pos time.Duration) (OpenedTrack, error)
+	// StartOpened replaces the current track with opened, and returns a
+	// channel closed when it finishes or is stopped. If paused is set the
+	// track waits for Resume.
+	StartOpened(opened OpenedTrack, paused bool) (<-chan struct{}, error)
+	// PreloadOpened has opened play straight after the current one,
+	// replacing any track preloaded before, and returns a channel closed when
+	// it finishes or is stopped. The current track's channel is closed at the
+	// moment the preloaded track takes over.
+	PreloadOpened(opened OpenedTrack) (<-chan struct{}, error)
+	// CancelPreload drops the preloaded track, if any.
+	CancelPreload()
+	Pause()
+	Resume()
+	// Stop ends playback, closing the channels of the current and preloaded
+	// tracks.
+	Stop()
+	SeekTo(pos time.Duration) error
+	// SetLoop loops the current track between start and end until it is
+	// replaced. A zero end clears the loop.
+	SetLoop(start, end time.Duration) error
+	SetVolume(percent float64)
+	// SetSpeed changes the playback speed, 1 being normal.
+	SetSpeed(speed float64)
+	// SetShuffled tells the backend whether the queue is shuffled.
+	SetShuffled(on bool)
+	// State returns the track the backend is playing and its progress.
+	State() PlayerState
+}
+
+var _ Backend = (*AudioPlayer)(nil)
+
+// OpenedTrack is a track a Backend has opened, to be played by it. One that
+// won't be played must be closed.
+type OpenedTrack interface {
+	Track() *util.AudioFile
+	Close()
+}
+
+// Engine is a headless player. It owns the audio backend, the queue and the
+// repeat, shuffle and volume settings, and advances through the queue as
+// tracks end. The track that follows is preloaded into the backend, so
+// consecutive tracks play without a gap. Front-ends drive it through
+// PlayerController and follow it through Events; all methods are safe for
+// concurrent use.
+type Engine struct {
+	mu         sync.Mutex
+	backend    Backend
+	queue      *Queue
+	nowPlaying *util.AudioFile // Track playing or paused; nil when stopped
+	done       <-chan struct{} // Closed when nowPlaying ends
+	opening    bool            // Whether nowPlaying is still being opened, in which case done is nil
+	openPos    time.Duration   // Where nowPlaying starts once it is open
+	next       *util.AudioFile // Track preloaded to follow nowPlaying; may be nil
+	nextDone   <-chan struct{} // Closed when next ends
+	preloading *util.AudioFile // Track being opened to be preloaded; may be nil
+	state      PlaybackState
+	volume     float64 // Volume set by the user, kept while muted
+	muted      bool
+	autoPlay   bool   // Whether Enqueue starts an idle engine
+	gen        uint64 // Incremented for every track started, so the end of a replaced track is ignored
+	events     chan Event
+	bookmarks  *Bookmarks // Where long tracks were left; may be nil
+}
+
+var _ PlayerController = (*Engine)(nil)
+
+// NewEngine returns a stopped engine with an empty queue playing through backend.
+func NewEngine(backend Backend) *Engine {
+	e := &Engine{
+		backend:  backend,
+		queue:    NewQueue(),
+		volume:   50,
+		autoPlay: true,
+		events:   make(chan Event, eventBuffer),
+	}
+	backend.SetVolume(e.volume)
+	return e
+}
+
+// SetBookmarks sets where the positions long tracks are left at are
+// remembered, for them to resume there. Nil plays every track from the start.
+func (e *Engine) SetBookmarks(b *Bookmarks) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bookmarks = b
+}
+
+// Events returns the channel the engine's events are sent on. Events are
+// dropped while the channel is full, so a subscriber that falls behind should
+// catch up with GetPlaybackInfo.
+func (e *Engine) Events() <-chan Event {
+	return e.events
+}
+
+// emit sends an event without blocking. It must be called with e.mu held.
+func (e *Engine) emit(typ, message string, data interface{}) {
+	select {
+	case e.events <- Event{Type: typ, Message: message, Time: time.Now(), Data: data}:
+	default:
+	}
+}
+
+// start plays track from pos, replacing whatever is playing. A track started
+// from the beginning resumes where it was left instead, if that was
+// remembered. The track is opened on a goroutine of its own, as decoders may
+// scan the whole file first; until then the engine reports it as playing, or
+// paused, at pos, while the track it replaces plays on. If the track can't be
+// played, playback stops and the error is emitted. It must be called with
+// e.mu held.
+func (e *Engine) start(track *util.AudioFile, pos time.Duration, paused bool) {
+	e.leave()
+	if pos == 0 {
+		pos = e.bookmarks.ResumePosition(track)
+	}
+	e.gen++
+	gen := e.gen
+	e.backend.CancelPreload() // The track playing mustn't move on meanwhile.
+	e.nowPlaying, e.done = track, nil
+	e.opening, e.openPos = true, pos
+	e.next, e.nextDone, e.preloading = nil, nil, nil
+	e.state = StatePlaying
+	if paused {
+		e.state = StatePaused
+	}
+	e.emit(EventTrackStarted, track.Title, track)
+	go func() {
+		opened, err := e.backend.Open(track, pos)
+		e.opened(gen, opened, pos, err)
+	}()
+}
+
+// opened plays the track started as generation gen once the backend has
+// opened it from pos, unless another track was started or playback stopped
+// meanwhile.
+func (e *Engine) opened(gen uint64, opened OpenedTrack, pos time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if gen != e.gen || e.state == StateStopped {
+		if err == nil {
+			opened.Close()
+		}
+		return
+	}
+	var done <-chan struct{}
+	if err == nil {
+		done, err = e.backend.StartOpened(opened, e.state == StatePaused)
+	}
+	if err != nil {
+		e.backend.Stop()
+		e.halt()
+		e.emit(EventError, err.Error(), err)
+		return
+	}
+	e.opening, e.done = false, done
+	if e.openPos != pos {
+		_ = e.backend.SeekTo(e.openPos) // Seeked while opening
+	}
+	e.watch(gen, done)
+	e.preloadNext()
+}
+
+// watch calls finished once the track started as generation gen is done.
+func (e *Engine) watch(gen uint64, done <-chan struct{}) {
+	go func() {
+		<-done
+		e.finished(gen)
+	}()
+}
+
+// leave remembers where the current track is left, for it to resume there
+// when it plays again. It must be called with e.mu held, before the backend
+// moves on from the track.
+func (e *Engine) leave() {
+	if e.state == StateStopped || e.opening || e.bookmarks == nil {
+		return
+	}
+	s := e.backend.State()
+	if s.Track != e.nowPlaying {
+		// The backend has moved on already: the track played to the end.
+		e.bookmarks.ForgetPosition(e.nowPlaying)
+		return
+	}
+	e.bookmarks.RememberPosition(e.nowPlaying, s.PlayedTime, s.TotalTime)
+}
+
+// preloadNext has the backend open the track that follows the current one so
+// it plays without a gap. The track is opened on a goroutine of its own, like
+// those started. A track that resumes where it was left isn't preloaded, as it
+// is started afresh once the current one ends. It must be called with e.mu
+// held whenever the track that follows may have changed.
+func (e *Engine) preloadNext() {
+	if e.state == StateStopped || e.opening {
+		return
+	}
+	next := e.queue.PeekNext()
+	if e.bookmarks.ResumePosition(next) > 0 {
+		next = nil
+	}
+	if next != nil && (next == e.next || next == e.preloading) {
+		return
+	}
+	e.next, e.nextDone, e.preloading = nil, nil, next
+	e.backend.CancelPreload()
+	if next == nil {
+		return
+	}
+	gen := e.gen
+	go func() {
+		opened, err := e.backend.Open(next, 0)
+		e.preloaded(gen, next, opened, err)
+	}()
+}
+
+// preloaded has the backend preload track, opened by preloadNext while the
+// track of generation gen played, unless another track is to follow it by
+// now, or the track playing has changed.
+func (e *Engine) preloaded(gen uint64, track *util.AudioFile, opened OpenedTrack, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	current := gen == e.gen && track == e.preloading
+	if err != nil {
+		// Try again when the current track ends, which reports the error.
+		if current {
+			e.preloading = nil
+		}
+		return
+	}
+	if !current || e.state == StateStopped {
+		opened.Close()
+		return
+	}
+	e.preloading = nil
+	done, err := e.backend.PreloadOpened(opened)
+	if err != nil {
+		return // The current track ended meanwhile; the next one is started afresh.
+	}
+	e.next, e.nextDone = track, done
+}
+
+// advance follows the backend on to the preloaded track, which has taken
+// over from the one that ended. It must be called with e.mu held.
+func (e *Engine) advance() {
+	e.bookmarks.ForgetPosition(e.nowPlaying)
+	e.queue.GetNext()
+	e.gen++
+	e.nowPlaying, e.done = e.next, e.nextDone
+	e.next, e.nextDone, e.preloading = nil, nil, nil
+	e.emit(EventTrackStarted, e.nowPlaying.Title, e.nowPlaying)
+	e.watch(e.gen, e.done)
+	e.preloadNext()
+}
+
+// finished is called when the track started as generation gen ends, and moves
+// on to the next one in the queue.
+func (e *Engine) finished(gen uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if gen != e.gen || e.state == StateStopped {
+		return // Stopped, or replaced by another track.
+	}
+	if e.next != nil {
+		e.advance()
+		return
+	}
+	e.bookmarks.ForgetPosition(e.nowPlaying)
+	next := e.queue.GetNext()
+	if next == nil {
+		e.halt()
+		e.emit(EventStopped, "end of queue", nil)
+		return
+	}
+	e.start(next, 0, false)
+}
+
+// halt resets the playback state after the backend has stopped. It must be
+// called with e.mu held.
+func (e *Engine) halt() {
+	e.gen++
+	e.nowPlaying, e.done = nil, nil
+	e.opening = false
+	e.next, e.nextDone, e.preloading = nil, nil, nil
+	e.state = StateStopped
+}
+
+// catchUp advances to the preloaded track if the backend has switched to it
+// already, which it does on the exact sample the current track ends, before
+// finished hears of it. It reports whether it advanced, and must be called
+// with e.mu held.
+func (e *Engine) catchUp() bool {
+	if e.next == nil {
+		return false
+	}
+	select {
+	case <-e.done:
+		e.advance()
+		return true
+	default:
+		return false
+	}
+}
+
+// Play resumes a paused track, or starts the queue's current track if
+// nothing is playing.
+func (e *Engine) Play() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch e.state {
+	case StatePlaying:
+		return nil
+	case StatePaused:
+		e.resume()
+		return nil
+	}
+	if e.queue.Current() == nil {
+		e.queue.Next() // The current track was removed: play the one after it
+	}
+	track := e.queue.Current()
+	if track == nil {
+		return ErrQueueEmpty
+	}
+	e.start(track, 0, false)
+	return nil
+}
+
+// resume continues a paused track. It must be called with e.mu held.
+func (e *Engine) resume() {
+	e.backend.Resume()
+	e.state = StatePlaying
+	e.emit(EventResumed, e.nowPlaying.Title, e.nowPlaying)
+}
+
+// Pause pauses the playing track. It does nothing if no track is playing.
+func (e *Engine) Pause() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state != StatePlaying {
+		return nil
+	}
+	e.backend.Pause()
+	e.state = StatePaused
+	e.emit(EventPaused, e.nowPlaying.Title, e.nowPlaying)
+	return nil
+}
+
+// TogglePause pauses the playing track, or plays as for Play otherwise.
+func (e *Engine) TogglePause() error {
+	e.mu.Lock()
+	playing := e.state == StatePlaying
+	e.mu.Unlock()
+
+	if playing {
+		return e.Pause()
+	}
+	return e.Play()
+}
+
+// Stop ends playback. The queue keeps its current track.
+func (e *Engine) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state == StateStopped {
+		return nil
+	}
+	e.leave()
+	e.backend.Stop()
+	e.halt()
+	e.emit(EventStopped, "stopped", nil)
+	return nil
+}
+
+// Next moves to the next track in the queue, playing it if a track was
+// playing or paused. At the end of the queue it does nothing.
+func (e *Engine) Next() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.queue.Next() {
+		return nil
+	}
+	e.playCurrentIfActive()
+	return nil
+}
+
+// Previous moves to the previous track in the queue, playing it if a track
+// was playing or paused. At the start of the queue it does nothing.
+func (e *Engine) Previous() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.queue.Previous() {
+		return nil
+	}
+	e.playCurrentIfActive()
+	return nil
+}
+
+// playCurrentIfActive switches playback to the queue's current track unless
+// playback is stopped. It must be called with e.mu held.
+func (e *Engine) playCurrentIfActive() {
+	if e.state == StateStopped {
+		e.emit(EventQueueChanged, "", nil)
+		return
+	}
+	e.start(e.queue.Current(), 0, false)
+}
+
+// PlayIndex makes the queue's track at index the current one and plays it.
+func (e *Engine) PlayIndex(index int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if index < 0 || index >= e.queue.Length() {
+		return ErrTrackNotFound
+	}
+	e.queue.Jump(index)
+	e.start(e.queue.Current(), 0, false)
+	return nil
+}
+
+// Cue loads the queue's current track paused at pos, ready to be resumed
+// with Play.
+func (e *Engine) Cue(pos time.Duration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	track := e.queue.Current()
+	if track == nil {
+		return ErrQueueEmpty
+	}
+	e.start(track, pos, true)
+	return nil
+}
+
+// Seek moves the playing or paused track to pos, clamped to the track.
+func (e *Engine) Seek(pos time.Duration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state == StateStopped {
+		return ErrInvalidState
+	}
+	if e.opening {
+		// The track starts there once it is open.
+		if total := e.nowPlaying.Duration; total > 0 {
+			pos = min(pos, total)
+		}
+		e.openPos = max(0, pos)
+		e.emit(EventSeeked, "", e.openPos)
+		return nil
+	}
+	e.catchUp()
+	if total := e.backend.State().TotalTime; total > 0 {
+		pos = min(pos, total)
+	}
+	pos = max(0, pos)
+	if err := e.backend.SeekTo(pos); err != nil {
+		return err
+	}
+	e.emit(EventSeeked, "", pos)
+	return nil
+}
+
+// SetLoop loops the playing or paused track between start and end, seamlessly,
+// until the track changes. If the track is past end it jumps back to start.
+func (e *Engine) SetLoop(start, end time.Duration) error {
+	if end <= start {
+		return ErrInvalidLoop
+	}
+	return e.setLoop(start, end, "loop set")
+}
+
+// ClearLoop stops looping the current track, which plays on from where it is.
+func (e *Engine) ClearLoop() error {
+	return e.setLoop(0, 0, "loop cleared")
+}
+
+func (e *Engine) setLoop(start, end time.Duration, message string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state == StateStopped || e.opening {
+		return ErrInvalidState
+	}
+	e.catchUp()
+	if err := e.backend.SetLoop(start, end); err != nil {
+		return err
+	}
+	e.emit(EventLoopChanged, message, nil)
+	return nil
+}
+
+// SetVolume sets the volume as a percentage (0-100) and unmutes.
+func (e *Engine) SetVolume(vol float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.volume = max(minVolume, min(vol, maxVolume))
+	e.muted = false
+	e.backend.SetVolume(e.volume)
+	e.emit(EventVolumeChanged, "", e.volume)
+	return nil
+}
+
+// SetSpeed sets the playback speed, 1 being normal. The backend decides
+// whether it applies to the current track only; see AudioPlayer.SetSpeed.
+func (e *Engine) SetSpeed(speed float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.backend.SetSpeed(speed)
+	e.emit(EventSpeedChanged, "", e.backend.State().Speed)
+	return nil
+}
+
+// ToggleMute silences the output, or restores the volume from before muting.
+func (e *Engine) ToggleMute() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.muted = !e.muted
+	if e.muted {
+		e.backend.SetVolume(minVolume)
+		e.emit(EventVolumeChanged, "muted", minVolume)
+	} else {
+		e.backend.SetVolume(e.volume)
+		e.emit(EventVolumeChanged, "", e.volume)
+	}
+	return nil
+}
+
+// ToggleRepeat cycles the repeat mode.
+func (e *Engine) ToggleRepeat() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.Repeat = e.queue.Repeat.Next()
+	e.emit(EventPlayOrderChanged, "repeat "+e.queue.Repeat.String(), nil)
+	e.preloadNext()
+	return nil
+}
+
+// ToggleShuffle turns shuffled playback of the queue on or off.
+func (e *Engine) ToggleShuffle() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.SetShuffle(!e.queue.Shuffled())
+	e.backend.SetShuffled(e.queue.Shuffled())
+	e.emit(EventPlayOrderChanged, "", nil)
+	e.preloadNext()
+	return nil
+}
+
+// SetRepeat sets the repeat mode.
+func (e *Engine) SetRepeat(mode RepeatMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.Repeat = mode
+	e.emit(EventPlayOrderChanged, "repeat "+mode.String(), nil)
+	e.preloadNext()
+}
+
+// SetShuffle turns shuffled playback of the queue on or off.
+func (e *Engine) SetShuffle(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.SetShuffle(on)
+	e.backend.SetShuffled(on)
+	e.emit(EventPlayOrderChanged, "", nil)
+	e.preloadNext()
+}
+
+// SetAutoPlay sets whether Enqueue starts playback when nothing is playing.
+func (e *Engine) SetAutoPlay(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.autoPlay = on
+}
+
+// GetPlaybackInfo returns a snapshot of the playback state.
+func (e *Engine) GetPlaybackInfo() (*PlaybackInfo, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	played := e.backend.State()
+	if e.state != StateStopped && e.catchUp() {
+		played = e.backend.State()
+	}
+	info := &PlaybackInfo{
+		CurrentTrack:  e.nowPlaying,
+		State:         e.state,
+		Volume:        e.volume,
+		IsMuted:       e.muted,
+		Speed:         played.Speed,
+		RepeatMode:    e.queue.Repeat,
+		IsShuffled:    e.queue.Shuffled(),
+		QueuePosition: e.queue.CurrentIndex,
+		QueueLength:   e.queue.Length(),
+	}
+	if e.opening {
+		info.CurrentTime, info.Duration = e.openPos, e.nowPlaying.Duration
+	} else if e.state != StateStopped {
+		info.CurrentTime = played.PlayedTime
+		info.Duration = played.TotalTime
+		info.LoopStart, info.LoopEnd = played.LoopStart, played.LoopEnd
+		if info.Duration == 0 {
+			info.Duration = e.nowPlaying.Duration // The backend may not know it
+		}
+	}
+	return info, nil
+}
+
+// Enqueue adds tracks to the end of the queue. If auto-play is on and
+// nothing is playing, the first of them starts playing.
+func (e *Engine) Enqueue(tracks ...*util.AudioFile) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(tracks) == 0 {
+		return
+	}
+	first := e.queue.Length()
+	for _, track := range tracks {
+		e.queue.Add(track)
+	}
+	e.emit(EventQueueChanged, "", nil)
+	if e.state == StateStopped && e.autoPlay {
+		e.queue.Jump(first)
+		e.start(e.queue.Current(), 0, false)
+		return
+	}
+	e.preloadNext()
+}
+
+// PlayNow adds track to the end of the queue and plays it straight away.
+func (e *Engine) PlayNow(track *util.AudioFile) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.Add(track)
+	e.queue.Jump(e.queue.Length() - 1)
+	e.emit(EventQueueChanged, "", nil)
+	e.start(track, 0, false)
+}
+
+// LoadQueue replaces the queue with tracks, current being the index of the
+// current one, without starting playback.
+func (e *Engine) LoadQueue(tracks []*util.AudioFile, current int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.Clear()
+	for _, track := range tracks {
+		e.queue.Add(track)
+	}
+	e.queue.Jump(current)
+	e.emit(EventQueueChanged, "", nil)
+	e.preloadNext()
+}
+
+// RemoveFromQueue removes the queue's track at index. Playback carries on.
+func (e *Engine) RemoveFromQueue(index int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if index < 0 || index >= e.queue.Length() {
+		return ErrTrackNotFound
+	}
+	e.queue.Remove(index)
+	e.emit(EventQueueChanged, "", nil)
+	e.preloadNext()
+	return nil
+}
+
+// ClearQueue removes every track from the queue. Playback carries on.
+func (e *Engine) ClearQueue() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queue.Clear()
+	e.emit(EventQueueChanged, "", nil)
+	e.preloadNext()
+}
+
+// Queue returns a copy of the queued tracks and the index of the current one.
+func (e *Engine) Queue() ([]*util.AudioFile, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*util.AudioFile(nil), e.queue.Tracks...), e.queue.CurrentIndex
+}
@@ -0,0 +1,630 @@
+package components
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+// fakeBackend plays tracks without an audio device. Each track plays until
+// the test finishes it or the engine stops it; a preloaded track then takes
+// over as the real backend would.
+type fakeBackend struct {
+	started chan string // Title of every track started, including preloaded ones taking over
+
+	mu         sync.Mutex
+	track      *util.AudioFile
+	done       chan struct{}   // Closed to end the current track
+	queued     *util.AudioFile // Preloaded track
+	queuedDone chan struct{}
+	pos        time.Duration // Start position of the last track
+	paused     bool
+	volume     float64
+	speed      float64
+	loop       [2]time.Duration // Start and end of the A-B loop
+	openGate   chan struct{}    // If set, Open waits for it to be closed
+	closed     []string         // Titles of tracks opened but closed unplayed
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{started: make(chan string, 16), speed: 1}
+}
+
+// fakeTrack is a track opened by fakeBackend.
+type fakeTrack struct {
+	backend *fakeBackend
+	track   *util.AudioFile
+	pos     time.Duration
+}
+
+func (t *fakeTrack) Track() *util.AudioFile { return t.track }
+
+func (t *fakeTrack) Close() {
+	t.backend.mu.Lock()
+	defer t.backend.mu.Unlock()
+	t.backend.closed = append(t.backend.closed, t.track.Title)
+}
+
+func (f *fakeBackend) Open(track *util.AudioFile, pos time.Duration) (OpenedTrack, error) {
+	f.mu.Lock()
+	gate := f.openGate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	return &fakeTrack{f, track, pos}, nil
+}
+
+func (f *fakeBackend) StartOpened(opened OpenedTrack, paused bool) (<-chan struct{}, error) {
+	t := opened.(*fakeTrack)
+	f.Stop()
+	done := make(chan struct{})
+	f.mu.Lock()
+	f.track, f.done, f.pos, f.paused = t.track, done, t.pos, paused
+	f.mu.Unlock()
+
+	f.started <- t.track.Title
+	return done, nil
+}
+
+func (f *fakeBackend) PreloadOpened(opened OpenedTrack) (<-chan struct{}, error) {
+	f.CancelPreload()
+	done := make(chan struct{})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.track == nil {
+		return nil, ErrNotPlaying // The current track ended before the engine caught up.
+	}
+	f.queued, f.queuedDone = opened.Track(), done
+	return done, nil
+}
+
+func (f *fakeBackend) CancelPreload() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.queuedDone != nil {
+		close(f.queuedDone)
+	}
+	f.queued, f.queuedDone = nil, nil
+}
+
+// finish ends the current track as if it had played to the end, moving on to
+// the preloaded track if there is one.
+func (f *fakeBackend) finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.done)
+	f.track, f.done = f.queued, f.queuedDone
+	f.queued, f.queuedDone = nil, nil
+	f.pos = 0
+	if f.track != nil {
+		f.started <- f.track.Title
+	}
+}
+
+func (f *fakeBackend) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, done := range []chan struct{}{f.done, f.queuedDone} {
+		if done != nil {
+			close(done)
+		}
+	}
+	f.track, f.done, f.queued, f.queuedDone = nil, nil, nil, nil
+}
+
+func (f *fakeBackend) Pause()  { f.mu.Lock(); f.paused = true; f.mu.Unlock() }
+func (f *fakeBackend) Resume() { f.mu.Lock(); f.paused = false; f.mu.Unlock() }
+
+func (f *fakeBackend) SeekTo(pos time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pos = pos
+	return nil
+}
+
+func (f *fakeBackend) SetLoop(start, end time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loop = [2]time.Duration{start, end}
+	return nil
+}
+
+func (f *fakeBackend) SetVolume(percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.volume = percent
+}
+
+func (f *fakeBackend) SetSpeed(speed float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.speed = speed
+}
+
+func (f *fakeBackend) SetShuffled(bool) {}
+
+func (f *fakeBackend) State() PlayerState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return PlayerState{Track: f.track, Paused: f.paused, PlayedTime: f.pos, TotalTime: time.Minute, Volume: f.volume, Speed: f.speed,
+		LoopStart: f.loop[0], LoopEnd: f.loop[1]}
+}
+
+// preloaded returns the title of the preloaded track, or "" if there is none.
+func (f *fakeBackend) preloaded() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.queued == nil {
+		return ""
+	}
+	return f.queued.Title
+}
+
+// waitForPreload waits for the backend to have the track titled title
+// preloaded, as the engine opens it on a goroutine of its own, and returns
+// the title of the track preloaded by then.
+func (f *fakeBackend) waitForPreload(title string) string {
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := f.preloaded()
+		if got == title || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// state returns the position, pause state and volume the engine last set.
+func (f *fakeBackend) state() (pos time.Duration, paused bool, volume float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pos, f.paused, f.volume
+}
+
+// next waits for the backend to start a track and returns its title.
+func (f *fakeBackend) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case title := <-f.started:
+		return title
+	case <-time.After(time.Second):
+		t.Fatal("no track started")
+		return ""
+	}
+}
+
+// newTestEngine returns an engine with the given tracks queued and auto-play off.
+func newTestEngine(repeat RepeatMode, titles ...string) (*Engine, *fakeBackend) {
+	backend := newFakeBackend()
+	e := NewEngine(backend)
+	e.SetAutoPlay(false)
+	e.SetRepeat(repeat)
+	for _, title := range titles {
+		e.Enqueue(&util.AudioFile{Title: title, Path: "/music/" + title})
+	}
+	return e, backend
+}
+
+// waitForState waits for the engine to reach state, as it advances on its own goroutine.
+func waitForState(t *testing.T, e *Engine, state PlaybackState) *PlaybackInfo {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		info, _ := e.GetPlaybackInfo()
+		if info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %v, want %v", info.State, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEngineRepeatModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		repeat RepeatMode
+		want   []string
+	}{
+		{"off stops at end", RepeatOff, []string{"A", "B", "C"}},
+		{"one replays track", RepeatOne, []string{"A", "A", "A", "A"}},
+		{"all wraps around", RepeatAll, []string{"A", "B", "C", "A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, backend := newTestEngine(tt.repeat, "A", "B", "C")
+			if err := e.Play(); err != nil {
+				t.Fatalf("Play: %v", err)
+			}
+			for i, want := range tt.want {
+				if got := backend.next(t); got != want {
+					t.Fatalf("track %d = %q, want %q", i, got, want)
+				}
+				backend.finish()
+			}
+			if tt.repeat == RepeatOff {
+				if info := waitForState(t, e, StateStopped); info.CurrentTrack != nil {
+					t.Errorf("CurrentTrack = %v after the queue ended, want nil", info.CurrentTrack)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineEnqueueAutoPlay(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff)
+	e.Enqueue(&util.AudioFile{Title: "A"})
+	if info, _ := e.GetPlaybackInfo(); info.State != StateStopped {
+		t.Fatalf("enqueueing with auto-play off started playback")
+	}
+
+	e.SetAutoPlay(true)
+	e.Enqueue(&util.AudioFile{Title: "B"}, &util.AudioFile{Title: "C"})
+	if got := backend.next(t); got != "B" {
+		t.Errorf("auto-play started %q, want the first added track", got)
+	}
+
+	// While a track is playing, adding another only queues it.
+	e.Enqueue(&util.AudioFile{Title: "D"})
+	if info, _ := e.GetPlaybackInfo(); info.CurrentTrack.Title != "B" || info.QueueLength != 4 {
+		t.Errorf("playing %q with %d queued, want B with 4", info.CurrentTrack.Title, info.QueueLength)
+	}
+}
+
+func TestEnginePauseResumeStop(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B")
+	if err := e.Pause(); err != nil {
+		t.Errorf("Pause while stopped: %v", err)
+	}
+	_ = e.Play()
+	backend.next(t)
+
+	_ = e.TogglePause()
+	info := waitForState(t, e, StatePaused)
+	if _, paused, _ := backend.state(); info.CurrentTrack.Title != "A" || !paused {
+		t.Errorf("paused on %v, backend paused %v", info.CurrentTrack, paused)
+	}
+	_ = e.TogglePause()
+	waitForState(t, e, StatePlaying)
+
+	_ = e.Stop()
+	waitForState(t, e, StateStopped)
+	select {
+	case title := <-backend.started:
+		t.Errorf("stopping started %q", title)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := e.Seek(time.Second); err != ErrInvalidState {
+		t.Errorf("Seek while stopped = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestEngineNextReplacesPlayingTrack(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B", "C")
+
+	// While stopped, Next only moves through the queue.
+	_ = e.Next()
+	if info, _ := e.GetPlaybackInfo(); info.State != StateStopped || info.QueuePosition != 1 {
+		t.Fatalf("Next while stopped: state %v at %d", info.State, info.QueuePosition)
+	}
+
+	_ = e.Play()
+	if got := backend.next(t); got != "B" {
+		t.Fatalf("Play started %q, want B", got)
+	}
+	_ = e.Next()
+	if got := backend.next(t); got != "C" {
+		t.Fatalf("Next started %q, want C", got)
+	}
+	// The replaced track ending must not advance the queue again.
+	backend.finish()
+	waitForState(t, e, StateStopped)
+	select {
+	case title := <-backend.started:
+		t.Errorf("queue advanced to %q after the last track", title)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestEngineCue(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B")
+	e.LoadQueue([]*util.AudioFile{{Title: "X"}, {Title: "Y"}}, 1)
+	if err := e.Cue(90 * time.Second); err != nil {
+		t.Fatalf("Cue: %v", err)
+	}
+	got := backend.next(t)
+	if pos, paused, _ := backend.state(); got != "Y" || pos != 90*time.Second || !paused {
+		t.Errorf("cued %q at %v (paused %v), want Y paused at 1m30s", got, pos, paused)
+	}
+	if info := waitForState(t, e, StatePaused); info.QueueLength != 2 {
+		t.Errorf("queue has %d tracks, want the loaded 2", info.QueueLength)
+	}
+	_ = e.Play()
+	waitForState(t, e, StatePlaying)
+}
+
+func TestEngineSeekAndLoop(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A")
+	if err := e.SetLoop(time.Second, 2*time.Second); err != ErrInvalidState {
+		t.Errorf("SetLoop while stopped = %v, want ErrInvalidState", err)
+	}
+	_ = e.Play()
+	backend.next(t)
+
+	// Seeking works while paused, and is clamped to the track.
+	_ = e.Pause()
+	if err := e.Seek(90 * time.Second); err != nil {
+		t.Fatalf("Seek while paused: %v", err)
+	}
+	if pos, paused, _ := backend.state(); pos != time.Minute || !paused {
+		t.Errorf("seeking past the end while paused moved to %v (paused %v), want 1m0s paused", pos, paused)
+	}
+
+	if err := e.SetLoop(20*time.Second, 10*time.Second); err != ErrInvalidLoop {
+		t.Errorf("SetLoop ending before it starts = %v, want ErrInvalidLoop", err)
+	}
+	if err := e.SetLoop(10*time.Second, 20*time.Second); err != nil {
+		t.Fatalf("SetLoop: %v", err)
+	}
+	if info, _ := e.GetPlaybackInfo(); info.LoopStart != 10*time.Second || info.LoopEnd != 20*time.Second {
+		t.Errorf("loop = %v-%v, want 10s-20s", info.LoopStart, info.LoopEnd)
+	}
+	_ = e.ClearLoop()
+	if info, _ := e.GetPlaybackInfo(); info.LoopEnd != 0 {
+		t.Errorf("loop still ends at %v after ClearLoop", info.LoopEnd)
+	}
+}
+
+func TestEngineVolumeAndMute(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff)
+	_ = e.SetVolume(150)
+	if info, _ := e.GetPlaybackInfo(); info.Volume != 100 {
+		t.Errorf("Volume = %v, want it clamped to 100", info.Volume)
+	}
+	_ = e.SetVolume(40)
+
+	_ = e.ToggleMute()
+	info, _ := e.GetPlaybackInfo()
+	if _, _, output := backend.state(); !info.IsMuted || info.Volume != 40 || output != 0 {
+		t.Errorf("muted: IsMuted %v, Volume %v, output %v; want true, 40, 0", info.IsMuted, info.Volume, output)
+	}
+	_ = e.ToggleMute()
+	info, _ = e.GetPlaybackInfo()
+	if _, _, output := backend.state(); info.IsMuted || output != 40 {
+		t.Errorf("unmuted: IsMuted %v, output %v; want false, 40", info.IsMuted, output)
+	}
+}
+
+func TestEngineEvents(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A")
+	for len(e.Events()) > 0 {
+		<-e.Events() // Drop the events of the setup.
+	}
+
+	_ = e.Play()
+	backend.next(t)
+	_ = e.ToggleRepeat()
+	backend.finish() // Repeat all wraps around to A again.
+	backend.next(t)
+	waitForState(t, e, StatePlaying)
+
+	var got []string
+	for len(e.Events()) > 0 {
+		got = append(got, (<-e.Events()).Type)
+	}
+	want := []string{EventTrackStarted, EventPlayOrderChanged, EventTrackStarted}
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEnginePreloadsNext(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B", "C")
+	_ = e.Play()
+	backend.next(t)
+	if got := backend.waitForPreload("B"); got != "B" {
+		t.Fatalf("preloaded %q while playing A, want B", got)
+	}
+
+	// Changing what follows the current track replaces the preloaded one.
+	_ = e.ToggleRepeat() // all
+	_ = e.ToggleRepeat() // one
+	if got := backend.waitForPreload("A"); got != "A" {
+		t.Errorf("preloaded %q when repeating A, want A", got)
+	}
+	e.SetRepeat(RepeatOff)
+	_ = e.RemoveFromQueue(1)
+	if got := backend.waitForPreload("C"); got != "C" {
+		t.Errorf("preloaded %q after removing B, want C", got)
+	}
+
+	// The preloaded track takes over without waiting for the engine, and the
+	// engine reports it straight away.
+	backend.finish()
+	info, _ := e.GetPlaybackInfo()
+	if info.CurrentTrack == nil || info.CurrentTrack.Title != "C" || info.QueuePosition != 1 {
+		t.Fatalf("playing %v at %d after A ended, want C at 1", info.CurrentTrack, info.QueuePosition)
+	}
+	if got := backend.next(t); got != "C" {
+		t.Errorf("backend moved on to %q, want C", got)
+	}
+	if got := backend.preloaded(); got != "" {
+		t.Errorf("preloaded %q at the end of the queue, want nothing", got)
+	}
+	backend.finish()
+	waitForState(t, e, StateStopped)
+}
+
+func TestEngineResumesLongTracks(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B")
+	bookmarks := NewBookmarks("")
+	bookmarks.SetResumeThreshold(30 * time.Second) // The fake backend's tracks last a minute
+	e.SetBookmarks(bookmarks)
+	tracks, _ := e.Queue()
+	_ = e.Play()
+	backend.next(t)
+
+	// Leaving A remembers where it was left, and B isn't preloaded once it has
+	// a position to resume at.
+	_ = e.Seek(20 * time.Second)
+	_ = e.Next()
+	backend.next(t)
+	_ = e.Seek(30 * time.Second)
+	_ = e.Previous()
+	if got := backend.next(t); got != "A" {
+		t.Fatalf("started %q, want A", got)
+	}
+	if pos, _, _ := backend.state(); pos != 20*time.Second {
+		t.Errorf("A resumed at %v, want 20s", pos)
+	}
+	if got := backend.preloaded(); got != "" {
+		t.Errorf("preloaded %q, want nothing as B resumes", got)
+	}
+
+	// B resumes once A plays to the end, and A starts afresh next time.
+	backend.finish()
+	if got := backend.next(t); got != "B" {
+		t.Fatalf("started %q after A ended, want B", got)
+	}
+	if pos, _, _ := backend.state(); pos != 30*time.Second {
+		t.Errorf("B resumed at %v, want 30s", pos)
+	}
+	if pos := bookmarks.ResumePosition(tracks[0]); pos != 0 {
+		t.Errorf("A resumes at %v after playing to the end, want the start", pos)
+	}
+
+	// Stopping remembers the position too.
+	_ = e.Seek(45 * time.Second)
+	_ = e.Stop()
+	if pos := bookmarks.ResumePosition(tracks[1]); pos != 45*time.Second {
+		t.Errorf("B resumes at %v after stopping, want 45s", pos)
+	}
+}
+
+func TestEngineOpensTracksWithoutBlocking(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B")
+	gate := make(chan struct{})
+	backend.mu.Lock()
+	backend.openGate = gate
+	backend.mu.Unlock()
+
+	// Neither track can be opened yet, but the engine carries on meanwhile.
+	if err := e.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	if err := e.Next(); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	info, _ := e.GetPlaybackInfo()
+	if info.CurrentTrack == nil || info.CurrentTrack.Title != "B" || info.State != StatePlaying {
+		t.Fatalf("while opening, playing %v in state %v, want B playing", info.CurrentTrack, info.State)
+	}
+	if err := e.Seek(10 * time.Second); err != nil {
+		t.Fatalf("Seek while opening: %v", err)
+	}
+	if info, _ := e.GetPlaybackInfo(); info.CurrentTime != 10*time.Second {
+		t.Errorf("position while opening = %v, want the one seeked to", info.CurrentTime)
+	}
+
+	close(gate)
+	if title := backend.next(t); title != "B" {
+		t.Fatalf("started %q, want B", title)
+	}
+	if pos, _, _ := backend.state(); pos != 10*time.Second {
+		t.Errorf("B started at %v, want where it was seeked to while opening", pos)
+	}
+	// A was replaced before it opened, so it is closed without playing.
+	deadline := time.Now().Add(time.Second)
+	for {
+		backend.mu.Lock()
+		closed := append([]string(nil), backend.closed...)
+		backend.mu.Unlock()
+		if len(closed) == 1 && closed[0] == "A" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("closed unplayed %v, want A", closed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEnginePreloadsWithoutBlocking(t *testing.T) {
+	e, backend := newTestEngine(RepeatOff, "A", "B", "C")
+	gate := make(chan struct{})
+	backend.mu.Lock()
+	backend.openGate = gate
+	backend.mu.Unlock()
+	_ = e.Play()
+	gate <- struct{}{} // Let A open, but not B after it
+	backend.next(t)
+
+	// B can't be opened yet, but the engine carries on, and once C follows A
+	// instead B is discarded when it opens.
+	if err := e.RemoveFromQueue(1); err != nil {
+		t.Fatalf("RemoveFromQueue while preloading: %v", err)
+	}
+	if got := backend.preloaded(); got != "" {
+		t.Errorf("preloaded %q before any track opened, want nothing", got)
+	}
+	close(gate)
+	if got := backend.waitForPreload("C"); got != "C" {
+		t.Fatalf("preloaded %q, want C", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		backend.mu.Lock()
+		closed := append([]string(nil), backend.closed...)
+		backend.mu.Unlock()
+		if len(closed) == 1 && closed[0] == "B" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("closed unplayed %v, want B", closed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEngineRemovesPlayingTrack(t *testing.T) {
+	for _, tt := range []struct {
+		repeat RepeatMode
+		want   string // Title of the track played after A; "" if playback stops
+	}{
+		{RepeatOff, "B"},
+		{RepeatAll, "B"},
+		{RepeatOne, ""},
+	} {
+		e, backend := newTestEngine(tt.repeat, "A", "B", "C")
+		_ = e.Play()
+		backend.next(t)
+
+		// A plays on, and the track that followed it plays once it ends.
+		if err := e.RemoveFromQueue(0); err != nil {
+			t.Fatalf("RemoveFromQueue: %v", err)
+		}
+		if tt.want != "" {
+			if got := backend.waitForPreload(tt.want); got != tt.want {
+				t.Errorf("repeat %v: preloaded %q after removing A, want %s", tt.repeat, got, tt.want)
+			}
+		}
+		backend.finish()
+		if tt.want == "" {
+			waitForState(t, e, StateStopped)
+			continue
+		}
+		if got := backend.next(t); got != tt.want {
+			t.Errorf("repeat %v: played %q after removing A, want %s", tt.repeat, got, tt.want)
+		}
+		_ = e.Stop()
+	}
+}
@@ -0,0 +1,219 @@
+package components
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+
+	"github.com/gopxl/beep"
+)
+
+// EQBands are the centre frequencies of the equalizer's bands in Hz, an
+// octave apart.
+var EQBands = [...]float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+const (
+	// MaxEQGain bounds the gain of each band and of the pre-amp, in dB, either way.
+	MaxEQGain = 12.0
+	// eqQ is the quality factor of the bands, giving each one an octave of
+	// bandwidth.
+	eqQ = math.Sqrt2
+)
+
+// EQGains are the gains of the bands in dB, in the order of EQBands.
+type EQGains [len(EQBands)]float64
+
+// EQSettings are the settings of the equalizer.
+type EQSettings struct {
+	Enabled bool    `json:"enabled"`
+	Preset  string  `json:"preset,omitempty"` // Preset the gains were loaded from; empty once changed by hand
+	PreAmp  float64 `json:"preamp"`           // dB, applied before the bands to leave headroom for boosts
+	Gains   EQGains `json:"gains"`
+}
+
+// clamped returns s with every gain within MaxEQGain.
+func (s EQSettings) clamped() EQSettings {
+	s.PreAmp = clampEQGain(s.PreAmp)
+	for i, g := range s.Gains {
+		s.Gains[i] = clampEQGain(g)
+	}
+	return s
+}
+
+func clampEQGain(db float64) float64 {
+	if math.IsNaN(db) {
+		return 0
+	}
+	return max(-MaxEQGain, min(db, MaxEQGain))
+}
+
+// flat reports whether the settings leave the sound unchanged.
+func (s EQSettings) flat() bool {
+	return s.PreAmp == 0 && s.Gains == EQGains{}
+}
+
+// EQPreset is a named set of gains.
+type EQPreset struct {
+	Name   string
+	PreAmp float64
+	Gains  EQGains
+}
+
+// Settings returns the settings that load the preset.
+func (p EQPreset) Settings(enabled bool) EQSettings {
+	return EQSettings{Enabled: enabled, Preset: p.Name, PreAmp: p.PreAmp, Gains: p.Gains}
+}
+
+// builtinEQPresets come with muxic. Presets that boost lower the pre-amp to
+// about the largest boost, so they don't clip.
+var builtinEQPresets = []EQPreset{
+	{Name: "flat"},
+	{Name: "bass-boost", PreAmp: -6, Gains: EQGains{6, 5, 4, 2, 0, 0, 0, 0, 0, 0}},
+	{Name: "treble-boost", PreAmp: -6, Gains: EQGains{0, 0, 0, 0, 0, 1, 2, 4, 5, 6}},
+	{Name: "vocal", PreAmp: -3, Gains: EQGains{-2, -2, -1, 0, 2, 3, 3, 2, 0, -1}},
+	{Name: "rock", PreAmp: -4, Gains: EQGains{4, 3, 2, 0, -1, -1, 1, 2, 3, 4}},
+	{Name: "pop", PreAmp: -3, Gains: EQGains{-1, 0, 2, 3, 3, 2, 0, -1, -1, -1}},
+	{Name: "jazz", PreAmp: -3, Gains: EQGains{3, 2, 1, 2, -1, -1, 0, 1, 2, 3}},
+	{Name: "classical", PreAmp: -3, Gains: EQGains{3, 2, 1, 0, 0, 0, -1, -1, 1, 3}},
+	{Name: "electronic", PreAmp: -5, Gains: EQGains{5, 4, 1, 0, -2, 2, 1, 1, 4, 5}},
+}
+
+// BuiltinEQPresets returns the presets that come with muxic.
+func BuiltinEQPresets() []EQPreset {
+	return append([]EQPreset(nil), builtinEQPresets...)
+}
+
+// FindEQPreset returns the preset called name.
+func FindEQPreset(presets []EQPreset, name string) (EQPreset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return EQPreset{}, false
+}
+
+// peaking is a peaking filter from the Audio EQ Cookbook, which boosts or
+// cuts around a centre frequency and leaves the rest of the spectrum alone.
+// Its coefficients are normalised so that a0 is 1.
+type peaking struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+func newPeaking(freq, gainDB, q float64, rate beep.SampleRate) peaking {
+	a := math.Pow(10, gainDB/40)
+	w0 := 2 * math.Pi * freq / float64(rate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha/a
+	return peaking{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+// process filters x, updating the filter state z (transposed direct form II).
+func (p *peaking) process(x float64, z *[2]float64) float64 {
+	y := p.b0*x + z[0]
+	z[0] = p.b1*x - p.a1*y + z[1]
+	z[1] = p.b2*x - p.a2*y
+	return y
+}
+
+// response returns the gain of the filter at freq, in dB.
+func (p peaking) response(freq float64, rate beep.SampleRate) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(rate))) // z^-1
+	num := complex(p.b0, 0) + complex(p.b1, 0)*z + complex(p.b2, 0)*z*z
+	den := 1 + complex(p.a1, 0)*z + complex(p.a2, 0)*z*z
+	return 20 * math.Log10(cmplx.Abs(num/den))
+}
+
+// Equalizer is a graphic equalizer: a pre-amp followed by a peaking filter
+// for each of EQBands. It streams from Streamer on the output's goroutine
+// with the output locked, and its settings are changed with the output
+// locked too, so a change always falls between two buffers. The filters
+// keep their state across changes, so adjusting a band doesn't click.
+type Equalizer struct {
+	Streamer beep.Streamer
+
+	lock sync.Locker // The output's lock
+	rate beep.SampleRate
+
+	// Guarded by lock.
+	settings EQSettings
+	active   bool // Whether the settings change the sound at all
+	preAmp   float64
+	filters  [len(EQBands)]peaking
+	state    [len(EQBands)][2][2]float64 // Filter state of each band and channel
+}
+
+// newEqualizer returns a disabled equalizer for a stream at rate, whose
+// settings are guarded by lock.
+func newEqualizer(lock sync.Locker, rate beep.SampleRate) *Equalizer {
+	return &Equalizer{lock: lock, rate: rate, preAmp: 1}
+}
+
+// Settings returns the current settings.
+func (e *Equalizer) Settings() EQSettings {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.settings
+}
+
+// Set changes the settings, clamping the gains to MaxEQGain. It takes effect
+// from the next buffer played.
+func (e *Equalizer) Set(s EQSettings) {
+	s = s.clamped()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	active := s.Enabled && !s.flat()
+	if active && !e.active {
+		e.state = [len(EQBands)][2][2]float64{} // Don't resume from stale samples.
+	}
+	e.settings, e.active = s, active
+	e.preAmp = math.Pow(10, s.PreAmp/20)
+	for i, freq := range EQBands {
+		e.filters[i] = newPeaking(freq, s.Gains[i], eqQ, e.rate)
+	}
+}
+
+// Response returns the gain of the equalizer at freq, in dB.
+func (e *Equalizer) Response(freq float64) float64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.active {
+		return 0
+	}
+	db := e.settings.PreAmp
+	for _, f := range e.filters {
+		db += f.response(freq, e.rate)
+	}
+	return db
+}
+
+// Stream streams from Streamer, equalized. The output must be locked.
+func (e *Equalizer) Stream(samples [][2]float64) (int, bool) {
+	n, ok := e.Streamer.Stream(samples)
+	if !e.active {
+		return n, ok
+	}
+	for i := range samples[:n] {
+		for c := range samples[i] {
+			x := samples[i][c] * e.preAmp
+			for b := range e.filters {
+				x = e.filters[b].process(x, &e.state[b][c])
+			}
+			samples[i][c] = x
+		}
+	}
+	return n, ok
+}
+
+// Err returns the error of Streamer.
+func (e *Equalizer) Err() error {
+	return e.Streamer.Err()
+}
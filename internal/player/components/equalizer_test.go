@@ -0,0 +1,111 @@
+package components
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/gopxl/beep"
+)
+
+func TestPeakingResponse(t *testing.T) {
+	const rate = OutputSampleRate
+	nyquist := float64(rate) / 2
+	for _, freq := range EQBands {
+		for _, gain := range []float64{-12, -4.5, 3, 12} {
+			p := newPeaking(freq, gain, eqQ, rate)
+			// The full gain at the centre, none at DC and Nyquist.
+			for _, c := range []struct{ freq, want float64 }{{freq, gain}, {0, 0}, {nyquist, 0}} {
+				if got := p.response(c.freq, rate); math.Abs(got-c.want) > 1e-6 {
+					t.Errorf("%g Hz %+g dB: response at %g Hz = %.6f dB, want %g", freq, gain, c.freq, got, c.want)
+				}
+			}
+			// A cut mirrors the boost of the same size, and an octave away
+			// less than half of the gain is left.
+			cut := newPeaking(freq, -gain, eqQ, rate)
+			for _, f := range []float64{freq / 2, freq * 1.5} {
+				if got, mirror := p.response(f, rate), cut.response(f, rate); math.Abs(got+mirror) > 1e-6 {
+					t.Errorf("%g Hz %+g dB: response at %g Hz = %.6f, cut gives %.6f", freq, gain, f, got, mirror)
+				}
+			}
+			if got := p.response(freq/2, rate); math.Abs(got) >= math.Abs(gain)/2 {
+				t.Errorf("%g Hz %+g dB: response an octave below = %.3f dB", freq, gain, got)
+			}
+		}
+	}
+}
+
+// sine returns a full scale sine wave at freq.
+func sine(freq float64, rate beep.SampleRate) beep.Streamer {
+	n := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := math.Sin(2 * math.Pi * freq * float64(n) / float64(rate))
+			samples[i] = [2]float64{v, v}
+			n++
+		}
+		return len(samples), true
+	})
+}
+
+// rmsGain streams a second of a sine at freq through e and returns the gain
+// of the last half, once the filters have settled, in dB.
+func rmsGain(e *Equalizer, freq float64) float64 {
+	e.Streamer = sine(freq, e.rate)
+	samples := make([][2]float64, e.rate.N(1e9))
+	e.Stream(samples)
+	var sum float64
+	tail := samples[len(samples)/2:]
+	for _, s := range tail {
+		sum += s[0] * s[0]
+	}
+	return 20 * math.Log10(math.Sqrt(sum/float64(len(tail)))*math.Sqrt2)
+}
+
+func TestEqualizerStream(t *testing.T) {
+	e := newEqualizer(&sync.Mutex{}, OutputSampleRate)
+	for _, freq := range []float64{100, 1000, 5000} {
+		if got := rmsGain(e, freq); math.Abs(got) > 0.01 {
+			t.Errorf("disabled equalizer changes %g Hz by %.3f dB", freq, got)
+		}
+	}
+
+	rock, _ := FindEQPreset(builtinEQPresets, "rock")
+	e.Set(rock.Settings(true))
+	for _, freq := range []float64{62, 440, 1000, 3000, 12000} {
+		want := e.Response(freq)
+		if got := rmsGain(e, freq); math.Abs(got-want) > 0.1 {
+			t.Errorf("rock at %g Hz: measured %.3f dB, response %.3f dB", freq, got, want)
+		}
+	}
+
+	// Disabling keeps the gains but bypasses them.
+	e.Set(rock.Settings(false))
+	if got := e.Settings().Gains; got != rock.Gains {
+		t.Errorf("disabled gains = %v, want %v", got, rock.Gains)
+	}
+	if got := e.Response(62); got != 0 {
+		t.Errorf("disabled response = %g dB, want 0", got)
+	}
+
+	e.Set(EQSettings{Enabled: true, PreAmp: -40, Gains: EQGains{3: 20}})
+	if s := e.Settings(); s.PreAmp != -MaxEQGain || s.Gains[3] != MaxEQGain {
+		t.Errorf("gains out of range were set as %+v", s)
+	}
+}
+
+func TestBuiltinEQPresets(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, p := range BuiltinEQPresets() {
+		if seen[p.Name] {
+			t.Errorf("preset %s is listed twice", p.Name)
+		}
+		seen[p.Name] = true
+		if s := p.Settings(true); s.clamped() != s {
+			t.Errorf("preset %s has gains out of range", p.Name)
+		}
+	}
+	if flat, ok := FindEQPreset(BuiltinEQPresets(), "flat"); !ok || !flat.Settings(true).flat() {
+		t.Errorf("flat preset = %+v, %v", flat, ok)
+	}
+}
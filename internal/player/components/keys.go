@@ -0,0 +1,394 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+
+	"muxic/internal/util"
+)
+
+// Action names something the user can do with a key binding. The names are
+// the ones used in the [keys] table of the config file.
+type Action string
+
+const (
+	ActionUp           Action = "up"
+	ActionDown         Action = "down"
+	ActionPageUp       Action = "page_up"
+	ActionPageDown     Action = "page_down"
+	ActionHalfPageUp   Action = "half_page_up"
+	ActionHalfPageDown Action = "half_page_down"
+	ActionGotoTop      Action = "goto_top"
+	ActionGotoBottom   Action = "goto_bottom"
+	ActionBack         Action = "back"
+
+	ActionPlay          Action = "play"
+	ActionPause         Action = "pause"
+	ActionStop          Action = "stop"
+	ActionSkipBackward  Action = "skip_backward"
+	ActionSkipForward   Action = "skip_forward"
+	ActionNextTrack     Action = "next_track"
+	ActionPreviousTrack Action = "previous_track"
+	ActionToggleRepeat  Action = "toggle_repeat"
+	ActionToggleShuffle Action = "toggle_shuffle"
+
+	ActionSkipBackwardLong Action = "skip_backward_long"
+	ActionSkipForwardLong  Action = "skip_forward_long"
+	ActionSeekTo           Action = "seek_to"
+	ActionABLoop           Action = "ab_loop"
+
+	ActionVolumeUp   Action = "volume_up"
+	ActionVolumeDown Action = "volume_down"
+	ActionVolumeMute Action = "volume_mute"
+
+	ActionSpeedUp    Action = "speed_up"
+	ActionSpeedDown  Action = "speed_down"
+	ActionSpeedReset Action = "speed_reset"
+
+	ActionQuit         Action = "quit"
+	ActionToggleSearch Action = "toggle_search"
+	ActionToggleView   Action = "toggle_view"
+
+	ActionCreatePlaylist     Action = "create_playlist"
+	ActionAddToPlaylist      Action = "add_to_playlist"
+	ActionRemoveFromPlaylist Action = "remove_from_playlist"
+	ActionShufflePlaylist    Action = "shuffle_playlist"
+	ActionSortByAlbum        Action = "sort_by_album"
+	ActionExportPlaylist     Action = "export_playlist"
+
+	ActionAddToQueue      Action = "add_to_queue"
+	ActionRemoveFromQueue Action = "remove_from_queue"
+	ActionViewQueue       Action = "view_queue"
+	ActionPlayNext        Action = "play_next"
+	ActionPlayPrevious    Action = "play_previous"
+	ActionClearQueue      Action = "clear_queue"
+
+	ActionViewEqualizer Action = "view_equalizer"
+	ActionEQBoost       Action = "eq_boost"
+	ActionEQCut         Action = "eq_cut"
+	ActionEQReset       Action = "eq_reset"
+	ActionEQNextPreset  Action = "eq_next_preset"
+	ActionEQToggle      Action = "eq_toggle"
+
+	ActionAddBookmark      Action = "add_bookmark"
+	ActionNextBookmark     Action = "next_bookmark"
+	ActionPreviousBookmark Action = "previous_bookmark"
+	ActionViewBookmarks    Action = "view_bookmarks"
+	ActionRemoveBookmark   Action = "remove_bookmark"
+
+	ActionNextChapter     Action = "next_chapter"
+	ActionPreviousChapter Action = "previous_chapter"
+	ActionViewChapters    Action = "view_chapters"
+)
+
+// KeyViews are the views that have their own binding table, in the order
+// they are checked and listed.
+var KeyViews = []ViewMode{ViewLibrary, ViewSearch, ViewPlaylistTracks, ViewQueue, ViewEqualizer, ViewBookmarks, ViewChapters}
+
+// keyAction describes one configurable action and where it applies.
+type keyAction struct {
+	action  Action
+	views   []ViewMode // Views the action is available in; nil means all of them
+	binding func(k *util.KeyMap) *key.Binding
+}
+
+var (
+	libraryOnly   = []ViewMode{ViewLibrary}
+	searchOnly    = []ViewMode{ViewSearch}
+	playlistOnly  = []ViewMode{ViewPlaylistTracks}
+	queueOnly     = []ViewMode{ViewQueue}
+	eqOnly        = []ViewMode{ViewEqualizer}
+	bookmarksOnly = []ViewMode{ViewBookmarks}
+)
+
+// keyActions lists every configurable action, in the order they are written
+// to the default config file. Its default keys and help text come from
+// util.DefaultKeyMap.
+var keyActions = []keyAction{
+	{ActionUp, nil, func(k *util.KeyMap) *key.Binding { return &k.Up }},
+	{ActionDown, nil, func(k *util.KeyMap) *key.Binding { return &k.Down }},
+	{ActionPageUp, nil, func(k *util.KeyMap) *key.Binding { return &k.PageUp }},
+	{ActionPageDown, nil, func(k *util.KeyMap) *key.Binding { return &k.PageDown }},
+	{ActionHalfPageUp, nil, func(k *util.KeyMap) *key.Binding { return &k.HalfPageUp }},
+	{ActionHalfPageDown, nil, func(k *util.KeyMap) *key.Binding { return &k.HalfPageDown }},
+	{ActionGotoTop, nil, func(k *util.KeyMap) *key.Binding { return &k.GotoTop }},
+	{ActionGotoBottom, nil, func(k *util.KeyMap) *key.Binding { return &k.GotoBottom }},
+	{ActionBack, searchOnly, func(k *util.KeyMap) *key.Binding { return &k.Back }},
+
+	{ActionPlay, nil, func(k *util.KeyMap) *key.Binding { return &k.Play }},
+	{ActionPause, nil, func(k *util.KeyMap) *key.Binding { return &k.Pause }},
+	{ActionStop, nil, func(k *util.KeyMap) *key.Binding { return &k.Stop }},
+	{ActionSkipBackward, nil, func(k *util.KeyMap) *key.Binding { return &k.SkipBackward }},
+	{ActionSkipForward, nil, func(k *util.KeyMap) *key.Binding { return &k.SkipForward }},
+	{ActionSkipBackwardLong, nil, func(k *util.KeyMap) *key.Binding { return &k.SkipBackwardLong }},
+	{ActionSkipForwardLong, nil, func(k *util.KeyMap) *key.Binding { return &k.SkipForwardLong }},
+	{ActionSeekTo, nil, func(k *util.KeyMap) *key.Binding { return &k.SeekTo }},
+	{ActionABLoop, nil, func(k *util.KeyMap) *key.Binding { return &k.ABLoop }},
+	{ActionNextTrack, nil, func(k *util.KeyMap) *key.Binding { return &k.NextTrack }},
+	{ActionPreviousTrack, nil, func(k *util.KeyMap) *key.Binding { return &k.PreviousTrack }},
+	{ActionToggleRepeat, nil, func(k *util.KeyMap) *key.Binding { return &k.ToggleRepeat }},
+	{ActionToggleShuffle, nil, func(k *util.KeyMap) *key.Binding { return &k.ToggleShuffle }},
+
+	{ActionVolumeUp, nil, func(k *util.KeyMap) *key.Binding { return &k.VolumeUp }},
+	{ActionVolumeDown, nil, func(k *util.KeyMap) *key.Binding { return &k.VolumeDown }},
+	{ActionVolumeMute, nil, func(k *util.KeyMap) *key.Binding { return &k.VolumeMute }},
+
+	{ActionSpeedUp, nil, func(k *util.KeyMap) *key.Binding { return &k.SpeedUp }},
+	{ActionSpeedDown, nil, func(k *util.KeyMap) *key.Binding { return &k.SpeedDown }},
+	{ActionSpeedReset, nil, func(k *util.KeyMap) *key.Binding { return &k.SpeedReset }},
+
+	{ActionQuit, nil, func(k *util.KeyMap) *key.Binding { return &k.Quit }},
+	{ActionToggleSearch, searchOnly, func(k *util.KeyMap) *key.Binding { return &k.Search }},
+	{ActionToggleView, nil, func(k *util.KeyMap) *key.Binding { return &k.ToggleView }},
+
+	{ActionCreatePlaylist, nil, func(k *util.KeyMap) *key.Binding { return &k.CreatePlaylist }},
+	{ActionAddToPlaylist, libraryOnly, func(k *util.KeyMap) *key.Binding { return &k.AddToPlaylist }},
+	{ActionRemoveFromPlaylist, playlistOnly, func(k *util.KeyMap) *key.Binding { return &k.RemoveFromPlaylist }},
+	{ActionShufflePlaylist, nil, func(k *util.KeyMap) *key.Binding { return &k.ShufflePlaylist }},
+	{ActionSortByAlbum, []ViewMode{ViewLibrary, ViewPlaylistTracks}, func(k *util.KeyMap) *key.Binding { return &k.SortByAlbum }},
+	{ActionExportPlaylist, playlistOnly, func(k *util.KeyMap) *key.Binding { return &k.ExportPlaylist }},
+
+	{ActionAddToQueue, libraryOnly, func(k *util.KeyMap) *key.Binding { return &k.AddToQueue }},
+	{ActionRemoveFromQueue, queueOnly, func(k *util.KeyMap) *key.Binding { return &k.RemoveFromQueue }},
+	{ActionViewQueue, nil, func(k *util.KeyMap) *key.Binding { return &k.ViewQueue }},
+	{ActionPlayNext, nil, func(k *util.KeyMap) *key.Binding { return &k.PlayNext }},
+	{ActionPlayPrevious, nil, func(k *util.KeyMap) *key.Binding { return &k.PlayPrevious }},
+	{ActionClearQueue, nil, func(k *util.KeyMap) *key.Binding { return &k.ClearQueue }},
+
+	{ActionViewEqualizer, nil, func(k *util.KeyMap) *key.Binding { return &k.ViewEqualizer }},
+	{ActionEQBoost, eqOnly, func(k *util.KeyMap) *key.Binding { return &k.EQBoost }},
+	{ActionEQCut, eqOnly, func(k *util.KeyMap) *key.Binding { return &k.EQCut }},
+	{ActionEQReset, eqOnly, func(k *util.KeyMap) *key.Binding { return &k.EQReset }},
+	{ActionEQNextPreset, eqOnly, func(k *util.KeyMap) *key.Binding { return &k.EQNextPreset }},
+	{ActionEQToggle, eqOnly, func(k *util.KeyMap) *key.Binding { return &k.EQToggle }},
+
+	{ActionAddBookmark, nil, func(k *util.KeyMap) *key.Binding { return &k.AddBookmark }},
+	{ActionNextBookmark, nil, func(k *util.KeyMap) *key.Binding { return &k.NextBookmark }},
+	{ActionPreviousBookmark, nil, func(k *util.KeyMap) *key.Binding { return &k.PreviousBookmark }},
+	{ActionViewBookmarks, nil, func(k *util.KeyMap) *key.Binding { return &k.ViewBookmarks }},
+	{ActionRemoveBookmark, bookmarksOnly, func(k *util.KeyMap) *key.Binding { return &k.RemoveBookmark }},
+
+	{ActionNextChapter, nil, func(k *util.KeyMap) *key.Binding { return &k.NextChapter }},
+	{ActionPreviousChapter, nil, func(k *util.KeyMap) *key.Binding { return &k.PreviousChapter }},
+	{ActionViewChapters, nil, func(k *util.KeyMap) *key.Binding { return &k.ViewChapters }},
+}
+
+// findKeyAction returns the action with the given config name.
+func findKeyAction(name string) (keyAction, bool) {
+	for _, a := range keyActions {
+		if string(a.action) == name {
+			return a, true
+		}
+	}
+	return keyAction{}, false
+}
+
+// appliesTo reports whether the action is available in view.
+func (a keyAction) appliesTo(view ViewMode) bool {
+	if a.views == nil {
+		return true
+	}
+	for _, v := range a.views {
+		if v == view {
+			return true
+		}
+	}
+	return false
+}
+
+// Views returns the views the action is available in.
+func (a Action) Views() []ViewMode {
+	ka, ok := findKeyAction(string(a))
+	if !ok {
+		return nil
+	}
+	if ka.views == nil {
+		return KeyViews
+	}
+	return ka.views
+}
+
+// Actions returns every configurable action.
+func Actions() []Action {
+	actions := make([]Action, len(keyActions))
+	for i, a := range keyActions {
+		actions[i] = a.action
+	}
+	return actions
+}
+
+// KeyMap holds key binding overrides from the config file. Each binding is a
+// key sequence: key names separated by spaces, such as "g g", where
+// "<leader>" stands for the Leader key.
+type KeyMap struct {
+	Leader string // Key that "<leader>" stands for in sequences
+	// Actions replaces the keys of an action in every view it is available
+	// in. An empty list unbinds the action.
+	Actions map[Action][]string
+	// Views replaces the keys of an action in one view only, taking
+	// precedence over Actions.
+	Views map[ViewMode]map[Action][]string
+}
+
+// DefaultKeyMap returns the built-in keys of every action.
+func DefaultKeyMap() KeyMap {
+	k := KeyMap{Actions: make(map[Action][]string, len(keyActions))}
+	base := util.DefaultKeyMap
+	for _, a := range keyActions {
+		k.Actions[a.action] = a.binding(&base).Keys()
+	}
+	return k
+}
+
+// keys returns the key sequences bound to the action in view, as written.
+func (k KeyMap) keys(a keyAction, view ViewMode) []string {
+	if keys, ok := k.Views[view][a.action]; ok {
+		return keys
+	}
+	if keys, ok := k.Actions[a.action]; ok {
+		return keys
+	}
+	base := util.DefaultKeyMap
+	return a.binding(&base).Keys()
+}
+
+// ParseKeySequence splits a binding such as "g g" or "<leader> e" into its key
+// presses, replacing "<leader>" with leader.
+func ParseKeySequence(s, leader string) ([]string, error) {
+	keys := strings.Fields(s)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key binding")
+	}
+	for i, k := range keys {
+		if k != "<leader>" {
+			continue
+		}
+		if leader == "" {
+			return nil, fmt.Errorf("%q uses <leader>, but no leader key is set", s)
+		}
+		keys[i] = leader
+	}
+	return keys, nil
+}
+
+// KeyBinding is one key sequence bound to an action.
+type KeyBinding struct {
+	Action Action
+	Keys   []string // Key presses in order, e.g. ["g", "g"]
+}
+
+// String formats the sequence as written in the config file.
+func (b KeyBinding) String() string {
+	return strings.Join(b.Keys, " ")
+}
+
+// KeyBindings resolves key sequences to actions. Every view has its own
+// binding table, so the same key can do different things in different views.
+type KeyBindings struct {
+	views map[ViewMode][]KeyBinding
+}
+
+// NewKeyBindings builds the binding tables for every view from the defaults
+// and the overrides in k. Sequences that can't be parsed are returned as
+// errors and left out.
+func NewKeyBindings(k KeyMap) (*KeyBindings, []error) {
+	b := &KeyBindings{views: make(map[ViewMode][]KeyBinding, len(KeyViews))}
+	var errs []error
+	for _, view := range KeyViews {
+		for _, a := range keyActions {
+			if !a.appliesTo(view) {
+				continue
+			}
+			for _, s := range k.keys(a, view) {
+				keys, err := ParseKeySequence(s, k.Leader)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", a.action, err))
+					continue
+				}
+				b.views[view] = append(b.views[view], KeyBinding{Action: a.action, Keys: keys})
+			}
+		}
+	}
+	return b, errs
+}
+
+// Bindings returns the binding table of view.
+func (b *KeyBindings) Bindings(view ViewMode) []KeyBinding {
+	return b.views[view]
+}
+
+// Lookup resolves the keys pressed so far in view. It returns the action if
+// they form a complete sequence. Otherwise partial reports whether they are
+// the start of a longer sequence, in which case the caller should wait for
+// the next key.
+func (b *KeyBindings) Lookup(view ViewMode, pressed []string) (action Action, partial bool) {
+	for _, binding := range b.views[view] {
+		if !hasPrefix(binding.Keys, pressed) {
+			continue
+		}
+		if len(binding.Keys) == len(pressed) {
+			return binding.Action, false
+		}
+		partial = true
+	}
+	return "", partial
+}
+
+// Help returns the keys bound to the action in view, for display.
+func (b *KeyBindings) Help(view ViewMode, action Action) string {
+	var keys []string
+	for _, binding := range b.views[view] {
+		if binding.Action == action {
+			keys = append(keys, binding.String())
+		}
+	}
+	return strings.Join(keys, "/")
+}
+
+// KeyConflict is a pair of bindings in one view that can't be told apart:
+// both sequences are the same, or one is the start of the other.
+type KeyConflict struct {
+	View     ViewMode
+	Bindings [2]KeyBinding
+}
+
+// Conflicts returns every ambiguous pair of bindings of different actions.
+func (b *KeyBindings) Conflicts() []KeyConflict {
+	var conflicts []KeyConflict
+	for _, view := range KeyViews {
+		bindings := b.views[view]
+		for i, x := range bindings {
+			for _, y := range bindings[i+1:] {
+				if x.Action != y.Action && (hasPrefix(x.Keys, y.Keys) || hasPrefix(y.Keys, x.Keys)) {
+					conflicts = append(conflicts, KeyConflict{View: view, Bindings: [2]KeyBinding{x, y}})
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// hasPrefix reports whether seq starts with prefix.
+func hasPrefix(seq, prefix []string) bool {
+	if len(prefix) > len(seq) {
+		return false
+	}
+	for i := range prefix {
+		if seq[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ViewName returns the name of a view as used in the config file.
+func ViewName(view ViewMode) string {
+	for name, v := range viewNames {
+		if v == view {
+			return name
+		}
+	}
+	return fmt.Sprintf("view %d", int(view))
+}
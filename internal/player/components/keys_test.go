@@ -0,0 +1,149 @@
+package components
+
+import (
+	"testing"
+)
+
+func TestDefaultBindingsReachEveryAction(t *testing.T) {
+	bindings, errs := NewKeyBindings(KeyMap{})
+	if len(errs) > 0 {
+		t.Fatalf("default bindings don't parse: %v", errs)
+	}
+	if conflicts := bindings.Conflicts(); len(conflicts) > 0 {
+		t.Fatalf("default bindings are ambiguous: %+v", conflicts)
+	}
+
+	for _, view := range KeyViews {
+		for _, action := range Actions() {
+			t.Run(ViewName(view)+"/"+string(action), func(t *testing.T) {
+				applies := false
+				for _, v := range action.Views() {
+					applies = applies || v == view
+				}
+
+				reached := false
+				for _, b := range bindings.Bindings(view) {
+					if b.Action != action {
+						continue
+					}
+					got := resolve(bindings, view, b.Keys)
+					if got != action {
+						t.Errorf("%q resolves to %q", b.String(), got)
+					}
+					reached = true
+				}
+				if reached != applies {
+					t.Errorf("reachable = %v, want %v", reached, applies)
+				}
+			})
+		}
+	}
+}
+
+// resolve feeds keys to Lookup one at a time, as the player does, and returns
+// the action they trigger.
+func resolve(b *KeyBindings, view ViewMode, keys []string) Action {
+	var pressed []string
+	for i, k := range keys {
+		pressed = append(pressed, k)
+		action, partial := b.Lookup(view, pressed)
+		if action != "" {
+			if i != len(keys)-1 {
+				return "" // Triggered before the sequence was complete
+			}
+			return action
+		}
+		if !partial {
+			return ""
+		}
+	}
+	return ""
+}
+
+func TestKeyBindingsOverrides(t *testing.T) {
+	k := KeyMap{
+		Leader: ",",
+		Actions: map[Action][]string{
+			ActionStop:       {"<leader> s"},
+			ActionClearQueue: {},
+		},
+		Views: map[ViewMode]map[Action][]string{
+			ViewQueue: {ActionRemoveFromQueue: {"delete", "g d"}},
+		},
+	}
+	bindings, errs := NewKeyBindings(k)
+	if len(errs) > 0 {
+		t.Fatalf("NewKeyBindings: %v", errs)
+	}
+
+	tests := []struct {
+		view ViewMode
+		keys []string
+		want Action
+	}{
+		{ViewLibrary, []string{",", "s"}, ActionStop},
+		{ViewQueue, []string{",", "s"}, ActionStop},
+		{ViewLibrary, []string{"x"}, ""}, // Replaced by the leader sequence
+		{ViewQueue, []string{"ctrl+shift+d"}, ""},
+		{ViewQueue, []string{"delete"}, ActionRemoveFromQueue},
+		{ViewQueue, []string{"g", "d"}, ActionRemoveFromQueue},
+		{ViewQueue, []string{"g", "g"}, ActionGotoTop},
+		{ViewQueue, []string{"r"}, ""}, // View override replaces the default
+		{ViewPlaylistTracks, []string{"r"}, ActionRemoveFromPlaylist},
+		{ViewLibrary, []string{"g", "d"}, ""},
+	}
+	for _, tt := range tests {
+		if got := resolve(bindings, tt.view, tt.keys); got != tt.want {
+			t.Errorf("%s view: %v resolves to %q, want %q", ViewName(tt.view), tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestKeyBindingsLookupPartial(t *testing.T) {
+	bindings, _ := NewKeyBindings(KeyMap{})
+	if action, partial := bindings.Lookup(ViewLibrary, []string{"g"}); action != "" || !partial {
+		t.Errorf("Lookup(g) = %q, %v; want a partial match", action, partial)
+	}
+	if action, partial := bindings.Lookup(ViewLibrary, []string{"g", "x"}); action != "" || partial {
+		t.Errorf("Lookup(g x) = %q, %v; want no match", action, partial)
+	}
+}
+
+func TestKeyBindingsConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		keys KeyMap
+		want int
+	}{
+		{"same key in different views", KeyMap{Views: map[ViewMode]map[Action][]string{
+			ViewPlaylistTracks: {ActionExportPlaylist: {"a"}}, // add_to_queue is library only
+		}}, 0},
+		{"same key in one view", KeyMap{Actions: map[Action][]string{ActionStop: {"q"}}}, len(KeyViews)},
+		{"prefix of a chord", KeyMap{Actions: map[Action][]string{ActionStop: {"g"}}}, len(KeyViews)},
+		{"chord extending a key", KeyMap{Views: map[ViewMode]map[Action][]string{
+			ViewQueue: {ActionClearQueue: {"r", "r c"}},
+		}}, 2},
+		{"same action twice", KeyMap{Actions: map[Action][]string{ActionStop: {"x", "x y"}}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bindings, _ := NewKeyBindings(tt.keys)
+			if got := bindings.Conflicts(); len(got) != tt.want {
+				t.Errorf("got %d conflicts, want %d: %+v", len(got), tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseKeySequence(t *testing.T) {
+	if _, err := ParseKeySequence("<leader> x", ""); err == nil {
+		t.Error("<leader> without a leader key parsed")
+	}
+	if _, err := ParseKeySequence("  ", ","); err == nil {
+		t.Error("empty sequence parsed")
+	}
+	keys, err := ParseKeySequence("<leader>  g g", "space")
+	if err != nil || len(keys) != 3 || keys[0] != "space" || keys[2] != "g" {
+		t.Errorf("ParseKeySequence = %v, %v", keys, err)
+	}
+}
@@ -16,6 +16,9 @@ var (
 type Library struct {
 	Name  string
 	Files []*util.AudioFile
+
+	// paths indexes Files by path so duplicate checks and lookups stay cheap for large libraries.
+	paths map[string]*util.AudioFile
 }
 
 // GetLibrary returns the singleton instance of the library
@@ -24,6 +27,7 @@ func GetLibrary() *Library {
 		libraryInstance = &Library{
 			Name:  "Music Library",
 			Files: make([]*util.AudioFile, 0),
+			paths: make(map[string]*util.AudioFile),
 		}
 	})
 	return libraryInstance
@@ -32,15 +36,20 @@ func GetLibrary() *Library {
 // AddFile adds a file to the library if it doesn't already exist
 func (l *Library) AddFile(file *util.AudioFile) bool {
 	// Check if file already exists in library
-	for _, f := range l.Files {
-		if f.Path == file.Path {
-			return false // File already exists
-		}
+	if _, ok := l.paths[file.Path]; ok {
+		return false // File already exists
 	}
+	l.paths[file.Path] = file
 	l.Files = append(l.Files, file)
 	return true
 }
 
+// FindByPath returns the library's file with the given path, if any
+func (l *Library) FindByPath(path string) (*util.AudioFile, bool) {
+	file, ok := l.paths[path]
+	return file, ok
+}
+
 // GetFile returns a file by index
 func (l *Library) GetFile(index int) (*util.AudioFile, error) {
 	if index < 0 || index >= len(l.Files) {
@@ -54,23 +63,19 @@ func (l *Library) RemoveFile(index int) error {
 	if index < 0 || index >= len(l.Files) {
 		return fmt.Errorf("index out of range")
 	}
+	delete(l.paths, l.Files[index].Path)
 	l.Files = append(l.Files[:index], l.Files[index+1:]...)
 	return nil
 }
 
-// ToTableRows converts all files in the library to table rows
-func (l *Library) ToTableRows() []table.Row {
-	library := GetLibrary()
-	rows := make([]table.Row, library.Length())
-	for i, t := range library.Files {
-		rows[i] = table.Row{
-			t.Title,
-			t.Artist,
-			t.Album,
-			t.Duration,
-		}
-	}
-	return rows
+// ToTableRows converts all files in the library to table rows with the given columns
+func (l *Library) ToTableRows(columns []TrackColumn) []table.Row {
+	return TrackRows(l.Files, columns)
+}
+
+// SortByAlbum orders the library by album artist, album, disc and track number
+func (l *Library) SortByAlbum() {
+	SortByAlbum(l.Files)
 }
 
 // GetPaths returns all file paths in the library
@@ -90,4 +95,5 @@ func (l *Library) Length() int {
 // Clear removes all files from the library
 func (l *Library) Clear() {
 	l.Files = make([]*util.AudioFile, 0)
+	l.paths = make(map[string]*util.AudioFile)
 }
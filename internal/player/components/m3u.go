@@ -0,0 +1,220 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"muxic/internal/util"
+)
+
+// utf8BOM is the byte order mark some players write at the start of .m3u8 files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// M3UEntry is a single track reference read from an M3U playlist.
+type M3UEntry struct {
+	Path     string        // Absolute path of the track
+	Title    string        // Display title from #EXTINF, if any
+	Duration time.Duration // Duration from #EXTINF; 0 if unknown
+}
+
+// ParseM3U reads an M3U or M3U8 playlist. Relative paths are resolved against
+// baseDir, normally the directory containing the playlist. Both plain and
+// extended (#EXTM3U) playlists are accepted; a leading UTF-8 byte order mark is
+// skipped, and lines that aren't valid UTF-8 are read as Latin-1, as older
+// players write .m3u files in the system code page. Entries that aren't local
+// files, such as stream URLs, are skipped.
+func ParseM3U(r io.Reader, baseDir string) ([]M3UEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	var (
+		entries []M3UEntry
+		info    M3UEntry // Pending #EXTINF for the next path
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(decodeM3ULine(scanner.Bytes()))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue // #EXTM3U and other directives
+		}
+
+		path, ok := m3uPath(line, baseDir)
+		if ok {
+			info.Path = path
+			entries = append(entries, info)
+		}
+		info = M3UEntry{}
+	}
+	return entries, scanner.Err()
+}
+
+// decodeM3ULine returns the line as a string, converting it from Latin-1 if it
+// isn't valid UTF-8.
+func decodeM3ULine(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// parseExtInf parses the "<seconds>[ attributes],<title>" part of an #EXTINF line.
+func parseExtInf(s string) M3UEntry {
+	var entry M3UEntry
+	head, title, _ := strings.Cut(s, ",")
+	entry.Title = strings.TrimSpace(title)
+
+	// Some writers append key="value" attributes after the duration.
+	if fields := strings.Fields(head); len(fields) > 0 {
+		if secs, err := strconv.ParseFloat(fields[0], 64); err == nil && secs > 0 {
+			entry.Duration = time.Duration(secs * float64(time.Second))
+		}
+	}
+	return entry
+}
+
+// m3uPath turns a playlist line into an absolute file path. It reports false
+// for URLs that don't refer to local files. Only lines holding "://" or
+// starting with "file:" are taken for URLs, as a file name may well contain a
+// colon, and backslashes are taken for the separators of playlists written on
+// Windows.
+func m3uPath(line, baseDir string) (string, bool) {
+	if strings.Contains(line, "://") || strings.HasPrefix(strings.ToLower(line), "file:") {
+		u, err := url.Parse(line)
+		if err != nil || !strings.EqualFold(u.Scheme, "file") {
+			return "", false
+		}
+		line = u.Path
+	} else {
+		line = strings.ReplaceAll(line, `\`, "/")
+	}
+	line = filepath.FromSlash(line)
+	if !filepath.IsAbs(line) {
+		line = filepath.Join(baseDir, line)
+	}
+	return filepath.Clean(line), true
+}
+
+// ImportM3U creates a playlist from an M3U/M3U8 file, named after the file.
+// Its tracks are placeholders, like those of loaded playlists, until they are
+// resolved against the library with ResolveTracks.
+func (pm *PlaylistManager) ImportM3U(path string) (*Playlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ParseM3U(f, filepath.Dir(absPath))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	playlist, err := pm.CreatePlaylist(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		track := placeholderTrack(entry.Path)
+		if entry.Title != "" {
+			track.Title = entry.Title
+		}
+		track.Duration = entry.Duration
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	return playlist, nil
+}
+
+// WriteM3U writes tracks as an extended M3U playlist in UTF-8. When relative is
+// set, paths are written relative to baseDir (the directory the playlist will
+// be saved in) with forward slashes, so the playlist keeps working when the
+// music and playlist are copied together to another device. Tracks on another
+// volume are always written with absolute paths.
+//
+// Other players can't play a track split from a file by a CUE sheet on its
+// own, so the whole file is written instead, titled after its album, once for
+// each run of its tracks.
+func WriteM3U(w io.Writer, tracks []*util.AudioFile, baseDir string, relative bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	lastSource := ""
+	for _, t := range tracks {
+		secs := -1 // Unknown, as the format specifies
+		path, title := t.Path, m3uTitle(t.Artist, t.Title)
+		if t.IsPart() {
+			if t.Source == lastSource {
+				continue
+			}
+			album := t.Album
+			if album == "" {
+				album = filepath.Base(t.Source)
+			}
+			path, title = t.Source, m3uTitle(t.AlbumArtist, album)
+		} else if t.Duration > 0 {
+			secs = int(t.Duration.Round(time.Second) / time.Second)
+		}
+		lastSource = t.Source
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", secs, title)
+
+		if relative {
+			if rel, err := filepath.Rel(baseDir, path); err == nil {
+				path = filepath.ToSlash(rel)
+			}
+		}
+		fmt.Fprintln(bw, path)
+	}
+	return bw.Flush()
+}
+
+// m3uTitle returns the #EXTINF title of a track or album, "Artist - Title".
+func m3uTitle(artist, title string) string {
+	if artist != "" && artist != "Unknown" {
+		return artist + " - " + title
+	}
+	return title
+}
+
+// ExportM3U saves a playlist to path as an M3U8 file, atomically. See WriteM3U
+// for the meaning of relative.
+func (pm *PlaylistManager) ExportM3U(playlistID int, path string, relative bool) error {
+	playlist, err := pm.GetPlaylist(playlistID)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := WriteM3U(&buf, playlist.Tracks, filepath.Dir(absPath), relative); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(absPath, buf.Bytes(), 0o644)
+}
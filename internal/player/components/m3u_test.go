@@ -0,0 +1,119 @@
+package components
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+func TestParseM3U(t *testing.T) {
+	input := "\xEF\xBB\xBF#EXTM3U\r\n" +
+		"#EXTINF:215,Artist - Song\r\n" +
+		"album/01 song.flac\r\n" +
+		"\r\n" +
+		"# a comment\r\n" +
+		"/abs/track.mp3\r\n" +
+		"#EXTINF:-1 tvg-id=\"x\",Stream\r\n" +
+		"http://radio.example/stream\r\n" +
+		"file:///abs/with%20space.ogg\r\n" +
+		"caf\xe9.mp3\r\n" + // Latin-1
+		"Intro:Part1.mp3\r\n" +
+		"sub\\dir\\song.mp3\r\n"
+
+	entries, err := ParseM3U(strings.NewReader(input), "/music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []M3UEntry{
+		{Path: "/music/album/01 song.flac", Title: "Artist - Song", Duration: 215 * time.Second},
+		{Path: "/abs/track.mp3"},
+		{Path: "/abs/with space.ogg"},
+		{Path: "/music/café.mp3"},
+		{Path: "/music/Intro:Part1.mp3"},
+		{Path: "/music/sub/dir/song.mp3"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries %+v, want %d", len(entries), entries, len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestExportImportM3URoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tracks := []*util.AudioFile{
+		{Title: "One", Artist: "Band", Duration: 61500 * time.Millisecond, Path: filepath.Join(dir, "a", "one.flac")},
+		{Title: "Two", Artist: "Unknown", Path: filepath.Join(dir, "two.mp3")},
+	}
+	pm := NewPlaylistManager()
+	playlist, _ := pm.CreatePlaylist("Mix")
+	_ = pm.AddTracks(playlist.ID, tracks...)
+
+	out := filepath.Join(dir, "Mix.m3u8")
+	if err := pm.ExportM3U(playlist.ID, out, true); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(out)
+	wantText := "#EXTM3U\n#EXTINF:62,Band - One\na/one.flac\n#EXTINF:-1,Two\ntwo.mp3\n"
+	if string(data) != wantText {
+		t.Errorf("exported:\n%s\nwant:\n%s", data, wantText)
+	}
+
+	imported, err := pm.ImportM3U(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Name != "Mix" || imported.Length() != 2 {
+		t.Fatalf("imported %q with %d tracks", imported.Name, imported.Length())
+	}
+	for i, track := range imported.Tracks {
+		if track.Path != tracks[i].Path {
+			t.Errorf("track %d path = %q, want %q", i, track.Path, tracks[i].Path)
+		}
+	}
+
+	var abs bytes.Buffer
+	_ = WriteM3U(&abs, tracks, dir, false)
+	if !strings.Contains(abs.String(), "\n"+tracks[0].Path+"\n") {
+		t.Errorf("absolute export doesn't contain %s:\n%s", tracks[0].Path, abs.String())
+	}
+}
+
+func TestWriteM3UExportsPartsAsTheirFile(t *testing.T) {
+	const album = "/music/album.flac"
+	part := func(n int, source string) *util.AudioFile {
+		return &util.AudioFile{
+			Title: "Part", Artist: "Band", Album: "Album", AlbumArtist: "Band", Duration: time.Minute,
+			Path: fmt.Sprintf("/music/album.cue#%02d", n), Source: source,
+		}
+	}
+	tracks := []*util.AudioFile{
+		part(1, album), part(2, album),
+		{Title: "Song", Path: "/music/song.mp3", Duration: time.Minute},
+		part(3, album),
+		part(1, "/music/other.wav"),
+	}
+	tracks[4].Album = ""
+
+	var buf bytes.Buffer
+	if err := WriteM3U(&buf, tracks, "/music", true); err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n" +
+		"#EXTINF:-1,Band - Album\nalbum.flac\n" +
+		"#EXTINF:60,Song\nsong.mp3\n" +
+		"#EXTINF:-1,Band - Album\nalbum.flac\n" +
+		"#EXTINF:-1,Band - other.wav\nother.wav\n"
+	if buf.String() != want {
+		t.Errorf("exported:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,90 @@
+package components
+
+import (
+	"math"
+
+	"muxic/internal/util"
+)
+
+const (
+	// maxNormalizationGain bounds the gain applied to a track, in dB, so a
+	// nearly silent track isn't boosted into noise.
+	maxNormalizationGain = 24.0
+	// MaxPreAmp bounds the pre-amp, in dB, either way.
+	MaxPreAmp = 15.0
+)
+
+// ReplayGainMode selects which gain normalizes the loudness of tracks.
+type ReplayGainMode int
+
+const (
+	ReplayGainOff   ReplayGainMode = iota // Tracks play as they are
+	ReplayGainTrack                       // Each track is brought to the same loudness
+	ReplayGainAlbum                       // Each album is, keeping the differences between its tracks
+	ReplayGainAuto                        // Album gain, or track gain while the queue is shuffled
+)
+
+var replayGainModeNames = []string{"off", "track", "album", "auto"}
+
+func (m ReplayGainMode) String() string {
+	if m < 0 || int(m) >= len(replayGainModeNames) {
+		return "unknown"
+	}
+	return replayGainModeNames[m]
+}
+
+// ParseReplayGainMode parses a mode name as returned by ReplayGainMode.String.
+func ParseReplayGainMode(s string) (ReplayGainMode, bool) {
+	for i, name := range replayGainModeNames {
+		if s == name {
+			return ReplayGainMode(i), true
+		}
+	}
+	return ReplayGainOff, false
+}
+
+// ReplayGainModeNames returns the names of the modes, for help texts.
+func ReplayGainModeNames() []string {
+	return append([]string(nil), replayGainModeNames...)
+}
+
+// Normalization configures loudness normalization. Tracks are normalized by
+// their ReplayGain tags, or by their measured loudness if they have none.
+type Normalization struct {
+	Mode   ReplayGainMode
+	PreAmp float64 // Added to every gain, in dB
+	// PreventClipping lowers the gain of a track whose peak would otherwise
+	// go over full scale.
+	PreventClipping bool
+}
+
+// gain returns the linear gain to play track at. Album gains are used in
+// album mode, and in auto mode unless shuffled is set; a track lacking the
+// gain asked for falls back to the other one, then to its measured loudness.
+// Tracks with neither play unchanged.
+func (n Normalization) gain(track *util.AudioFile, shuffled bool) float64 {
+	if n.Mode == ReplayGainOff {
+		return 1
+	}
+	rg := track.ReplayGain
+	album := n.Mode == ReplayGainAlbum || (n.Mode == ReplayGainAuto && !shuffled)
+
+	var db, peak float64
+	switch {
+	case rg.HasAlbum && (album || !rg.HasTrack):
+		db, peak = rg.AlbumGain, rg.AlbumPeak
+	case rg.HasTrack:
+		db, peak = rg.TrackGain, rg.TrackPeak
+	case track.Loudness != nil:
+		db, peak = track.Loudness.Gain(), track.Loudness.Peak
+	default:
+		return 1
+	}
+
+	db = max(-maxNormalizationGain, min(db+n.PreAmp, maxNormalizationGain))
+	g := math.Pow(10, db/20)
+	if n.PreventClipping && peak > 0 && g*peak > 1 {
+		g = 1 / peak
+	}
+	return g
+}
@@ -0,0 +1,52 @@
+package components
+
+import (
+	"math"
+	"testing"
+
+	"muxic/internal/util"
+)
+
+func TestNormalizationGain(t *testing.T) {
+	tagged := &util.AudioFile{ReplayGain: util.ReplayGain{
+		TrackGain: -6, TrackPeak: 0.5, HasTrack: true,
+		AlbumGain: -3, AlbumPeak: 0.9, HasAlbum: true,
+	}}
+	trackOnly := &util.AudioFile{ReplayGain: util.ReplayGain{TrackGain: 4, TrackPeak: 0.8, HasTrack: true}}
+	measured := &util.AudioFile{Loudness: &util.Loudness{Integrated: -12, Peak: 0.25}}
+	quiet := &util.AudioFile{Loudness: &util.Loudness{Integrated: -50}}
+
+	tests := []struct {
+		name     string
+		n        Normalization
+		track    *util.AudioFile
+		shuffled bool
+		want     float64 // dB
+	}{
+		{"off", Normalization{Mode: ReplayGainOff, PreAmp: 6}, tagged, false, 0},
+		{"track", Normalization{Mode: ReplayGainTrack}, tagged, false, -6},
+		{"album", Normalization{Mode: ReplayGainAlbum}, tagged, true, -3},
+		{"auto in order", Normalization{Mode: ReplayGainAuto}, tagged, false, -3},
+		{"auto shuffled", Normalization{Mode: ReplayGainAuto}, tagged, true, -6},
+		{"album falls back to track", Normalization{Mode: ReplayGainAlbum}, trackOnly, false, 4},
+		{"pre-amp", Normalization{Mode: ReplayGainTrack, PreAmp: 2.5}, tagged, false, -3.5},
+		{"measured loudness", Normalization{Mode: ReplayGainTrack}, measured, false, -6},
+		{"untagged", Normalization{Mode: ReplayGainAuto, PreAmp: 3}, &util.AudioFile{}, false, 0},
+		{"bounded", Normalization{Mode: ReplayGainTrack}, quiet, false, maxNormalizationGain},
+		// 10^(4/20) * 0.8 goes over full scale.
+		{"clipping prevented", Normalization{Mode: ReplayGainTrack, PreventClipping: true}, trackOnly, false, 20 * math.Log10(1/0.8)},
+		{"peak allows the gain", Normalization{Mode: ReplayGainTrack, PreventClipping: true}, measured, false, -6},
+	}
+	for _, tt := range tests {
+		got := 20 * math.Log10(tt.n.gain(tt.track, tt.shuffled))
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: gain = %.3f dB, want %.3f dB", tt.name, got, tt.want)
+		}
+	}
+
+	for _, name := range ReplayGainModeNames() {
+		if m, ok := ParseReplayGainMode(name); !ok || m.String() != name {
+			t.Errorf("ParseReplayGainMode(%q) = %v, %v", name, m, ok)
+		}
+	}
+}
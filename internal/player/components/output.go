@@ -0,0 +1,273 @@
+package components
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/speaker"
+)
+
+// outputBuffer is how much audio an output renders at a time.
+const outputBuffer = time.Second / 10
+
+// Output is where an AudioPlayer sends its samples. Streamers passed to Play
+// are mixed and consumed on the output's own goroutine, which holds the lock
+// while it reads from them; callers must hold it too while changing state
+// those streamers depend on.
+type Output interface {
+	// SampleRate is the rate streamers are played at.
+	SampleRate() beep.SampleRate
+	// Play starts playing s alongside anything already playing.
+	Play(s beep.Streamer)
+	// Clear stops and removes every streamer.
+	Clear()
+	Lock()
+	Unlock()
+	// Close stops the output and releases its resources.
+	Close() error
+}
+
+// OpenOutput opens the output named by spec: "speaker" for the sound card,
+// "null" to discard the samples, or "wav:path" to record them to a WAV file.
+// Speed sets how fast the null and WAV outputs consume samples, relative to
+// real time; 0 consumes them as fast as possible.
+func OpenOutput(spec string, rate beep.SampleRate, speed float64) (Output, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("output speed must not be negative, got %v", speed)
+	}
+	name, arg, _ := strings.Cut(spec, ":")
+	switch {
+	case name == "speaker" && arg == "":
+		return NewSpeakerOutput(rate)
+	case name == "null" && arg == "":
+		return NewNullOutput(rate, speed), nil
+	case name == "wav" && arg != "":
+		return NewWAVOutput(arg, rate, speed)
+	case name == "wav":
+		return nil, errors.New("wav output needs a file: wav:path")
+	default:
+		return nil, fmt.Errorf("unknown output %q (available: speaker, null, wav:path)", spec)
+	}
+}
+
+// speakerOutput plays through the sound card. There is only one speaker per
+// process, so only one may be open at a time.
+type speakerOutput struct {
+	rate beep.SampleRate
+}
+
+// NewSpeakerOutput initializes the sound card at rate.
+func NewSpeakerOutput(rate beep.SampleRate) (Output, error) {
+	if err := speaker.Init(rate, rate.N(outputBuffer)); err != nil {
+		return nil, err
+	}
+	return &speakerOutput{rate: rate}, nil
+}
+
+func (o *speakerOutput) SampleRate() beep.SampleRate { return o.rate }
+func (o *speakerOutput) Play(s beep.Streamer)        { speaker.Play(s) }
+func (o *speakerOutput) Clear()                      { speaker.Clear() }
+func (o *speakerOutput) Lock()                       { speaker.Lock() }
+func (o *speakerOutput) Unlock()                     { speaker.Unlock() }
+
+func (o *speakerOutput) Close() error {
+	speaker.Close()
+	return nil
+}
+
+// SinkOutput mixes its streamers on its own goroutine and hands the samples to
+// a sink function instead of a sound card. It only runs while something is
+// playing, so no time passes for it while the player is stopped.
+type SinkOutput struct {
+	rate  beep.SampleRate
+	speed float64
+	sink  func(samples [][2]float64) error
+	close func() error // Releases the sink's resources; may be nil
+
+	mu    sync.Mutex
+	mixer beep.Mixer
+	err   error // First error returned by sink
+
+	wake   chan struct{} // Signals that a streamer was added
+	quit   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+}
+
+// NewNullOutput returns an output that discards its samples, consuming them
+// at speed times real time, or as fast as possible if speed is 0.
+func NewNullOutput(rate beep.SampleRate, speed float64) *SinkOutput {
+	return newSinkOutput(rate, speed, func([][2]float64) error { return nil }, nil)
+}
+
+func newSinkOutput(rate beep.SampleRate, speed float64, sink func([][2]float64) error, close func() error) *SinkOutput {
+	o := &SinkOutput{
+		rate:   rate,
+		speed:  speed,
+		sink:   sink,
+		close:  close,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go o.run()
+	return o
+}
+
+func (o *SinkOutput) SampleRate() beep.SampleRate { return o.rate }
+func (o *SinkOutput) Lock()                       { o.mu.Lock() }
+func (o *SinkOutput) Unlock()                     { o.mu.Unlock() }
+
+func (o *SinkOutput) Play(s beep.Streamer) {
+	o.mu.Lock()
+	o.mixer.Add(s)
+	o.mu.Unlock()
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *SinkOutput) Clear() {
+	o.mu.Lock()
+	o.mixer.Clear()
+	o.mu.Unlock()
+}
+
+// Close stops the output and closes its sink. It returns the first error
+// the sink reported, if any.
+func (o *SinkOutput) Close() error {
+	o.once.Do(func() { close(o.quit) })
+	<-o.exited
+
+	o.mu.Lock()
+	err := o.err
+	o.mu.Unlock()
+	if o.close != nil {
+		if cerr := o.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// run consumes the mixer's samples in chunks of outputBuffer, pacing itself
+// to the output speed, until the output is closed.
+func (o *SinkOutput) run() {
+	defer close(o.exited)
+
+	samples := make([][2]float64, o.rate.N(outputBuffer))
+	next := time.Now()
+	for {
+		o.mu.Lock()
+		idle := o.mixer.Len() == 0
+		if !idle {
+			o.mixer.Stream(samples)
+		}
+		o.mu.Unlock()
+
+		if idle {
+			select {
+			case <-o.wake:
+				next = time.Now()
+				continue
+			case <-o.quit:
+				return
+			}
+		}
+		if err := o.sink(samples); err != nil {
+			o.mu.Lock()
+			if o.err == nil {
+				o.err = err
+			}
+			o.mu.Unlock()
+		}
+
+		if o.speed > 0 {
+			next = next.Add(time.Duration(float64(outputBuffer) / o.speed))
+			select {
+			case <-time.After(time.Until(next)):
+			case <-o.quit:
+				return
+			}
+		} else {
+			select {
+			case <-o.quit:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// wavHeaderSize is the size of the header NewWAVOutput writes.
+const wavHeaderSize = 44
+
+// NewWAVOutput returns an output that records its samples to a 16-bit stereo
+// WAV file at path, consuming them at speed times real time, or as fast as
+// possible if speed is 0. The file is complete once the output is closed.
+func NewWAVOutput(path string, rate beep.SampleRate, speed float64) (*SinkOutput, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(wavHeader(rate, 0)); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	var dataSize uint32
+	buf := make([]byte, 0, rate.N(outputBuffer)*4)
+	sink := func(samples [][2]float64) error {
+		buf = buf[:0]
+		for _, s := range samples {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(pcm16(s[0])))
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(pcm16(s[1])))
+		}
+		n, err := f.Write(buf)
+		dataSize += uint32(n)
+		return err
+	}
+	finish := func() error {
+		// Fill in the sizes now that the amount of data is known.
+		if _, err := f.WriteAt(wavHeader(rate, dataSize), 0); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return newSinkOutput(rate, speed, sink, finish), nil
+}
+
+// wavHeader returns the header of a 16-bit stereo PCM WAV file holding
+// dataSize bytes of samples.
+func wavHeader(rate beep.SampleRate, dataSize uint32) []byte {
+	const channels, bytesPerSample = 2, 2
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, wavHeaderSize-8+dataSize)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16) // Size of the fmt chunk
+	h = binary.LittleEndian.AppendUint16(h, 1)  // PCM
+	h = binary.LittleEndian.AppendUint16(h, channels)
+	h = binary.LittleEndian.AppendUint32(h, uint32(rate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(rate)*channels*bytesPerSample)
+	h = binary.LittleEndian.AppendUint16(h, channels*bytesPerSample)
+	h = binary.LittleEndian.AppendUint16(h, bytesPerSample*8)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	return h
+}
+
+// pcm16 converts a sample in [-1, 1] to a signed 16-bit value, clipping it.
+func pcm16(v float64) int16 {
+	v = math.Max(-1, math.Min(1, v))
+	return int16(math.Round(v * math.MaxInt16))
+}
@@ -0,0 +1,174 @@
+package components
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/wav"
+	"muxic/internal/util"
+)
+
+// writeTone writes a WAV file of a constant tone at level lasting d.
+func writeTone(t *testing.T, path string, rate beep.SampleRate, d time.Duration, level float64) {
+	t.Helper()
+	n := rate.N(d)
+	data := wavHeader(rate, uint32(n*4))
+	for range n {
+		data = binary.LittleEndian.AppendUint16(data, uint16(pcm16(level)))
+		data = binary.LittleEndian.AppendUint16(data, uint16(pcm16(level)))
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// toneLevel returns the level a tone written by writeTone at level plays at.
+// beep's WAV decoder divides 16-bit samples by 65535, halving them.
+func toneLevel(level float64) float64 {
+	return float64(pcm16(level)) / (1<<16 - 1)
+}
+
+// constant streams n samples of v.
+func constant(n int, v float64) beep.Streamer {
+	return beep.Take(n, beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			samples[i] = [2]float64{v, -v}
+		}
+		return len(samples), true
+	}))
+}
+
+func TestOpenOutput(t *testing.T) {
+	for _, spec := range []string{"", "wav", "wav:", "null:x", "speakers", "file:x.wav"} {
+		if o, err := OpenOutput(spec, OutputSampleRate, 0); err == nil {
+			_ = o.Close()
+			t.Errorf("OpenOutput(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := OpenOutput("null", OutputSampleRate, -1); err == nil {
+		t.Error("OpenOutput with a negative speed succeeded")
+	}
+
+	o, err := OpenOutput("null", OutputSampleRate, 0)
+	if err != nil {
+		t.Fatalf("OpenOutput(null): %v", err)
+	}
+	if err := o.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestWAVOutputRecordsSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	o, err := NewWAVOutput(path, OutputSampleRate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := OutputSampleRate.N(outputBuffer)
+	n := 3 * chunk
+	done := make(chan struct{})
+	o.Play(beep.Seq(constant(n, 0.5), beep.Callback(func() { close(done) })))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("streamer never finished")
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, format, err := wav.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding the recording: %v", err)
+	}
+	// The output only notices the end of a streamer on the next chunk, which
+	// it fills with silence.
+	if format.SampleRate != OutputSampleRate || format.NumChannels != 2 || s.Len() < n || s.Len() > n+chunk {
+		t.Fatalf("recorded %d samples at %v Hz, %d channels; want %d at %v Hz, 2 channels",
+			s.Len(), format.SampleRate, format.NumChannels, n, OutputSampleRate)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := int16(binary.LittleEndian.Uint16(data[wavHeaderSize:]))
+	r := int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2:]))
+	if want := pcm16(0.5); l != want || r != -want {
+		t.Errorf("first frame = [%d %d], want [%d %d]", l, r, want, -want)
+	}
+}
+
+func TestHeadlessPlaybackAdvancesQueue(t *testing.T) {
+	dir := t.TempDir()
+	var tracks []*util.AudioFile
+	for _, title := range []string{"A", "B", "C"} {
+		path := filepath.Join(dir, title+".wav")
+		writeTone(t, path, OutputSampleRate, 200*time.Millisecond, 0.25)
+		tracks = append(tracks, &util.AudioFile{Title: title, Path: path})
+	}
+
+	output := NewNullOutput(OutputSampleRate, 0)
+	defer output.Close()
+	e := NewEngine(NewAudioPlayer(output))
+	e.Enqueue(tracks...)
+
+	var started []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-e.Events():
+			if event.Type == EventError {
+				t.Fatalf("playback failed: %s", event.Message)
+			}
+			if event.Type == EventTrackStarted {
+				started = append(started, event.Data.(*util.AudioFile).Title)
+			}
+			if event.Type != EventStopped {
+				continue
+			}
+		case <-timeout:
+			t.Fatalf("queue didn't finish, started %v", started)
+		}
+		break
+	}
+	if len(started) != 3 || started[0] != "A" || started[1] != "B" || started[2] != "C" {
+		t.Errorf("started %v, want [A B C]", started)
+	}
+	if info, _ := e.GetPlaybackInfo(); info.State != StateStopped || info.CurrentTrack != nil {
+		t.Errorf("state %v playing %v at the end of the queue, want stopped", info.State, info.CurrentTrack)
+	}
+}
+
+func TestHeadlessPlaybackProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "A.wav")
+	// A track at another rate is resampled, but progress stays in its own time.
+	writeTone(t, path, 22050, 2*time.Second, 0.25)
+
+	output := NewNullOutput(OutputSampleRate, 1)
+	defer output.Close()
+	e := NewEngine(NewAudioPlayer(output))
+	e.Enqueue(&util.AudioFile{Title: "A", Path: path})
+
+	time.Sleep(500 * time.Millisecond)
+	info, _ := e.GetPlaybackInfo()
+	if info.State != StatePlaying || info.Duration != 2*time.Second {
+		t.Fatalf("state %v with duration %v, want playing 2s", info.State, info.Duration)
+	}
+	if info.CurrentTime < 200*time.Millisecond || info.CurrentTime > time.Second {
+		t.Errorf("played %v after 500ms in real time", info.CurrentTime)
+	}
+
+	if err := e.Seek(1900 * time.Millisecond); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	waitForState(t, e, StateStopped)
+}
@@ -0,0 +1,149 @@
+package components
+
+import "math/rand"
+
+// PlayOrder is a shuffled play order over a list of tracks. It holds a
+// permutation of track indices instead of reordering the list itself, so the
+// original order is still there when shuffle is turned off again.
+//
+// Tracks before the current position have already been played in this round.
+// Every track is played once before the order is reshuffled with Restart, and
+// moving backwards walks through that history.
+type PlayOrder struct {
+	order []int // Track indices in play order
+	pos   int   // Position of the current track in order; -1 before the first
+}
+
+// NewPlayOrder returns a shuffled order over n tracks. If current is a valid
+// index, that track is put first and treated as already playing.
+func NewPlayOrder(n, current int) *PlayOrder {
+	p := &PlayOrder{order: rand.Perm(n), pos: -1}
+	if current >= 0 && current < n {
+		for i, idx := range p.order {
+			if idx == current {
+				p.order[0], p.order[i] = p.order[i], p.order[0]
+				break
+			}
+		}
+		p.pos = 0
+	}
+	return p
+}
+
+// Len returns the number of tracks in the order.
+func (p *PlayOrder) Len() int {
+	return len(p.order)
+}
+
+// Current returns the index of the current track, or -1 if there is none.
+func (p *PlayOrder) Current() int {
+	if p.pos < 0 || p.pos >= len(p.order) {
+		return -1
+	}
+	return p.order[p.pos]
+}
+
+// Next moves to the next unplayed track and returns its index. It returns
+// false once every track has been played.
+func (p *PlayOrder) Next() (int, bool) {
+	if p.pos+1 >= len(p.order) {
+		return -1, false
+	}
+	p.pos++
+	return p.order[p.pos], true
+}
+
+// Peek returns the index of the track Next would move to, without moving.
+// It returns false once every track has been played.
+func (p *PlayOrder) Peek() (int, bool) {
+	if p.pos+1 >= len(p.order) {
+		return -1, false
+	}
+	return p.order[p.pos+1], true
+}
+
+// Previous moves back to the previously played track and returns its index.
+// It returns false at the start of the history.
+func (p *PlayOrder) Previous() (int, bool) {
+	if p.pos <= 0 {
+		return -1, false
+	}
+	p.pos--
+	return p.order[p.pos], true
+}
+
+// Restart begins a new round with a fresh permutation and returns the index of
+// its first track. The track that was playing is not picked first, so the
+// round boundary never plays the same track twice in a row.
+func (p *PlayOrder) Restart() int {
+	last := p.Current()
+	p.order = rand.Perm(len(p.order))
+	p.pos = -1
+	if len(p.order) == 0 {
+		return -1
+	}
+	if len(p.order) > 1 && p.order[0] == last {
+		j := 1 + rand.Intn(len(p.order)-1)
+		p.order[0], p.order[j] = p.order[j], p.order[0]
+	}
+	p.pos = 0
+	return p.order[0]
+}
+
+// Jump makes the track at index the current one, e.g. when the user picks a
+// track directly. It is moved right after the current position so the rest of
+// the round is unaffected.
+func (p *PlayOrder) Jump(index int) {
+	at := p.find(index)
+	if at < 0 {
+		return
+	}
+	p.order = append(p.order[:at], p.order[at+1:]...)
+	if at <= p.pos {
+		p.pos--
+	}
+	p.pos++
+	p.order = append(p.order[:p.pos], append([]int{index}, p.order[p.pos:]...)...)
+}
+
+// Insert accounts for a track inserted into the list at index. Indices at or
+// after it shift up by one, and the new track is placed at a random position
+// among the tracks not yet played.
+func (p *PlayOrder) Insert(index int) {
+	for i, idx := range p.order {
+		if idx >= index {
+			p.order[i]++
+		}
+	}
+	at := p.pos + 1 + rand.Intn(len(p.order)-p.pos)
+	p.order = append(p.order[:at], append([]int{index}, p.order[at:]...)...)
+}
+
+// Remove accounts for the track at index being removed from the list. If it
+// was the current track, the position moves back to the track played before
+// it, or before the first, so that Next moves on to the track after it.
+func (p *PlayOrder) Remove(index int) {
+	at := p.find(index)
+	if at < 0 {
+		return
+	}
+	p.order = append(p.order[:at], p.order[at+1:]...)
+	for i, idx := range p.order {
+		if idx > index {
+			p.order[i]--
+		}
+	}
+	if at <= p.pos {
+		p.pos--
+	}
+}
+
+// find returns the position of the track index in the order, or -1.
+func (p *PlayOrder) find(index int) int {
+	for i, idx := range p.order {
+		if idx == index {
+			return i
+		}
+	}
+	return -1
+}
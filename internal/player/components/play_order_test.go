@@ -0,0 +1,153 @@
+package components
+
+import (
+	"sort"
+	"testing"
+)
+
+// checkPermutation fails the test unless order holds each of 0..n-1 exactly once.
+func checkPermutation(t *testing.T, p *PlayOrder, n int) {
+	t.Helper()
+	got := append([]int(nil), p.order...)
+	sort.Ints(got)
+	if len(got) != n {
+		t.Fatalf("order has %d entries, want %d: %v", len(got), n, p.order)
+	}
+	for i, idx := range got {
+		if idx != i {
+			t.Fatalf("order is not a permutation of 0..%d: %v", n-1, p.order)
+		}
+	}
+}
+
+func TestPlayOrderPlaysEveryTrackOncePerRound(t *testing.T) {
+	const n = 20
+	p := NewPlayOrder(n, 7)
+	if p.Current() != 7 {
+		t.Fatalf("Current() = %d, want the starting track 7", p.Current())
+	}
+
+	seen := map[int]bool{7: true}
+	for {
+		idx, ok := p.Next()
+		if !ok {
+			break
+		}
+		if seen[idx] {
+			t.Fatalf("track %d played twice in one round", idx)
+		}
+		seen[idx] = true
+	}
+	if len(seen) != n {
+		t.Fatalf("round played %d tracks, want %d", len(seen), n)
+	}
+
+	last := p.Current()
+	if first := p.Restart(); first == last {
+		t.Errorf("new round started with the track that just played (%d)", last)
+	}
+	checkPermutation(t, p, n)
+}
+
+func TestPlayOrderPreviousWalksHistory(t *testing.T) {
+	p := NewPlayOrder(5, 0)
+	var played []int
+	for i := 0; i < 3; i++ {
+		idx, _ := p.Next()
+		played = append(played, idx)
+	}
+	for i := len(played) - 2; i >= 0; i-- {
+		idx, ok := p.Previous()
+		if !ok || idx != played[i] {
+			t.Fatalf("Previous() = (%d, %v), want (%d, true)", idx, ok, played[i])
+		}
+	}
+	if idx, _ := p.Previous(); idx != 0 {
+		t.Fatalf("Previous() = %d, want the starting track 0", idx)
+	}
+	if _, ok := p.Previous(); ok {
+		t.Fatal("Previous() moved past the start of the history")
+	}
+}
+
+func TestPlayOrderInsertRemoveJump(t *testing.T) {
+	p := NewPlayOrder(5, 2)
+	p.Next()
+	played := p.order[:p.pos+1]
+	playedBefore := append([]int(nil), played...)
+
+	p.Insert(5) // Appended track
+	checkPermutation(t, p, 6)
+	for i, idx := range playedBefore {
+		if p.order[i] != idx {
+			t.Fatalf("Insert changed the history: %v, want prefix %v", p.order, playedBefore)
+		}
+	}
+
+	cur := p.Current()
+	following, _ := p.Peek()
+	if following > cur {
+		following-- // Shifted down by the removal
+	}
+	p.Remove(cur)
+	checkPermutation(t, p, 5)
+	if next, ok := p.Peek(); !ok || next != following {
+		t.Fatalf("Peek() = %d, %v after removing the current track, want %d", next, ok, following)
+	}
+
+	p.Jump(4)
+	if p.Current() != 4 {
+		t.Fatalf("Current() = %d after Jump(4)", p.Current())
+	}
+	checkPermutation(t, p, 5)
+}
+
+func TestQueueShuffleKeepsOriginalOrder(t *testing.T) {
+	q := newTestQueue(10, RepeatOff)
+	original := append(q.Tracks[:0:0], q.Tracks...)
+	q.CurrentIndex = 3
+
+	q.SetShuffle(true)
+	seen := map[int]bool{3: true}
+	for i := 0; i < 4; i++ {
+		if !q.Next() {
+			t.Fatal("Next() ended early while shuffling")
+		}
+		if seen[q.CurrentIndex] {
+			t.Fatalf("track %d repeated before the round ended", q.CurrentIndex)
+		}
+		seen[q.CurrentIndex] = true
+	}
+	for i := range original {
+		if q.Tracks[i] != original[i] {
+			t.Fatal("shuffling reordered the queue's tracks")
+		}
+	}
+
+	current := q.Current()
+	q.SetShuffle(false)
+	if q.Current() != current {
+		t.Fatal("turning shuffle off changed the current track")
+	}
+	want := q.CurrentIndex + 1
+	if q.Next() && q.CurrentIndex != want {
+		t.Errorf("after shuffle off, Next() went to %d, want %d", q.CurrentIndex, want)
+	}
+}
+
+func TestQueueShuffleRepeatOff(t *testing.T) {
+	q := newTestQueue(4, RepeatOff)
+	q.SetShuffle(true)
+	q.Jump(0)
+
+	plays := 1
+	for q.GetNext() != nil {
+		plays++
+		if plays > 4 {
+			t.Fatal("shuffled queue kept playing with repeat off")
+		}
+	}
+	if plays != 4 {
+		t.Errorf("played %d tracks, want 4", plays)
+	}
+}
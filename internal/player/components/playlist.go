@@ -4,10 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/charmbracelet/bubbles/table"
-	"math/rand"
 	"muxic/internal/util"
 	"sort"
-	"strconv"
 )
 
 // Playlist represents a collection of audio tracks
@@ -23,6 +21,7 @@ type PlaylistManager struct {
 	ActivePlaylist *Playlist   `json:"-"`
 	ActiveTrackIdx int         `json:"active_track_idx"`
 	lastID         int         `json:"-"`
+	order          *PlayOrder  // Shuffled play order of the active playlist; nil when shuffle is off
 }
 
 // NewPlaylistManager creates a new playlist manager
@@ -57,6 +56,9 @@ func (pm *PlaylistManager) DeletePlaylist(id int) error {
 			if pm.ActivePlaylist != nil && pm.ActivePlaylist.ID == id {
 				pm.ActivePlaylist = nil
 				pm.ActiveTrackIdx = 0
+				if pm.order != nil {
+					pm.order = NewPlayOrder(0, -1)
+				}
 			}
 			pm.Playlists = append(pm.Playlists[:i], pm.Playlists[i+1:]...)
 			return nil
@@ -83,6 +85,9 @@ func (pm *PlaylistManager) SetActivePlaylist(id int) error {
 	}
 	pm.ActivePlaylist = playlist
 	pm.ActiveTrackIdx = 0
+	if pm.order != nil {
+		pm.order = NewPlayOrder(len(playlist.Tracks), 0)
+	}
 	return nil
 }
 
@@ -92,7 +97,13 @@ func (pm *PlaylistManager) AddTracks(playlistID int, tracks ...*util.AudioFile)
 	if err != nil {
 		return err
 	}
+	start := len(playlist.Tracks)
 	playlist.Tracks = append(playlist.Tracks, tracks...)
+	if pm.order != nil && playlist == pm.ActivePlaylist {
+		for i := start; i < len(playlist.Tracks); i++ {
+			pm.order.Insert(i)
+		}
+	}
 	return nil
 }
 
@@ -106,10 +117,19 @@ func (pm *PlaylistManager) RemoveTrack(playlistID int, trackIndex int) error {
 		return errors.New("track index out of range")
 	}
 	playlist.Tracks = append(playlist.Tracks[:trackIndex], playlist.Tracks[trackIndex+1:]...)
+	if playlist == pm.ActivePlaylist {
+		if pm.order != nil {
+			pm.order.Remove(trackIndex)
+			pm.ActiveTrackIdx = max(pm.order.Current(), 0)
+		} else if trackIndex < pm.ActiveTrackIdx || pm.ActiveTrackIdx >= len(playlist.Tracks) {
+			pm.ActiveTrackIdx = max(pm.ActiveTrackIdx-1, 0)
+		}
+	}
 	return nil
 }
 
-// NextTrack moves to the next track in the active playlist
+// NextTrack moves to the next track in the active playlist. When shuffling it
+// follows the shuffled order, starting a new round once every track has played.
 func (pm *PlaylistManager) NextTrack() (*util.AudioFile, error) {
 	if pm.ActivePlaylist == nil {
 		return nil, errors.New("no active playlist")
@@ -117,11 +137,20 @@ func (pm *PlaylistManager) NextTrack() (*util.AudioFile, error) {
 	if len(pm.ActivePlaylist.Tracks) == 0 {
 		return nil, errors.New("playlist is empty")
 	}
-	pm.ActiveTrackIdx = (pm.ActiveTrackIdx + 1) % len(pm.ActivePlaylist.Tracks)
+	if pm.order != nil {
+		idx, ok := pm.order.Next()
+		if !ok {
+			idx = pm.order.Restart()
+		}
+		pm.ActiveTrackIdx = idx
+	} else {
+		pm.ActiveTrackIdx = (pm.ActiveTrackIdx + 1) % len(pm.ActivePlaylist.Tracks)
+	}
 	return pm.ActivePlaylist.Tracks[pm.ActiveTrackIdx], nil
 }
 
-// PreviousTrack moves to the previous track in the active playlist
+// PreviousTrack moves to the previous track in the active playlist. When
+// shuffling it steps back through the tracks already played in this round.
 func (pm *PlaylistManager) PreviousTrack() (*util.AudioFile, error) {
 	if pm.ActivePlaylist == nil {
 		return nil, errors.New("no active playlist")
@@ -129,6 +158,12 @@ func (pm *PlaylistManager) PreviousTrack() (*util.AudioFile, error) {
 	if len(pm.ActivePlaylist.Tracks) == 0 {
 		return nil, errors.New("playlist is empty")
 	}
+	if pm.order != nil {
+		if idx, ok := pm.order.Previous(); ok {
+			pm.ActiveTrackIdx = idx
+		}
+		return pm.ActivePlaylist.Tracks[pm.ActiveTrackIdx], nil
+	}
 	pm.ActiveTrackIdx--
 	if pm.ActiveTrackIdx < 0 {
 		pm.ActiveTrackIdx = len(pm.ActivePlaylist.Tracks) - 1
@@ -147,38 +182,36 @@ func (pm *PlaylistManager) GetCurrentTrack() (*util.AudioFile, error) {
 	return pm.ActivePlaylist.Tracks[pm.ActiveTrackIdx], nil
 }
 
-// ShufflePlaylist randomizes the order of tracks in a playlist
+// ShufflePlaylist toggles shuffled playback of a playlist, making it the
+// active playlist. The playlist's own track order is left untouched; turning
+// shuffle off continues in that order from the current track.
 func (pm *PlaylistManager) ShufflePlaylist(playlistID int) error {
 	playlist, err := pm.GetPlaylist(playlistID)
 	if err != nil {
 		return err
 	}
-
-	// Store the current track to maintain its position
-	var currentTrack *util.AudioFile
-	if pm.ActivePlaylist != nil && pm.ActivePlaylist.ID == playlistID && len(playlist.Tracks) > 0 {
-		currentTrack = playlist.Tracks[pm.ActiveTrackIdx]
-	}
-
-	// Shuffle all tracks
-	shuffled := make([]*util.AudioFile, len(playlist.Tracks))
-	perm := rand.Perm(len(playlist.Tracks))
-	for i, v := range perm {
-		shuffled[v] = playlist.Tracks[i]
+	if pm.ActivePlaylist != playlist {
+		pm.ActivePlaylist = playlist
+		pm.ActiveTrackIdx = 0
+		pm.order = nil
 	}
-	playlist.Tracks = shuffled
+	pm.SetShuffle(pm.order == nil)
+	return nil
+}
 
-	// Restore current track position if possible
-	if currentTrack != nil {
-		for i, track := range playlist.Tracks {
-			if track == currentTrack {
-				pm.ActiveTrackIdx = i
-				break
-			}
-		}
+// SetShuffle turns shuffled playback of the active playlist on or off.
+func (pm *PlaylistManager) SetShuffle(on bool) {
+	switch {
+	case on && pm.order == nil && pm.ActivePlaylist != nil:
+		pm.order = NewPlayOrder(len(pm.ActivePlaylist.Tracks), pm.ActiveTrackIdx)
+	case !on:
+		pm.order = nil
 	}
+}
 
-	return nil
+// Shuffled reports whether the active playlist is played in shuffled order.
+func (pm *PlaylistManager) Shuffled() bool {
+	return pm.order != nil
 }
 
 // SortPlaylist sorts the tracks in a playlist by a given field
@@ -188,6 +221,12 @@ func (pm *PlaylistManager) SortPlaylist(playlistID int, by string, ascending boo
 		return err
 	}
 
+	// Keep the active track selected, wherever it ends up.
+	var currentTrack *util.AudioFile
+	if playlist == pm.ActivePlaylist && pm.ActiveTrackIdx < len(playlist.Tracks) {
+		currentTrack = playlist.Tracks[pm.ActiveTrackIdx]
+	}
+
 	sort.Slice(playlist.Tracks, func(i, j int) bool {
 		switch by {
 		case "title":
@@ -201,10 +240,16 @@ func (pm *PlaylistManager) SortPlaylist(playlistID int, by string, ascending boo
 			}
 			return playlist.Tracks[i].Artist > playlist.Tracks[j].Artist
 		case "album":
+			// Keep album tracks in disc and track order.
+			if ascending {
+				return albumLess(playlist.Tracks[i], playlist.Tracks[j])
+			}
+			return albumLess(playlist.Tracks[j], playlist.Tracks[i])
+		case "year":
 			if ascending {
-				return playlist.Tracks[i].Album < playlist.Tracks[j].Album
+				return playlist.Tracks[i].Year < playlist.Tracks[j].Year
 			}
-			return playlist.Tracks[i].Album > playlist.Tracks[j].Album
+			return playlist.Tracks[i].Year > playlist.Tracks[j].Year
 		default:
 			if ascending {
 				return playlist.Tracks[i].Title < playlist.Tracks[j].Title
@@ -213,22 +258,29 @@ func (pm *PlaylistManager) SortPlaylist(playlistID int, by string, ascending boo
 		}
 	})
 
+	if currentTrack != nil {
+		for i, track := range playlist.Tracks {
+			if track == currentTrack {
+				pm.ActiveTrackIdx = i
+				break
+			}
+		}
+		if pm.order != nil {
+			// The shuffled order refers to positions that have moved.
+			pm.order = NewPlayOrder(len(playlist.Tracks), pm.ActiveTrackIdx)
+		}
+	}
+
 	return nil
 }
 
-func (pm *PlaylistManager) ToTableRows(playlistID int) []table.Row {
-	playlist, _ := pm.GetPlaylist(playlistID)
-	rows := make([]table.Row, len(playlist.Tracks))
-	for i, t := range playlist.Tracks {
-		rows[i] = table.Row{
-			strconv.Itoa(i + 1),
-			t.Title,
-			t.Artist,
-			t.Album,
-			t.Duration,
-		}
+// ToTableRows converts the tracks of a playlist to table rows with the given columns
+func (pm *PlaylistManager) ToTableRows(playlistID int, columns []TrackColumn) []table.Row {
+	playlist, err := pm.GetPlaylist(playlistID)
+	if err != nil {
+		return []table.Row{}
 	}
-	return rows
+	return TrackRows(playlist.Tracks, columns)
 }
 
 func (p *Playlist) Length() int {
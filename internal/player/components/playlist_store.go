@@ -0,0 +1,203 @@
+package components
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"muxic/internal/util"
+)
+
+// playlistStoreVersion must be bumped whenever the layout of the playlists
+// file changes incompatibly.
+const playlistStoreVersion = 1
+
+// playlistsFileName is the name of the playlists file in the data directory.
+const playlistsFileName = "playlists.json"
+
+// storedPlaylist is the on-disk form of a Playlist. Tracks are stored by path
+// only; their metadata comes from the library when the playlists are loaded.
+type storedPlaylist struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Tracks []string `json:"tracks"`
+}
+
+// storedPlaylists is the on-disk form of a PlaylistManager.
+type storedPlaylists struct {
+	Version   int              `json:"version"`
+	LastID    int              `json:"last_id"`
+	ActiveID  int              `json:"active_id,omitempty"`
+	Playlists []storedPlaylist `json:"playlists"`
+}
+
+// PlaylistStore saves and loads playlists as a JSON file.
+type PlaylistStore struct {
+	path string
+
+	mu      sync.Mutex
+	gen     uint64 // Generation of the most recent snapshot
+	written uint64 // Generation of the snapshot last written to disk
+}
+
+// PlaylistSnapshot is the encoded state of the playlists at one point in time,
+// ready to be written to disk.
+type PlaylistSnapshot struct {
+	data []byte
+	gen  uint64
+}
+
+// DefaultPlaylistsPath returns the location of the playlists file in muxic's data directory.
+func DefaultPlaylistsPath() (string, error) {
+	dir, err := util.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, playlistsFileName), nil
+}
+
+// NewPlaylistStore returns a store backed by the file at path.
+func NewPlaylistStore(path string) *PlaylistStore {
+	return &PlaylistStore{path: path}
+}
+
+// Path returns the location of the playlists file.
+func (s *PlaylistStore) Path() string {
+	return s.path
+}
+
+// Load reads the playlists file. A missing file yields an empty manager. The
+// tracks of the returned playlists are placeholders holding only their path
+// until ResolveTracks is called with the loaded library.
+func (s *PlaylistStore) Load() (*PlaylistManager, error) {
+	pm := NewPlaylistManager()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored storedPlaylists
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("reading playlists from %s: %w", s.path, err)
+	}
+	if stored.Version != playlistStoreVersion {
+		return nil, fmt.Errorf("reading playlists from %s: unsupported version %d", s.path, stored.Version)
+	}
+
+	pm.lastID = stored.LastID
+	for _, sp := range stored.Playlists {
+		playlist := &Playlist{
+			ID:     sp.ID,
+			Name:   sp.Name,
+			Tracks: make([]*util.AudioFile, len(sp.Tracks)),
+		}
+		for i, path := range sp.Tracks {
+			playlist.Tracks[i] = placeholderTrack(path)
+		}
+		pm.Playlists = append(pm.Playlists, playlist)
+
+		// Never hand out an ID that is already taken, even if last_id is stale.
+		if sp.ID > pm.lastID {
+			pm.lastID = sp.ID
+		}
+		if sp.ID == stored.ActiveID {
+			pm.ActivePlaylist = playlist
+		}
+	}
+	return pm, nil
+}
+
+// Snapshot encodes the current state of the playlists. It is cheap and should
+// be taken on the goroutine that owns pm; the snapshot can then be written
+// from any goroutine.
+func (s *PlaylistStore) Snapshot(pm *PlaylistManager) (PlaylistSnapshot, error) {
+	stored := storedPlaylists{
+		Version:   playlistStoreVersion,
+		LastID:    pm.lastID,
+		Playlists: make([]storedPlaylist, len(pm.Playlists)),
+	}
+	if pm.ActivePlaylist != nil {
+		stored.ActiveID = pm.ActivePlaylist.ID
+	}
+	for i, p := range pm.Playlists {
+		sp := storedPlaylist{ID: p.ID, Name: p.Name, Tracks: make([]string, len(p.Tracks))}
+		for j, track := range p.Tracks {
+			sp.Tracks[j] = track.Path
+		}
+		stored.Playlists[i] = sp
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return PlaylistSnapshot{}, err
+	}
+
+	s.mu.Lock()
+	s.gen++
+	gen := s.gen
+	s.mu.Unlock()
+	return PlaylistSnapshot{data: data, gen: gen}, nil
+}
+
+// Write atomically replaces the playlists file with the snapshot. Snapshots
+// older than one already written are dropped, so concurrent writes can't
+// leave stale playlists on disk.
+func (s *PlaylistStore) Write(snap PlaylistSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snap.gen <= s.written {
+		return nil
+	}
+	if err := util.WriteFileAtomic(s.path, snap.data, 0o644); err != nil {
+		return fmt.Errorf("saving playlists: %w", err)
+	}
+	s.written = snap.gen
+	return nil
+}
+
+// Save snapshots and writes the playlists in one go.
+func (s *PlaylistStore) Save(pm *PlaylistManager) error {
+	snap, err := s.Snapshot(pm)
+	if err != nil {
+		return err
+	}
+	return s.Write(snap)
+}
+
+// placeholderTrack stands in for a playlist entry until it is resolved against the library.
+func placeholderTrack(path string) *util.AudioFile {
+	name := filepath.Base(path)
+	return &util.AudioFile{Title: name, Path: path, FileName: name}
+}
+
+// ResolveTracks replaces every playlist entry with the library's track for the
+// same path, as returned by find. Entries the library doesn't have are kept
+// (so saving doesn't drop them) but flagged as missing. It returns the number
+// of missing entries.
+func (pm *PlaylistManager) ResolveTracks(find func(path string) (*util.AudioFile, bool)) int {
+	missing := 0
+	for _, p := range pm.Playlists {
+		for i, track := range p.Tracks {
+			if resolved, ok := find(track.Path); ok {
+				p.Tracks[i] = resolved
+				continue
+			}
+			if !track.Missing {
+				// Copy, so tracks shared with other lists aren't flagged too.
+				flagged := *track
+				flagged.Missing = true
+				p.Tracks[i] = &flagged
+			}
+			missing++
+		}
+	}
+	return missing
+}
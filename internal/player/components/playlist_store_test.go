@@ -0,0 +1,103 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"muxic/internal/util"
+)
+
+func TestPlaylistStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "playlists.json")
+	store := NewPlaylistStore(path)
+
+	a := &util.AudioFile{Title: "A", Path: "/music/a.flac", Picture: &tag.Picture{}}
+	b := &util.AudioFile{Title: "B", Path: "/music/b.mp3"}
+
+	pm := NewPlaylistManager()
+	first, _ := pm.CreatePlaylist("First")
+	second, _ := pm.CreatePlaylist("Second")
+	_ = pm.AddTracks(first.ID, a, b)
+	_ = pm.AddTracks(second.ID, b)
+	_ = pm.DeletePlaylist(first.ID)
+	third, _ := pm.CreatePlaylist("Third")
+	_ = pm.AddTracks(third.ID, a, b)
+	_ = pm.SetActivePlaylist(third.ID)
+
+	if err := store.Save(pm); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "Picture") || strings.Contains(string(data), `"title"`) {
+		t.Errorf("playlists file stores track metadata instead of paths:\n%s", data)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Playlists) != 2 || loaded.ActivePlaylist == nil || loaded.ActivePlaylist.ID != third.ID {
+		t.Fatalf("loaded %d playlists, active %v", len(loaded.Playlists), loaded.ActivePlaylist)
+	}
+	if next, _ := loaded.CreatePlaylist("Fourth"); next.ID != third.ID+1 {
+		t.Errorf("new playlist got ID %d, want %d (lastID not restored)", next.ID, third.ID+1)
+	}
+
+	library := map[string]*util.AudioFile{a.Path: a}
+	missing := loaded.ResolveTracks(func(path string) (*util.AudioFile, bool) {
+		f, ok := library[path]
+		return f, ok
+	})
+	if missing != 2 {
+		t.Errorf("ResolveTracks reported %d missing entries, want 2", missing)
+	}
+	tracks := loaded.ActivePlaylist.Tracks
+	if tracks[0] != a {
+		t.Error("entry in the library was not resolved to the library's track")
+	}
+	if !tracks[1].Missing || tracks[1].Path != b.Path {
+		t.Errorf("entry not in the library = %+v, want it flagged missing with its path kept", tracks[1])
+	}
+}
+
+func TestPlaylistStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	pm, err := NewPlaylistStore(filepath.Join(dir, "none.json")).Load()
+	if err != nil || len(pm.Playlists) != 0 {
+		t.Fatalf("Load of a missing file = (%v, %v), want an empty manager", pm, err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	_ = os.WriteFile(corrupt, []byte("{not json"), 0o644)
+	if _, err := NewPlaylistStore(corrupt).Load(); err == nil {
+		t.Fatal("Load of a corrupt file succeeded")
+	}
+}
+
+func TestPlaylistStoreDropsStaleSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "playlists.json")
+	store := NewPlaylistStore(path)
+	pm := NewPlaylistManager()
+
+	old, _ := store.Snapshot(pm)
+	_, _ = pm.CreatePlaylist("New")
+	latest, _ := store.Snapshot(pm)
+
+	if err := store.Write(latest); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write(old); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Playlists) != 1 {
+		t.Errorf("stale snapshot overwrote the newer one: %d playlists", len(loaded.Playlists))
+	}
+}
@@ -2,9 +2,7 @@ package components
 
 import (
 	"github.com/charmbracelet/bubbles/table"
-	"math/rand"
 	"muxic/internal/util"
-	"strconv"
 	"sync"
 )
 
@@ -12,7 +10,14 @@ type Queue struct {
 	Tracks       []*util.AudioFile
 	CurrentIndex int
 	Playing      bool
+	Repeat       RepeatMode // What happens when a track or the whole queue ends
+	order        *PlayOrder // Shuffled play order; nil when shuffle is off
 	mu           sync.Mutex
+
+	// removed is set once the current track is removed: there is no current
+	// track then, and CurrentIndex is the track before the one removed, so
+	// moving on plays the track that followed it.
+	removed bool
 }
 
 func NewQueue() *Queue {
@@ -21,39 +26,161 @@ func NewQueue() *Queue {
 
 func (q *Queue) Add(track *util.AudioFile) {
 	q.Tracks = append(q.Tracks, track)
+	if q.order != nil {
+		q.order.Insert(len(q.Tracks) - 1)
+	}
 }
 
+// Remove removes the track at index. Removing the current track leaves the
+// queue without one until it moves on, to the track that followed it.
 func (q *Queue) Remove(index int) {
+	current := index == q.CurrentIndex && !q.removed
 	q.Tracks = append(q.Tracks[:index], q.Tracks[index+1:]...)
+	if q.order != nil {
+		q.order.Remove(index)
+		if cur := q.order.Current(); cur >= 0 {
+			q.CurrentIndex = cur
+		}
+	} else if index <= q.CurrentIndex {
+		q.CurrentIndex--
+	}
+	if current {
+		q.removed = true
+	}
 }
 
-func (q *Queue) Next() {
-	q.CurrentIndex++
-	if q.CurrentIndex >= len(q.Tracks) {
-		q.CurrentIndex = 0
+// SetShuffle turns shuffled playback on or off. The tracks themselves are never
+// reordered: turning shuffle off continues in the original order from the
+// current track.
+func (q *Queue) SetShuffle(on bool) {
+	switch {
+	case on && q.order == nil:
+		current := -1
+		if q.Current() != nil {
+			current = q.CurrentIndex
+		}
+		q.order = NewPlayOrder(len(q.Tracks), current)
+	case !on:
+		q.order = nil
 	}
 }
 
+// Shuffled reports whether shuffled playback is on.
+func (q *Queue) Shuffled() bool {
+	return q.order != nil
+}
+
+// Jump makes the track at index the current one.
+func (q *Queue) Jump(index int) {
+	if index < 0 || index >= len(q.Tracks) {
+		return
+	}
+	q.CurrentIndex = index
+	q.removed = false
+	if q.order != nil {
+		q.order.Jump(index)
+	}
+}
+
+// Next moves to the next track, in shuffled order if shuffle is on. Past the
+// last track it wraps around to the first (or starts a new shuffled round)
+// unless repeat is off, in which case it stays put and returns false.
+func (q *Queue) Next() bool {
+	if q.order != nil {
+		if idx, ok := q.order.Next(); ok {
+			q.CurrentIndex, q.removed = idx, false
+			return true
+		}
+		if q.Repeat == RepeatOff || len(q.Tracks) == 0 {
+			return false
+		}
+		q.CurrentIndex, q.removed = q.order.Restart(), false
+		return true
+	}
+	if q.CurrentIndex+1 < len(q.Tracks) {
+		q.CurrentIndex++
+		q.removed = false
+		return true
+	}
+	if q.Repeat == RepeatOff || len(q.Tracks) == 0 {
+		return false
+	}
+	q.CurrentIndex, q.removed = 0, false
+	return true
+}
+
+// GetNext advances to the track that should play once the current one has
+// finished and returns it: the same track when repeating one, otherwise the
+// next one as for Next. It returns nil at the end of the queue, and when
+// repeating a track that was removed.
 func (q *Queue) GetNext() *util.AudioFile {
-	q.Next()
+	if q.Repeat == RepeatOne {
+		return q.Current()
+	}
+	if !q.Next() {
+		return nil
+	}
 	return q.Current()
 }
 
-func (q *Queue) Previous() {
-	q.CurrentIndex--
-	if q.CurrentIndex < 0 {
-		q.CurrentIndex = len(q.Tracks) - 1
+// PeekNext returns the track GetNext would return, without advancing. When
+// shuffling, the first track of a new round is only picked once it is reached,
+// so at the end of a round it returns nil.
+func (q *Queue) PeekNext() *util.AudioFile {
+	switch {
+	case q.Repeat == RepeatOne:
+		return q.Current()
+	case q.order != nil:
+		if idx, ok := q.order.Peek(); ok {
+			return q.Tracks[idx]
+		}
+		return nil
+	case q.CurrentIndex+1 < len(q.Tracks):
+		return q.Tracks[q.CurrentIndex+1]
+	case q.Repeat == RepeatAll && len(q.Tracks) > 0:
+		return q.Tracks[0]
 	}
+	return nil
 }
 
-func (q *Queue) Shuffle() {
-	rand.Shuffle(len(q.Tracks), func(i, j int) {
-		q.Tracks[i], q.Tracks[j] = q.Tracks[j], q.Tracks[i]
-	})
+// Previous moves to the previous track. When shuffling it steps back through
+// the tracks played in this round. Otherwise, before the first track it wraps
+// around to the last unless repeat is off. After the current track was
+// removed, the previous track is the one before it. It returns false if it
+// stays put.
+func (q *Queue) Previous() bool {
+	if q.order != nil {
+		var idx int
+		var ok bool
+		if q.removed {
+			// The order is already back on the track before the one removed.
+			idx = q.order.Current()
+			ok = idx >= 0
+		} else {
+			idx, ok = q.order.Previous()
+		}
+		if ok {
+			q.CurrentIndex, q.removed = idx, false
+		}
+		return ok
+	}
+	if q.removed && q.CurrentIndex >= 0 {
+		q.removed = false
+		return true
+	}
+	if q.CurrentIndex > 0 {
+		q.CurrentIndex--
+		return true
+	}
+	if q.Repeat == RepeatOff || len(q.Tracks) == 0 {
+		return false
+	}
+	q.CurrentIndex, q.removed = len(q.Tracks)-1, false
+	return true
 }
 
 func (q *Queue) Current() *util.AudioFile {
-	if len(q.Tracks) == 0 || q.CurrentIndex < 0 || q.CurrentIndex >= len(q.Tracks) {
+	if q.removed || len(q.Tracks) == 0 || q.CurrentIndex < 0 || q.CurrentIndex >= len(q.Tracks) {
 		return nil
 	}
 	return q.Tracks[q.CurrentIndex]
@@ -61,6 +188,11 @@ func (q *Queue) Current() *util.AudioFile {
 
 func (q *Queue) Clear() {
 	q.Tracks = nil
+	q.CurrentIndex = 0
+	q.removed = false
+	if q.order != nil {
+		q.order = NewPlayOrder(0, -1)
+	}
 }
 
 func (q *Queue) Length() int {
@@ -71,16 +203,6 @@ func (q *Queue) IsEmpty() bool {
 	return len(q.Tracks) == 0
 }
 
-func (q *Queue) ToTableRows() []table.Row {
-	rows := make([]table.Row, len(q.Tracks))
-	for i, t := range q.Tracks {
-		rows[i] = table.Row{
-			strconv.Itoa(i + 1),
-			t.Title,
-			t.Artist,
-			t.Album,
-			t.Duration,
-		}
-	}
-	return rows
+func (q *Queue) ToTableRows(columns []TrackColumn) []table.Row {
+	return TrackRows(q.Tracks, columns)
 }
@@ -0,0 +1,180 @@
+package components
+
+import (
+	"testing"
+
+	"muxic/internal/util"
+)
+
+func newTestQueue(n int, repeat RepeatMode) *Queue {
+	q := NewQueue()
+	for i := 0; i < n; i++ {
+		q.Add(&util.AudioFile{Title: string(rune('A' + i))})
+	}
+	q.Repeat = repeat
+	return q
+}
+
+func TestQueueGetNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		repeat RepeatMode
+		start  int
+		want   string // Title of the returned track; "" for nil
+		index  int    // CurrentIndex afterwards
+	}{
+		{"off middle", RepeatOff, 0, "B", 1},
+		{"off end", RepeatOff, 2, "", 2},
+		{"one middle", RepeatOne, 1, "B", 1},
+		{"one end", RepeatOne, 2, "C", 2},
+		{"all middle", RepeatAll, 1, "C", 2},
+		{"all end", RepeatAll, 2, "A", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(3, tt.repeat)
+			q.CurrentIndex = tt.start
+
+			got := q.GetNext()
+			title := ""
+			if got != nil {
+				title = got.Title
+			}
+			if title != tt.want {
+				t.Errorf("GetNext() = %q, want %q", title, tt.want)
+			}
+			if q.CurrentIndex != tt.index {
+				t.Errorf("CurrentIndex = %d, want %d", q.CurrentIndex, tt.index)
+			}
+		})
+	}
+}
+
+func TestQueuePeekNextMatchesGetNext(t *testing.T) {
+	for _, repeat := range []RepeatMode{RepeatOff, RepeatOne, RepeatAll} {
+		for _, shuffle := range []bool{false, true} {
+			q := newTestQueue(4, repeat)
+			q.SetShuffle(shuffle)
+			// Walk past the end of the queue, where repeating wraps around.
+			for i := 0; i < 6; i++ {
+				peeked := q.PeekNext()
+				if got := q.GetNext(); peeked != nil && peeked != got {
+					t.Fatalf("repeat %v, shuffle %v, step %d: PeekNext = %v, GetNext = %v", repeat, shuffle, i, peeked, got)
+				} else if peeked == nil && got != nil && !shuffle {
+					t.Fatalf("repeat %v, step %d: PeekNext = nil, GetNext = %v", repeat, i, got)
+				}
+			}
+		}
+	}
+}
+
+func TestQueueNextPrevious(t *testing.T) {
+	tests := []struct {
+		name     string
+		repeat   RepeatMode
+		start    int
+		forward  bool
+		wantOK   bool
+		wantIdx  int
+		numTrack int
+	}{
+		{"next off end", RepeatOff, 2, true, false, 2, 3},
+		{"next one end wraps", RepeatOne, 2, true, true, 0, 3},
+		{"next all end wraps", RepeatAll, 2, true, true, 0, 3},
+		{"previous off start", RepeatOff, 0, false, false, 0, 3},
+		{"previous all start wraps", RepeatAll, 0, false, true, 2, 3},
+		{"previous middle", RepeatOff, 1, false, true, 0, 3},
+		{"next empty", RepeatAll, 0, true, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(tt.numTrack, tt.repeat)
+			q.CurrentIndex = tt.start
+
+			var ok bool
+			if tt.forward {
+				ok = q.Next()
+			} else {
+				ok = q.Previous()
+			}
+			if ok != tt.wantOK || q.CurrentIndex != tt.wantIdx {
+				t.Errorf("got (%v, %d), want (%v, %d)", ok, q.CurrentIndex, tt.wantOK, tt.wantIdx)
+			}
+		})
+	}
+}
+
+func TestQueueRemoveCurrent(t *testing.T) {
+	tests := []struct {
+		name     string
+		repeat   RepeatMode
+		current  int
+		previous bool   // Move back instead of on
+		want     string // Title of the track moved to; "" if it stays put
+	}{
+		{"first", RepeatOff, 0, false, "B"},
+		{"middle", RepeatOff, 1, false, "C"},
+		{"last", RepeatOff, 2, false, ""},
+		{"last wraps", RepeatAll, 2, false, "A"},
+		{"repeating one", RepeatOne, 1, false, ""},
+		{"back from middle", RepeatOff, 1, true, "A"},
+		{"back from first", RepeatOff, 0, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(4, tt.repeat)
+			q.Remove(3) // D; C is the last track
+			q.Jump(tt.current)
+			q.Remove(tt.current)
+			if got := q.Current(); got != nil {
+				t.Errorf("current track is %s after removing it", got.Title)
+			}
+
+			peeked := q.PeekNext()
+			var got *util.AudioFile
+			if tt.previous {
+				if q.Previous() {
+					got = q.Current()
+				}
+			} else {
+				got = q.GetNext()
+				if peeked != got {
+					t.Errorf("PeekNext = %v, GetNext = %v", peeked, got)
+				}
+			}
+			title := ""
+			if got != nil {
+				title = got.Title
+			}
+			if title != tt.want {
+				t.Errorf("moved to %q, want %q", title, tt.want)
+			}
+		})
+	}
+
+	// When shuffling, the track that was to follow the removed one still does.
+	q := newTestQueue(5, RepeatOff)
+	q.SetShuffle(true)
+	q.GetNext()
+	q.GetNext()
+	want := q.PeekNext()
+	q.Remove(q.CurrentIndex)
+	if got := q.GetNext(); got != want {
+		t.Errorf("shuffled, moved to %v after removing the current track, want %v", got, want)
+	}
+}
+
+func TestRepeatModeNextCycles(t *testing.T) {
+	mode := RepeatOff
+	var seen []string
+	for i := 0; i < 4; i++ {
+		mode = mode.Next()
+		seen = append(seen, mode.String())
+	}
+	want := []string{"all", "one", "off", "all"}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("cycle = %v, want %v", seen, want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package components
 import (
 	"github.com/charmbracelet/bubbles/table"
 	"muxic/internal/util"
-	"strconv"
 )
 
 type Search struct {
@@ -22,16 +21,6 @@ func (s *Search) GetTracks() []*util.AudioFile {
 	return s.Tracks
 }
 
-func (s *Search) ToTableRows() []table.Row {
-	rows := make([]table.Row, len(s.Tracks))
-	for i, t := range s.Tracks {
-		rows[i] = table.Row{
-			strconv.Itoa(i + 1),
-			t.Title,
-			t.Artist,
-			t.Album,
-			t.Duration,
-		}
-	}
-	return rows
+func (s *Search) ToTableRows(columns []TrackColumn) []table.Row {
+	return TrackRows(s.Tracks, columns)
 }
@@ -0,0 +1,92 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSkipStep and DefaultLongSkipStep are how far the skip actions
+	// seek unless the config says otherwise.
+	DefaultSkipStep     = 10 * time.Second
+	DefaultLongSkipStep = time.Minute
+	// MaxSkipStep bounds the configured skip steps.
+	MaxSkipStep = time.Hour
+)
+
+// ErrInvalidLoop is returned for an A-B loop that doesn't end after it starts.
+var ErrInvalidLoop = errors.New("loop must end after it starts")
+
+// ParseSeekTarget parses a position typed into the go-to-time prompt, for a
+// track at pos that lasts total. It accepts a timestamp ("1:23.5", "1:02:03"
+// or "83"), a duration with units ("90s", "1m30s"), or a percentage of the
+// track ("50%"). A leading + or - makes any of them relative to pos. The
+// result isn't clamped to the track.
+func ParseSeekTarget(s string, pos, total time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	sign := 0
+	if strings.HasPrefix(s, "+") {
+		sign, s = 1, s[1:]
+	} else if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+
+	var d time.Duration
+	switch {
+	case strings.HasSuffix(s, "%"):
+		pct, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-1]), 64)
+		if err != nil || pct < 0 || math.IsInf(pct, 0) {
+			return 0, fmt.Errorf("invalid percentage %q", s)
+		}
+		if total <= 0 {
+			return 0, errors.New("the length of the track is unknown")
+		}
+		d = time.Duration(float64(total) * pct / 100)
+	case strings.ContainsAny(s, "hmsuµn"):
+		var err error
+		if d, err = time.ParseDuration(s); err != nil || d < 0 || strings.HasPrefix(s, "+") {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	default:
+		var ok bool
+		if d, ok = parseTimestamp(s); !ok {
+			return 0, fmt.Errorf("invalid time %q (use 1:23.5, -30s or 50%%)", s)
+		}
+	}
+
+	if sign != 0 {
+		return pos + time.Duration(sign)*d, nil
+	}
+	return d, nil
+}
+
+// parseTimestamp parses seconds, minutes:seconds or hours:minutes:seconds.
+// Only the seconds may have a fraction, and every field but the first must
+// be under 60.
+func parseTimestamp(s string) (time.Duration, bool) {
+	fields := strings.Split(s, ":")
+	if len(fields) > 3 {
+		return 0, false
+	}
+	last := len(fields) - 1
+	secs, err := strconv.ParseFloat(fields[last], 64)
+	if err != nil || secs < 0 || math.IsInf(secs, 0) || strings.ContainsAny(fields[last], "+-eEInN") ||
+		(last > 0 && secs >= 60) {
+		return 0, false
+	}
+	d := time.Duration(math.Round(secs * float64(time.Second)))
+	unit := time.Minute
+	for i := last - 1; i >= 0; i-- {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || n < 0 || strings.HasPrefix(fields[i], "+") || (i > 0 && n >= 60) {
+			return 0, false
+		}
+		d += time.Duration(n) * unit
+		unit *= 60
+	}
+	return d, true
+}
@@ -0,0 +1,41 @@
+package components
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSeekTarget(t *testing.T) {
+	const pos, total = 2 * time.Minute, 4 * time.Minute
+	for _, tt := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"83", 83 * time.Second},
+		{"1:23.5", 83500 * time.Millisecond},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"0:05", 5 * time.Second},
+		{" 90s ", 90 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"50%", 2 * time.Minute},
+		{"12.5%", 30 * time.Second},
+		{"-30s", 90 * time.Second},
+		{"+1:00", 3 * time.Minute},
+		{"-10%", 2*time.Minute - 24*time.Second},
+		{"-3:00", -time.Minute}, // Clamped by the engine
+	} {
+		got, err := ParseSeekTarget(tt.in, pos, total)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSeekTarget(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1:60", "1:-5", "1:2:3:4", "1e3", "--5", "+-5s", "x%", "NaN", "1:2.5:3"} {
+		if got, err := ParseSeekTarget(in, pos, total); err == nil {
+			t.Errorf("ParseSeekTarget(%q) = %v, want an error", in, got)
+		}
+	}
+	if _, err := ParseSeekTarget("50%", pos, 0); err == nil {
+		t.Error("a percentage of a track of unknown length was accepted")
+	}
+}
@@ -0,0 +1,119 @@
+package components
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"muxic/internal/util"
+)
+
+// sessionVersion must be bumped whenever the layout of the session file
+// changes incompatibly.
+const sessionVersion = 1
+
+// sessionFileName is the name of the session file in the state directory.
+const sessionFileName = "session.json"
+
+// Session is the playback state saved on quit, so the next launch can pick up
+// where the last one left off. Tracks are stored by path only, as in the
+// playlists file.
+type Session struct {
+	Version      int                `json:"version"`
+	Queue        []string           `json:"queue"`
+	CurrentIndex int                `json:"current_index"`
+	Track        string             `json:"track,omitempty"` // Track playing or paused on quit; empty if stopped
+	Position     time.Duration      `json:"position"`        // Playback position within Track
+	Volume       float64            `json:"volume"`
+	Repeat       string             `json:"repeat"`
+	Shuffle      bool               `json:"shuffle"`
+	View         string             `json:"view"`              // Active view, by its config file name
+	Cursors      map[string]int     `json:"cursors,omitempty"` // Table cursor of each view, by view name
+	Equalizer    *EQSettings        `json:"equalizer,omitempty"`
+	Speeds       map[string]float64 `json:"speeds,omitempty"` // Speeds remembered for tracks and albums
+}
+
+// DefaultSessionPath returns the location of the session file in muxic's state directory.
+func DefaultSessionPath() (string, error) {
+	dir, err := util.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionFileName), nil
+}
+
+// LoadSession reads the session file. A missing file yields a nil session.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("reading session from %s: %w", path, err)
+	}
+	if s.Version != sessionVersion {
+		return nil, fmt.Errorf("reading session from %s: unsupported version %d", path, s.Version)
+	}
+	return &s, nil
+}
+
+// Save atomically replaces the session file at path with s.
+func (s *Session) Save(path string) error {
+	s.Version = sessionVersion
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(path, data, 0o644); err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+	return nil
+}
+
+// ApplyTo overrides the startup settings of cfg with the ones saved in the
+// session. Values the session doesn't hold, or that are no longer valid, keep
+// the configured ones.
+func (s *Session) ApplyTo(cfg *Config) {
+	if s.Volume >= minVolume && s.Volume <= maxVolume {
+		cfg.Volume = s.Volume
+	}
+	if repeat, ok := ParseRepeatMode(s.Repeat); ok {
+		cfg.RepeatMode = repeat
+	}
+	cfg.Shuffle = s.Shuffle
+	if view, ok := viewNames[s.View]; ok {
+		cfg.DefaultView = view
+	}
+	if s.Equalizer != nil {
+		cfg.Equalizer = s.Equalizer.clamped()
+	}
+	cfg.LastPlayedFile = s.Track
+	cfg.LastPosition = s.Position
+	cfg.RememberedSpeeds = s.Speeds
+}
+
+// ResolveQueue looks up the saved queue in the library with find. Tracks the
+// library no longer has are dropped, and current is the index of the saved
+// current track among the rest, or of the one after it if it was dropped.
+func (s *Session) ResolveQueue(find func(path string) (*util.AudioFile, bool)) (tracks []*util.AudioFile, current int) {
+	for i, path := range s.Queue {
+		if i == s.CurrentIndex {
+			current = len(tracks)
+		}
+		if track, ok := find(path); ok {
+			tracks = append(tracks, track)
+		}
+	}
+	if current >= len(tracks) {
+		current = 0
+	}
+	return tracks, current
+}
@@ -0,0 +1,112 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"muxic/internal/util"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "session.json")
+	saved := &Session{
+		Queue:        []string{"/music/a.flac", "/music/b.mp3"},
+		CurrentIndex: 1,
+		Track:        "/music/b.mp3",
+		Position:     83*time.Minute + 12*time.Second,
+		Volume:       35,
+		Repeat:       "all",
+		Shuffle:      true,
+		View:         "queue",
+		Cursors:      map[string]int{"library": 40, "queue": 1},
+		Equalizer:    &EQSettings{Enabled: true, PreAmp: -3, Gains: EQGains{2: 4, 7: -2.5}},
+		Speeds:       map[string]float64{"track:/music/a.flac": 1.5},
+	}
+	if err := saved.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("loaded %+v, want %+v", loaded, saved)
+	}
+
+	cfg := DefaultConfig()
+	loaded.ApplyTo(&cfg)
+	if cfg.Volume != 35 || cfg.RepeatMode != RepeatAll || !cfg.Shuffle || cfg.DefaultView != ViewQueue {
+		t.Errorf("settings = %v %v %v %v, want 35 all true queue", cfg.Volume, cfg.RepeatMode, cfg.Shuffle, cfg.DefaultView)
+	}
+	if cfg.LastPlayedFile != saved.Track || cfg.LastPosition != saved.Position {
+		t.Errorf("resume = %q at %v, want %q at %v", cfg.LastPlayedFile, cfg.LastPosition, saved.Track, saved.Position)
+	}
+	if !reflect.DeepEqual(cfg.RememberedSpeeds, saved.Speeds) {
+		t.Errorf("RememberedSpeeds = %v, want %v", cfg.RememberedSpeeds, saved.Speeds)
+	}
+	if cfg.Equalizer != *saved.Equalizer {
+		t.Errorf("Equalizer = %+v, want %+v", cfg.Equalizer, *saved.Equalizer)
+	}
+}
+
+func TestLoadSession(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := LoadSession(filepath.Join(dir, "none.json"))
+	if err != nil || s != nil {
+		t.Errorf("missing file = %+v, %v; want nil, nil", s, err)
+	}
+
+	path := filepath.Join(dir, "session.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSession(path); err == nil {
+		t.Error("session with an unknown version loaded")
+	}
+}
+
+func TestSessionApplyToKeepsInvalidSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	(&Session{Volume: 300, Repeat: "sometimes", View: "settings"}).ApplyTo(&cfg)
+	want := DefaultConfig()
+	if cfg.Volume != want.Volume || cfg.RepeatMode != want.RepeatMode || cfg.DefaultView != want.DefaultView {
+		t.Errorf("invalid session settings were applied: %v %v %v", cfg.Volume, cfg.RepeatMode, cfg.DefaultView)
+	}
+}
+
+func TestSessionResolveQueue(t *testing.T) {
+	a := &util.AudioFile{Path: "/a"}
+	c := &util.AudioFile{Path: "/c"}
+	library := map[string]*util.AudioFile{a.Path: a, c.Path: c}
+	find := func(path string) (*util.AudioFile, bool) {
+		f, ok := library[path]
+		return f, ok
+	}
+
+	tests := []struct {
+		name        string
+		current     int
+		wantCurrent int
+	}{
+		{"current kept", 2, 1},
+		{"current dropped", 1, 1},
+		{"last dropped", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{Queue: []string{"/a", "/b", "/c", "/d"}, CurrentIndex: tt.current}
+			tracks, current := s.ResolveQueue(find)
+			if len(tracks) != 2 || tracks[0] != a || tracks[1] != c {
+				t.Errorf("tracks = %v, want [a c]", tracks)
+			}
+			if current != tt.wantCurrent {
+				t.Errorf("current = %d, want %d", current, tt.wantCurrent)
+			}
+		})
+	}
+}
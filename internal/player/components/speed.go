@@ -0,0 +1,392 @@
+package components
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep"
+
+	"muxic/internal/util"
+)
+
+const (
+	// MinSpeed and MaxSpeed bound the playback speed.
+	MinSpeed = 0.5
+	MaxSpeed = 3.0
+
+	// stretchHop is how much output each frame of the time stretch adds. Frames
+	// are twice as long, so each one overlaps the next by half.
+	stretchHop = 12 * time.Millisecond
+	// stretchTolerance is how far a frame may be moved from where the speed
+	// puts it, to line its waveform up with the end of the last frame.
+	stretchTolerance = 6 * time.Millisecond
+)
+
+// RememberSpeed selects whether the speed set while a track plays is kept for
+// it, and for what.
+type RememberSpeed int
+
+const (
+	RememberSpeedOff   RememberSpeed = iota // Every track plays at the same speed
+	RememberSpeedTrack                      // Each track keeps its own speed
+	RememberSpeedAlbum                      // Each album keeps its own speed
+)
+
+var rememberSpeedNames = []string{"off", "track", "album"}
+
+func (r RememberSpeed) String() string {
+	if r < 0 || int(r) >= len(rememberSpeedNames) {
+		return "unknown"
+	}
+	return rememberSpeedNames[r]
+}
+
+// ParseRememberSpeed parses a name as returned by RememberSpeed.String.
+func ParseRememberSpeed(s string) (RememberSpeed, bool) {
+	for i, name := range rememberSpeedNames {
+		if s == name {
+			return RememberSpeed(i), true
+		}
+	}
+	return RememberSpeedOff, false
+}
+
+// RememberSpeedNames returns the names of the modes, for help texts.
+func RememberSpeedNames() []string {
+	return append([]string(nil), rememberSpeedNames...)
+}
+
+// SpeedSettings configure the playback speed.
+type SpeedSettings struct {
+	Speed float64 // Speed of tracks without a remembered one, MinSpeed to MaxSpeed
+	// PreservePitch stretches time, keeping voices natural. Without it the
+	// tracks are resampled, which raises the pitch along with the speed.
+	PreservePitch bool
+	Remember      RememberSpeed
+}
+
+// clampSpeed bounds speed to MinSpeed-MaxSpeed and rounds it to hundredths,
+// so stepping away from the normal speed and back returns to exactly 1.
+// Anything invalid is taken to be the normal speed.
+func clampSpeed(speed float64) float64 {
+	if !(speed > 0) || math.IsInf(speed, 0) {
+		return 1
+	}
+	return max(MinSpeed, min(math.Round(speed*100)/100, MaxSpeed))
+}
+
+// SpeedMemory holds the speeds remembered for tracks or albums, by track
+// path or by album. It is safe for concurrent use.
+type SpeedMemory struct {
+	mu     sync.Mutex
+	mode   RememberSpeed
+	speeds map[string]float64
+}
+
+// NewSpeedMemory returns a memory remembering speeds as mode says, starting
+// with speeds, as returned by Speeds.
+func NewSpeedMemory(mode RememberSpeed, speeds map[string]float64) *SpeedMemory {
+	m := &SpeedMemory{mode: mode, speeds: make(map[string]float64, len(speeds))}
+	for k, v := range speeds {
+		m.speeds[k] = clampSpeed(v)
+	}
+	return m
+}
+
+// key returns the name track's speed is remembered under, or "" if speeds
+// aren't remembered.
+func (m *SpeedMemory) key(track *util.AudioFile) string {
+	switch {
+	case m == nil || track == nil:
+		return ""
+	case m.mode == RememberSpeedTrack:
+		return "track:" + track.Path
+	case m.mode == RememberSpeedAlbum && track.Album != "":
+		return "album:" + albumArtist(track) + "/" + track.Album
+	}
+	return ""
+}
+
+// Lookup returns the speed remembered for track.
+func (m *SpeedMemory) Lookup(track *util.AudioFile) (float64, bool) {
+	key := m.key(track)
+	if key == "" {
+		return 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	speed, ok := m.speeds[key]
+	return speed, ok
+}
+
+// Remember keeps speed for track, reporting false if speeds aren't
+// remembered. The default speed isn't kept, so it follows the configured one.
+func (m *SpeedMemory) Remember(track *util.AudioFile, speed, def float64) bool {
+	key := m.key(track)
+	if key == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if speed == def {
+		delete(m.speeds, key)
+	} else {
+		m.speeds[key] = speed
+	}
+	return true
+}
+
+// Speeds returns a copy of the remembered speeds, to be saved.
+func (m *SpeedMemory) Speeds() map[string]float64 {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.speeds) == 0 {
+		return nil
+	}
+	speeds := make(map[string]float64, len(m.speeds))
+	for k, v := range m.speeds {
+		speeds[k] = v
+	}
+	return speeds
+}
+
+// stretcher changes the speed of Streamer keeping its pitch, by waveform
+// similarity overlap-add (WSOLA). The input is cut into overlapping frames
+// taken a hop times the speed apart and laid out a hop apart; each frame is
+// moved within a tolerance to where its waveform best continues the one
+// before, and crossfaded into it over the overlap. At the normal speed the
+// input passes through untouched.
+type stretcher struct {
+	Streamer beep.Streamer
+	speed    float64
+
+	hop       int       // Samples of output each frame adds
+	tolerance int       // How far a frame may move, in samples
+	window    []float64 // Gain of the incoming frame across the overlap
+
+	in     [][2]float64 // Input from the oldest sample a frame may still use
+	cont   int          // Index in in of the natural continuation of the last frame
+	pos    float64      // Index in in where the speed puts the next frame
+	ended  bool         // Whether Streamer has run out
+	out    [][2]float64 // Scratch buffer for one hop of output
+	queued [][2]float64 // Output not yet streamed
+
+	// Scratch buffers for finding where frames line up.
+	target, candidates []float64
+}
+
+func newStretcher(s beep.Streamer, rate beep.SampleRate) *stretcher {
+	t := &stretcher{
+		Streamer:  s,
+		speed:     1,
+		hop:       rate.N(stretchHop),
+		tolerance: rate.N(stretchTolerance),
+	}
+	t.window = make([]float64, t.hop)
+	for i := range t.window {
+		t.window[i] = (1 - math.Cos(math.Pi*(float64(i)+0.5)/float64(t.hop))) / 2
+	}
+	return t
+}
+
+// reset drops the buffered input, to start afresh from Streamer.
+func (t *stretcher) reset() {
+	t.in, t.cont, t.pos, t.ended, t.queued = t.in[:0], 0, 0, false, nil
+}
+
+// setSpeed changes the speed from the next frame. Returning to the normal
+// speed first plays out the buffered input from where the last frame ended,
+// so the change is seamless either way.
+func (t *stretcher) setSpeed(speed float64) {
+	t.speed = speed
+}
+
+func (t *stretcher) Stream(samples [][2]float64) (int, bool) {
+	n := 0
+	for n < len(samples) {
+		if len(t.queued) > 0 {
+			c := copy(samples[n:], t.queued)
+			t.queued = t.queued[c:]
+			n += c
+			continue
+		}
+		if t.speed == 1 {
+			if t.cont < len(t.in) {
+				c := copy(samples[n:], t.in[t.cont:])
+				t.cont += c
+				n += c
+				continue
+			}
+			t.in, t.cont, t.pos = t.in[:0], 0, 0
+			if t.ended {
+				break
+			}
+			m, ok := t.Streamer.Stream(samples[n:])
+			n += m
+			if !ok || m == 0 {
+				t.ended = true
+				break
+			}
+			continue
+		}
+		if !t.step() {
+			break
+		}
+	}
+	return n, n > 0
+}
+
+// Err returns the error of Streamer.
+func (t *stretcher) Err() error {
+	return t.Streamer.Err()
+}
+
+// step queues the output of the next frame, reporting false once the input
+// has run out.
+func (t *stretcher) step() bool {
+	center := int(math.Round(t.pos))
+	if !t.fill(max(t.cont, center+t.tolerance) + t.hop) {
+		// Too little input is left for a frame: play the rest as it is.
+		t.queued = append(t.out[:0], t.in[min(t.cont, len(t.in)):]...)
+		t.cont = len(t.in)
+		return len(t.queued) > 0
+	}
+
+	frame := t.bestFrame(max(0, center-t.tolerance), center+t.tolerance, center)
+	t.out = t.out[:0]
+	for i, w := range t.window {
+		a, b := t.in[t.cont+i], t.in[frame+i]
+		t.out = append(t.out, [2]float64{a[0]*(1-w) + b[0]*w, a[1]*(1-w) + b[1]*w})
+	}
+	t.queued = t.out
+	t.cont = frame + t.hop
+	t.pos += float64(t.hop) * t.speed
+
+	// Drop the input no frame can use any more.
+	if drop := min(t.cont, int(t.pos)-t.tolerance); drop > len(t.in)/2 {
+		t.in = t.in[:copy(t.in, t.in[drop:])]
+		t.cont -= drop
+		t.pos -= float64(drop)
+	}
+	return true
+}
+
+// fill reads from Streamer until in holds n samples, reporting whether it
+// does.
+func (t *stretcher) fill(n int) bool {
+	for len(t.in) < n && !t.ended {
+		have := len(t.in)
+		t.in = slices.Grow(t.in, n-have)[:n]
+		m, ok := t.Streamer.Stream(t.in[have:])
+		t.in = t.in[:have+m]
+		if !ok || m == 0 {
+			t.ended = true
+		}
+	}
+	return len(t.in) >= n
+}
+
+// bestFrame returns the start of the frame between first and last whose
+// waveform best continues the last frame, by normalised cross-correlation
+// with the natural continuation. Ties, such as silence, go to center.
+func (t *stretcher) bestFrame(first, last, center int) int {
+	mono := func(dst []float64, src [][2]float64) []float64 {
+		dst = dst[:0]
+		for _, s := range src {
+			dst = append(dst, s[0]+s[1])
+		}
+		return dst
+	}
+	t.target = mono(t.target, t.in[t.cont:t.cont+t.hop])
+	t.candidates = mono(t.candidates, t.in[first:last+t.hop])
+
+	energy := 0.0
+	for _, v := range t.candidates[:t.hop] {
+		energy += v * v
+	}
+	best, bestScore := center, math.Inf(-1)
+	for c := first; c <= last; c++ {
+		y := t.candidates[c-first : c-first+t.hop]
+		if c > first {
+			prev, next := t.candidates[c-first-1], y[t.hop-1]
+			energy += next*next - prev*prev
+		}
+		score := 0.0
+		if energy > 1e-12 {
+			dot := 0.0
+			for i, x := range t.target {
+				dot += x * y[i]
+			}
+			score = dot / math.Sqrt(energy)
+		}
+		if score > bestScore || (score == bestScore && abs(c-center) < abs(best-center)) {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// speedStage plays Streamer at a variable speed, by a stretcher or, without
+// pitch preservation, by resampling. It is used with the output locked.
+type speedStage struct {
+	stretch   *stretcher
+	resampler *beep.Resampler // Used instead of stretch unless preserving pitch
+	source    beep.Streamer
+	speed     float64
+	quality   int // Resampling quality
+}
+
+func newSpeedStage(s beep.Streamer, rate beep.SampleRate) *speedStage {
+	return &speedStage{stretch: newStretcher(s, rate), source: s, speed: 1, quality: DefaultResampleQuality}
+}
+
+// setPreservePitch picks between stretching and resampling, dropping what
+// either has buffered.
+func (s *speedStage) setPreservePitch(on bool) {
+	s.resampler = nil
+	if !on {
+		s.resampler = beep.ResampleRatio(s.quality, s.speed, s.source)
+	}
+	s.reset()
+}
+
+// setSpeed changes the speed from the next sample.
+func (s *speedStage) setSpeed(speed float64) {
+	s.speed = speed
+	s.stretch.setSpeed(speed)
+	if s.resampler != nil {
+		s.resampler.SetRatio(speed)
+	}
+}
+
+// reset drops the buffered input, to start afresh from the source, as after
+// a seek.
+func (s *speedStage) reset() {
+	s.stretch.reset()
+	if s.resampler != nil {
+		s.resampler = beep.ResampleRatio(s.quality, s.speed, s.source)
+	}
+}
+
+func (s *speedStage) Stream(samples [][2]float64) (int, bool) {
+	if s.resampler != nil {
+		return s.resampler.Stream(samples)
+	}
+	return s.stretch.Stream(samples)
+}
+
+func (s *speedStage) Err() error {
+	return s.source.Err()
+}
@@ -0,0 +1,204 @@
+package components
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep"
+
+	"muxic/internal/util"
+)
+
+// streamAll streams s to the end in buffers of varying sizes.
+func streamAll(s beep.Streamer) [][2]float64 {
+	var out [][2]float64
+	buf := make([][2]float64, 1000)
+	for i := 0; ; i++ {
+		n, ok := s.Stream(buf[:300+i%701])
+		out = append(out, buf[:n]...)
+		if !ok {
+			return out
+		}
+	}
+}
+
+// pitch estimates the frequency of a sine from its upward zero crossings.
+func pitch(samples [][2]float64, rate beep.SampleRate) float64 {
+	first, last, crossings := -1, -1, 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1][0] < 0 && samples[i][0] >= 0 {
+			if first < 0 {
+				first = i
+			} else {
+				crossings++
+			}
+			last = i
+		}
+	}
+	return float64(crossings) * float64(rate) / float64(last-first)
+}
+
+func TestStretcherKeepsPitch(t *testing.T) {
+	const rate = OutputSampleRate
+	n := rate.N(2 * time.Second)
+	for _, speed := range []float64{0.5, 0.8, 1, 1.5, 2, 3} {
+		s := newStretcher(beep.Take(n, sine(440, rate)), rate)
+		s.setSpeed(speed)
+		out := streamAll(s)
+
+		want := float64(n) / speed
+		if slack := float64(s.hop + s.tolerance); math.Abs(float64(len(out))-want) > slack {
+			t.Errorf("%gx: %d samples out, want %.0f", speed, len(out), want)
+		}
+		middle := out[len(out)/4 : 3*len(out)/4]
+		if f := pitch(middle, rate); math.Abs(f-440) > 4 {
+			t.Errorf("%gx: pitch %.1f Hz, want 440", speed, f)
+		}
+		var sum float64
+		for _, v := range middle {
+			sum += v[0] * v[0]
+		}
+		if rms := math.Sqrt(sum / float64(len(middle))); math.Abs(rms-1/math.Sqrt2) > 0.05 {
+			t.Errorf("%gx: RMS level %.3f, want %.3f", speed, rms, 1/math.Sqrt2)
+		}
+	}
+}
+
+func TestStretcherChangesSpeedSeamlessly(t *testing.T) {
+	const rate = OutputSampleRate
+	input := streamAll(beep.Take(rate.N(time.Second), sine(440, rate)))
+	s := newStretcher(beep.Take(len(input), sine(440, rate)), rate)
+
+	// At the normal speed the input passes through untouched.
+	out := make([][2]float64, 5000)
+	s.Stream(out)
+	for i := range out {
+		if out[i] != input[i] {
+			t.Fatalf("sample %d at 1x is %v, want %v", i, out[i], input[i])
+		}
+	}
+
+	// Speeding up and back down leaves no jumps in the waveform: a 440 Hz
+	// sine moves at most 2π·440/44100 of its amplitude between samples.
+	prev := out[len(out)-1][0]
+	maxStep := 2 * math.Pi * 440 / float64(rate) * 1.1
+	for _, speed := range []float64{2, 2, 1, 0.5, 1, 1} {
+		s.setSpeed(speed)
+		n, _ := s.Stream(out)
+		for i, v := range out[:n] {
+			if math.Abs(v[0]-prev) > maxStep {
+				t.Fatalf("jump of %.3f at sample %d after changing to %gx", v[0]-prev, i, speed)
+			}
+			prev = v[0]
+		}
+	}
+}
+
+func TestSpeedMemory(t *testing.T) {
+	a1 := &util.AudioFile{Path: "/a1", Artist: "A", Album: "One"}
+	a2 := &util.AudioFile{Path: "/a2", Artist: "A", Album: "One"}
+	b := &util.AudioFile{Path: "/b", Artist: "B", Album: "Two"}
+
+	var off *SpeedMemory
+	if off.Remember(a1, 2, 1) {
+		t.Error("a nil memory remembered a speed")
+	}
+
+	perTrack := NewSpeedMemory(RememberSpeedTrack, nil)
+	perTrack.Remember(a1, 1.5, 1)
+	if s, ok := perTrack.Lookup(a1); !ok || s != 1.5 {
+		t.Errorf("per track: a1 = %g, %v; want 1.5", s, ok)
+	}
+	if _, ok := perTrack.Lookup(a2); ok {
+		t.Error("per track: a2 shares a1's speed")
+	}
+
+	perAlbum := NewSpeedMemory(RememberSpeedAlbum, perTrack.Speeds())
+	perAlbum.Remember(a1, 2, 1)
+	if s, ok := perAlbum.Lookup(a2); !ok || s != 2 {
+		t.Errorf("per album: a2 = %g, %v; want 2", s, ok)
+	}
+	if _, ok := perAlbum.Lookup(b); ok {
+		t.Error("per album: b shares a1's speed")
+	}
+	// The default speed isn't kept.
+	perAlbum.Remember(a2, 1, 1)
+	if speeds := perAlbum.Speeds(); len(speeds) != 1 || speeds["track:/a1"] != 1.5 {
+		t.Errorf("Speeds() = %v, want only the speed of a1 per track", speeds)
+	}
+}
+
+func TestAudioPlayerSpeed(t *testing.T) {
+	for _, preservePitch := range []bool{true, false} {
+		dir := t.TempDir()
+		track := filepath.Join(dir, "A.wav")
+		writeTone(t, track, OutputSampleRate, 600*time.Millisecond, 0.25)
+		out := filepath.Join(dir, "out.wav")
+		output, err := NewWAVOutput(out, OutputSampleRate, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := NewAudioPlayer(output)
+		a.SetSpeedSettings(SpeedSettings{Speed: 2, PreservePitch: preservePitch})
+
+		done, err := a.Start(&util.AudioFile{Title: "A", Path: track}, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitClosed(t, done, "A")
+		if s := a.State(); s.Speed != 2 {
+			t.Errorf("preserving pitch %v: speed = %g, want 2", preservePitch, s.Speed)
+		}
+		if err := output.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The track plays in half its time, at the same level.
+		var heard []int16
+		for _, v := range recordedLevels(t, out) {
+			if v != 0 {
+				heard = append(heard, v)
+			}
+		}
+		want := OutputSampleRate.N(300 * time.Millisecond)
+		if math.Abs(float64(len(heard)-want)) > float64(OutputSampleRate.N(20*time.Millisecond)) {
+			t.Errorf("preserving pitch %v: heard %d samples, want %d", preservePitch, len(heard), want)
+		}
+		level := toneLevel(0.25) * defaultGain
+		if got := float64(heard[len(heard)/2]) / math.MaxInt16; math.Abs(got-level) > 0.001 {
+			t.Errorf("preserving pitch %v: level %.4f, want %.4f", preservePitch, got, level)
+		}
+	}
+}
+
+func TestAudioPlayerRemembersSpeed(t *testing.T) {
+	tracks := toneTracks(t, 2, time.Minute)
+	output := NewNullOutput(OutputSampleRate, 1)
+	defer output.Close()
+	a := NewAudioPlayer(output)
+	a.SetSpeedSettings(SpeedSettings{Speed: 1.2, PreservePitch: true, Remember: RememberSpeedTrack})
+	a.SetSpeedMemory(NewSpeedMemory(RememberSpeedTrack, nil))
+
+	a.SetSpeed(2) // Nothing is playing, so this is the speed of every track.
+	for _, step := range []struct {
+		track *util.AudioFile
+		set   float64 // Speed set while the track plays; 0 for none
+		want  float64
+	}{
+		{tracks[0], 1.5, 1.5},
+		{tracks[1], 0, 2},
+		{tracks[0], 0, 1.5},
+	} {
+		if _, err := a.Start(step.track, 0, true); err != nil {
+			t.Fatal(err)
+		}
+		if step.set != 0 {
+			a.SetSpeed(step.set)
+		}
+		if s := a.State(); s.Speed != step.want {
+			t.Errorf("%s plays at %gx, want %gx", step.track.Title, s.Speed, step.want)
+		}
+	}
+}
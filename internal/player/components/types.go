@@ -19,11 +19,45 @@ const (
 type RepeatMode int
 
 const (
-	RepeatOff RepeatMode = iota
-	RepeatOne
-	RepeatAll
+	RepeatOff RepeatMode = iota // Stop at the end of the queue
+	RepeatOne                   // Replay the current track
+	RepeatAll                   // Wrap around to the start of the queue
 )
 
+// String returns a short label for the mode, as shown in the status bar.
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatOne:
+		return "one"
+	case RepeatAll:
+		return "all"
+	default:
+		return "off"
+	}
+}
+
+// ParseRepeatMode returns the mode with the given String name.
+func ParseRepeatMode(name string) (RepeatMode, bool) {
+	for _, r := range []RepeatMode{RepeatOff, RepeatOne, RepeatAll} {
+		if r.String() == name {
+			return r, true
+		}
+	}
+	return RepeatOff, false
+}
+
+// Next returns the mode that follows r when cycling off → all → one → off.
+func (r RepeatMode) Next() RepeatMode {
+	switch r {
+	case RepeatOff:
+		return RepeatAll
+	case RepeatAll:
+		return RepeatOne
+	default:
+		return RepeatOff
+	}
+}
+
 // ViewMode represents the different UI views
 type ViewMode int
 
@@ -33,63 +67,71 @@ const (
 	ViewPlaylistTracks
 	ViewQueue
 	ViewSettings
+	ViewSearch
+	ViewEqualizer
+	ViewBookmarks
+	ViewChapters
 )
 
-// KeyMap defines the keyboard shortcuts for the application
-type KeyMap struct {
-	PlayPause     string
-	Stop          string
-	NextTrack     string
-	PreviousTrack string
-	VolumeUp      string
-	VolumeDown    string
-	ToggleMute    string
-	ToggleRepeat  string
-	ToggleShuffle string
-	ToggleView    string
-	Quit          string
-}
-
-// DefaultKeyMap returns the default key bindings
-func DefaultKeyMap() KeyMap {
-	return KeyMap{
-		PlayPause:     " ",
-		Stop:          "s",
-		NextTrack:     "n",
-		PreviousTrack: "p",
-		VolumeUp:      "+",
-		VolumeDown:    "-",
-		ToggleMute:    "m",
-		ToggleRepeat:  "r",
-		ToggleShuffle: "S",
-		ToggleView:    "tab",
-		Quit:          "q",
-	}
-}
-
-// Config holds the application configuration
+// Config holds the application configuration. It is loaded from the config
+// file by LoadConfig; see DefaultConfig for the defaults.
 type Config struct {
-	Volume         float64
-	RepeatMode     RepeatMode
-	Shuffle        bool
-	DefaultView    ViewMode
-	AutoPlay       bool
+	LibraryRoots   []string      // Directories scanned for music
+	Exclude        []string      // Glob patterns excluded from the scan
+	FollowSymlinks bool          // Whether the scan follows symlinks
+	Volume         float64       // Initial volume, 0-100
+	RepeatMode     RepeatMode    // Initial repeat mode of the queue
+	Shuffle        bool          // Whether the queue starts shuffled
+	DefaultView    ViewMode      // View shown at startup
+	AutoPlay       bool          // Start playing when a track is added to an idle queue
+	Columns        []TrackColumn // Track columns to show; nil keeps the defaults
+	Crossfade      Crossfade     // How consecutive tracks are joined
+	Normalization  Normalization // How the loudness of tracks is evened out
+	Speed          SpeedSettings // Playback speed and how it is changed
+	SkipStep       time.Duration // How far the skip actions seek
+	LongSkipStep   time.Duration // How far the long skip actions seek
+	Equalizer      EQSettings    // Initial equalizer settings
+	EQPresets      []EQPreset    // Built-in presets followed by the user's
 	Theme          Theme
-	LibraryPath    string
-	PlaylistsPath  string
-	ConfigPath     string
-	LastPlayedFile string
-	LastPosition   time.Duration
+	Keys           KeyMap
+	PlaylistsPath  string        // Playlists file; empty uses the data directory
+	ConfigPath     string        // File the configuration was loaded from, if any
+	LastPlayedFile string        // Track to resume paused at startup, from the saved session
+	LastPosition   time.Duration // Where to resume LastPlayedFile
+	// Tracks at least this long resume where they were left; 0 plays every
+	// track from the start.
+	ResumeThreshold time.Duration
+	// Speeds remembered for tracks or albums, from the saved session.
+	RememberedSpeeds map[string]float64
 }
 
-// Theme defines the visual styling of the application
+// Theme defines the visual styling of the application. Colors are ANSI color
+// numbers ("62") or hex values ("#5f5fd7"); empty keeps the terminal's default.
 type Theme struct {
-	PrimaryColor   string
-	SecondaryColor string
-	AccentColor    string
-	TextColor      string
-	Background     string
-	BorderStyle    string
+	PrimaryColor    string `toml:"primary" json:"primary"`         // View titles and the status bar background
+	SecondaryColor  string `toml:"secondary" json:"secondary"`     // Background of the selected table row
+	AccentColor     string `toml:"accent" json:"accent"`           // Text of the selected table row
+	TextColor       string `toml:"text" json:"text"`               // Title of the playing track
+	MutedColor      string `toml:"muted" json:"muted"`             // Artist, album and volume
+	BorderColor     string `toml:"border" json:"border"`           // Table header border
+	StatusTextColor string `toml:"status_text" json:"status_text"` // Status bar text
+	ProgressColor   string `toml:"progress" json:"progress"`       // Filled part of the progress bar
+	BorderStyle     string `toml:"border_style" json:"border_style"`
+}
+
+// DefaultTheme returns the built-in color scheme.
+func DefaultTheme() Theme {
+	return Theme{
+		PrimaryColor:    "62",
+		SecondaryColor:  "57",
+		AccentColor:     "229",
+		TextColor:       "255",
+		MutedColor:      "250",
+		BorderColor:     "240",
+		StatusTextColor: "15",
+		ProgressColor:   "",
+		BorderStyle:     "normal",
+	}
 }
 
 // PlaybackInfo contains information about the current playback
@@ -100,6 +142,9 @@ type PlaybackInfo struct {
 	State         PlaybackState
 	Volume        float64
 	IsMuted       bool
+	Speed         float64       // Playback speed, 1 being normal
+	LoopStart     time.Duration // Start of the A-B loop of the current track
+	LoopEnd       time.Duration // End of the A-B loop; 0 if there is none
 	RepeatMode    RepeatMode
 	IsShuffled    bool
 	QueuePosition int
@@ -142,7 +187,7 @@ var (
 	ErrTrackNotFound    = errors.New("track not found")
 	ErrInvalidState     = errors.New("invalid player state")
 	ErrFileNotFound     = errors.New("file not found")
-	ErrInvalidFormat    = errors.New("invalid audio format")
+	ErrInvalidFormat    = util.ErrInvalidFormat
 )
 
 // Interface for player controls
@@ -0,0 +1,74 @@
+package player
+
+import (
+	"fmt"
+
+	"muxic/internal/player/components"
+)
+
+// moveEQCursor selects a row of the equalizer view, if it is showing: 0 for
+// the pre-amp, then one for each band.
+func (m *Model) moveEQCursor(row int) {
+	if m.viewMode != ViewEqualizer {
+		return
+	}
+	m.eqCursor = max(0, min(row, len(components.EQBands)))
+}
+
+// adjustEQ changes the gain of the selected row by db. Adjusting a band
+// turns the equalizer on, and the settings no longer match a preset.
+func (m *Model) adjustEQ(db float64) {
+	if m.equalizer == nil {
+		return
+	}
+	s := m.equalizer.Settings()
+	if m.eqCursor == 0 {
+		s.PreAmp += db
+	} else {
+		s.Gains[m.eqCursor-1] += db
+	}
+	s.Enabled, s.Preset = true, ""
+	m.equalizer.Set(s)
+}
+
+// loadEQPreset replaces the gains with those of the preset called name,
+// leaving the equalizer on or off.
+func (m *Model) loadEQPreset(name string) {
+	if m.equalizer == nil {
+		return
+	}
+	preset, ok := components.FindEQPreset(m.eqPresets, name)
+	if !ok {
+		preset, _ = components.FindEQPreset(components.BuiltinEQPresets(), name)
+	}
+	m.equalizer.Set(preset.Settings(m.equalizer.Settings().Enabled))
+	m.Status = fmt.Sprintf("Equalizer preset: %s", preset.Name)
+}
+
+// nextEQPreset loads the preset after the current one, or the first one if
+// the gains were changed by hand. It turns the equalizer on.
+func (m *Model) nextEQPreset() {
+	if m.equalizer == nil || len(m.eqPresets) == 0 {
+		return
+	}
+	next := 0
+	current := m.equalizer.Settings().Preset
+	for i, p := range m.eqPresets {
+		if p.Name == current {
+			next = (i + 1) % len(m.eqPresets)
+		}
+	}
+	m.equalizer.Set(m.eqPresets[next].Settings(true))
+	m.Status = fmt.Sprintf("Equalizer preset: %s", m.eqPresets[next].Name)
+}
+
+// toggleEQ turns the equalizer on or off, keeping its gains.
+func (m *Model) toggleEQ() {
+	if m.equalizer == nil {
+		return
+	}
+	s := m.equalizer.Settings()
+	s.Enabled = !s.Enabled
+	m.equalizer.Set(s)
+	m.Status = fmt.Sprintf("Equalizer: %s", onOff(s.Enabled))
+}
@@ -0,0 +1,146 @@
+package player
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"muxic/internal/player/components"
+	"muxic/internal/ui"
+)
+
+// newKeyTestModel returns a model with a queue and a playlist of the given
+// tracks, the default key bindings, and the given view showing.
+func newKeyTestModel(t *testing.T, view ViewMode, titles ...string) (*Model, *fakeBackend) {
+	t.Helper()
+	m, backend := newTestModel(components.RepeatOff, titles...)
+	tracks, _ := m.engine.Queue()
+
+	pm := components.NewPlaylistManager()
+	playlist, _ := pm.CreatePlaylist("Test")
+	_ = pm.AddTracks(playlist.ID, tracks...)
+	_ = pm.SetActivePlaylist(playlist.ID)
+	m.PlaylistManager = pm
+
+	theme := uiTheme(components.DefaultTheme())
+	m.Columns = components.DefaultTableColumns()
+	m.QueueTable = ui.NewQueueTable(layoutColumns(80, m.Columns.Queue), components.TrackRows(tracks, m.Columns.Queue), theme)
+	m.PlaylistTable = []table.Model{ui.NewPlaylistTable(layoutColumns(80, m.Columns.Playlist), components.TrackRows(playlist.Tracks, m.Columns.Playlist), theme)}
+	m.keys, _ = components.NewKeyBindings(components.KeyMap{})
+	m.seekInput = ui.NewSeekPrompt()
+	m.bookmarkInput = ui.NewBookmarkPrompt()
+	m.BookmarkTable = ui.NewBookmarkTable(bookmarkColumns(80), nil, theme)
+	m.bookmarks = components.NewBookmarks("")
+	m.ChapterTable = ui.NewChapterTable(chapterColumns(80), nil, theme)
+	m.skipStep, m.longSkipStep = components.DefaultSkipStep, components.DefaultLongSkipStep
+	m.viewMode = view
+	return m, backend
+}
+
+// press feeds key presses to the model and returns the message produced by
+// the last one's command, if any.
+func press(m *Model, keys ...tea.KeyMsg) tea.Msg {
+	var cmd tea.Cmd
+	for _, k := range keys {
+		_, cmd = m.handleKeyPress(k)
+	}
+	if cmd == nil {
+		return nil
+	}
+	return cmd()
+}
+
+func runes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestSharedKeyDependsOnView(t *testing.T) {
+	// "r" is bound to removing from both the queue and the playlist.
+	m, _ := newKeyTestModel(t, ViewQueue, "A", "B", "C")
+	m.QueueTable.SetCursor(1)
+	if msg, ok := press(m, runes("r")).(removeTrackFromQueueMsg); !ok || msg.index != 1 {
+		t.Errorf("r in the queue view = %#v, want removeTrackFromQueueMsg{index: 1}", msg)
+	}
+
+	m, _ = newKeyTestModel(t, ViewPlaylistTracks, "A", "B", "C")
+	m.PlaylistTable[0].SetCursor(2)
+	if msg, ok := press(m, runes("r")).(trackRemovedFromPlaylistMsg); !ok || msg.trackIndex != 2 {
+		t.Errorf("r in the playlist view = %#v, want trackRemovedFromPlaylistMsg{trackIndex: 2}", msg)
+	}
+}
+
+func TestKeySequences(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []tea.KeyMsg
+		wantCursor int
+		wantMsg    bool // Whether the last key removed the track under the cursor
+	}{
+		{"chord", []tea.KeyMsg{runes("g"), runes("g")}, 0, false},
+		{"single key", []tea.KeyMsg{runes("k")}, 2, false},
+		{"start of a chord waits", []tea.KeyMsg{runes("g")}, 3, false},
+		{"broken chord falls back to the last key", []tea.KeyMsg{runes("g"), runes("r")}, 3, true},
+		{"special keys", []tea.KeyMsg{{Type: tea.KeyHome}}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newKeyTestModel(t, ViewQueue, "A", "B", "C", "D")
+			m.QueueTable.GotoBottom()
+
+			msg := press(m, tt.keys...)
+			if got := m.QueueTable.Cursor(); got != tt.wantCursor {
+				t.Errorf("cursor = %d, want %d", got, tt.wantCursor)
+			}
+			if _, removed := msg.(removeTrackFromQueueMsg); removed != tt.wantMsg {
+				t.Errorf("last key produced %#v", msg)
+			}
+		})
+	}
+}
+
+func TestLeaderBinding(t *testing.T) {
+	m, _ := newKeyTestModel(t, ViewLibrary)
+	m.keys, _ = components.NewKeyBindings(components.KeyMap{
+		Leader:  ",",
+		Actions: map[components.Action][]string{components.ActionViewQueue: {"<leader> q"}},
+	})
+	if msg := press(m, runes(","), runes("q")); msg != (viewQueueMsg{}) {
+		t.Errorf("leader sequence produced %#v, want viewQueueMsg", msg)
+	}
+}
+
+func TestEqualizerKeys(t *testing.T) {
+	m, _ := newKeyTestModel(t, ViewLibrary)
+	output := components.NewNullOutput(components.OutputSampleRate, 1)
+	defer output.Close()
+	m.equalizer = components.NewAudioPlayer(output).Equalizer()
+	m.eqPresets = components.BuiltinEQPresets()
+
+	press(m, runes("E"))
+	if m.viewMode != ViewEqualizer {
+		t.Fatalf("view after E = %v, want the equalizer", m.viewMode)
+	}
+	// Boosting a band turns the equalizer on.
+	press(m, runes("j"), runes("j"), runes("l"), runes("l"), runes("l"), runes("h"))
+	want := components.EQSettings{Enabled: true, Gains: components.EQGains{1: 2}}
+	if got := m.equalizer.Settings(); got != want {
+		t.Errorf("settings after boosting 62 Hz = %+v, want %+v", got, want)
+	}
+
+	press(m, runes("t"))
+	if m.equalizer.Settings().Enabled {
+		t.Error("t left the equalizer on")
+	}
+	press(m, tea.KeyMsg{Type: tea.KeyCtrlP}, tea.KeyMsg{Type: tea.KeyCtrlP})
+	if got := m.equalizer.Settings(); !got.Enabled || got.Preset != m.eqPresets[1].Name {
+		t.Errorf("settings after two presets = %+v, want %s on", got, m.eqPresets[1].Name)
+	}
+	press(m, runes("0"))
+	if got := m.equalizer.Settings(); !got.Enabled || got.Preset != "flat" || got.Gains != (components.EQGains{}) {
+		t.Errorf("settings after reset = %+v, want flat on", got)
+	}
+	if view := m.renderContent(); !strings.Contains(view, "Equalizer (on, flat)") || !strings.Contains(view, "16 kHz") {
+		t.Errorf("equalizer view = %q", view)
+	}
+}
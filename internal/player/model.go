@@ -7,8 +7,7 @@ import (
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/gopxl/beep"
-	"github.com/gopxl/beep/speaker"
+	"github.com/charmbracelet/lipgloss"
 
 	"muxic/internal/player/components"
 	"muxic/internal/ui"
@@ -26,6 +25,9 @@ const (
 	ViewPlaylists                      // The view listing all available playlists.
 	ViewPlaylistTracks                 // The view showing tracks inside a specific playlist.
 	ViewQueue                          // The playback queue view.
+	ViewEqualizer                      // The equalizer's bands and presets.
+	ViewBookmarks                      // The bookmarks of every track.
+	ViewChapters                       // The chapters of the track playing.
 )
 
 // String provides a human-readable name for each ViewMode, useful for debugging or UI labels.
@@ -41,6 +43,12 @@ func (v ViewMode) String() string {
 		return "Playlist"
 	case ViewQueue:
 		return "Queue"
+	case ViewEqualizer:
+		return "Equalizer"
+	case ViewBookmarks:
+		return "Bookmarks"
+	case ViewChapters:
+		return "Chapters"
 	default:
 		return "Unknown"
 	}
@@ -58,12 +66,19 @@ func (v ViewMode) IsPlaylistView() bool {
 type Model struct {
 	// --- UI Components ---
 	// These are "sub-models" from the Bubble Tea ecosystem. Each manages its own state.
-	LibraryTable  table.Model     // The component for displaying the main music library.
-	SearchInput   textinput.Model // The component for the text search bar.
-	SearchTable   table.Model     // The component for displaying search results.
-	PlaylistTable []table.Model   // A slice of tables, one for each playlist.
-	QueueTable    table.Model     // The component for displaying the playback queue.
-	Progress      progress.Model  // The component for the playback progress bar.
+	LibraryTable  table.Model             // The component for displaying the main music library.
+	SearchInput   textinput.Model         // The component for the text search bar.
+	SearchTable   table.Model             // The component for displaying search results.
+	seekInput     textinput.Model         // The go-to-time prompt, shown in place of the status bar.
+	bookmarkInput textinput.Model         // The prompt a new bookmark is named in, shown in place of the status bar.
+	PlaylistTable []table.Model           // A slice of tables, one for each playlist.
+	QueueTable    table.Model             // The component for displaying the playback queue.
+	BookmarkTable table.Model             // The bookmarks of every track.
+	ChapterTable  table.Model             // The chapters of the track playing.
+	Progress      progress.Model          // The component for the playback progress bar.
+	theme         ui.Theme                // Colors and borders of every component.
+	keys          *components.KeyBindings // Per-view key bindings, with the config file's overrides applied.
+	pendingKeys   []string                // Keys pressed so far of an unfinished key sequence.
 
 	// --- UI State ---
 	// State related to the UI's current status and layout.
@@ -74,23 +89,56 @@ type Model struct {
 	Height              int      // Current terminal height.
 	ProgressWidth       int      // Calculated width for the progress bar.
 	Error               error    // Stores the last error received, for display in the UI.
+	Status              string   // Short message about the last completed action, shown in the status bar.
+	seeking             bool     // True while the go-to-time prompt has focus.
+	naming              bool     // True while the bookmark name prompt has focus.
 
 	// --- Data & Business Logic Components ---
 	// These manage the application's core data.
-	LibraryColumns  []table.Column              // Column definitions for the library table.
+	Columns         components.TableColumns     // Track columns shown by each table.
 	PlaylistManager *components.PlaylistManager // Manages all playlist data and operations.
+	playlistStore   *components.PlaylistStore   // Persists playlists; nil disables saving.
 	Search          *components.Search          // Holds search state and results.
-	Queue           *components.Queue           // Manages the playback queue.
-	AudioPlayer     *components.AudioPlayer     // Manages all audio playback via beep.
+	engine          *components.Engine          // Plays the queue; the model is one of its clients.
+	equalizer       *components.Equalizer       // Equalizer of the audio player; nil if there is none.
+	eqPresets       []components.EQPreset       // Presets cycled through in the equalizer view.
+	eqCursor        int                         // Row selected in the equalizer view: 0 is the pre-amp, then each band.
+	speeds          *components.SpeedMemory     // Speeds remembered for tracks or albums; nil if there is none.
+	bookmarks       *components.Bookmarks       // Bookmarks, and where long tracks were left.
+	bookmarkRows    []bookmarkRow               // What each row of BookmarkTable stands for.
+	skipStep        time.Duration               // How far the skip actions seek.
+	longSkipStep    time.Duration               // How far the long skip actions seek.
 
 	// --- Playback State ---
-	// Data related to the currently playing track.
-	NowPlaying    *util.AudioFile // The track currently playing or paused.
-	CurrentVolume float64         // The current volume level, to be reflected in the UI.
+	// The engine's state as of the last tick or event, to be reflected in the UI.
+	playback components.PlaybackInfo
+	// Start of an A-B loop whose end is yet to be marked, if loopMarked.
+	loopMark   time.Duration
+	loopMarked bool
+	// Track and position of the bookmark being named.
+	bookmarkTrack *util.AudioFile
+	bookmarkPos   time.Duration
 
 	// Internal state for debouncing search input.
 	searchTimer *time.Timer
 
+	// Library roots and filters used by the background library scan.
+	scanOptions util.ScanOptions
+	// What to measure in the background once the library has loaded.
+	measure util.MeasureOptions
+
+	// Where and how playlists are exported as M3U8 files.
+	exportDir      string
+	exportRelative bool
+
+	// Where the session is saved on quit; empty disables saving.
+	sessionFile string
+	// Session to restore once the library has loaded; nil if there is none.
+	session *components.Session
+	// Track the restored session resumes, paused at resumePosition.
+	resumeFile     string
+	resumePosition time.Duration
+
 	// Track to be added after a new playlist is created
 	pendingTrackToAdd *util.AudioFile
 }
@@ -98,15 +146,6 @@ type Model struct {
 // --- Custom Message Definitions ---
 // These messages are defined here because they are closely tied to the Model's state updates.
 
-// UpdateNowPlayingMsg is sent to update the 'Now Playing' information in the UI.
-type UpdateNowPlayingMsg struct {
-	Track *util.AudioFile
-}
-
-// PlaybackFinishedMsg is sent when a track has finished playing,
-// triggering the handler to play the next track in the queue.
-type PlaybackFinishedMsg struct{}
-
 // tickMsg is sent on each "tick" of our update timer to refresh the progress bar.
 type tickMsg time.Time
 
@@ -125,7 +164,8 @@ func (m *Model) Init() tea.Cmd {
 	// We use tea.Batch to run multiple commands concurrently at startup:
 	// 1. tickCmd(): Starts the timer for progress bar updates.
 	// 2. LoadLibraryCmd(): Starts scanning the music library in the background.
-	return tea.Batch(tickCmd(), LoadLibraryCmd())
+	// 3. waitForEventCmd(): Follows the playback engine.
+	return tea.Batch(tickCmd(), LoadLibraryCmd(m.scanOptions), waitForEventCmd(m.engine.Events()))
 }
 
 // resize is a helper method called when the window size changes. It updates the
@@ -142,36 +182,26 @@ func (m *Model) resize(width, height int) {
 	m.ProgressWidth = width
 	m.Progress.Width = m.ProgressWidth
 	m.SearchInput.Width = width
+	m.seekInput.Width = width
+	m.bookmarkInput.Width = width
 }
 
-// HandlePlaybackFinished is the logic for what to do when a track finishes playing.
-// It gets the next track from the queue and creates commands to play it and update the UI.
-func (m *Model) HandlePlaybackFinished() tea.Cmd {
-	if m.Queue == nil || m.Queue.IsEmpty() {
-		return nil // Nothing to play.
+// refreshPlayback takes a fresh snapshot of the engine's state for the UI.
+func (m *Model) refreshPlayback() {
+	info, err := m.engine.GetPlaybackInfo()
+	if err != nil {
+		m.Error = err
+		return
 	}
-
-	nextTrack := m.Queue.GetNext()
-	if nextTrack == nil {
-		return nil // Reached the end of the queue.
+	changed := info.CurrentTrack != m.playback.CurrentTrack ||
+		(info.State == components.StateStopped) != (m.playback.State == components.StateStopped)
+	if info.CurrentTrack != m.playback.CurrentTrack {
+		m.loopMarked = false // The mark belonged to the last track.
 	}
-
-	// This command plays the audio. It's defined inline here as it's a core part
-	// of the playback flow. It returns a message on completion or error.
-	playCmd := func() tea.Msg {
-		if err := m.AudioPlayer.Play(nextTrack); err != nil {
-			return err
-		}
-		return PlaybackFinishedMsg{}
+	m.playback = *info
+	if changed {
+		m.UpdateChapterTable()
 	}
-
-	// We batch the play command with a message to update the "Now Playing" UI.
-	return tea.Batch(
-		playCmd,
-		func() tea.Msg {
-			return UpdateNowPlayingMsg{Track: nextTrack}
-		},
-	)
 }
 
 // calculateContentHeight calculates the available height for table content.
@@ -194,59 +224,141 @@ func (m *Model) calculateContentWidth() int {
 	return width
 }
 
-// NewModel is the constructor for our application's model. It initializes all
-// components and sets up the default state of the application.
-func NewModel() (*Model, error) {
-	defaultWidth := 80
+// layoutColumns lays out track columns as table columns filling the given width.
+func layoutColumns(width int, columns []components.TrackColumn) []table.Column {
+	specs := make([]ui.ColumnSpec, len(columns))
+	for i, c := range columns {
+		specs[i] = ui.ColumnSpec{Title: c.Header(), Width: c.Width(), Weight: c.Weight()}
+	}
+	return ui.LayoutColumns(width, specs)
+}
+
+// SetColumns changes the track columns shown by each table and refreshes their rows.
+func (m *Model) SetColumns(columns components.TableColumns) {
+	m.Columns = columns
+
+	// Clear the rows first: the table renders on every change, and rows with
+	// fewer cells than the new columns would be out of range.
+	for _, tbl := range m.allTrackTables() {
+		tbl.SetRows(nil)
+	}
+	m.updateTableLayouts(m.calculateContentWidth(), m.calculateContentHeight())
+	m.refreshTrackTables()
+}
+
+// SetTheme restyles every component with the given theme.
+func (m *Model) SetTheme(theme components.Theme) {
+	m.theme = uiTheme(theme)
+	styles := ui.TableStyles(m.theme)
+	for _, tbl := range m.allTrackTables() {
+		tbl.SetStyles(styles)
+	}
+	m.BookmarkTable.SetStyles(styles)
+	m.ChapterTable.SetStyles(styles)
+	m.Progress.FullColor = string(m.theme.Progress)
+}
+
+// uiTheme converts a configured theme to the styles used by the ui package.
+// The border style has already been validated with the config.
+func uiTheme(t components.Theme) ui.Theme {
+	border, ok := ui.BorderByName(t.BorderStyle)
+	if !ok {
+		border, _ = ui.BorderByName("normal")
+	}
+	return ui.Theme{
+		Primary:    lipgloss.Color(t.PrimaryColor),
+		Secondary:  lipgloss.Color(t.SecondaryColor),
+		Accent:     lipgloss.Color(t.AccentColor),
+		Text:       lipgloss.Color(t.TextColor),
+		Muted:      lipgloss.Color(t.MutedColor),
+		Border:     lipgloss.Color(t.BorderColor),
+		StatusText: lipgloss.Color(t.StatusTextColor),
+		Progress:   lipgloss.Color(t.ProgressColor),
+		BorderType: border,
+	}
+}
 
-	// Initialize the audio speaker hardware. This must be done once.
-	sr := beep.SampleRate(44100)
-	if err := speaker.Init(sr, sr.N(time.Second/10)); err != nil {
-		return nil, err
+// refreshTrackTables rebuilds the rows of every track table, e.g. after track
+// metadata has changed.
+func (m *Model) refreshTrackTables() {
+	m.LibraryTable.SetRows(components.GetLibrary().ToTableRows(m.Columns.Library))
+	m.UpdateSearchTable()
+	m.UpdatePlaylistTable()
+	m.UpdateQueueTable()
+}
+
+// allTrackTables returns pointers to every table that lists tracks.
+func (m *Model) allTrackTables() []*table.Model {
+	tables := []*table.Model{&m.LibraryTable, &m.SearchTable, &m.QueueTable}
+	for i := range m.PlaylistTable {
+		tables = append(tables, &m.PlaylistTable[i])
 	}
+	return tables
+}
+
+// NewModel is the constructor for our application's model. It initializes all
+// components and sets up the default state of the application. Playback is
+// left to the engine, which plays through whatever output it was given.
+func NewModel(engine *components.Engine) (*Model, error) {
+	defaultWidth := 80
 
 	// Initialize all data managers and UI components with default values.
 	playlistManager := components.NewPlaylistManager()
 	library := components.GetLibrary()
 
-	libraryColumns := ui.DefaultLibraryTableColumns(defaultWidth)
-	libraryRows := library.ToTableRows()
-	libraryTable := ui.NewLibraryTable(libraryColumns, libraryRows)
+	theme := uiTheme(components.DefaultTheme())
+	columns := components.DefaultTableColumns()
+	libraryColumns := layoutColumns(defaultWidth, columns.Library)
+	libraryRows := library.ToTableRows(columns.Library)
+	libraryTable := ui.NewLibraryTable(libraryColumns, libraryRows, theme)
 
-	progressBar := ui.NewProgressBar()
+	progressBar := ui.NewProgressBar(theme)
 	searchInput := ui.NewSearch()
 
 	searchRows := make([]table.Row, 0)
-	searchColumns := ui.DefaultSearchTableColumns(defaultWidth)
-	searchTable := ui.NewSearchTable(searchColumns, searchRows)
+	searchColumns := layoutColumns(defaultWidth, columns.Search)
+	searchTable := ui.NewSearchTable(searchColumns, searchRows, theme)
 
 	playlistRows := make([]table.Row, 0)
-	playlistColumns := ui.DefaultPlaylistTableColumns(defaultWidth)
-	playlistTable := ui.NewPlaylistTable(playlistColumns, playlistRows)
+	playlistColumns := layoutColumns(defaultWidth, columns.Playlist)
+	playlistTable := ui.NewPlaylistTable(playlistColumns, playlistRows, theme)
 	playlists := []table.Model{playlistTable}
 
 	queueRows := make([]table.Row, 0)
-	queueColumns := ui.DefaultQueueTableColumns(defaultWidth)
-	queueTable := ui.NewQueueTable(queueColumns, queueRows)
+	queueColumns := layoutColumns(defaultWidth, columns.Queue)
+	queueTable := ui.NewQueueTable(queueColumns, queueRows, theme)
+
+	bookmarkTable := ui.NewBookmarkTable(bookmarkColumns(defaultWidth), nil, theme)
+	chapterTable := ui.NewChapterTable(chapterColumns(defaultWidth), nil, theme)
+
+	keys, _ := components.NewKeyBindings(components.KeyMap{}) // The defaults always parse
 
 	// Construct the final Model struct with all initialized components.
 	return &Model{
 		LibraryTable:        libraryTable,
 		SearchInput:         searchInput,
+		seekInput:           ui.NewSeekPrompt(),
+		bookmarkInput:       ui.NewBookmarkPrompt(),
 		SearchTable:         searchTable,
 		PlaylistTable:       playlists,
 		QueueTable:          queueTable,
-		LibraryColumns:      libraryColumns,
+		BookmarkTable:       bookmarkTable,
+		ChapterTable:        chapterTable,
+		Columns:             columns,
 		ActivePlaylistIndex: 0,
 		PlaylistManager:     playlistManager,
 		Progress:            progressBar,
+		theme:               theme,
+		keys:                keys,
 		viewMode:            ViewLibrary,
 		isLoading:           true, // Start in a loading state until the library is scanned.
 		Width:               80,
 		Height:              24,
-		AudioPlayer:         components.NewAudioPlayer(),
-		Queue:               components.NewQueue(),
+		engine:              engine,
 		Search:              components.NewSearch(),
+		bookmarks:           components.NewBookmarks(""),
+		skipStep:            components.DefaultSkipStep,
+		longSkipStep:        components.DefaultLongSkipStep,
 	}, nil
 }
 
@@ -0,0 +1,325 @@
+package player
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"muxic/internal/player/components"
+	"muxic/internal/util"
+)
+
+// fakeBackend records the tracks it is asked to play instead of playing them.
+// Each track "plays" until it is stopped.
+type fakeBackend struct {
+	mu     sync.Mutex
+	played []string
+	from   time.Duration // Start position of the last track
+	paused bool          // Whether the last track is paused
+	pos    time.Duration // Position the last track was moved to
+	loop   [2]time.Duration
+	speed  float64
+	stop   chan struct{}
+}
+
+// fakeTrack is a track opened by fakeBackend.
+type fakeTrack struct {
+	track *util.AudioFile
+	pos   time.Duration
+}
+
+func (t *fakeTrack) Track() *util.AudioFile { return t.track }
+func (t *fakeTrack) Close()                 {}
+
+func (f *fakeBackend) Open(track *util.AudioFile, pos time.Duration) (components.OpenedTrack, error) {
+	return &fakeTrack{track, pos}, nil
+}
+
+func (f *fakeBackend) StartOpened(opened components.OpenedTrack, paused bool) (<-chan struct{}, error) {
+	t := opened.(*fakeTrack)
+	f.Stop()
+	stop := make(chan struct{})
+	f.mu.Lock()
+	f.played = append(f.played, t.track.Title)
+	f.from, f.paused, f.stop, f.pos, f.loop = t.pos, paused, stop, t.pos, [2]time.Duration{}
+	f.mu.Unlock()
+	return stop, nil
+}
+
+func (f *fakeBackend) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+}
+
+// PreloadOpened refuses, so tracks don't play back to back.
+func (f *fakeBackend) PreloadOpened(components.OpenedTrack) (<-chan struct{}, error) {
+	return nil, components.ErrNotPlaying
+}
+
+func (f *fakeBackend) CancelPreload()            {}
+func (f *fakeBackend) Pause()                    { f.mu.Lock(); f.paused = true; f.mu.Unlock() }
+func (f *fakeBackend) Resume()                   { f.mu.Lock(); f.paused = false; f.mu.Unlock() }
+func (f *fakeBackend) SetVolume(percent float64) {}
+func (f *fakeBackend) SetSpeed(speed float64)    { f.mu.Lock(); f.speed = speed; f.mu.Unlock() }
+func (f *fakeBackend) SetShuffled(bool)          {}
+
+func (f *fakeBackend) SeekTo(pos time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pos = pos
+	return nil
+}
+
+func (f *fakeBackend) SetLoop(start, end time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loop = [2]time.Duration{start, end}
+	return nil
+}
+
+// State reports every track as lasting four minutes.
+func (f *fakeBackend) State() components.PlayerState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return components.PlayerState{PlayedTime: f.pos, TotalTime: 4 * time.Minute, Speed: f.speed,
+		LoopStart: f.loop[0], LoopEnd: f.loop[1]}
+}
+
+// waitForPlayed waits for the backend to have started n tracks and returns
+// their titles along with the start position and pause state of the last one.
+func (f *fakeBackend) waitForPlayed(t *testing.T, n int) ([]string, time.Duration, bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		f.mu.Lock()
+		played, from, paused := append([]string(nil), f.played...), f.from, f.paused
+		f.mu.Unlock()
+		if len(played) >= n || time.Now().After(deadline) {
+			return played, from, paused
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestModel returns a model whose engine plays through a fake backend and
+// has the given tracks queued.
+func newTestModel(repeat components.RepeatMode, titles ...string) (*Model, *fakeBackend) {
+	backend := &fakeBackend{speed: 1}
+	engine := components.NewEngine(backend)
+	engine.SetAutoPlay(false)
+	engine.SetRepeat(repeat)
+	for _, title := range titles {
+		engine.Enqueue(&util.AudioFile{Title: title, Path: "/music/" + title})
+	}
+	engine.SetAutoPlay(true)
+	m := &Model{engine: engine}
+	m.refreshPlayback()
+	return m, backend
+}
+
+func TestAddToQueueStartsPlayback(t *testing.T) {
+	m, backend := newTestModel(components.RepeatOff)
+
+	track := &util.AudioFile{Title: "A"}
+	m.Update(addTrackToQueueMsg{track: track})
+	if played, _, _ := backend.waitForPlayed(t, 1); len(played) != 1 || played[0] != "A" {
+		t.Fatalf("played %v, want the added track", played)
+	}
+	if m.playback.CurrentTrack != track {
+		t.Errorf("CurrentTrack = %v, want the added track", m.playback.CurrentTrack)
+	}
+
+	// While a track is playing, adding another only queues it.
+	m.Update(addTrackToQueueMsg{track: &util.AudioFile{Title: "B"}})
+	if m.playback.CurrentTrack != track || m.playback.QueueLength != 2 {
+		t.Errorf("playing %v with %d queued, want A with 2", m.playback.CurrentTrack, m.playback.QueueLength)
+	}
+}
+
+func TestPlaybackKeys(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewQueue, "A", "B", "C")
+
+	m.QueueTable.SetCursor(1)
+	press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if played, _, _ := backend.waitForPlayed(t, 1); len(played) != 1 || played[0] != "B" {
+		t.Fatalf("enter in the queue played %v, want B", played)
+	}
+
+	press(m, tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+	if m.playback.State != components.StatePaused {
+		t.Errorf("state after space = %v, want paused", m.playback.State)
+	}
+	press(m, runes("+"), runes("m"))
+	if !m.playback.IsMuted || m.playback.Volume != 55 {
+		t.Errorf("muted %v at volume %v, want muted keeping 55", m.playback.IsMuted, m.playback.Volume)
+	}
+	press(m, runes("m"))
+	if m.playback.IsMuted || m.playback.Volume != 55 {
+		t.Errorf("muted %v at volume %v after unmuting, want 55", m.playback.IsMuted, m.playback.Volume)
+	}
+
+	press(m, runes(">"), runes(">"), runes("<"))
+	if m.playback.Speed != 1.1 {
+		t.Errorf("speed after >, > and < = %g, want 1.1", m.playback.Speed)
+	}
+	press(m, runes("."))
+	if m.playback.Speed != 1 {
+		t.Errorf("speed after . = %g, want 1", m.playback.Speed)
+	}
+}
+
+func TestSeekAndLoopKeys(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewQueue, "A")
+	press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	backend.waitForPlayed(t, 1)
+	press(m, tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}) // Seeking works while paused.
+
+	// goTo types text into the go-to-time prompt and confirms it. The keys
+	// are handled without running their commands, which blink the cursor.
+	goTo := func(text string) {
+		m.handleKeyPress(runes(":"))
+		for _, r := range text {
+			m.handleKeyPress(runes(string(r)))
+		}
+		m.handleKeyPress(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	for _, step := range []struct {
+		text string
+		want time.Duration
+	}{
+		{"1:30", 90 * time.Second},
+		{"-30s", time.Minute},
+		{"50%", 2 * time.Minute},
+		{"+5", 125 * time.Second},
+	} {
+		goTo(step.text)
+		if m.seeking || m.playback.CurrentTime != step.want {
+			t.Errorf("going to %q: at %v (prompt open %v), want %v", step.text, m.playback.CurrentTime, m.seeking, step.want)
+		}
+	}
+	goTo("soon")
+	if m.Error == nil || m.playback.CurrentTime != 125*time.Second {
+		t.Errorf("going to an invalid time: error %v at %v", m.Error, m.playback.CurrentTime)
+	}
+	m.handleKeyPress(runes(":"))
+	m.handleKeyPress(runes("9"))
+	m.handleKeyPress(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.seeking || m.playback.CurrentTime != 125*time.Second {
+		t.Errorf("escape left the prompt open %v and moved to %v", m.seeking, m.playback.CurrentTime)
+	}
+	press(m, runes("Z"), runes("c"))
+	if want := 75 * time.Second; m.playback.CurrentTime != want {
+		t.Errorf("after a long skip back and a skip forward at %v, want %v", m.playback.CurrentTime, want)
+	}
+
+	// The loop is marked from either end, and cleared by a third press.
+	press(m, runes("L"))
+	if marks := m.loopMarks(); len(marks) != 1 || m.playback.LoopEnd != 0 {
+		t.Errorf("after marking the start: marks %v, loop ends at %v", marks, m.playback.LoopEnd)
+	}
+	goTo("1:00")
+	press(m, runes("L"))
+	if m.playback.LoopStart != time.Minute || m.playback.LoopEnd != 75*time.Second || len(m.loopMarks()) != 2 {
+		t.Errorf("loop %v-%v with marks %v, want 1m0s-1m15s marked", m.playback.LoopStart, m.playback.LoopEnd, m.loopMarks())
+	}
+	press(m, runes("L"))
+	if m.playback.LoopEnd != 0 || m.loopMarks() != nil {
+		t.Errorf("loop %v-%v after clearing it", m.playback.LoopStart, m.playback.LoopEnd)
+	}
+}
+
+func TestBookmarkKeys(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewQueue, "A")
+	press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	backend.waitForPlayed(t, 1)
+
+	// bookmark names a bookmark at pos; the keys are handled without running
+	// their commands, which blink the cursor.
+	bookmark := func(pos time.Duration, name string) {
+		_ = m.engine.Seek(pos)
+		m.handleKeyPress(runes("B"))
+		for _, r := range name {
+			m.handleKeyPress(runes(string(r)))
+		}
+		m.handleKeyPress(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	bookmark(time.Minute, "Intro")
+	bookmark(3*time.Minute, "")
+	marks := m.bookmarks.For(m.playback.CurrentTrack)
+	if want := []components.Bookmark{{Name: "Intro", Position: time.Minute}, {Name: "03:00", Position: 3 * time.Minute}}; !reflect.DeepEqual(marks, want) {
+		t.Fatalf("bookmarks = %v, want %v", marks, want)
+	}
+
+	_ = m.engine.Seek(2 * time.Minute)
+	press(m, runes("}"))
+	if m.playback.CurrentTime != 3*time.Minute {
+		t.Errorf("} from 2:00 moved to %v, want the bookmark at 3:00", m.playback.CurrentTime)
+	}
+	press(m, runes("{"))
+	if m.playback.CurrentTime != time.Minute {
+		t.Errorf("{ just after 3:00 moved to %v, want the bookmark before it, at 1:00", m.playback.CurrentTime)
+	}
+
+	// The bookmarks view lists them, plays from them and removes them.
+	press(m, runes("M"))
+	if m.viewMode != ViewBookmarks || len(m.BookmarkTable.Rows()) != 2 {
+		t.Fatalf("view %v lists %d bookmarks, want the bookmarks view with 2", m.viewMode, len(m.BookmarkTable.Rows()))
+	}
+	press(m, runes("j"), tea.KeyMsg{Type: tea.KeyEnter})
+	if m.playback.CurrentTime != 3*time.Minute {
+		t.Errorf("playing the second bookmark moved to %v, want 3:00", m.playback.CurrentTime)
+	}
+	if err := press(m, runes("r")); err != nil {
+		t.Errorf("saving after removing a bookmark: %v", err)
+	}
+	if rows := m.BookmarkTable.Rows(); len(rows) != 1 || rows[0][1] != "Intro" {
+		t.Errorf("rows after removing the second bookmark = %v, want just Intro", rows)
+	}
+}
+
+func TestChapterKeys(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewQueue, "A")
+	tracks, _ := m.engine.Queue()
+	tracks[0].Chapters = []util.Chapter{{Title: "Opening"}, {Title: "Middle", Start: time.Minute}, {Start: 2 * time.Minute}}
+	press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	backend.waitForPlayed(t, 1)
+
+	press(m, runes(")"))
+	if m.playback.CurrentTime != time.Minute {
+		t.Errorf(") from the start moved to %v, want the second chapter, at 1:00", m.playback.CurrentTime)
+	}
+	if got := m.renderCurrentTrackDisplay(); !strings.Contains(got, "Middle") {
+		t.Errorf("track display %q doesn't name the chapter playing", got)
+	}
+
+	_ = m.engine.Seek(2*time.Minute + 30*time.Second)
+	press(m, runes("("))
+	if m.playback.CurrentTime != 2*time.Minute {
+		t.Errorf("( well into the last chapter moved to %v, want its start, 2:00", m.playback.CurrentTime)
+	}
+	press(m, runes("("))
+	if m.playback.CurrentTime != time.Minute {
+		t.Errorf("( at the start of the last chapter moved to %v, want the one before, at 1:00", m.playback.CurrentTime)
+	}
+	if marks := m.chapterMarks(); len(marks) != 2 {
+		t.Errorf("progress bar has %d chapter ticks, want one for each chapter but the first", len(marks))
+	}
+
+	// The chapters view lists them and plays from them.
+	press(m, runes("T"))
+	rows := m.ChapterTable.Rows()
+	if m.viewMode != ViewChapters || len(rows) != 3 || rows[2][1] != "Chapter 3" {
+		t.Fatalf("view %v lists chapters %v, want the chapters view with 3, the last untitled", m.viewMode, rows)
+	}
+	press(m, runes("j"), runes("j"), tea.KeyMsg{Type: tea.KeyEnter})
+	if m.playback.CurrentTime != 2*time.Minute {
+		t.Errorf("playing the third chapter moved to %v, want 2:00", m.playback.CurrentTime)
+	}
+}
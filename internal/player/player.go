@@ -2,44 +2,165 @@ package player
 
 import (
 	"fmt"
+	"log"
 	"muxic/internal/player/components"
 	"muxic/internal/util"
 )
 
 type MusicPlayer struct {
-	model *Model
+	model  *Model
+	output components.Output
 }
 
-func NewMusicPlayer(dir string) (*MusicPlayer, error) {
-	// Get audio files from the directory
-	audioFiles, err := util.GetAudioFiles(dir)
+// Options configures a MusicPlayer.
+type Options struct {
+	Scan            util.ScanOptions         // Library roots and filters to scan at startup
+	ResampleQuality int                      // Quality used to resample tracks to the output rate (1-64)
+	Columns         []components.TrackColumn // Track columns to show; nil keeps the defaults
+	// Output names where audio is played: "speaker", "null" or "wav:path".
+	// Empty plays through the speaker.
+	Output string
+	// OutputSpeed is how fast the null and WAV outputs consume audio relative
+	// to real time; 0 consumes it as fast as possible.
+	OutputSpeed float64
+	// AccurateDurations decodes tracks whose durations were estimated from their
+	// headers in the background once the library has loaded.
+	AccurateDurations bool
+	// PlaylistsFile is where playlists are saved; empty disables persistence.
+	PlaylistsFile string
+	// ExportDir is the directory playlists are exported to as M3U8 files.
+	ExportDir string
+	// ExportRelative writes exported playlists with paths relative to ExportDir.
+	ExportRelative bool
+	// SessionFile is where the session is saved on quit; empty disables saving.
+	SessionFile string
+	// BookmarksFile is where bookmarks and the positions long tracks were left
+	// at are saved; empty keeps them until quitting only.
+	BookmarksFile string
+	// Session is the saved session to restore once the library has loaded; its
+	// settings must already be applied to Config. Nil starts afresh.
+	Session *components.Session
+	// Config supplies the startup volume, play order, view, theme and key
+	// bindings. Library settings are taken from the fields above instead.
+	Config components.Config
+}
+
+// NewMusicPlayer creates the player. The library itself is scanned in the
+// background once the program starts, so startup isn't blocked on disk I/O.
+func NewMusicPlayer(opts Options) (*MusicPlayer, error) {
+	spec := opts.Output
+	if spec == "" {
+		spec = "speaker"
+	}
+	output, err := components.OpenOutput(spec, components.OutputSampleRate, opts.OutputSpeed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get audio files: %w", err)
+		return nil, fmt.Errorf("failed to open output: %w", err)
 	}
 
-	// Get the library instance and add all audio files
-	library := components.GetLibrary()
-	for _, file := range audioFiles {
-		library.AddFile(file)
+	audioPlayer := components.NewAudioPlayer(output)
+	if opts.ResampleQuality > 0 {
+		audioPlayer.SetResampleQuality(opts.ResampleQuality)
 	}
+	audioPlayer.SetCrossfade(opts.Config.Crossfade)
+	audioPlayer.SetNormalization(opts.Config.Normalization)
+	audioPlayer.SetSpeedSettings(opts.Config.Speed)
+	speeds := components.NewSpeedMemory(opts.Config.Speed.Remember, opts.Config.RememberedSpeeds)
+	audioPlayer.SetSpeedMemory(speeds)
 
 	// Create the model
-	model, err := NewModel()
+	model, err := NewModel(components.NewEngine(audioPlayer))
 	if err != nil {
+		_ = output.Close()
 		return nil, fmt.Errorf("failed to create model: %w", err)
 	}
-
-	// Refresh the library view
-	model.LibraryTable.SetRows(library.ToTableRows())
-
-	// Set the cursor to the first item if the library is not empty
-	if library.Length() > 0 {
-		model.LibraryTable.SetCursor(0)
+	model.equalizer = audioPlayer.Equalizer()
+	model.speeds = speeds
+	if opts.BookmarksFile != "" {
+		bookmarks, err := components.LoadBookmarks(opts.BookmarksFile)
+		if err != nil {
+			// Leave the file alone rather than overwrite bookmarks we couldn't read.
+			model.Error = fmt.Errorf("bookmarks not loaded, changes won't be saved: %w", err)
+		} else {
+			model.bookmarks = bookmarks
+		}
+	}
+	model.bookmarks.SetResumeThreshold(opts.Config.ResumeThreshold)
+	model.engine.SetBookmarks(model.bookmarks)
+	model.applyConfig(opts.Config)
+	model.sessionFile = opts.SessionFile
+	model.session = opts.Session
+	model.scanOptions = opts.Scan
+	model.measure = util.MeasureOptions{
+		Durations: opts.AccurateDurations,
+		Loudness:  opts.Config.Normalization.Mode != components.ReplayGainOff,
+	}
+	if opts.PlaylistsFile != "" {
+		store := components.NewPlaylistStore(opts.PlaylistsFile)
+		pm, err := store.Load()
+		if err != nil {
+			// Leave the file alone rather than overwrite playlists we couldn't read.
+			model.Error = fmt.Errorf("playlists not loaded, changes won't be saved: %w", err)
+		} else {
+			model.PlaylistManager = pm
+			model.playlistStore = store
+		}
+	}
+	model.exportDir = opts.ExportDir
+	model.exportRelative = opts.ExportRelative
+	if len(opts.Columns) > 0 {
+		model.SetColumns(components.TableColumnsFor(opts.Columns))
 	}
 
-	return &MusicPlayer{model: model}, nil
+	return &MusicPlayer{model: model, output: output}, nil
 }
 
+// Run runs the player until the user quits, then stops playback, saves the
+// bookmarks with where the track playing was left, and closes the output,
+// which completes a WAV recording.
 func (p *MusicPlayer) Run() error {
-	return p.model.Run()
+	err := p.model.Run()
+	_ = p.model.engine.Stop()
+	if serr := p.model.bookmarks.Save(); serr != nil {
+		log.Printf("Failed to save bookmarks: %v", serr)
+	}
+	if cerr := p.output.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("closing output: %w", cerr)
+	}
+	return err
+}
+
+// applyConfig applies the playback and UI settings of cfg to the model.
+func (m *Model) applyConfig(cfg components.Config) {
+	_ = m.engine.SetVolume(cfg.Volume)
+	m.engine.SetRepeat(cfg.RepeatMode)
+	m.engine.SetShuffle(cfg.Shuffle)
+	m.engine.SetAutoPlay(cfg.AutoPlay)
+	m.refreshPlayback()
+	m.resumeFile = cfg.LastPlayedFile
+	m.resumePosition = cfg.LastPosition
+	// The keys were validated when the config was loaded.
+	m.keys, _ = components.NewKeyBindings(cfg.Keys)
+	m.SetTheme(cfg.Theme)
+	m.skipStep, m.longSkipStep = cfg.SkipStep, cfg.LongSkipStep
+	m.eqPresets = cfg.EQPresets
+	if m.equalizer != nil {
+		m.equalizer.Set(cfg.Equalizer)
+	}
+
+	switch cfg.DefaultView {
+	case components.ViewSearch:
+		m.viewMode = ViewSearch
+	case components.ViewPlaylists, components.ViewPlaylistTracks:
+		m.viewMode = ViewPlaylistTracks
+	case components.ViewQueue:
+		m.viewMode = ViewQueue
+	case components.ViewEqualizer:
+		m.viewMode = ViewEqualizer
+	case components.ViewBookmarks:
+		m.viewMode = ViewBookmarks
+	case components.ViewChapters:
+		m.viewMode = ViewChapters
+	default:
+		m.viewMode = ViewLibrary
+	}
 }
@@ -0,0 +1,104 @@
+package player
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"muxic/internal/player/components"
+	"muxic/internal/ui"
+)
+
+// skip seeks d from the playback position. It does nothing while stopped.
+func (m *Model) skip(d time.Duration) (tea.Model, tea.Cmd) {
+	if m.playback.State == components.StateStopped {
+		return m, nil
+	}
+	return m.control(m.engine.Seek(m.playback.CurrentTime + d))
+}
+
+// openSeekPrompt gives the go-to-time prompt the keys, unless nothing is
+// playing.
+func (m *Model) openSeekPrompt() (tea.Model, tea.Cmd) {
+	if m.playback.State == components.StateStopped {
+		return m, nil
+	}
+	m.seeking = true
+	m.seekInput.Reset()
+	return m, m.seekInput.Focus()
+}
+
+// handleSeekPromptKey types a key into the go-to-time prompt. Enter seeks to
+// the time typed, and escape closes the prompt without seeking.
+func (m *Model) handleSeekPromptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.closeSeekPrompt()
+		m.refreshPlayback() // Relative times count from where playback is now.
+		pos, err := components.ParseSeekTarget(m.seekInput.Value(), m.playback.CurrentTime, m.playback.Duration)
+		if err != nil {
+			m.Error = err
+			return m, nil
+		}
+		return m.control(m.engine.Seek(pos))
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.closeSeekPrompt()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.seekInput, cmd = m.seekInput.Update(msg)
+	return m, cmd
+}
+
+func (m *Model) closeSeekPrompt() {
+	m.seeking = false
+	m.seekInput.Blur()
+}
+
+// cycleLoop marks the start of an A-B loop at the playback position, then its
+// end, which starts the loop. With a loop playing, it clears the loop.
+func (m *Model) cycleLoop() (tea.Model, tea.Cmd) {
+	if m.playback.State == components.StateStopped {
+		return m, nil
+	}
+	m.refreshPlayback()
+	pos := m.playback.CurrentTime
+
+	switch {
+	case m.playback.LoopEnd > 0:
+		m.loopMarked = false
+		m.Status, m.Error = "Loop cleared", nil
+		return m.control(m.engine.ClearLoop())
+	case !m.loopMarked:
+		m.loopMark, m.loopMarked = pos, true
+		m.Status, m.Error = "Loop from "+formatDuration(pos), nil
+		return m, nil
+	}
+	start, end := min(m.loopMark, pos), max(m.loopMark, pos)
+	if err := m.engine.SetLoop(start, end); err != nil {
+		return m.control(err) // Keep the mark, to be tried with another end.
+	}
+	m.loopMarked = false
+	m.Status, m.Error = "Looping "+formatDuration(start)+"-"+formatDuration(end), nil
+	return m.control(nil)
+}
+
+// loopMarks returns the marks of the A-B loop, or of its start while the end
+// is yet to be marked, to be drawn over the progress bar.
+func (m *Model) loopMarks() []ui.ProgressMark {
+	total := m.playback.Duration
+	if m.playback.State == components.StateStopped || total <= 0 {
+		return nil
+	}
+	at := func(pos time.Duration) float64 { return float64(pos) / float64(total) }
+	switch {
+	case m.playback.LoopEnd > 0:
+		return []ui.ProgressMark{
+			{At: at(m.playback.LoopStart), Label: "A"},
+			{At: at(m.playback.LoopEnd), Label: "B"},
+		}
+	case m.loopMarked:
+		return []ui.ProgressMark{{At: at(m.loopMark), Label: "A"}}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package player
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"muxic/internal/player/components"
+	"muxic/internal/util"
+)
+
+// sessionSnapshot captures the state to be restored on the next launch: the
+// queue, the track playing and its position, the play order settings, the
+// active view, the table cursors, the equalizer and the remembered speeds.
+func (m *Model) sessionSnapshot() *components.Session {
+	m.refreshPlayback()
+	tracks, current := m.engine.Queue()
+	s := &components.Session{
+		Queue:        make([]string, len(tracks)),
+		CurrentIndex: current,
+		Volume:       m.playback.Volume,
+		Repeat:       m.playback.RepeatMode.String(),
+		Shuffle:      m.playback.IsShuffled,
+		View:         components.ViewName(m.keyView()),
+		Cursors: map[string]int{
+			components.ViewName(components.ViewLibrary): m.LibraryTable.Cursor(),
+			components.ViewName(components.ViewQueue):   m.QueueTable.Cursor(),
+		},
+	}
+	for i, track := range tracks {
+		s.Queue[i] = track.Path
+	}
+	if tbl := m.playlistTable(); tbl != nil {
+		s.Cursors[components.ViewName(components.ViewPlaylistTracks)] = tbl.Cursor()
+	}
+	if m.equalizer != nil {
+		eq := m.equalizer.Settings()
+		s.Equalizer = &eq
+	}
+	s.Speeds = m.speeds.Speeds()
+	if track := m.playback.CurrentTrack; track != nil {
+		s.Track = track.Path
+		s.Position = m.playback.CurrentTime
+	}
+	return s
+}
+
+// saveSession writes the session file, if enabled. It runs synchronously, as
+// the program is about to exit. A session that hasn't been restored yet
+// because the library is still loading is left as it is.
+func (m *Model) saveSession() {
+	if m.sessionFile == "" || m.session != nil {
+		return
+	}
+	if err := m.sessionSnapshot().Save(m.sessionFile); err != nil {
+		log.Printf("Failed to save session: %v", err)
+	}
+}
+
+// restoreSession refills the queue and the table cursors from the saved
+// session, and cues the track that was playing, paused where it was left. It
+// runs once the library has loaded, as the session only holds paths, which
+// are looked up with find.
+func (m *Model) restoreSession(find func(path string) (*util.AudioFile, bool)) tea.Cmd {
+	s := m.session
+	m.session = nil
+	if s == nil {
+		return nil
+	}
+
+	tracks, current := s.ResolveQueue(find)
+	if missing := len(s.Queue) - len(tracks); missing > 0 {
+		log.Printf("%d queued tracks are no longer in the library", missing)
+	}
+	m.engine.LoadQueue(tracks, current)
+	m.UpdateQueueTable()
+
+	if cursor, ok := s.Cursors[components.ViewName(components.ViewLibrary)]; ok {
+		m.LibraryTable.SetCursor(cursor)
+	}
+	if cursor, ok := s.Cursors[components.ViewName(components.ViewQueue)]; ok {
+		m.QueueTable.SetCursor(cursor)
+	}
+	if cursor, ok := s.Cursors[components.ViewName(components.ViewPlaylistTracks)]; ok {
+		if tbl := m.playlistTable(); tbl != nil {
+			tbl.SetCursor(cursor)
+		}
+	}
+
+	if current >= len(tracks) || m.resumeFile == "" || tracks[current].Path != m.resumeFile {
+		return nil // Playback was stopped, or the track is gone.
+	}
+	if err := m.engine.Cue(m.resumePosition); err != nil {
+		m.Error = err
+		return nil
+	}
+	m.refreshPlayback()
+	return m.updateProgress()
+}
@@ -0,0 +1,74 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"muxic/internal/player/components"
+	"muxic/internal/util"
+)
+
+func TestSessionRestore(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewQueue, "A", "B", "C")
+	tracks, _ := m.engine.Queue()
+	for _, track := range tracks {
+		track.Duration = 10 * time.Minute
+	}
+	m.engine.SetRepeat(components.RepeatAll)
+	_ = m.engine.SetVolume(20)
+	_ = m.engine.PlayIndex(1)
+	backend.waitForPlayed(t, 1)
+	m.QueueTable.SetCursor(2)
+
+	saved := m.sessionSnapshot()
+	saved.Position = 4 * time.Minute // The fake backend doesn't advance
+	if saved.Track != "/music/B" || saved.CurrentIndex != 1 || saved.View != "queue" || saved.Cursors["queue"] != 2 {
+		t.Fatalf("snapshot = %+v", saved)
+	}
+
+	library := map[string]*util.AudioFile{}
+	for _, track := range tracks {
+		library[track.Path] = track
+	}
+	cfg := components.DefaultConfig()
+	saved.ApplyTo(&cfg)
+
+	restored, restoredBackend := newKeyTestModel(t, ViewLibrary)
+	restored.applyConfig(cfg)
+	restored.session = saved
+	restored.restoreSession(func(path string) (*util.AudioFile, bool) {
+		f, ok := library[path]
+		return f, ok
+	})
+
+	played, from, paused := restoredBackend.waitForPlayed(t, 1)
+	if len(played) != 1 || played[0] != "B" || from != 4*time.Minute || !paused {
+		t.Errorf("played %v from %v (paused %v), want B paused at 4m0s", played, from, paused)
+	}
+	restored.refreshPlayback()
+	info := restored.playback
+	if info.QueueLength != 3 || info.QueuePosition != 1 || info.State != components.StatePaused {
+		t.Errorf("queue = %d tracks at %d, state %v", info.QueueLength, info.QueuePosition, info.State)
+	}
+	if restored.viewMode != ViewQueue || restored.QueueTable.Cursor() != 2 {
+		t.Errorf("view %v with queue cursor %d, want Queue with cursor 2", restored.viewMode, restored.QueueTable.Cursor())
+	}
+	if info.RepeatMode != components.RepeatAll || info.Volume != 20 {
+		t.Errorf("repeat %v, volume %v; want all, 20", info.RepeatMode, info.Volume)
+	}
+}
+
+func TestSessionRestoreStopped(t *testing.T) {
+	m, backend := newKeyTestModel(t, ViewLibrary)
+	m.session = &components.Session{Queue: []string{"/music/A"}, Track: ""}
+	a := &util.AudioFile{Title: "A", Path: "/music/A"}
+
+	m.restoreSession(func(string) (*util.AudioFile, bool) { return a, true })
+	m.refreshPlayback()
+	if played, _, _ := backend.waitForPlayed(t, 0); len(played) != 0 || m.playback.CurrentTrack != nil {
+		t.Errorf("played %v after restoring a stopped session, want nothing", played)
+	}
+	if tracks, current := m.engine.Queue(); len(tracks) != 1 || tracks[current] != a {
+		t.Error("queue not restored")
+	}
+}
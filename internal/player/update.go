@@ -1,16 +1,24 @@
 package player
 
 import (
-	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
+	"log"
 	"muxic/internal/player/components"
-	"muxic/internal/ui"
 	"muxic/internal/util"
 	"time"
 )
 
+// volumeStep is how much the volume actions change the volume, in percent.
+const volumeStep = 5
+
+// speedStep is how much the speed actions change the playback speed.
+const speedStep = 0.1
+
+// eqStep is how much the equalizer actions boost or cut a band, in dB.
+const eqStep = 1.0
+
 // Update is the central message processing function of the application. It follows
 // the Elm Architecture, where the function receives the current model and a message,
 // and returns the new model state and a command to be executed.
@@ -56,88 +64,60 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// The state mutation happens here, not in the command.
 	case playlistCreatedMsg:
 		m.UpdatePlaylistTable()
-		return m, nil
+		return m, m.savePlaylistsCmd()
+	case playlistDeletedMsg:
+		m.UpdatePlaylistTable()
+		return m, m.savePlaylistsCmd()
 	case trackAddedToPlaylistMsg:
 		m.UpdatePlaylistTable()
-		return m, nil
+		return m, m.savePlaylistsCmd()
 	case trackRemovedFromPlaylistMsg:
 		m.UpdatePlaylistTable()
-		return m, nil
+		return m, m.savePlaylistsCmd()
 	case playlistShuffledMsg:
 		m.UpdatePlaylistTable()
 		return m, nil
+	case playlistExportedMsg:
+		m.Status = "Exported " + msg.path
+		m.Error = nil
+		return m, nil
 
 	// --- Queue Management Messages ---
 
 	case addTrackToQueueMsg:
-		m.Queue.Add(msg.track)
-		m.UpdateQueueTable()
-
-		// If this is the first track added, we start playback automatically.
-		if m.Queue.Length() == 1 {
-			return m, m.HandlePlaybackFinished()
-		}
-		return m, nil
+		// If nothing is playing, the engine starts the new track unless
+		// auto-play is off.
+		m.engine.Enqueue(msg.track)
+		return m.control(nil)
 
 	case removeTrackFromQueueMsg:
-		m.Queue.Remove(msg.index)
-		m.UpdateQueueTable()
-
-		return m, nil
+		return m.control(m.engine.RemoveFromQueue(msg.index))
 
 	case nextTrackInQueueMsg:
-		m.Queue.Next()
-		m.UpdateQueueTable()
-		return m, nil
+		return m.control(m.engine.Next())
 
 	case previousTrackInQueueMsg:
-		m.Queue.Previous()
-		m.UpdateQueueTable()
-		return m, nil
+		return m.control(m.engine.Previous())
 
 	case clearQueueMsg:
-		m.Queue.Clear()
-		m.UpdateQueueTable()
-		return m, nil
+		m.engine.ClearQueue()
+		return m.control(nil)
 
 	case viewQueueMsg:
 		m.viewMode = ViewQueue
 		return m, nil
 
-	// --- Audio Player State Messages ---
+	// --- Playback Engine Messages ---
 
-	case pauseMsg:
-		// The command performed the side effect; now we update our model's state.
-		if m.AudioPlayer != nil {
-			m.AudioPlayer.Playing = false
+	// playerEventMsg is sent whenever the engine's state changes, including
+	// when it moves on to the next track by itself.
+	case playerEventMsg:
+		if err, ok := msg.event.Data.(error); ok && msg.event.Type == components.EventError {
+			m.Error = err
 		}
-		return m, nil
-
-	case stopMsg:
-		// The command stopped the hardware; now we reset our model's state.
-		if m.AudioPlayer != nil {
-			m.AudioPlayer.Playing = false
-			m.AudioPlayer.CurrentStreamer = nil
-			m.AudioPlayer.SamplesPlayed = 0
-			m.AudioPlayer.PlayedTime = 0
-		}
-		m.NowPlaying = nil
-		// We also need to tell the progress bar component to update its view.
-		progressCmd := m.Progress.SetPercent(0)
-		return m, progressCmd
-
-	case playbackSeekedMsg:
-		// The command performed the seek; we receive the new position and apply it.
-		if m.AudioPlayer != nil {
-			m.AudioPlayer.SamplesPlayed = msg.newPosition
-			m.AudioPlayer.PlayedTime = msg.newPlayedTime
-		}
-		return m, nil
-
-	case volumeChangedMsg:
-		// The command set the volume; now we update our model's state to reflect it.
-		m.CurrentVolume = msg.newVolume
-		return m, nil
+		m.refreshPlayback()
+		m.UpdateQueueTable()
+		return m, tea.Batch(m.updateProgress(), waitForEventCmd(m.engine.Events()))
 
 	// --- Data Loading and Search Messages ---
 
@@ -146,9 +126,36 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		for _, track := range msg.Tracks {
 			library.AddFile(track)
 		}
-		m.LibraryTable.SetRows(library.ToTableRows())
+		m.LibraryTable.SetRows(library.ToTableRows(m.Columns.Library))
 		m.isLoading = false
-		return m, nil
+
+		// Saved playlists only hold paths until the library is known.
+		if m.PlaylistManager != nil {
+			if missing := m.PlaylistManager.ResolveTracks(library.FindByPath); missing > 0 {
+				log.Printf("%d playlist entries are no longer in the library", missing)
+			}
+			m.UpdatePlaylistTable()
+		}
+		m.UpdateBookmarkTable() // Bookmarked tracks are listed by title.
+		restoreCmd := m.restoreSession(library.FindByPath)
+		if m.measure.Durations || m.measure.Loudness {
+			// Hand the pass its own copy of the list, as the library may be re-sorted meanwhile.
+			tracks := append([]*util.AudioFile(nil), library.Files...)
+			return m, tea.Batch(restoreCmd, MeasureTracksCmd(tracks, m.scanOptions, m.measure))
+		}
+		return m, restoreCmd
+
+	case tracksMeasuredMsg:
+		for _, u := range msg.updates {
+			u.Apply(u.File)
+		}
+		if len(msg.updates) > 0 {
+			m.refreshTrackTables()
+		}
+		if msg.done {
+			return m, nil
+		}
+		return m, waitForMeasurementsCmd(msg.source)
 
 	case performSearchMsg:
 		// This message triggers the search command.
@@ -160,16 +167,6 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.UpdateSearchTable()
 		return m, nil
 
-	// --- Playback Flow Messages ---
-
-	case UpdateNowPlayingMsg:
-		m.NowPlaying = msg.Track
-		return m, nil
-
-	case PlaybackFinishedMsg:
-		// When one track finishes, this handler decides what to play next.
-		return m, m.HandlePlaybackFinished()
-
 	// If no other case matches, we do nothing.
 	default:
 		return m, nil
@@ -187,19 +184,27 @@ func tickCmd() tea.Cmd {
 // handleTick is called for every tickMsg. It calculates the current playback
 // percentage and sends a command to the progress bar to update its view.
 func (m *Model) handleTick() (tea.Model, tea.Cmd) {
-	if !m.AudioPlayer.Playing || m.AudioPlayer.TotalSamples <= 0 {
-		return m, tickCmd() // If not playing, just schedule the next tick.
+	m.refreshPlayback()
+	if m.playback.State == components.StateStopped || m.playback.Duration <= 0 {
+		return m, tickCmd() // If nothing is playing, just schedule the next tick.
 	}
 
-	percent := float64(m.AudioPlayer.SamplesPlayed) / float64(m.AudioPlayer.TotalSamples)
+	// We create a command to update the progress bar component.
+	// We also batch it with the next tick command to keep the loop going.
+	return m, tea.Batch(tickCmd(), m.updateProgress())
+}
+
+// updateProgress returns the command that moves the progress bar to the
+// playback position; it is empty when playback is stopped.
+func (m *Model) updateProgress() tea.Cmd {
+	if m.playback.State == components.StateStopped || m.playback.Duration <= 0 {
+		return m.Progress.SetPercent(0)
+	}
+	percent := float64(m.playback.CurrentTime) / float64(m.playback.Duration)
 	if percent > 1.0 {
 		percent = 1.0
 	}
-
-	// We create a command to update the progress bar component.
-	// We also batch it with the next tick command to keep the loop going.
-	progressCmd := m.Progress.SetPercent(percent)
-	return m, tea.Batch(tickCmd(), progressCmd)
+	return m.Progress.SetPercent(percent)
 }
 
 // --- View Update Helpers ---
@@ -211,7 +216,7 @@ func (m *Model) UpdatePlaylistTable() {
 		return
 	}
 
-	rows := m.PlaylistManager.ToTableRows(m.PlaylistManager.ActivePlaylist.ID)
+	rows := m.PlaylistManager.ToTableRows(m.PlaylistManager.ActivePlaylist.ID, m.Columns.Playlist)
 	if m.ActivePlaylistIndex >= 0 && m.ActivePlaylistIndex < len(m.PlaylistTable) {
 		tbl := &m.PlaylistTable[m.ActivePlaylistIndex]
 		tbl.SetRows(rows)
@@ -225,17 +230,15 @@ func (m *Model) UpdateSearchTable() {
 	if m.Search == nil {
 		return
 	}
-	rows := m.Search.ToTableRows()
+	rows := m.Search.ToTableRows(m.Columns.Search)
 	m.SearchTable.SetRows(rows)
 
 }
 
 // UpdateQueueTable refreshes the rows in the queue table.
 func (m *Model) UpdateQueueTable() {
-	if m.Queue == nil {
-		return
-	}
-	rows := m.Queue.ToTableRows()
+	tracks, _ := m.engine.Queue()
+	rows := components.TrackRows(tracks, m.Columns.Queue)
 	m.QueueTable.SetRows(rows)
 	m.UpdateCursorPosition(&m.QueueTable)
 }
@@ -282,134 +285,255 @@ func (m *Model) handleProgressFrame(msg progress.FrameMsg) (tea.Model, tea.Cmd)
 
 // updateTableLayouts is a helper to resize all tables when the window size changes.
 func (m *Model) updateTableLayouts(width, height int) {
-	m.LibraryTable.SetColumns(ui.DefaultLibraryTableColumns(width))
+	m.LibraryTable.SetColumns(layoutColumns(width, m.Columns.Library))
 	m.LibraryTable.SetHeight(height)
-	m.SearchTable.SetColumns(ui.DefaultSearchTableColumns(width))
+	m.SearchTable.SetColumns(layoutColumns(width, m.Columns.Search))
 	m.SearchTable.SetHeight(height)
 	// This assumes at least one playlist table exists.
 	if len(m.PlaylistTable) > 0 {
-		m.PlaylistTable[m.ActivePlaylistIndex].SetColumns(ui.DefaultPlaylistTableColumns(width))
+		m.PlaylistTable[m.ActivePlaylistIndex].SetColumns(layoutColumns(width, m.Columns.Playlist))
 		m.PlaylistTable[m.ActivePlaylistIndex].SetHeight(height)
 	}
-	m.QueueTable.SetColumns(ui.DefaultQueueTableColumns(width))
+	m.QueueTable.SetColumns(layoutColumns(width, m.Columns.Queue))
 	m.QueueTable.SetHeight(height)
+	m.BookmarkTable.SetColumns(bookmarkColumns(width))
+	m.BookmarkTable.SetHeight(height)
+	m.ChapterTable.SetColumns(chapterColumns(width))
+	m.ChapterTable.SetHeight(height)
 }
 
 // handleKeyPress is the logical hub for all user keyboard input.
-// It first delegates input to the active component (like a table or text input).
-// If the component doesn't handle the key, it checks for global application-level keybindings.
+// While a prompt or the search input has focus, keys are typed into it. Otherwise every key press is added to the pending key sequence,
+// which is looked up in the binding table of the current view: a complete
+// sequence runs its action, and the start of a longer one (such as the first
+// "g" of "g g") waits for the next key.
 func (m *Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	var cmd tea.Cmd
+	if m.seeking {
+		return m.handleSeekPromptKey(msg)
+	}
+	if m.naming {
+		return m.handleBookmarkPromptKey(msg)
+	}
+
+	name := keyName(msg)
+	if m.viewMode == ViewSearch && m.Search.IsSearching {
+		// Only single-key back bindings leave the input; every other key is text.
+		if action, _ := m.keys.Lookup(components.ViewSearch, []string{name}); action == components.ActionBack {
+			return m.runAction(action)
+		}
+		var cmd tea.Cmd
+		m.SearchInput, cmd = m.SearchInput.Update(msg)
+		// This is a great example of debouncing input. We wait for the user
+		// to stop typing before dispatching the search command.
+		debounceCmd := func() tea.Msg {
+			time.Sleep(200 * time.Millisecond)
+			return performSearchMsg{}
+		}
+		return m, tea.Batch(cmd, debounceCmd)
+	}
 
-	// --- Component-level Input Handling ---
-	// First, give the active view's main component a chance to handle the key.
-	// This is for things like scrolling up/down in a table.
+	m.pendingKeys = append(m.pendingKeys, name)
+	action, partial := m.keys.Lookup(m.keyView(), m.pendingKeys)
+	if !partial && action == "" && len(m.pendingKeys) > 1 {
+		// The sequence led nowhere, but its last key may start a binding of its own.
+		m.pendingKeys = []string{name}
+		action, partial = m.keys.Lookup(m.keyView(), m.pendingKeys)
+	}
+	if partial {
+		return m, nil // Wait for the rest of the sequence.
+	}
+	m.pendingKeys = nil
+	return m.runAction(action)
+}
+
+// keyName returns the name of a key press as used in key bindings.
+func keyName(msg tea.KeyMsg) string {
+	if msg.Type == tea.KeySpace {
+		return "space" // Bubble Tea reports the space bar as " "
+	}
+	return msg.String()
+}
+
+// keyView returns the binding table that applies to the current view.
+func (m *Model) keyView() components.ViewMode {
+	switch m.viewMode {
+	case ViewSearch:
+		return components.ViewSearch
+	case ViewPlaylists, ViewPlaylistTracks:
+		return components.ViewPlaylistTracks
+	case ViewQueue:
+		return components.ViewQueue
+	case ViewEqualizer:
+		return components.ViewEqualizer
+	case ViewBookmarks:
+		return components.ViewBookmarks
+	case ViewChapters:
+		return components.ViewChapters
+	default:
+		return components.ViewLibrary
+	}
+}
+
+// activeTable returns the table shown in the current view.
+func (m *Model) activeTable() *table.Model {
 	switch m.viewMode {
 	case ViewLibrary:
-		m.LibraryTable, cmd = m.LibraryTable.Update(msg)
+		return &m.LibraryTable
 	case ViewSearch:
-		if m.Search.IsSearching {
-			// If we're in search input mode, all keys go to the text input.
-			m.SearchInput, cmd = m.SearchInput.Update(msg)
-			// This is a great example of debouncing input. We wait for the user
-			// to stop typing before dispatching the search command.
-			debounceCmd := func() tea.Msg {
-				time.Sleep(200 * time.Millisecond)
-				return performSearchMsg{}
-			}
-			return m, tea.Batch(cmd, debounceCmd)
-		} else {
-			// If not actively typing, keys go to the search results table.
-			m.SearchTable, cmd = m.SearchTable.Update(msg)
-		}
+		return &m.SearchTable
 	case ViewPlaylists, ViewPlaylistTracks:
-		if len(m.PlaylistTable) > 0 {
-			m.PlaylistTable[m.ActivePlaylistIndex], cmd = m.PlaylistTable[m.ActivePlaylistIndex].Update(msg)
-		}
+		return m.playlistTable()
 	case ViewQueue:
-		m.QueueTable, cmd = m.QueueTable.Update(msg)
+		return &m.QueueTable
+	case ViewBookmarks:
+		return &m.BookmarkTable
+	case ViewChapters:
+		return &m.ChapterTable
 	}
+	return nil
+}
 
-	// If the component handled the key (e.g., table scrolling), it might return a command.
-	// If so, we return early and don't check for global keybindings.
-	if cmd != nil {
-		return m, cmd
+// playlistTable returns the table of the active playlist, or nil if there is none.
+func (m *Model) playlistTable() *table.Model {
+	if m.ActivePlaylistIndex < 0 || m.ActivePlaylistIndex >= len(m.PlaylistTable) {
+		return nil
 	}
+	return &m.PlaylistTable[m.ActivePlaylistIndex]
+}
 
-	// --- Global Application Keybindings ---
-	// If the active component did not handle the key, we check our own key map.
-	switch {
-	case key.Matches(msg, util.DefaultKeyMap.ToggleView):
+// runAction performs the action of a key binding. Each action first validates
+// the state (e.g., is a track playing?) and, if it is valid, dispatches the
+// appropriate focused command.
+func (m *Model) runAction(action components.Action) (tea.Model, tea.Cmd) {
+	switch action {
+	// --- Navigation ---
+	// The tables have no key bindings of their own; their cursor is moved here.
+	case components.ActionUp:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveUp(1)
+		}
+		m.moveEQCursor(m.eqCursor - 1)
+		return m, nil
+	case components.ActionDown:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveDown(1)
+		}
+		m.moveEQCursor(m.eqCursor + 1)
+		return m, nil
+	case components.ActionPageUp:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveUp(tbl.Height())
+		}
+		return m, nil
+	case components.ActionPageDown:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveDown(tbl.Height())
+		}
+		return m, nil
+	case components.ActionHalfPageUp:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveUp(tbl.Height() / 2)
+		}
+		return m, nil
+	case components.ActionHalfPageDown:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.MoveDown(tbl.Height() / 2)
+		}
+		return m, nil
+	case components.ActionGotoTop:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.GotoTop()
+		}
+		m.moveEQCursor(0)
+		return m, nil
+	case components.ActionGotoBottom:
+		if tbl := m.activeTable(); tbl != nil {
+			tbl.GotoBottom()
+		}
+		m.moveEQCursor(len(components.EQBands))
+		return m, nil
+	case components.ActionBack:
+		// Leave the search input, handing the keys back to the results.
+		if m.viewMode == ViewSearch && m.Search.IsSearching {
+			m.Search.IsSearching = false
+			m.SearchInput.Blur()
+			m.SearchTable.Focus()
+		}
+		return m, nil
+
+	case components.ActionToggleView:
 		return m.toggleView()
 
 	// --- Playback Controls ---
-	// For each action, we first validate the state (e.g., is a track playing?).
-	// If the state is valid, we dispatch the appropriate focused command.
-	case key.Matches(msg, util.DefaultKeyMap.Pause):
-		if m.AudioPlayer == nil || !m.AudioPlayer.Playing {
-			return m, nil
+	// The engine validates the state itself (e.g., is a track playing?).
+	case components.ActionPlay:
+		switch m.viewMode {
+		case ViewQueue:
+			return m.control(m.engine.PlayIndex(m.QueueTable.Cursor()))
+		case ViewBookmarks:
+			return m.playBookmark()
+		case ViewChapters:
+			return m.playChapter(m.ChapterTable.Cursor())
 		}
-		return m, PauseCmd(m.AudioPlayer)
-
-	case key.Matches(msg, util.DefaultKeyMap.Stop):
-		if m.AudioPlayer == nil || !m.AudioPlayer.Playing {
+		track := m.selectedTrack()
+		if track == nil {
 			return m, nil
 		}
-		return m, StopCmd(m.AudioPlayer)
+		m.engine.PlayNow(track)
+		return m.control(nil)
 
-	case key.Matches(msg, util.DefaultKeyMap.SkipBackward):
-		if m.AudioPlayer == nil || !m.AudioPlayer.Playing {
-			return m, nil
-		}
-		return m, SkipBackwardCmd(m.AudioPlayer)
+	case components.ActionPause:
+		return m.control(m.engine.TogglePause())
 
-	case key.Matches(msg, util.DefaultKeyMap.SkipForward):
-		if m.AudioPlayer == nil || !m.AudioPlayer.Playing {
-			return m, nil
-		}
-		return m, SkipForwardCmd(m.AudioPlayer)
+	case components.ActionStop:
+		return m.control(m.engine.Stop())
+
+	case components.ActionSkipBackward:
+		return m.skip(-m.skipStep)
+
+	case components.ActionSkipForward:
+		return m.skip(m.skipStep)
+
+	case components.ActionSkipBackwardLong:
+		return m.skip(-m.longSkipStep)
+
+	case components.ActionSkipForwardLong:
+		return m.skip(m.longSkipStep)
+
+	case components.ActionSeekTo:
+		return m.openSeekPrompt()
+
+	case components.ActionABLoop:
+		return m.cycleLoop()
+
+	case components.ActionToggleRepeat:
+		return m.control(m.engine.ToggleRepeat())
+
+	case components.ActionToggleShuffle:
+		return m.control(m.engine.ToggleShuffle())
 
 	// --- Volume Controls ---
-	// Here, all the logic for calculating the new volume level lives right
-	// where the event is handled. The command is only told what the target volume is.
-	case key.Matches(msg, util.DefaultKeyMap.VolumeUp):
-		if m.AudioPlayer == nil || m.AudioPlayer.Volume == nil {
-			return m, nil
-		}
-		currentVol := m.AudioPlayer.GetVolume()
-		newVol := currentVol + 5
-		if newVol > 100 {
-			newVol = 100
-		}
-		return m, SetVolumeCmd(m.AudioPlayer, newVol)
+	case components.ActionVolumeUp:
+		return m.control(m.engine.SetVolume(m.playback.Volume + volumeStep))
 
-	case key.Matches(msg, util.DefaultKeyMap.VolumeDown):
-		if m.AudioPlayer == nil || m.AudioPlayer.Volume == nil {
-			return m, nil
-		}
-		currentVol := m.AudioPlayer.GetVolume()
-		newVol := currentVol - 5
-		if newVol < 0 {
-			newVol = 0
-		}
-		return m, SetVolumeCmd(m.AudioPlayer, newVol)
+	case components.ActionVolumeDown:
+		return m.control(m.engine.SetVolume(m.playback.Volume - volumeStep))
 
-	// Mute/Unmute could be improved by storing the pre-mute volume.
-	case key.Matches(msg, util.DefaultKeyMap.VolumeMute):
-		if m.AudioPlayer == nil || m.AudioPlayer.Volume == nil {
-			return m, nil
-		}
-		// This is a simple toggle to 0. A more advanced implementation
-		// would store the current volume and restore it on unmute.
-		if m.CurrentVolume > 0 {
-			m.CurrentVolume = m.CurrentVolume // Assuming m.lastVolume is a new field on Model
-			return m, SetVolumeCmd(m.AudioPlayer, 0)
-		} else {
-			return m, SetVolumeCmd(m.AudioPlayer, m.CurrentVolume)
-		}
+	case components.ActionVolumeMute:
+		return m.control(m.engine.ToggleMute())
+
+	// --- Speed Controls ---
+	case components.ActionSpeedUp:
+		return m.control(m.engine.SetSpeed(m.playback.Speed + speedStep))
+
+	case components.ActionSpeedDown:
+		return m.control(m.engine.SetSpeed(m.playback.Speed - speedStep))
+
+	case components.ActionSpeedReset:
+		return m.control(m.engine.SetSpeed(1))
 
 	// --- Search ---
-	case key.Matches(msg, util.DefaultKeyMap.Search):
+	case components.ActionToggleSearch:
 		if m.viewMode == ViewSearch {
 			// Toggle between typing-mode and selection-mode.
 			m.Search.IsSearching = !m.Search.IsSearching
@@ -424,13 +548,13 @@ func (m *Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	// --- Playlist Management ---
-	case key.Matches(msg, util.DefaultKeyMap.CreatePlaylist):
+	case components.ActionCreatePlaylist:
 		if m.PlaylistManager == nil {
 			m.PlaylistManager = components.NewPlaylistManager()
 		}
 		return m, CreatePlaylistCmd(m.PlaylistManager, "New Playlist")
 
-	case key.Matches(msg, util.DefaultKeyMap.AddToPlaylist):
+	case components.ActionAddToPlaylist:
 		// This block handles all the state validation and data gathering
 		// before dispatching the clean AddToPlaylistCmd.
 		if m.PlaylistManager == nil {
@@ -449,53 +573,168 @@ func (m *Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return m, AddToPlaylistCmd(m.PlaylistManager, m.PlaylistManager.ActivePlaylist.ID, trackToAdd)
 
-	case key.Matches(msg, util.DefaultKeyMap.RemoveFromPlaylist):
+	case components.ActionRemoveFromPlaylist:
 		if m.viewMode != ViewPlaylistTracks || m.PlaylistManager.ActivePlaylist == nil {
 			return m, nil
 		}
 		indexToRemove := m.PlaylistTable[m.ActivePlaylistIndex].Cursor()
 		return m, RemoveFromPlaylistCmd(m.PlaylistManager, m.PlaylistManager.ActivePlaylist.ID, indexToRemove)
 
-	case key.Matches(msg, util.DefaultKeyMap.ShufflePlaylist):
+	case components.ActionSortByAlbum:
+		// Order the current list by album, disc and track number.
+		switch m.viewMode {
+		case ViewLibrary:
+			library := components.GetLibrary()
+			library.SortByAlbum()
+			m.LibraryTable.SetRows(library.ToTableRows(m.Columns.Library))
+		case ViewPlaylistTracks:
+			if m.PlaylistManager == nil || m.PlaylistManager.ActivePlaylist == nil {
+				return m, nil
+			}
+			if err := m.PlaylistManager.SortPlaylist(m.PlaylistManager.ActivePlaylist.ID, "album", true); err != nil {
+				m.Error = err
+				return m, nil
+			}
+			m.UpdatePlaylistTable()
+			return m, m.savePlaylistsCmd()
+		}
+		return m, nil
+
+	case components.ActionExportPlaylist:
+		if !m.viewMode.IsPlaylistView() || m.PlaylistManager == nil || m.PlaylistManager.ActivePlaylist == nil {
+			return m, nil
+		}
+		return m, ExportPlaylistCmd(m.PlaylistManager, m.PlaylistManager.ActivePlaylist.ID, m.exportDir, m.exportRelative)
+
+	case components.ActionShufflePlaylist:
 		if m.PlaylistManager == nil || m.PlaylistManager.ActivePlaylist == nil {
 			return m, nil
 		}
 		return m, ShufflePlaylistCmd(m.PlaylistManager, m.PlaylistManager.ActivePlaylist.ID)
 
 	// --- Queue Management ---
-	case key.Matches(msg, util.DefaultKeyMap.AddToQueue):
+	case components.ActionAddToQueue:
 		track := components.GetLibrary().Files[m.LibraryTable.Cursor()]
 		return m, AddToQueueCmd(track)
 
-	case key.Matches(msg, util.DefaultKeyMap.RemoveFromQueue):
+	case components.ActionRemoveFromQueue:
 		if m.viewMode != ViewQueue {
 			return m, nil
 		}
 		indexToRemove := m.QueueTable.Cursor()
 		return m, RemoveFromQueueCmd(indexToRemove)
 
-	case key.Matches(msg, util.DefaultKeyMap.ViewQueue):
+	case components.ActionViewQueue:
 		return m, ViewQueueCmd()
 
-	case key.Matches(msg, util.DefaultKeyMap.PlayNext):
+	case components.ActionPlayNext:
 		return m, PlayNextInQueueCmd()
 
-	case key.Matches(msg, util.DefaultKeyMap.PlayPrevious):
+	case components.ActionPlayPrevious:
 		return m, PlayPreviousInQueueCmd()
 
-	case key.Matches(msg, util.DefaultKeyMap.ClearQueue):
+	case components.ActionClearQueue:
 		return m, ClearQueueCmd()
 
+	// --- Equalizer ---
+	case components.ActionViewEqualizer:
+		m.viewMode = ViewEqualizer
+		return m, nil
+
+	case components.ActionEQBoost:
+		m.adjustEQ(eqStep)
+		return m, nil
+
+	case components.ActionEQCut:
+		m.adjustEQ(-eqStep)
+		return m, nil
+
+	case components.ActionEQReset:
+		m.loadEQPreset("flat")
+		return m, nil
+
+	case components.ActionEQNextPreset:
+		m.nextEQPreset()
+		return m, nil
+
+	case components.ActionEQToggle:
+		m.toggleEQ()
+		return m, nil
+
+	// --- Bookmarks ---
+	case components.ActionAddBookmark:
+		return m.openBookmarkPrompt()
+
+	case components.ActionNextBookmark:
+		return m.jumpToBookmark(true)
+
+	case components.ActionPreviousBookmark:
+		return m.jumpToBookmark(false)
+
+	case components.ActionViewBookmarks:
+		m.UpdateBookmarkTable()
+		m.viewMode = ViewBookmarks
+		return m, nil
+
+	case components.ActionRemoveBookmark:
+		return m.removeBookmark()
+
+	// --- Chapters ---
+	case components.ActionNextChapter:
+		return m.jumpToChapter(true)
+
+	case components.ActionPreviousChapter:
+		return m.jumpToChapter(false)
+
+	case components.ActionViewChapters:
+		m.refreshPlayback()
+		m.UpdateChapterTable()
+		m.viewMode = ViewChapters
+		return m, nil
+
 	// --- Quit ---
-	case key.Matches(msg, util.DefaultKeyMap.Quit):
+	case components.ActionQuit:
+		m.saveSession()
 		return m, tea.Quit
 
-	// If we get here, the key wasn't handled by any of our bindings.
+	// Actions without a handler yet, and keys that aren't bound at all.
 	default:
 		return m, nil
 	}
 }
 
+// control shows the result of a call to the engine: the error, if any, and
+// the engine's new state.
+func (m *Model) control(err error) (tea.Model, tea.Cmd) {
+	if err != nil {
+		m.Error = err
+	}
+	m.refreshPlayback()
+	m.UpdateQueueTable()
+	return m, nil
+}
+
+// selectedTrack returns the track under the cursor of the library, search
+// results or playlist, whichever is showing, or nil if there is none.
+func (m *Model) selectedTrack() *util.AudioFile {
+	var tracks []*util.AudioFile
+	switch m.viewMode {
+	case ViewLibrary:
+		tracks = components.GetLibrary().Files
+	case ViewSearch:
+		tracks = m.Search.Tracks
+	case ViewPlaylistTracks:
+		if m.PlaylistManager != nil && m.PlaylistManager.ActivePlaylist != nil {
+			tracks = m.PlaylistManager.ActivePlaylist.Tracks
+		}
+	}
+	tbl := m.activeTable()
+	if tbl == nil || tbl.Cursor() < 0 || tbl.Cursor() >= len(tracks) {
+		return nil
+	}
+	return tracks[tbl.Cursor()]
+}
+
 // toggleView cycles through the main views of the application.
 func (m *Model) toggleView() (tea.Model, tea.Cmd) {
 	switch m.viewMode {
@@ -3,6 +3,9 @@ package player
 import (
 	"fmt"
 	"github.com/charmbracelet/lipgloss"
+	"muxic/internal/player/components"
+	"muxic/internal/ui"
+	"strings"
 	"time"
 )
 
@@ -40,6 +43,12 @@ func (m *Model) renderContent() string {
 		return m.renderPlaylistView()
 	case ViewQueue:
 		return m.renderQueueView()
+	case ViewEqualizer:
+		return m.renderEqualizerView()
+	case ViewBookmarks:
+		return m.renderBookmarksView()
+	case ViewChapters:
+		return m.renderChaptersView()
 	default:
 		return ""
 	}
@@ -49,7 +58,7 @@ func (m *Model) renderContent() string {
 func (m *Model) renderTitledView(title string, content ...string) string {
 	titleStyle := lipgloss.NewStyle().
 		Bold(true).
-		Foreground(lipgloss.Color("62")).
+		Foreground(m.theme.Primary).
 		MarginBottom(1)
 
 	// Prepend the rendered title to the content strings.
@@ -74,6 +83,9 @@ func (m *Model) renderPlaylistView() string {
 	if m.viewMode == ViewPlaylistTracks {
 		title = "Playlist Tracks"
 	}
+	if m.PlaylistManager != nil && m.PlaylistManager.Shuffled() {
+		title += " (shuffled)"
+	}
 	return m.renderTitledView(title, m.PlaylistTable[m.ActivePlaylistIndex].View())
 }
 
@@ -85,11 +97,92 @@ func (m *Model) renderQueueView() string {
 	return m.renderTitledView("Queue", m.QueueTable.View())
 }
 
-// renderProgressBar renders the playback progress bar
+// renderEqualizerView renders the pre-amp and the gain of each band as bars,
+// with the selected row highlighted, followed by the keys that adjust them.
+func (m *Model) renderEqualizerView() string {
+	if m.equalizer == nil {
+		return m.renderTitledView("Equalizer", "\n  No equalizer on this output.")
+	}
+	s := m.equalizer.Settings()
+	title := "Equalizer (" + onOff(s.Enabled)
+	if s.Preset != "" {
+		title += ", " + s.Preset
+	}
+	title += ")"
+
+	barWidth := max(m.calculateContentWidth()-30, 10)
+	normal, selected := ui.EQRowStyles(m.theme)
+	rows := make([]string, 0, len(components.EQBands)+1)
+	for i := 0; i <= len(components.EQBands); i++ {
+		label, db := "Pre-amp", s.PreAmp
+		if i > 0 {
+			label, db = formatFrequency(components.EQBands[i-1]), s.Gains[i-1]
+		}
+		row := fmt.Sprintf("%8s %+5.1f dB  %s", label, db, ui.GainBar(db, components.MaxEQGain, barWidth))
+		if i == m.eqCursor {
+			rows = append(rows, selected.Render(row))
+		} else {
+			rows = append(rows, normal.Render(row))
+		}
+	}
+
+	view := m.keyView()
+	help := lipgloss.NewStyle().Foreground(m.theme.Muted).MarginTop(1).Render(fmt.Sprintf(
+		" %s/%s: cut/boost | %s: next preset | %s: reset | %s: on/off",
+		m.keys.Help(view, components.ActionEQCut), m.keys.Help(view, components.ActionEQBoost),
+		m.keys.Help(view, components.ActionEQNextPreset), m.keys.Help(view, components.ActionEQReset),
+		m.keys.Help(view, components.ActionEQToggle)))
+	return m.renderTitledView(title, strings.Join(rows, "\n"), help)
+}
+
+// renderBookmarksView renders the bookmarks of every track, followed by the
+// keys that use them.
+func (m *Model) renderBookmarksView() string {
+	view := m.keyView()
+	help := lipgloss.NewStyle().Foreground(m.theme.Muted).MarginTop(1).Render(fmt.Sprintf(
+		" %s: play from bookmark | %s: remove | %s: bookmark this position | %s/%s: previous/next bookmark",
+		m.keys.Help(view, components.ActionPlay), m.keys.Help(view, components.ActionRemoveBookmark),
+		m.keys.Help(view, components.ActionAddBookmark), m.keys.Help(view, components.ActionPreviousBookmark),
+		m.keys.Help(view, components.ActionNextBookmark)))
+	if len(m.bookmarkRows) == 0 {
+		return m.renderTitledView("Bookmarks", "\n  No bookmarks yet.", help)
+	}
+	return m.renderTitledView("Bookmarks", m.BookmarkTable.View(), help)
+}
+
+// renderChaptersView renders the chapters of the track playing, followed by
+// the keys that use them.
+func (m *Model) renderChaptersView() string {
+	view := m.keyView()
+	help := lipgloss.NewStyle().Foreground(m.theme.Muted).MarginTop(1).Render(fmt.Sprintf(
+		" %s: play chapter | %s/%s: previous/next chapter",
+		m.keys.Help(view, components.ActionPlay), m.keys.Help(view, components.ActionPreviousChapter),
+		m.keys.Help(view, components.ActionNextChapter)))
+	switch {
+	case m.playback.CurrentTrack == nil || m.playback.State == components.StateStopped:
+		return m.renderTitledView("Chapters", "\n  Nothing is playing.", help)
+	case len(m.playback.CurrentTrack.Chapters) == 0:
+		return m.renderTitledView("Chapters", "\n  This track has no chapters.", help)
+	}
+	return m.renderTitledView("Chapters of "+m.playback.CurrentTrack.Title, m.ChapterTable.View(), help)
+}
+
+// formatFrequency formats a band's centre frequency, e.g. "125 Hz" or "2 kHz".
+func formatFrequency(hz float64) string {
+	if hz >= 1000 {
+		return fmt.Sprintf("%g kHz", hz/1000)
+	}
+	return fmt.Sprintf("%g Hz", hz)
+}
+
+// renderProgressBar renders the playback progress bar, with ticks at the
+// start of each chapter and the markers of the A-B loop over it.
 func (m *Model) renderProgressBar() string {
+	marks := append(m.chapterMarks(), m.loopMarks()...)
+	bar := ui.MarkProgress(m.Progress.View(), m.Progress.Width, marks, m.theme)
 	return lipgloss.NewStyle().
 		MarginTop(1).
-		Render(m.Progress.View())
+		Render(bar)
 }
 
 func (m *Model) renderVolumeDisplay() string {
@@ -97,20 +190,18 @@ func (m *Model) renderVolumeDisplay() string {
 		Bold(true).
 		MarginLeft(1).
 		MarginRight(1).
-		Foreground(lipgloss.Color("250"))
+		Foreground(m.theme.Muted)
 
-	if m.AudioPlayer.Volume == nil {
-		return volumeStyle.Render("Volume: 50%")
+	speedText := ""
+	if s := m.playback.Speed; s > 0 && s != 1 {
+		speedText = fmt.Sprintf("Speed: %gx  ", s)
 	}
 
-	if m.AudioPlayer.Volume.Silent {
-		return volumeStyle.Render("Volume: Muted")
+	if m.playback.IsMuted {
+		return volumeStyle.Render(speedText + "Volume: Muted")
 	}
 
-	// Convert the logarithmic volume to a percentage (approximate)
-	// Assuming 0.0 is 100%, and it can go higher.
-	volumePercent := m.AudioPlayer.GetVolume()
-	volumeText := fmt.Sprintf("Volume: %.0f%%", volumePercent)
+	volumeText := speedText + fmt.Sprintf("Volume: %.0f%%", m.playback.Volume)
 
 	return volumeStyle.Render(volumeText)
 }
@@ -120,53 +211,67 @@ func (m *Model) renderCurrentTrackDisplay() string {
 		Bold(true).
 		MarginLeft(1).
 		MarginRight(1).
-		Foreground(lipgloss.Color("255"))
+		Foreground(m.theme.Text)
 
-	if m.Queue.Current() == nil {
+	if m.playback.CurrentTrack == nil {
 		return ""
 	}
 
-	trackText := fmt.Sprintf("%s", m.Queue.Current().Title)
+	trackText := fmt.Sprintf("%s", m.playback.CurrentTrack.Title)
+	if chapter, ok := m.currentChapter(); ok {
+		trackText += " · " + chapter
+	}
 
 	return trackStyle.Render(trackText)
 }
 
 func (m *Model) renderArtistDisplay() string {
 	artistStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("250")).
+		Foreground(m.theme.Muted).
 		MarginLeft(1).
 		MarginRight(1).
 		Align(lipgloss.Center)
 
-	if m.Queue.Current() == nil {
+	if m.playback.CurrentTrack == nil {
 		return ""
 	}
 
 	artistText := fmt.Sprintf(
 		"%s - %s",
-		m.Queue.Current().Artist,
-		m.Queue.Current().Album,
+		m.playback.CurrentTrack.Artist,
+		m.playback.CurrentTrack.Album,
 	)
 
 	return artistStyle.Render(artistText)
 }
 
-// renderStatusBar renders the status bar with view indicator and help text
+// renderStatusBar renders the status bar with view indicator and help text,
+// or the prompt that is open.
 func (m *Model) renderStatusBar() string {
+	if m.seeking {
+		return lipgloss.NewStyle().Width(m.Width).MarginTop(1).Render(m.seekInput.View())
+	}
+	if m.naming {
+		return lipgloss.NewStyle().Width(m.Width).MarginTop(1).Render(m.bookmarkInput.View())
+	}
 	return lipgloss.NewStyle().
 		Width(m.Width).
 		Bold(true).
 		MarginTop(1).
-		Foreground(lipgloss.Color("15")).
-		Background(lipgloss.Color("62")).
-		Render(fmt.Sprintf(" %s | Tab: Switch View | Q: Quit", m.viewMode))
+		Foreground(m.theme.StatusText).
+		Background(m.theme.Primary).
+		Render(fmt.Sprintf(" %s | Repeat: %s | Shuffle: %s | %s: Switch View | %s: Quit%s",
+			m.viewMode, m.playback.RepeatMode, onOff(m.playback.IsShuffled),
+			m.keys.Help(m.keyView(), components.ActionToggleView),
+			m.keys.Help(m.keyView(), components.ActionQuit),
+			m.renderStatusMessage()))
 }
 
 func (m *Model) renderPlayedTime() string {
 	playedTimeStyle := lipgloss.NewStyle().
 		MarginRight(1).
 		MarginLeft(1).
-		Render(formatDuration(m.AudioPlayer.PlayedTime))
+		Render(formatDuration(m.playback.CurrentTime))
 
 	return playedTimeStyle
 }
@@ -175,7 +280,7 @@ func (m *Model) renderTotalTime() string {
 	totalTimeStyle := lipgloss.NewStyle().
 		MarginLeft(1).
 		MarginRight(1).
-		Render(formatDuration(m.AudioPlayer.TotalTime))
+		Render(formatDuration(m.playback.Duration))
 
 	return totalTimeStyle
 }
@@ -199,8 +304,8 @@ func (m *Model) renderPlayerInfo() string {
 		m.renderVolumeDisplay(),
 	)
 
-	playedTimeStr := formatDuration(m.AudioPlayer.PlayedTime)
-	totalTimeStr := formatDuration(m.AudioPlayer.TotalTime)
+	playedTimeStr := formatDuration(m.playback.CurrentTime)
+	totalTimeStr := formatDuration(m.playback.Duration)
 
 	// Calculate widths for each block
 	leftWidth := lipgloss.Width(trackArtistBlock)
@@ -232,3 +337,23 @@ func formatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%02d:%02d", m, s)
 }
+
+// renderStatusMessage returns the last error or status message as a status bar suffix.
+func (m *Model) renderStatusMessage() string {
+	switch {
+	case m.Error != nil:
+		return " | Error: " + m.Error.Error()
+	case m.Status != "":
+		return " | " + m.Status
+	default:
+		return ""
+	}
+}
+
+// onOff formats a toggle for the status bar.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+// NewBookmarkTable returns the table of the bookmarks view, which lists the
+// bookmarks of every track.
+func NewBookmarkTable(columns []table.Column, rows []table.Row, theme Theme) table.Model {
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithKeyMap(noKeys),
+	)
+	t.SetStyles(TableStyles(theme))
+	return t
+}
+
+// NewBookmarkPrompt returns the input a new bookmark is named in.
+func NewBookmarkPrompt() textinput.Model {
+	t := textinput.New()
+	t.Prompt = "Bookmark name: "
+	t.CharLimit = 64
+	return t
+}
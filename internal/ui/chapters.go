@@ -0,0 +1,16 @@
+package ui
+
+import "github.com/charmbracelet/bubbles/table"
+
+// NewChapterTable returns the table of the chapters view, which lists the
+// chapters of the track playing.
+func NewChapterTable(columns []table.Column, rows []table.Row, theme Theme) table.Model {
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithKeyMap(noKeys),
+	)
+	t.SetStyles(TableStyles(theme))
+	return t
+}
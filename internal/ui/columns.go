@@ -0,0 +1,40 @@
+package ui
+
+import "github.com/charmbracelet/bubbles/table"
+
+// ColumnSpec describes a table column before it is laid out for a given width.
+// A column either has a fixed Width, or a Weight that decides its share of the
+// width left over once fixed columns have been placed.
+type ColumnSpec struct {
+	Title  string
+	Width  int // Fixed width; ignored when Weight is set
+	Weight int // Relative share of the remaining width
+}
+
+// LayoutColumns converts column specs into table columns that fill the given width.
+func LayoutColumns(width int, specs []ColumnSpec) []table.Column {
+	// Calculate remaining width for flexible columns
+	// Subtract fixed widths and separators (2 chars)
+	remainingWidth := width - 2
+	totalWeight := 0
+	for _, spec := range specs {
+		if spec.Weight > 0 {
+			totalWeight += spec.Weight
+		} else {
+			remainingWidth -= spec.Width
+		}
+	}
+	if remainingWidth < 0 {
+		remainingWidth = 0
+	}
+
+	columns := make([]table.Column, len(specs))
+	for i, spec := range specs {
+		w := spec.Width
+		if spec.Weight > 0 {
+			w = remainingWidth * spec.Weight / totalWeight
+		}
+		columns[i] = table.Column{Title: spec.Title, Width: w}
+	}
+	return columns
+}
@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"math"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// GainBar draws a gain between -limit and limit dB as a bar of the given
+// width, growing from a centre mark to the right for boosts and to the left
+// for cuts.
+func GainBar(db, limit float64, width int) string {
+	half := max(width/2, 1)
+	cells := []rune(strings.Repeat("─", 2*half+1))
+	cells[half] = '┼'
+	n := int(math.Round(math.Abs(db) / limit * float64(half)))
+	for i := 1; i <= min(n, half); i++ {
+		if db > 0 {
+			cells[half+i] = '█'
+		} else {
+			cells[half-i] = '█'
+		}
+	}
+	return string(cells)
+}
+
+// EQRowStyles returns the styles of the rows of the equalizer view: normal
+// and selected, matching the rows of the track tables.
+func EQRowStyles(theme Theme) (normal, selected lipgloss.Style) {
+	normal = lipgloss.NewStyle().Padding(0, 1)
+	selected = normal.
+		Foreground(theme.Accent).
+		Background(theme.Secondary).
+		Bold(true)
+	return normal, selected
+}
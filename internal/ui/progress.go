@@ -1,10 +1,71 @@
 package ui
 
-import "github.com/charmbracelet/bubbles/progress"
+import (
+	"sort"
 
-func NewProgressBar() progress.Model {
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func NewProgressBar(theme Theme) progress.Model {
 	return progress.New(
-		progress.WithSolidFill("White"),
+		progress.WithSolidFill(string(theme.Progress)),
 		progress.WithoutPercentage(),
 	)
 }
+
+// ProgressMark is a label drawn over a progress bar, such as the start of a
+// loop.
+type ProgressMark struct {
+	At    float64 // Position along the bar, 0-1
+	Label string  // One cell wide
+	// Tick marks, such as the starts of chapters, are drawn more quietly and
+	// left out where they would crowd other marks.
+	Tick bool
+}
+
+// MarkProgress draws marks over bar, a rendered progress bar of the given
+// width, each replacing the cell at its position.
+func MarkProgress(bar string, width int, marks []ProgressMark, theme Theme) string {
+	if width <= 0 || len(marks) == 0 {
+		return bar
+	}
+	style := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent).Background(theme.Secondary)
+	tickStyle := lipgloss.NewStyle().Foreground(theme.Muted)
+	cellOf := func(m ProgressMark) int { return max(0, min(int(m.At*float64(width)), width-1)) }
+
+	taken := make(map[int]bool)
+	for _, m := range marks {
+		if !m.Tick {
+			taken[cellOf(m)] = true
+		}
+	}
+	kept := make([]ProgressMark, 0, len(marks))
+	for _, m := range marks {
+		if m.Tick {
+			if taken[cellOf(m)] {
+				continue
+			}
+			taken[cellOf(m)] = true
+		}
+		kept = append(kept, m)
+	}
+	marks = kept
+	sort.Slice(marks, func(i, j int) bool { return marks[i].At < marks[j].At })
+
+	out, next := "", 0
+	for _, m := range marks {
+		cell := max(cellOf(m), next) // Marks sharing a cell are moved apart.
+		if cell >= width {
+			break
+		}
+		if m.Tick {
+			out += ansi.Cut(bar, next, cell) + tickStyle.Render(m.Label)
+		} else {
+			out += ansi.Cut(bar, next, cell) + style.Render(m.Label)
+		}
+		next = cell + 1
+	}
+	return out + ansi.Cut(bar, next, width)
+}
@@ -0,0 +1,12 @@
+package ui
+
+import "github.com/charmbracelet/bubbles/textinput"
+
+// NewSeekPrompt returns the input of the go-to-time prompt.
+func NewSeekPrompt() textinput.Model {
+	t := textinput.New()
+	t.Placeholder = "1:23.5, -30s or 50%"
+	t.Prompt = "Go to: "
+	t.CharLimit = 32
+	return t
+}
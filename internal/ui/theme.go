@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme holds the colors and border used to draw the UI.
+type Theme struct {
+	Primary    lipgloss.Color  // View titles and the status bar background
+	Secondary  lipgloss.Color  // Background of the selected table row
+	Accent     lipgloss.Color  // Text of the selected table row
+	Text       lipgloss.Color  // Title of the playing track
+	Muted      lipgloss.Color  // Artist, album and volume
+	Border     lipgloss.Color  // Table header border
+	StatusText lipgloss.Color  // Status bar text
+	Progress   lipgloss.Color  // Filled part of the progress bar
+	BorderType lipgloss.Border // Table header border style
+}
+
+// borders maps border style names, as used in config files, to lipgloss borders.
+var borders = map[string]lipgloss.Border{
+	"normal":  lipgloss.NormalBorder(),
+	"rounded": lipgloss.RoundedBorder(),
+	"thick":   lipgloss.ThickBorder(),
+	"double":  lipgloss.DoubleBorder(),
+	"hidden":  lipgloss.HiddenBorder(),
+}
+
+// BorderByName returns the border with the given name, e.g. "rounded".
+func BorderByName(name string) (lipgloss.Border, bool) {
+	b, ok := borders[name]
+	return b, ok
+}
+
+// TableStyles returns the styles shared by every track table.
+func TableStyles(theme Theme) table.Styles {
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		Bold(true).
+		Padding(0, 1).
+		BorderStyle(theme.BorderType).
+		BorderBottom(true).
+		BorderForeground(theme.Border)
+	s.Selected = s.Selected.
+		Foreground(theme.Accent).
+		Background(theme.Secondary).
+		Bold(true)
+	s.Cell = s.Cell.
+		Padding(0, 1)
+	return s
+}
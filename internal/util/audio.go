@@ -4,50 +4,111 @@ import (
 	"fmt"
 	"github.com/dhowden/tag"
 	"github.com/gopxl/beep"
-	"github.com/gopxl/beep/mp3"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
-	"sync"
 	"time"
 )
 
 // AudioFile represents a single audio file with its metadata
 type AudioFile struct {
-	Title    string
-	Artist   string
-	Album    string
-	Picture  *tag.Picture
-	Duration string
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Composer    string
+	Genre       string
+	Year        int
+	TrackNumber int // Position on the disc; 0 if unknown
+	TrackTotal  int // Number of tracks on the disc; 0 if unknown
+	DiscNumber  int // Disc within the album; 0 if unknown
+	DiscTotal   int // Number of discs in the album; 0 if unknown
+	Picture     *tag.Picture
+	Duration    time.Duration
+	// DurationEstimated is set when Duration was estimated from the file's
+	// headers rather than measured; see MeasureDuration.
+	DurationEstimated bool
+	Size              int64 // File size in bytes
+	Bitrate           int   // Average bitrate in kbit/s
+	SampleRate        int   // Sample rate in Hz
+	ReplayGain        ReplayGain
+	// Loudness is measured for files without ReplayGain tags; see
+	// MeasureTracks. It is nil until then, and for files too short or quiet
+	// to measure.
+	Loudness *Loudness
 	Path     string
 	FileName string
+	// Missing is set on playlist entries whose file is no longer in the library.
+	Missing bool
+	// Source is the file a track split from a single-file album by a CUE
+	// sheet lies in, from Start up to End; an End of 0 is the end of the
+	// file. It is empty for tracks that are files of their own.
+	Source     string
+	Start, End time.Duration
+	// Chapters are the chapters the file's tags divide the track into,
+	// sorted by start. They are nil for tracks without any.
+	Chapters []Chapter
 }
 
-// OpenAudioFile opens an MP3 file and decodes it to return the audio streamer, format, and total samples.
+// IsPart reports whether the track is part of a larger file.
+func (a *AudioFile) IsPart() bool {
+	return a.Source != ""
+}
+
+// SourcePath returns the path of the file the track's audio is in.
+func (a *AudioFile) SourcePath() string {
+	if a.IsPart() {
+		return a.Source
+	}
+	return a.Path
+}
+
+// DurationString returns the track duration formatted as "MM:SS" or "HH:MM:SS".
+func (a *AudioFile) DurationString() string {
+	return formatDuration(a.Duration)
+}
+
+// OpenAudioFile opens a supported audio file and decodes it to return the audio streamer, format, and total samples.
+// Files that cannot be decoded return an error wrapping ErrInvalidFormat.
 func OpenAudioFile(path string) (beep.StreamSeekCloser, beep.Format, int, error) {
 	// Open file.
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, beep.Format{}, 0, err
 	}
-	// Decode MP3 file.
-	streamer, format, err := mp3.Decode(f)
+	// Decode the file with the decoder registered for its format.
+	streamer, format, err := DecodeFile(f)
 	if err != nil {
-		err := f.Close()
-		if err != nil {
-			return nil, beep.Format{}, 0, err
-		}
 		return nil, beep.Format{}, 0, err
 	}
 	totalSamples := streamer.Len()
 	return streamer, format, totalSamples, nil
 }
 
-// isAudioFile checks if a file has an .mp3 extension (case-insensitive).
+// OpenTrack opens the audio of file like OpenAudioFile, limited to its part
+// of the source file for tracks split by a CUE sheet. Positions and the
+// length of the stream are then those within the track.
+func OpenTrack(file *AudioFile) (beep.StreamSeekCloser, beep.Format, int, error) {
+	streamer, format, totalSamples, err := OpenAudioFile(file.SourcePath())
+	if err != nil || !file.IsPart() {
+		return streamer, format, totalSamples, err
+	}
+	end := 0
+	if file.End > 0 {
+		end = format.SampleRate.N(file.End)
+	}
+	part, err := newSection(streamer, format.SampleRate.N(file.Start), end)
+	if err != nil {
+		_ = streamer.Close()
+		return nil, beep.Format{}, 0, err
+	}
+	return part, format, part.Len(), nil
+}
+
+// isAudioFile checks if a file has the extension of a registered audio format (case-insensitive).
 func isAudioFile(name string) bool {
-	const ext = ".mp3"
-	return strings.HasSuffix(strings.ToLower(name), ext)
+	_, ok := decoderForExtension(name)
+	return ok
 }
 
 // formatDuration formats a time.Duration as a string in the format "HH:MM:SS" or "MM:SS".
@@ -69,96 +130,93 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d", m, s)
 }
 
-// Add a cache for file metadata
-var (
-	metadataCache = make(map[string]struct {
-		title, artist, album, duration string
-		picture                        *tag.Picture
-	})
-	cacheMutex sync.RWMutex
-)
-
 // ReadAudioMetadata extracts metadata from the audio file at the specified path.
-func ReadAudioMetadata(path, defaultName string) (string, string, string, *tag.Picture, string) {
-	// Check if the file is in the cache
-	cacheMutex.RLock()
-	if cached, exists := metadataCache[path]; exists {
-		cacheMutex.RUnlock()
-		return cached.title, cached.artist, cached.album, cached.picture, cached.duration
-	}
-	cacheMutex.RUnlock()
-
+// It always reads the file; ScanLibrary consults the MetadataCache before calling it.
+// It returns an error wrapping ErrInvalidFormat if the file cannot be decoded.
+func ReadAudioMetadata(path, defaultName string) (*AudioFile, error) {
 	// Default values
-	title := defaultName
-	artist := "Unknown"
-	album := "Unknown"
-	picture := &tag.Picture{}
-	duration := "0:00"
+	file := &AudioFile{
+		Title:    defaultName,
+		Artist:   "Unknown",
+		Album:    "Unknown",
+		Picture:  &tag.Picture{},
+		Path:     path,
+		FileName: filepath.Base(path),
+	}
 
 	// Open file for reading
 	f, err := os.Open(path)
 	if err != nil {
-		return title, artist, album, picture, duration
+		return nil, err
 	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
 
-	// Get file info
 	fileInfo, err := f.Stat()
 	if err != nil {
-		return title, artist, album, picture, duration
+		return nil, err
 	}
+	file.Size = fileInfo.Size()
 
 	// Read metadata
 	meta, err := tag.ReadFrom(f)
 	if err == nil {
 		if t := meta.Title(); t != "" {
-			title = t
+			file.Title = t
 		}
 		if a := meta.Artist(); a != "" {
-			artist = a
+			file.Artist = a
 		}
 		if a := meta.Album(); a != "" {
-			album = a
+			file.Album = a
 		}
 		if a := meta.Picture(); a != nil {
-			picture = a
+			file.Picture = a
 		}
+		file.AlbumArtist = meta.AlbumArtist()
+		file.Composer = meta.Composer()
+		file.Genre = meta.Genre()
+		file.Year = meta.Year()
+		file.TrackNumber, file.TrackTotal = meta.Track()
+		file.DiscNumber, file.DiscTotal = meta.Disc()
+		file.ReplayGain = readReplayGain(meta.Raw())
+		file.Chapters = readChapters(meta)
+	}
+
+	// Get duration, from the headers where the format allows it. Otherwise the
+	// file is decoded, which also verifies that it can actually be played.
+	d, err := detectDecoder(f)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get duration
-	if _, err := f.Seek(0, 0); err == nil {
-		duration = getFileDurationFromReader(f, fileInfo)
+	var info StreamInfo
+	if d.Probe != nil {
+		info, err = d.Probe(f, file.Size)
+	} else {
+		info, err = probeAudioFile(file)
 	}
-
-	// Cache the results
-	cacheMutex.Lock()
-	metadataCache[path] = struct {
-		title, artist, album, duration string
-		picture                        *tag.Picture
-	}{
-		title:    title,
-		artist:   artist,
-		album:    album,
-		picture:  picture,
-		duration: duration,
+	if err != nil {
+		return nil, err
+	}
+	file.Duration = info.Duration
+	file.DurationEstimated = info.Estimated
+	file.SampleRate = info.SampleRate
+	file.Bitrate = info.Bitrate
+	if seconds := info.Duration.Seconds(); file.Bitrate == 0 && seconds > 0 {
+		file.Bitrate = int(float64(file.Size*8) / seconds / 1000)
 	}
-	cacheMutex.Unlock()
 
-	return title, artist, album, picture, duration
+	return file, nil
 }
 
-// getFileDurationFromReader reads the duration of an audio file from the provided file.
-// It returns the duration of the audio file as a string in the format "HH:MM:SS".
-// Note: The file should be opened and closed by the caller.
-func getFileDurationFromReader(f *os.File, fileInfo os.FileInfo) string {
-	// Seek to the beginning of the file in case it was read before
-	if _, err := f.Seek(0, 0); err != nil {
-		return "0:00"
-	}
-
-	// Decode the file
-	streamer, format, err := mp3.Decode(f)
+// probeAudioFile decodes the audio of file to determine its duration and format.
+func probeAudioFile(file *AudioFile) (StreamInfo, error) {
+	streamer, format, totalSamples, err := OpenTrack(file)
 	if err != nil {
-		return "0:00"
+		return StreamInfo{}, err
 	}
 	defer func() {
 		err := streamer.Close()
@@ -167,86 +225,23 @@ func getFileDurationFromReader(f *os.File, fileInfo os.FileInfo) string {
 		}
 	}()
 
-	// Calculate the total samples
-	totalSamples := streamer.Len()
-
 	// Calculate the duration from the sample rate and the length of the streamer
-	duration := format.SampleRate.D(totalSamples)
+	return StreamInfo{
+		Duration:   format.SampleRate.D(totalSamples),
+		SampleRate: int(format.SampleRate),
+	}, nil
+}
 
-	// Return the duration as a string in the format "HH:MM:SS"
-	return formatDuration(duration)
+// MeasureDuration fully decodes the audio of file to determine its exact
+// duration. It is much slower than the header-based estimate ReadAudioMetadata
+// uses for some formats.
+func MeasureDuration(file *AudioFile) (time.Duration, error) {
+	info, err := probeAudioFile(file)
+	return info.Duration, err
 }
 
-// GetAudioFiles scans the specified directory for audio files and returns a slice of AudioFile
+// GetAudioFiles recursively scans the specified directory for audio files and returns a slice of AudioFile.
+// It is a shorthand for ScanLibrary with a single root and default options.
 func GetAudioFiles(dir string) ([]*AudioFile, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, fmt.Errorf("error reading directory: %w", err)
-	}
-
-	type result struct {
-		file  *AudioFile
-		index int
-		err   error
-	}
-
-	var wg sync.WaitGroup
-	results := make(chan result, len(entries))
-	var audioFiles []*AudioFile
-
-	// Process files in parallel
-	for i, entry := range entries {
-		if entry.IsDir() || !isAudioFile(entry.Name()) {
-			continue
-		}
-
-		wg.Add(1)
-		go func(idx int, entry os.DirEntry) {
-			defer wg.Done()
-
-			path := filepath.Join(dir, entry.Name())
-			title, artist, album, picture, duration := ReadAudioMetadata(path, entry.Name())
-
-			results <- result{
-				file: &AudioFile{
-					Title:    title,
-					Artist:   artist,
-					Album:    album,
-					Picture:  picture,
-					Duration: duration,
-					Path:     path,
-					FileName: entry.Name(),
-				},
-				index: idx,
-			}
-		}(i, entry)
-	}
-
-	// Close results channel when all workers are done
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	// Collect results
-	tempFiles := make([]*AudioFile, len(entries))
-	var count int
-
-	for res := range results {
-		if res.err != nil {
-			continue
-		}
-		tempFiles[res.index] = res.file
-		count++
-	}
-
-	// Filter out nil entries
-	audioFiles = make([]*AudioFile, 0, count)
-	for _, file := range tempFiles {
-		if file != nil {
-			audioFiles = append(audioFiles, file)
-		}
-	}
-
-	return audioFiles, nil
+	return ScanLibrary(ScanOptions{Roots: []string{dir}})
 }
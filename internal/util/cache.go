@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// metadataCacheVersion must be bumped whenever AudioFile or the cache layout
+// changes in a way that makes existing cache files unusable.
+const metadataCacheVersion = 5
+
+// metadataCacheFileName is the name of the cache file inside CacheDir.
+const metadataCacheFileName = "metadata.gob"
+
+// cacheEntry is the cached metadata of a single file, along with the size and
+// modification time it was read at.
+type cacheEntry struct {
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+	File    AudioFile
+}
+
+// cacheFile is the on-disk layout of the metadata cache.
+type cacheFile struct {
+	Version int
+	Entries map[string]cacheEntry
+}
+
+// MetadataCache is a persistent store of track metadata keyed by path. An entry
+// is only used while the file's size and modification time are unchanged, so
+// edited or replaced files are re-read automatically.
+type MetadataCache struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]cacheEntry
+	dirty   bool
+}
+
+// DefaultMetadataCachePath returns the location of the metadata cache under CacheDir.
+func DefaultMetadataCachePath() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, metadataCacheFileName), nil
+}
+
+// NewMetadataCache returns an empty cache that will be saved to path.
+// An empty path gives a cache that only lives in memory.
+func NewMetadataCache(path string) *MetadataCache {
+	return &MetadataCache{
+		path:    path,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// LoadMetadataCache reads the cache stored at path. A missing, corrupt or
+// outdated cache file is not an error: an empty cache is returned instead and
+// rebuilt by the next scan.
+func LoadMetadataCache(path string) (*MetadataCache, error) {
+	c := NewMetadataCache(path)
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	var stored cacheFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stored); err != nil {
+		return c, fmt.Errorf("discarding unreadable metadata cache: %w", err)
+	}
+	if stored.Version != metadataCacheVersion {
+		c.dirty = true // Rewrite it in the current format.
+		return c, nil
+	}
+	if stored.Entries != nil {
+		c.entries = stored.Entries
+	}
+	return c, nil
+}
+
+// Lookup returns the cached metadata for path if the file is unchanged since it
+// was cached. The returned AudioFile is a fresh copy owned by the caller.
+func (c *MetadataCache) Lookup(path string, info os.FileInfo) (*AudioFile, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[path]
+	c.mu.RUnlock()
+
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	file := entry.File
+	file.Path = path
+	return &file, true
+}
+
+// Store records the metadata read for path. Artwork is not persisted.
+func (c *MetadataCache) Store(path string, info os.FileInfo, file *AudioFile) {
+	entry := cacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		File:    *file,
+	}
+	entry.File.Picture = nil
+
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// Prune drops every entry whose path is not in keep, so files removed from the
+// library don't linger in the cache forever.
+func (c *MetadataCache) Prune(keep []string) {
+	wanted := make(map[string]bool, len(keep))
+	for _, p := range keep {
+		wanted[p] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.entries {
+		if !wanted[p] {
+			delete(c.entries, p)
+			c.dirty = true
+		}
+	}
+}
+
+// Save atomically writes the cache to disk if it changed since it was loaded.
+func (c *MetadataCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheFile{
+		Version: metadataCacheVersion,
+		Entries: c.entries,
+	}); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(c.path, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,179 @@
+package util
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+func TestMetadataCacheLookup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stat := func() os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	c := NewMetadataCache("")
+	c.Store(path, stat(), &AudioFile{Title: "Song", Path: "/elsewhere", Picture: &tag.Picture{Data: []byte("cover")}})
+	got, ok := c.Lookup(path, stat())
+	if !ok || got.Title != "Song" || got.Path != path || got.Picture != nil {
+		t.Fatalf("Lookup = %+v, %v; want Song at %s without artwork", got, ok, path)
+	}
+	got.Title = "Changed"
+	if again, _ := c.Lookup(path, stat()); again.Title != "Song" {
+		t.Error("changing a looked up file changed the cache")
+	}
+	if _, ok := c.Lookup(filepath.Join(dir, "other.mp3"), stat()); ok {
+		t.Error("Lookup found a path never stored")
+	}
+
+	// A touched file is read again.
+	later := stat().ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup(path, stat()); ok {
+		t.Error("Lookup found the file after its modification time changed")
+	}
+
+	// So is one whose size changed, even at the same modification time.
+	c.Store(path, stat(), &AudioFile{Title: "Song"})
+	if err := os.WriteFile(path, []byte("longer audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup(path, stat()); ok {
+		t.Error("Lookup found the file after its size changed")
+	}
+}
+
+func TestMetadataCacheSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "metadata.gob")
+	paths := []string{filepath.Join(dir, "a.flac"), filepath.Join(dir, "b.flac")}
+	var infos []os.FileInfo
+	for _, p := range paths {
+		if err := os.WriteFile(p, []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, info)
+	}
+
+	// A missing cache file is an empty cache.
+	c, err := LoadMetadataCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadMetadataCache of a missing file: %v", err)
+	}
+	stored := &AudioFile{
+		Title: "A", Duration: time.Minute, Loudness: &Loudness{Integrated: -14, Peak: 0.9},
+		Chapters: []Chapter{{Title: "Intro", End: time.Second}},
+	}
+	c.Store(paths[0], infos[0], stored)
+	c.Store(paths[1], infos[1], &AudioFile{Title: "B"})
+	c.Prune(paths[:1])
+	if _, ok := c.Lookup(paths[1], infos[1]); ok {
+		t.Error("Prune kept a path not asked for")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadMetadataCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := loaded.Lookup(paths[0], infos[0])
+	stored.Path = paths[0]
+	if !ok || !reflect.DeepEqual(got, stored) {
+		t.Errorf("loaded %+v, %v; want %+v", got, ok, stored)
+	}
+	if _, ok := loaded.Lookup(paths[1], infos[1]); ok {
+		t.Error("the pruned entry was saved")
+	}
+
+	// An unchanged cache isn't written again.
+	if err := os.Remove(cachePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Errorf("an unchanged cache was saved: %v", err)
+	}
+}
+
+func TestMetadataCacheRejectsOtherVersions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	old := cacheFile{Version: metadataCacheVersion - 1, Entries: map[string]cacheEntry{
+		path: {Size: info.Size(), ModTime: info.ModTime().UnixNano(), File: AudioFile{Title: "Old"}},
+	}}
+	if err := gob.NewEncoder(&buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(dir, "metadata.gob")
+	if err := os.WriteFile(cachePath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadMetadataCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadMetadataCache of an outdated file: %v", err)
+	}
+	if f, ok := c.Lookup(path, info); ok {
+		t.Errorf("an outdated cache gave %+v", f)
+	}
+	// It is rewritten in the current format.
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	var saved cacheFile
+	data, _ := os.ReadFile(cachePath)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil || saved.Version != metadataCacheVersion {
+		t.Errorf("saved version %d, %v; want %d", saved.Version, err, metadataCacheVersion)
+	}
+
+	// A corrupt cache is reported, and replaced by an empty one.
+	if err := os.WriteFile(cachePath, []byte("not a cache"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadMetadataCache(cachePath)
+	if err == nil {
+		t.Error("LoadMetadataCache of a corrupt file succeeded")
+	}
+	if c == nil {
+		t.Fatal("LoadMetadataCache of a corrupt file returned no cache")
+	}
+	if _, ok := c.Lookup(path, info); ok {
+		t.Error("a corrupt cache gave an entry")
+	}
+}
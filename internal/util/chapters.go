@@ -0,0 +1,237 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/dhowden/tag"
+)
+
+// Chapter is a chapter of a track, such as those of an audiobook or a
+// podcast episode.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	// End is where the chapter ends, or 0 if it runs until the next one
+	// starts, or the end of the track for the last one.
+	End time.Duration
+}
+
+// ChapterAt returns the index of the chapter of chapters, sorted by start,
+// that pos lies in. Before the first chapter starts there is none.
+func ChapterAt(chapters []Chapter, pos time.Duration) (int, bool) {
+	i := sort.Search(len(chapters), func(i int) bool { return chapters[i].Start > pos }) - 1
+	return i, i >= 0
+}
+
+// ChapterEnd returns where chapters[i] ends, in a track lasting total.
+func ChapterEnd(chapters []Chapter, i int, total time.Duration) time.Duration {
+	end := total
+	if i+1 < len(chapters) {
+		end = chapters[i+1].Start
+	}
+	if c := chapters[i]; c.End > c.Start && c.End < end {
+		end = c.End
+	}
+	return end
+}
+
+// readChapters reads the chapters of a file from its tags: ID3v2 CHAP frames,
+// limited to those the top-level CTOC frame lists if there is one, or
+// Vorbis CHAPTERxxx comments. They are returned sorted by start. MP4 chapters,
+// as in M4B audiobooks, aren't read: muxic has no MP4 decoder to play them.
+func readChapters(meta tag.Metadata) []Chapter {
+	var chapters []Chapter
+	switch meta.Format() {
+	case tag.ID3v2_3, tag.ID3v2_4:
+		chapters = readID3Chapters(meta.Raw(), meta.Format() == tag.ID3v2_4)
+	case tag.VORBIS:
+		chapters = readVorbisChapters(meta.Raw())
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters
+}
+
+// readID3Chapters reads the CHAP frames among raw, the frames of an ID3v2.3
+// or, if syncSafe, ID3v2.4 tag. They are returned in the order the top-level
+// CTOC frame lists them, or else in no particular order, as raw doesn't keep
+// the order of the frames.
+func readID3Chapters(raw map[string]interface{}, syncSafe bool) []Chapter {
+	byID := make(map[string]Chapter)
+	var ids []string // Of every CHAP frame
+	var toc []string // Listed by the top-level table of contents
+	for key, value := range raw {
+		b, ok := value.([]byte)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, "CHAP"):
+			id, c, ok := parseCHAP(b, syncSafe)
+			if ok {
+				byID[id] = c
+				ids = append(ids, id)
+			}
+		case strings.HasPrefix(key, "CTOC"):
+			if children, top := parseCTOC(b); top {
+				toc = children
+			}
+		}
+	}
+	if len(toc) == 0 {
+		toc = ids
+	}
+
+	chapters := make([]Chapter, 0, len(toc))
+	for _, id := range toc {
+		if c, ok := byID[id]; ok {
+			chapters = append(chapters, c)
+		}
+	}
+	return chapters
+}
+
+// parseCHAP parses the body of a CHAP frame, returning its element ID and
+// the chapter, titled by its TIT2 sub-frame.
+func parseCHAP(b []byte, syncSafe bool) (string, Chapter, bool) {
+	id, b, ok := cutNul(b)
+	if !ok || len(b) < 16 {
+		return "", Chapter{}, false
+	}
+	start := binary.BigEndian.Uint32(b[0:4])
+	end := binary.BigEndian.Uint32(b[4:8])
+	c := Chapter{Start: time.Duration(start) * time.Millisecond}
+	if end != 0xFFFFFFFF && end > start {
+		c.End = time.Duration(end) * time.Millisecond
+	}
+	c.Title = readSubFrameText(b[16:], "TIT2", syncSafe)
+	return id, c, true
+}
+
+// parseCTOC parses the body of a CTOC frame, returning the element IDs of
+// the entries it lists and whether it is the top-level one.
+func parseCTOC(b []byte) ([]string, bool) {
+	_, b, ok := cutNul(b)
+	if !ok || len(b) < 2 {
+		return nil, false
+	}
+	top := b[0]&0x02 != 0
+	count := int(b[1])
+	b = b[2:]
+	children := make([]string, 0, count)
+	for range count {
+		var child string
+		if child, b, ok = cutNul(b); !ok {
+			break
+		}
+		children = append(children, child)
+	}
+	return children, top
+}
+
+// readSubFrameText returns the text of the first sub-frame called name
+// among b, the frames embedded in a CHAP or CTOC frame.
+func readSubFrameText(b []byte, name string, syncSafe bool) string {
+	for len(b) >= 10 {
+		size := int(binary.BigEndian.Uint32(b[4:8]))
+		if syncSafe {
+			size = int(b[4])<<21 | int(b[5])<<14 | int(b[6])<<7 | int(b[7])
+		}
+		if size <= 0 || size > len(b)-10 {
+			return ""
+		}
+		if string(b[:4]) == name {
+			return decodeID3Text(b[10 : 10+size])
+		}
+		b = b[10+size:]
+	}
+	return ""
+}
+
+// decodeID3Text decodes the body of an ID3v2 text frame, whose first byte
+// gives its encoding.
+func decodeID3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, b := b[0], b[1:]
+	var s string
+	switch enc {
+	case 0: // ISO-8859-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		s = string(runes)
+	case 1, 2: // UTF-16, with a byte order mark, or big-endian without one
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(b) >= 2 {
+			if b[0] == 0xFF && b[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if (b[0] == 0xFF && b[1] == 0xFE) || (b[0] == 0xFE && b[1] == 0xFF) {
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		s = string(utf16.Decode(units))
+	default: // UTF-8
+		s = string(b)
+	}
+	// Text may be terminated, or hold several values separated, by nulls.
+	s, _, _ = strings.Cut(s, "\x00")
+	return strings.TrimSpace(s)
+}
+
+// cutNul splits b at its first null byte.
+func cutNul(b []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(b[:i]), b[i+1:], true
+}
+
+// readVorbisChapters reads chapters from Vorbis comments such as
+// CHAPTER001=00:01:30.000 and CHAPTER001NAME=Introduction.
+func readVorbisChapters(raw map[string]interface{}) []Chapter {
+	var chapters []Chapter
+	for key, value := range raw {
+		text, ok := value.(string)
+		num, isNum := strings.CutPrefix(key, "chapter")
+		if !ok || !isNum || num == "" || strings.Trim(num, "0123456789") != "" {
+			continue
+		}
+		start, ok := parseChapterTime(text)
+		if !ok {
+			continue
+		}
+		title, _ := raw[key+"name"].(string)
+		chapters = append(chapters, Chapter{Title: strings.TrimSpace(title), Start: start})
+	}
+	return chapters
+}
+
+// parseChapterTime parses a chapter's start such as "01:02:03.500".
+func parseChapterTime(s string) (time.Duration, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || h < 0 || m < 0 || m >= 60 || !(sec >= 0 && sec < 60) {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec*float64(time.Second)).Round(time.Millisecond), true
+}
@@ -0,0 +1,245 @@
+package util
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// id3SubFrame returns a frame embedded in a CHAP or CTOC frame, its size
+// syncsafe as in ID3v2.4 if syncSafe is set.
+func id3SubFrame(id string, body []byte, syncSafe bool) []byte {
+	b := []byte(id)
+	size := len(body)
+	if syncSafe {
+		b = append(b, byte(size>>21&0x7F), byte(size>>14&0x7F), byte(size>>7&0x7F), byte(size&0x7F))
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(size))
+	}
+	b = append(b, 0, 0) // Flags
+	return append(b, body...)
+}
+
+// id3Text returns the body of a text frame in ISO-8859-1.
+func id3Text(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+// chapFrame returns the body of a CHAP frame.
+func chapFrame(id string, start, end uint32, subFrames ...[]byte) []byte {
+	b := append([]byte(id), 0)
+	b = binary.BigEndian.AppendUint32(b, start)
+	b = binary.BigEndian.AppendUint32(b, end)
+	b = append(b, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF) // Byte offsets, unused
+	for _, f := range subFrames {
+		b = append(b, f...)
+	}
+	return b
+}
+
+// ctocFrame returns the body of a CTOC frame listing children.
+func ctocFrame(id string, top bool, children ...string) []byte {
+	flags := byte(0x01) // Ordered
+	if top {
+		flags |= 0x02
+	}
+	b := append([]byte(id), 0, flags, byte(len(children)))
+	for _, c := range children {
+		b = append(append(b, c...), 0)
+	}
+	return b
+}
+
+func TestParseCHAP(t *testing.T) {
+	long := strings.Repeat("x", 200) // Its size differs when syncsafe
+	tests := []struct {
+		name     string
+		b        []byte
+		syncSafe bool
+		wantID   string
+		want     Chapter
+		wantOK   bool
+	}{
+		{
+			name:   "id3v2.3",
+			b:      chapFrame("ch1", 1500, 0xFFFFFFFF, id3SubFrame("TIT2", id3Text(long), false)),
+			wantID: "ch1", want: Chapter{Title: long, Start: 1500 * time.Millisecond}, wantOK: true,
+		},
+		{
+			name:     "id3v2.4",
+			b:        chapFrame("ch1", 1500, 9000, id3SubFrame("TIT2", id3Text(long), true)),
+			syncSafe: true,
+			wantID:   "ch1", want: Chapter{Title: long, Start: 1500 * time.Millisecond, End: 9 * time.Second}, wantOK: true,
+		},
+		{
+			// Read as ID3v2.3, the syncsafe size is too large for the frame.
+			name:   "id3v2.4 read as id3v2.3",
+			b:      chapFrame("ch1", 0, 0, id3SubFrame("TIT2", id3Text(long), true)),
+			wantID: "ch1", wantOK: true,
+		},
+		{
+			name: "title after another sub-frame",
+			b: chapFrame("ch2", 0, 0,
+				id3SubFrame("TPE1", id3Text("Narrator"), false), id3SubFrame("TIT2", id3Text("Intro"), false)),
+			wantID: "ch2", want: Chapter{Title: "Intro"}, wantOK: true,
+		},
+		{
+			name:   "end before start",
+			b:      chapFrame("ch1", 5000, 1000),
+			wantID: "ch1", want: Chapter{Start: 5 * time.Second}, wantOK: true,
+		},
+		{
+			name:   "oversized sub-frame",
+			b:      chapFrame("ch1", 0, 0, id3SubFrame("TIT2", id3Text("Intro"), false)[:12]),
+			wantID: "ch1", wantOK: true,
+		},
+		{
+			name:   "truncated sub-frame header",
+			b:      chapFrame("ch1", 0, 0, []byte("TIT2\x00\x00")),
+			wantID: "ch1", wantOK: true,
+		},
+		{
+			name: "zero-sized sub-frame, read as padding",
+			b: chapFrame("ch1", 0, 0,
+				id3SubFrame("TPE1", nil, false), id3SubFrame("TIT2", id3Text("Intro"), false)),
+			wantID: "ch1", wantOK: true,
+		},
+		{
+			name: "missing NUL in the element ID",
+			b:    []byte("ch1"),
+		},
+		{
+			name: "truncated times",
+			b:    chapFrame("ch1", 0, 0)[:12],
+		},
+	}
+	for _, tt := range tests {
+		id, c, ok := parseCHAP(tt.b, tt.syncSafe)
+		if id != tt.wantID || c != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: parseCHAP = %q, %+v, %v; want %q, %+v, %v", tt.name, id, c, ok, tt.wantID, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseCTOC(t *testing.T) {
+	// The last element ID isn't terminated.
+	truncated := ctocFrame("toc", true, "ch1", "ch2", "ch3")
+	tests := []struct {
+		name     string
+		b        []byte
+		want     []string
+		wantTop  bool
+		wantNone bool
+	}{
+		{name: "top level", b: ctocFrame("toc", true, "ch2", "ch1"), want: []string{"ch2", "ch1"}, wantTop: true},
+		{name: "nested", b: ctocFrame("part1", false, "ch1"), want: []string{"ch1"}},
+		{name: "truncated", b: truncated[:len(truncated)-1], want: []string{"ch1", "ch2"}, wantTop: true},
+		{name: "missing NUL in the element ID", b: []byte("toc"), wantNone: true},
+		{name: "no flags", b: []byte("toc\x00"), wantNone: true},
+	}
+	for _, tt := range tests {
+		children, top := parseCTOC(tt.b)
+		if tt.wantNone {
+			if children != nil || top {
+				t.Errorf("%s: parseCTOC = %q, %v; want nothing", tt.name, children, top)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(children, tt.want) || top != tt.wantTop {
+			t.Errorf("%s: parseCTOC = %q, %v; want %q, %v", tt.name, children, top, tt.want, tt.wantTop)
+		}
+	}
+}
+
+func TestReadID3Chapters(t *testing.T) {
+	title := func(s string) []byte { return id3SubFrame("TIT2", id3Text(s), true) }
+	raw := map[string]interface{}{
+		"CHAP":   chapFrame("ch1", 0, 0, title("One")),
+		"CHAP_0": chapFrame("ch2", 60000, 0, title("Two")),
+		"CHAP_1": chapFrame("ch3", 30000, 0, title("Three")),
+		"CHAP_2": []byte("broken"),
+		"TIT2":   "Not a chapter",
+	}
+
+	// Without a table of contents, every chapter is read.
+	got := readID3Chapters(raw, true)
+	var titles []string
+	for _, c := range got {
+		titles = append(titles, c.Title)
+	}
+	if len(titles) != 3 {
+		t.Errorf("without a CTOC, read %q, want every chapter", titles)
+	}
+
+	// The top-level table of contents limits and orders them, and nested
+	// ones are ignored.
+	raw["CTOC"] = ctocFrame("toc", true, "ch2", "missing", "ch1")
+	raw["CTOC_0"] = ctocFrame("part", false, "ch3")
+	want := []Chapter{{Title: "Two", Start: time.Minute}, {Title: "One"}}
+	if got := readID3Chapters(raw, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("with a CTOC, read %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeID3Text(t *testing.T) {
+	utf16 := func(enc byte, order binary.AppendByteOrder, bom bool, s string) []byte {
+		b := []byte{enc}
+		if bom {
+			b = order.AppendUint16(b, 0xFEFF)
+		}
+		for _, r := range s {
+			b = order.AppendUint16(b, uint16(r))
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"latin-1", []byte("\x00Caf\xe9"), "Café"},
+		{"utf-16 little-endian with BOM", utf16(1, binary.LittleEndian, true, "Café"), "Café"},
+		{"utf-16 big-endian with BOM", utf16(1, binary.BigEndian, true, "Café"), "Café"},
+		{"utf-16 without BOM", utf16(1, binary.BigEndian, false, "Café"), "Café"},
+		{"utf-16BE", utf16(2, binary.BigEndian, false, "Café"), "Café"},
+		{"utf-16 odd length", append(utf16(1, binary.LittleEndian, true, "Hi"), 'x'), "Hi"},
+		{"utf-8", []byte("\x03Café"), "Café"},
+		{"terminated", []byte("\x03One\x00Two"), "One"},
+		{"padded", []byte("\x00 Intro \x00"), "Intro"},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := decodeID3Text(tt.b); got != tt.want {
+			t.Errorf("%s: decodeID3Text = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadVorbisChapters(t *testing.T) {
+	raw := map[string]interface{}{
+		"chapter001":     "00:00:00.000",
+		"chapter001name": "Intro",
+		"chapter002":     "01:02:03.5",
+		"chapter003":     "bogus",
+		"chapterx":       "00:01:00.000",
+		"title":          "Book",
+	}
+	got := readVorbisChapters(raw)
+	want := map[time.Duration]string{0: "Intro", time.Hour + 2*time.Minute + 3500*time.Millisecond: ""}
+	if len(got) != len(want) {
+		t.Fatalf("read %+v, want %d chapters", got, len(want))
+	}
+	for _, c := range got {
+		if title, ok := want[c.Start]; !ok || c.Title != title {
+			t.Errorf("read chapter %+v, want one of %v", c, want)
+		}
+	}
+
+	for _, s := range []string{"1:00", "00:60:00", "00:00:60", "-1:00:00", "a:b:c"} {
+		if d, ok := parseChapterTime(s); ok {
+			t.Errorf("parseChapterTime(%q) = %v, want it rejected", s, d)
+		}
+	}
+}
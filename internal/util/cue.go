@@ -0,0 +1,437 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gopxl/beep"
+)
+
+// cueFramesPerSecond is the resolution of CUE sheet timestamps, which count
+// CD frames.
+const cueFramesPerSecond = 75
+
+// CueSheet is a parsed CUE sheet, which describes how the tracks of an album
+// lie within one or more audio files.
+type CueSheet struct {
+	Performer  string
+	Title      string
+	Songwriter string
+	Genre      string
+	Year       int
+	ReplayGain ReplayGain // Album gain, from REM REPLAYGAIN_ALBUM_* comments
+	Files      []CueFile
+}
+
+// CueFile is an audio file named by a CUE sheet, with the tracks it holds.
+type CueFile struct {
+	Path   string // Resolved against the directory of the sheet
+	Tracks []CueTrack
+}
+
+// CueTrack is a track of a CUE sheet.
+type CueTrack struct {
+	Number     int
+	Title      string
+	Performer  string
+	Songwriter string
+	Start      time.Duration // INDEX 01, where the track's audio starts in its file
+	ReplayGain ReplayGain    // Track gain, from REM REPLAYGAIN_TRACK_* comments
+}
+
+// isCueSheet reports whether name has the extension of a CUE sheet.
+func isCueSheet(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".cue")
+}
+
+// ReadCueSheet reads and parses the CUE sheet at path.
+func ReadCueSheet(path string) (*CueSheet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := ParseCueSheet(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sheet, nil
+}
+
+// ParseCueSheet parses a CUE sheet, resolving the files it names against dir.
+// Sheets are read as UTF-8, or as Latin-1 if they aren't valid UTF-8, as
+// older rippers wrote them. Commands that don't describe the tracks or their
+// metadata, such as FLAGS or ISRC, are ignored.
+func ParseCueSheet(data []byte, dir string) (*CueSheet, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := string(data)
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	sheet := &CueSheet{}
+	var file *CueFile
+	var track *CueTrack
+	hasStart := false
+	endTrack := func(line int) error {
+		if track != nil && !hasStart {
+			return fmt.Errorf("line %d: track %d has no INDEX 01", line, track.Number)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := cueFields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := strings.ToUpper(fields[0]), fields[1:]
+		arg := func(i int) string {
+			if i < len(args) {
+				return args[i]
+			}
+			return ""
+		}
+
+		switch cmd {
+		case "FILE":
+			if err := endTrack(line); err != nil {
+				return nil, err
+			}
+			if arg(0) == "" {
+				return nil, fmt.Errorf("line %d: FILE without a name", line)
+			}
+			path := filepath.FromSlash(strings.ReplaceAll(arg(0), `\`, "/"))
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			sheet.Files = append(sheet.Files, CueFile{Path: path})
+			file, track = &sheet.Files[len(sheet.Files)-1], nil
+		case "TRACK":
+			if err := endTrack(line); err != nil {
+				return nil, err
+			}
+			if file == nil {
+				return nil, fmt.Errorf("line %d: TRACK before any FILE", line)
+			}
+			n, err := strconv.Atoi(arg(0))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("line %d: invalid track number %q", line, arg(0))
+			}
+			file.Tracks = append(file.Tracks, CueTrack{Number: n})
+			track, hasStart = &file.Tracks[len(file.Tracks)-1], false
+		case "INDEX":
+			if track == nil {
+				return nil, fmt.Errorf("line %d: INDEX outside a track", line)
+			}
+			at, ok := parseCueTime(arg(1))
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid time %q", line, arg(1))
+			}
+			if n, _ := strconv.Atoi(arg(0)); n == 1 {
+				track.Start, hasStart = at, true
+			}
+		case "TITLE", "PERFORMER", "SONGWRITER":
+			value := strings.TrimSpace(strings.Join(args, " "))
+			switch {
+			case track != nil && cmd == "TITLE":
+				track.Title = value
+			case track != nil && cmd == "PERFORMER":
+				track.Performer = value
+			case track != nil:
+				track.Songwriter = value
+			case cmd == "TITLE":
+				sheet.Title = value
+			case cmd == "PERFORMER":
+				sheet.Performer = value
+			default:
+				sheet.Songwriter = value
+			}
+		case "REM":
+			parseCueComment(sheet, track, strings.ToUpper(arg(0)), strings.Join(args[min(1, len(args)):], " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := endTrack(line); err != nil {
+		return nil, err
+	}
+
+	for _, f := range sheet.Files {
+		for i := 1; i < len(f.Tracks); i++ {
+			if f.Tracks[i].Start <= f.Tracks[i-1].Start {
+				return nil, fmt.Errorf("track %d doesn't start after track %d", f.Tracks[i].Number, f.Tracks[i-1].Number)
+			}
+		}
+	}
+	return sheet, nil
+}
+
+// parseCueComment reads the REM comments that carry metadata: the genre and
+// date of the album, and ReplayGain values of the album or of track.
+func parseCueComment(sheet *CueSheet, track *CueTrack, name, value string) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	rg := &sheet.ReplayGain
+	if track != nil {
+		rg = &track.ReplayGain
+	}
+	switch name {
+	case "GENRE":
+		sheet.Genre = value
+	case "DATE":
+		if len(value) >= 4 {
+			sheet.Year, _ = strconv.Atoi(value[:4])
+		}
+	case "REPLAYGAIN_ALBUM_GAIN":
+		sheet.ReplayGain.AlbumGain, sheet.ReplayGain.HasAlbum = parseGain(value)
+	case "REPLAYGAIN_ALBUM_PEAK":
+		sheet.ReplayGain.AlbumPeak = parsePeak(value)
+	case "REPLAYGAIN_TRACK_GAIN":
+		rg.TrackGain, rg.HasTrack = parseGain(value)
+	case "REPLAYGAIN_TRACK_PEAK":
+		rg.TrackPeak = parsePeak(value)
+	}
+}
+
+// cueFields splits a line of a CUE sheet into fields separated by spaces,
+// where a quoted field may hold spaces of its own.
+func cueFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		var field string
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				field, line = line[1:], ""
+			} else {
+				field, line = line[1:end+1], line[end+2:]
+			}
+		} else if end := strings.IndexAny(line, " \t"); end >= 0 {
+			field, line = line[:end], line[end:]
+		} else {
+			field, line = line, ""
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields
+}
+
+// parseCueTime parses a CUE sheet timestamp, minutes:seconds:frames.
+func parseCueTime(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		n[i] = v
+	}
+	if n[1] >= 60 || n[2] >= cueFramesPerSecond {
+		return 0, false
+	}
+	return time.Duration(n[0])*time.Minute + time.Duration(n[1])*time.Second +
+		time.Duration(n[2])*time.Second/cueFramesPerSecond, true
+}
+
+// Tracks returns the tracks of file, a file of the sheet, as parts of
+// source, the file's metadata. Each is named after the sheet at path and its
+// number, such as "/music/album.cue#03", and inherits what the sheet doesn't
+// say from source. A track ends where the next one starts, and the last one
+// where the file ends.
+func (s *CueSheet) Tracks(path string, file CueFile, source *AudioFile) []*AudioFile {
+	total := 0
+	for _, f := range s.Files {
+		total += len(f.Tracks)
+	}
+
+	tracks := make([]*AudioFile, len(file.Tracks))
+	for i, t := range file.Tracks {
+		part := *source
+		part.Path = fmt.Sprintf("%s#%02d", path, t.Number)
+		part.FileName = filepath.Base(part.Path)
+		part.Source = source.Path
+		part.Start = t.Start
+		part.End = 0
+		part.Duration = max(0, source.Duration-t.Start)
+		if i+1 < len(file.Tracks) {
+			part.End = file.Tracks[i+1].Start
+			part.Duration = part.End - part.Start
+			part.DurationEstimated = false
+		}
+		part.Loudness = nil // Measured for the whole file, not the track.
+		part.Chapters = nil // Those of the whole file, too.
+
+		part.Title = firstNonEmpty(t.Title, fmt.Sprintf("Track %02d", t.Number))
+		part.Artist = firstNonEmpty(t.Performer, s.Performer, source.Artist)
+		part.AlbumArtist = firstNonEmpty(s.Performer, source.AlbumArtist)
+		part.Album = firstNonEmpty(s.Title, source.Album)
+		part.Composer = firstNonEmpty(t.Songwriter, s.Songwriter, source.Composer)
+		part.Genre = firstNonEmpty(s.Genre, source.Genre)
+		if s.Year > 0 {
+			part.Year = s.Year
+		}
+		part.TrackNumber, part.TrackTotal = t.Number, total
+
+		// A file's own ReplayGain tags are for the whole album.
+		rg := s.ReplayGain
+		if !rg.HasAlbum {
+			rg = source.ReplayGain
+			if rg.HasTrack && !rg.HasAlbum {
+				rg.AlbumGain, rg.AlbumPeak, rg.HasAlbum = rg.TrackGain, rg.TrackPeak, true
+			}
+		}
+		rg.TrackGain, rg.TrackPeak, rg.HasTrack = t.ReplayGain.TrackGain, t.ReplayGain.TrackPeak, t.ReplayGain.HasTrack
+		part.ReplayGain = rg
+
+		tracks[i] = &part
+	}
+	return tracks
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// splitCueSheets replaces each file of files that a CUE sheet of cuePaths
+// splits into tracks with those tracks, in the sheet's order. A sheet naming
+// a file the library doesn't have is matched with a file of the same name
+// but another extension, as sheets often still name the WAV file an album
+// was ripped to before it was compressed. Measurements cached for the
+// tracks are reused. It returns the tracks along with the paths of the
+// split ones, to be kept in the cache.
+func splitCueSheets(files []*AudioFile, cuePaths []string, cache *MetadataCache) ([]*AudioFile, []string) {
+	if len(cuePaths) == 0 {
+		return files, nil
+	}
+	index := make(map[string]int, len(files))
+	stems := make(map[string]int, len(files))
+	for i, f := range files {
+		index[f.Path] = i
+		stems[strings.TrimSuffix(f.Path, filepath.Ext(f.Path))] = i
+	}
+
+	parts := make(map[int][]*AudioFile)
+	var partPaths []string
+	for _, cuePath := range cuePaths {
+		sheet, err := ReadCueSheet(cuePath)
+		if err != nil {
+			log.Printf("Skipping CUE sheet: %v", err)
+			continue
+		}
+		for _, f := range sheet.Files {
+			i, ok := index[f.Path]
+			if !ok {
+				i, ok = stems[strings.TrimSuffix(f.Path, filepath.Ext(f.Path))]
+			}
+			if !ok {
+				log.Printf("Skipping %s: %s is not in the library", cuePath, f.Path)
+				continue
+			}
+			if _, split := parts[i]; split {
+				log.Printf("Skipping %s: %s is split by another CUE sheet", cuePath, files[i].Path)
+				continue
+			}
+			tracks := sheet.Tracks(cuePath, f, files[i])
+			info, err := os.Stat(files[i].Path)
+			for _, t := range tracks {
+				if err == nil {
+					reuseMeasurements(t, cache, info)
+				}
+				partPaths = append(partPaths, t.Path)
+			}
+			parts[i] = tracks
+		}
+	}
+
+	split := make([]*AudioFile, 0, len(files))
+	for i, f := range files {
+		if tracks, ok := parts[i]; ok {
+			split = append(split, tracks...)
+		} else {
+			split = append(split, f)
+		}
+	}
+	return split, partPaths
+}
+
+// reuseMeasurements copies the measurements cached for track, a part of a
+// file described by info, if they were taken of the same part.
+func reuseMeasurements(track *AudioFile, cache *MetadataCache, info os.FileInfo) {
+	cached, ok := cache.Lookup(track.Path, info)
+	if !ok || cached.Start != track.Start || cached.End != track.End {
+		return
+	}
+	track.Loudness = cached.Loudness
+	if track.DurationEstimated && !cached.DurationEstimated {
+		track.Duration, track.DurationEstimated = cached.Duration, false
+	}
+}
+
+// section is the part of a stream from start up to end, in samples, streamed
+// and seeked as a stream of its own.
+type section struct {
+	beep.StreamSeekCloser
+	start, end int
+	pos        int // Position within the section
+}
+
+// newSection returns the part of s from start to end, in samples; an end of
+// 0 runs to the end of s. It seeks s to start.
+func newSection(s beep.StreamSeekCloser, start, end int) (*section, error) {
+	if end <= 0 || end > s.Len() {
+		end = s.Len()
+	}
+	start = min(max(0, start), end)
+	if err := s.Seek(start); err != nil {
+		return nil, err
+	}
+	return &section{StreamSeekCloser: s, start: start, end: end}, nil
+}
+
+func (s *section) Stream(samples [][2]float64) (int, bool) {
+	left := s.end - s.start - s.pos
+	if left <= 0 {
+		return 0, false
+	}
+	n, ok := s.StreamSeekCloser.Stream(samples[:min(len(samples), left)])
+	s.pos += n
+	return n, ok
+}
+
+func (s *section) Len() int      { return s.end - s.start }
+func (s *section) Position() int { return s.pos }
+
+func (s *section) Seek(p int) error {
+	p = min(max(0, p), s.Len())
+	if err := s.StreamSeekCloser.Seek(s.start + p); err != nil {
+		return err
+	}
+	s.pos = p
+	return nil
+}
@@ -0,0 +1,311 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCueSheet(t *testing.T) {
+	dir := filepath.FromSlash("/music/album")
+	tests := []struct {
+		name    string
+		data    string
+		want    *CueSheet
+		wantErr bool
+	}{
+		{
+			name: "quoted fields",
+			data: `REM GENRE "Progressive Rock"
+REM DATE 1973/03/01
+PERFORMER "The Band"
+TITLE "An Album"
+FILE "Disc One.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "Side A, Part One"
+    PERFORMER Somebody Else
+    INDEX 00 00:00:00
+    INDEX 01 00:00:32
+  TRACK 02 AUDIO
+    TITLE "Part Two"
+    REM REPLAYGAIN_TRACK_GAIN -6.48 dB
+    INDEX 01 04:10:74
+`,
+			want: &CueSheet{
+				Performer: "The Band", Title: "An Album", Genre: "Progressive Rock", Year: 1973,
+				Files: []CueFile{{Path: filepath.Join(dir, "Disc One.flac"), Tracks: []CueTrack{
+					{Number: 1, Title: "Side A, Part One", Performer: "Somebody Else", Start: 32 * time.Second / 75},
+					{Number: 2, Title: "Part Two", Start: 4*time.Minute + 10*time.Second + 74*time.Second/75,
+						ReplayGain: ReplayGain{TrackGain: -6.48, HasTrack: true}},
+				}}},
+			},
+		},
+		{
+			name: "latin-1",
+			data: "TITLE \"Caf\xe9\"\r\nFILE \"caf\xe9.wav\" WAVE\r\nTRACK 1 AUDIO\r\nINDEX 01 00:00:00\r\n",
+			want: &CueSheet{Title: "Café", Files: []CueFile{{Path: filepath.Join(dir, "café.wav"), Tracks: []CueTrack{{Number: 1}}}}},
+		},
+		{
+			name: "byte order mark",
+			data: "\xef\xbb\xbfTITLE \"Café\"\nFILE sub\\a.flac WAVE\nTRACK 1 AUDIO\nINDEX 01 00:00:00\n",
+			want: &CueSheet{Title: "Café", Files: []CueFile{{Path: filepath.Join(dir, "sub", "a.flac"), Tracks: []CueTrack{{Number: 1}}}}},
+		},
+		{
+			name: "several files",
+			data: `FILE "a.flac" WAVE
+TRACK 01 AUDIO
+INDEX 01 00:00:00
+TRACK 02 AUDIO
+INDEX 01 01:00:00
+FILE "b.flac" WAVE
+TRACK 03 AUDIO
+INDEX 01 00:00:00
+`,
+			want: &CueSheet{Files: []CueFile{
+				{Path: filepath.Join(dir, "a.flac"), Tracks: []CueTrack{{Number: 1}, {Number: 2, Start: time.Minute}}},
+				{Path: filepath.Join(dir, "b.flac"), Tracks: []CueTrack{{Number: 3}}},
+			}},
+		},
+		{
+			name: "missing INDEX 01",
+			data: `FILE "a.flac" WAVE
+TRACK 01 AUDIO
+INDEX 00 00:00:00
+TRACK 02 AUDIO
+INDEX 01 01:00:00
+`,
+			wantErr: true,
+		},
+		{
+			name: "last track missing INDEX 01",
+			data: `FILE "a.flac" WAVE
+TRACK 01 AUDIO
+INDEX 01 00:00:00
+TRACK 02 AUDIO
+`,
+			wantErr: true,
+		},
+		{
+			name: "starts not increasing",
+			data: `FILE "a.flac" WAVE
+TRACK 01 AUDIO
+INDEX 01 01:00:00
+TRACK 02 AUDIO
+INDEX 01 01:00:00
+`,
+			wantErr: true,
+		},
+		{
+			name:    "track before any file",
+			data:    "TRACK 01 AUDIO\nINDEX 01 00:00:00\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			data:    "FILE a.flac WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:75\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseCueSheet([]byte(tt.data), dir)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ParseCueSheet succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseCueSheet: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseCueSheet =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCueSheetTracks(t *testing.T) {
+	sheet := &CueSheet{
+		Performer: "The Band", Title: "An Album", Year: 1999,
+		ReplayGain: ReplayGain{AlbumGain: -4, AlbumPeak: 0.9, HasAlbum: true},
+		Files: []CueFile{
+			{Path: "/music/a.flac", Tracks: []CueTrack{
+				{Number: 1, Title: "One", Start: 0},
+				{Number: 2, Performer: "Guest", Start: 3 * time.Minute,
+					ReplayGain: ReplayGain{TrackGain: -2, TrackPeak: 0.5, HasTrack: true}},
+			}},
+			{Path: "/music/b.flac", Tracks: []CueTrack{{Number: 3, Title: "Three"}}},
+		},
+	}
+	source := &AudioFile{
+		Path: "/music/a.flac", Title: "Whole album", Artist: "Someone", Genre: "Jazz",
+		Duration: 10 * time.Minute, DurationEstimated: true,
+		Loudness: &Loudness{Integrated: -14}, Chapters: []Chapter{{Title: "Chapter"}},
+	}
+
+	tracks := sheet.Tracks("/music/album.cue", sheet.Files[0], source)
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	first, last := tracks[0], tracks[1]
+	if first.Path != "/music/album.cue#01" || first.Source != "/music/a.flac" || !first.IsPart() {
+		t.Errorf("first track is %s of %s, want /music/album.cue#01 of /music/a.flac", first.Path, first.Source)
+	}
+	if first.Start != 0 || first.End != 3*time.Minute || first.Duration != 3*time.Minute || first.DurationEstimated {
+		t.Errorf("first track runs %v-%v for %v (estimated %v), want 0s-3m0s for 3m0s",
+			first.Start, first.End, first.Duration, first.DurationEstimated)
+	}
+	// The last track runs to the end of the file, as long as the file is.
+	if last.Start != 3*time.Minute || last.End != 0 || last.Duration != 7*time.Minute || !last.DurationEstimated {
+		t.Errorf("last track runs %v-%v for %v (estimated %v), want from 3m0s to the end for 7m0s, estimated",
+			last.Start, last.End, last.Duration, last.DurationEstimated)
+	}
+
+	if first.Title != "One" || first.Artist != "The Band" || first.AlbumArtist != "The Band" ||
+		first.Album != "An Album" || first.Genre != "Jazz" || first.Year != 1999 {
+		t.Errorf("first track tagged %q by %q (%q) on %q, %q, %d", first.Title, first.Artist,
+			first.AlbumArtist, first.Album, first.Genre, first.Year)
+	}
+	if last.Title != "Track 02" || last.Artist != "Guest" {
+		t.Errorf("last track tagged %q by %q, want Track 02 by Guest", last.Title, last.Artist)
+	}
+	if first.TrackNumber != 1 || first.TrackTotal != 3 {
+		t.Errorf("first track numbered %d of %d, want 1 of 3", first.TrackNumber, first.TrackTotal)
+	}
+	if first.Loudness != nil || first.Chapters != nil {
+		t.Error("tracks keep the loudness and chapters of the whole file")
+	}
+
+	want := ReplayGain{AlbumGain: -4, AlbumPeak: 0.9, HasAlbum: true, TrackGain: -2, TrackPeak: 0.5, HasTrack: true}
+	if last.ReplayGain != want {
+		t.Errorf("last track gain = %+v, want %+v", last.ReplayGain, want)
+	}
+	// Without album gain on the sheet, the file's own gain is the album's.
+	sheet.ReplayGain = ReplayGain{}
+	source.ReplayGain = ReplayGain{TrackGain: -5, TrackPeak: 0.7, HasTrack: true}
+	want = ReplayGain{AlbumGain: -5, AlbumPeak: 0.7, HasAlbum: true}
+	if got := sheet.Tracks("/music/album.cue", sheet.Files[0], source)[0].ReplayGain; got != want {
+		t.Errorf("first track gain = %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitCueSheets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// The sheet still names the WAV file the album was ripped to.
+	album := write("album.flac", "audio")
+	other := write("other.mp3", "audio")
+	cuePath := write("album.cue", "FILE \"album.wav\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n"+
+		"TRACK 02 AUDIO\nINDEX 01 02:00:00\n")
+	broken := write("broken.cue", "FILE \"other.mp3\" WAVE\nTRACK 01 AUDIO\n")
+	missing := write("missing.cue", "FILE \"gone.flac\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n")
+
+	// Measurements cached for a track are reused, if taken of the same part.
+	cache := NewMetadataCache("")
+	info, err := os.Stat(album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Store(cuePath+"#02", info, &AudioFile{Start: 2 * time.Minute, Duration: 3 * time.Minute,
+		Loudness: &Loudness{Integrated: -9}})
+	cache.Store(cuePath+"#01", info, &AudioFile{Start: time.Minute, Loudness: &Loudness{Integrated: -20}})
+
+	files := []*AudioFile{
+		{Path: album, Duration: 6 * time.Minute, DurationEstimated: true},
+		{Path: other},
+	}
+	split, partPaths := splitCueSheets(files, []string{cuePath, broken, missing}, cache)
+
+	var paths []string
+	for _, f := range split {
+		paths = append(paths, f.Path)
+	}
+	want := []string{cuePath + "#01", cuePath + "#02", other}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("split into %v, want %v", paths, want)
+	}
+	if !reflect.DeepEqual(partPaths, want[:2]) {
+		t.Errorf("part paths = %v, want %v", partPaths, want[:2])
+	}
+	if split[0].Source != album {
+		t.Errorf("first track is part of %s, want %s", split[0].Source, album)
+	}
+	if split[0].Loudness != nil {
+		t.Errorf("first track took the loudness measured of another part")
+	}
+	if l := split[1].Loudness; l == nil || l.Integrated != -9 || split[1].Duration != 3*time.Minute || split[1].DurationEstimated {
+		t.Errorf("second track measured %v for %v, want the cached measurements", l, split[1].Duration)
+	}
+}
+
+// rampStreamer streams n samples, each holding its own position.
+type rampStreamer struct {
+	n, pos int
+}
+
+func (s *rampStreamer) Stream(samples [][2]float64) (int, bool) {
+	if s.pos >= s.n {
+		return 0, false
+	}
+	n := min(len(samples), s.n-s.pos)
+	for i := range n {
+		samples[i] = [2]float64{float64(s.pos + i), float64(s.pos + i)}
+	}
+	s.pos += n
+	return n, true
+}
+
+func (s *rampStreamer) Err() error       { return nil }
+func (s *rampStreamer) Len() int         { return s.n }
+func (s *rampStreamer) Position() int    { return s.pos }
+func (s *rampStreamer) Seek(p int) error { s.pos = p; return nil }
+func (s *rampStreamer) Close() error     { return nil }
+
+func TestSection(t *testing.T) {
+	s, err := newSection(&rampStreamer{n: 100}, 20, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 30 || s.Position() != 0 {
+		t.Fatalf("section of %d samples at %d, want 30 at 0", s.Len(), s.Position())
+	}
+
+	buf := make([][2]float64, 64)
+	n, ok := s.Stream(buf)
+	if n != 30 || !ok || buf[0][0] != 20 || buf[29][0] != 49 {
+		t.Errorf("streamed %d samples from %v to %v, want 30 from 20 to 49", n, buf[0][0], buf[max(0, n-1)][0])
+	}
+	if n, ok := s.Stream(buf); n != 0 || ok {
+		t.Errorf("streamed %d more samples past the end", n)
+	}
+
+	// Positions are within the section, and clamped to it.
+	if err := s.Seek(10); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Stream(buf[:5]); n != 5 || buf[0][0] != 30 || s.Position() != 15 {
+		t.Errorf("after seeking to 10, streamed from %v to position %d, want from 30 to 15", buf[0][0], s.Position())
+	}
+	_ = s.Seek(-5)
+	if s.Position() != 0 {
+		t.Errorf("seeking before the start moved to %d, want 0", s.Position())
+	}
+	_ = s.Seek(1000)
+	if s.Position() != 30 {
+		t.Errorf("seeking past the end moved to %d, want 30", s.Position())
+	}
+
+	// An end of 0 runs to the end of the stream.
+	s, _ = newSection(&rampStreamer{n: 100}, 90, 0)
+	if n, _ := s.Stream(buf); n != 10 || buf[0][0] != 90 {
+		t.Errorf("streamed %d samples from %v, want 10 from 90", n, buf[0][0])
+	}
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/flac"
+	"github.com/gopxl/beep/mp3"
+	"github.com/gopxl/beep/vorbis"
+	"github.com/gopxl/beep/wav"
+)
+
+// ErrInvalidFormat is returned when a file is not in a supported audio format,
+// or when its contents cannot be decoded.
+var ErrInvalidFormat = errors.New("invalid audio format")
+
+// sniffLen is the number of leading bytes read from a file to detect its format.
+const sniffLen = 12
+
+// DecodeFunc decodes an opened audio file into a streamer. The decoder takes
+// ownership of the file and closes it when the returned streamer is closed.
+type DecodeFunc func(f *os.File) (beep.StreamSeekCloser, beep.Format, error)
+
+// Decoder describes a single supported audio format.
+type Decoder struct {
+	Name       string                   // Human-readable format name, e.g. "FLAC"
+	Extensions []string                 // Lower-case file extensions, including the dot
+	Match      func(header []byte) bool // Reports whether the leading bytes belong to this format
+	Decode     DecodeFunc
+	// Probe optionally reads the stream's duration and format from the file's
+	// headers. Formats without one are decoded by ReadAudioMetadata instead.
+	Probe func(f *os.File, size int64) (StreamInfo, error)
+}
+
+// StreamInfo describes an audio stream as read from a file's headers.
+type StreamInfo struct {
+	Duration   time.Duration
+	SampleRate int
+	Bitrate    int  // Average bitrate in kbit/s; 0 to derive it from the file size
+	Estimated  bool // Whether Duration is an estimate that a full decode may refine
+}
+
+// decoders is the registry of supported formats, in detection order.
+var decoders = []Decoder{
+	{
+		Name:       "FLAC",
+		Extensions: []string{".flac"},
+		Match: func(h []byte) bool {
+			return bytes.HasPrefix(h, []byte("fLaC"))
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return flac.Decode(f)
+		},
+	},
+	{
+		Name:       "WAV",
+		Extensions: []string{".wav", ".wave"},
+		Match: func(h []byte) bool {
+			return len(h) >= 12 && string(h[0:4]) == "RIFF" && string(h[8:12]) == "WAVE"
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return wav.Decode(skipID3v2(f))
+		},
+	},
+	{
+		Name:       "Ogg Vorbis",
+		Extensions: []string{".ogg", ".oga"},
+		Match: func(h []byte) bool {
+			return bytes.HasPrefix(h, []byte("OggS"))
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return vorbis.Decode(f)
+		},
+	},
+	{
+		Name:       "MP3",
+		Extensions: []string{".mp3"},
+		Match: func(h []byte) bool {
+			// Either an ID3v2 tag or a raw MPEG audio frame sync.
+			return bytes.HasPrefix(h, []byte("ID3")) ||
+				(len(h) >= 2 && h[0] == 0xFF && h[1]&0xE0 == 0xE0)
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return mp3.Decode(f)
+		},
+		Probe: readMP3Info,
+	},
+}
+
+// RegisterDecoder adds a decoder to the registry. Decoders registered later take
+// precedence over the built-in ones for the same extension or header.
+func RegisterDecoder(d Decoder) {
+	decoders = append([]Decoder{d}, decoders...)
+}
+
+// decoderForExtension returns the decoder registered for the file's extension, if any.
+func decoderForExtension(name string) (Decoder, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, d := range decoders {
+		for _, e := range d.Extensions {
+			if e == ext {
+				return d, true
+			}
+		}
+	}
+	return Decoder{}, false
+}
+
+// decoderForHeader returns the decoder whose magic bytes match the header, if any.
+func decoderForHeader(header []byte) (Decoder, bool) {
+	for _, d := range decoders {
+		if d.Match != nil && d.Match(header) {
+			return d, true
+		}
+	}
+	return Decoder{}, false
+}
+
+// readHeader reads up to sniffLen bytes of f from off.
+func readHeader(f *os.File, off int64) ([]byte, error) {
+	header := make([]byte, sniffLen)
+	n, err := f.ReadAt(header, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// skipID3v2 returns f past the ID3v2 tag it starts with, if any, for decoders
+// that expect their own header first. Positions are then counted from the end
+// of the tag. The FLAC and MP3 decoders skip such tags themselves.
+func skipID3v2(f *os.File) io.ReadSeekCloser {
+	header, err := readHeader(f, 0)
+	size := id3v2Size(header)
+	if err != nil || size == 0 {
+		return f
+	}
+	return struct {
+		*io.SectionReader
+		io.Closer
+	}{io.NewSectionReader(f, int64(size), math.MaxInt64-int64(size)), f}
+}
+
+// detectDecoder picks the decoder for an opened file from its leading bytes,
+// falling back to its extension. Some taggers prepend ID3v2 tags to FLAC and
+// WAV files too, so a file starting with one is told by the bytes after it,
+// or else by its extension, before it is taken for MP3. The file is left
+// positioned at the start.
+func detectDecoder(f *os.File) (Decoder, error) {
+	header, err := readHeader(f, 0)
+	if err != nil {
+		return Decoder{}, fmt.Errorf("%w: %s: %v", ErrInvalidFormat, f.Name(), err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Decoder{}, err
+	}
+
+	if size := id3v2Size(header); size > 0 {
+		if after, err := readHeader(f, int64(size)); err == nil {
+			if d, ok := decoderForHeader(after); ok {
+				return d, nil
+			}
+		}
+		if d, ok := decoderForExtension(f.Name()); ok {
+			return d, nil
+		}
+	}
+	d, ok := decoderForHeader(header)
+	if !ok {
+		d, ok = decoderForExtension(f.Name())
+	}
+	if !ok {
+		return Decoder{}, fmt.Errorf("%w: %s: unsupported file type", ErrInvalidFormat, f.Name())
+	}
+	return d, nil
+}
+
+// DecodeFile decodes an already opened file. The format is detected from the
+// leading bytes first, falling back to the extension. On failure the file is
+// closed and the returned error wraps ErrInvalidFormat.
+func DecodeFile(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+	d, err := detectDecoder(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, beep.Format{}, err
+	}
+
+	streamer, format, err := d.Decode(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, beep.Format{}, fmt.Errorf("%w: %s: %v", ErrInvalidFormat, f.Name(), err)
+	}
+	if format.SampleRate <= 0 {
+		_ = streamer.Close()
+		return nil, beep.Format{}, fmt.Errorf("%w: %s: invalid sample rate", ErrInvalidFormat, f.Name())
+	}
+	return streamer, format, nil
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectDecoder(t *testing.T) {
+	// An ID3v2.4 tag of 20 bytes, 10 of header and 10 of padding.
+	tag := "ID3\x04\x00\x00\x00\x00\x00\x0a" + string(make([]byte, 10))
+	// The same with a footer, whose 10 bytes aren't counted in the size.
+	footed := "ID3\x04\x00\x10\x00\x00\x00\x0a" + string(make([]byte, 10)) + "3DI\x04\x00\x10\x00\x00\x00\x0a"
+	mp3Frame := "\xff\xfb\x90\x64\x00\x00\x00\x00\x00\x00\x00\x00"
+	tests := []struct {
+		name, data, want string
+	}{
+		{"song.flac", "fLaC\x00\x00\x00\x22", "FLAC"},
+		{"tagged.flac", tag + "fLaC\x00\x00\x00\x22", "FLAC"},
+		{"footed.flac", footed + "fLaC\x00\x00\x00\x22", "FLAC"},
+		{"tagged.wav", tag + "RIFF\x24\x00\x00\x00WAVE", "WAV"},
+		{"misnamed.mp3", tag + "fLaC\x00\x00\x00\x22", "FLAC"},
+		{"tagged.mp3", tag + mp3Frame, "MP3"},
+		{"padded.mp3", tag + "\x00\x00" + mp3Frame, "MP3"},
+		// Nothing known follows the tag: the extension decides.
+		{"odd.flac", tag + "junkjunkjunk", "FLAC"},
+		{"noext", tag + "junkjunkjunk", "MP3"},
+		{"short", "ID3", "MP3"},
+		{"plain.ogg", "junk", "Ogg Vorbis"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := detectDecoder(f)
+		f.Close()
+		if err != nil || d.Name != tt.want {
+			t.Errorf("%s: detected %q, %v; want %q", tt.name, d.Name, err, tt.want)
+		}
+	}
+
+	path := filepath.Join(dir, "unknown.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if d, err := detectDecoder(f); err == nil {
+		t.Errorf("unknown.txt: detected %q, want an error", d.Name)
+	}
+}
+
+// wavData returns a 16-bit stereo WAV file at 44100 Hz whose n-th sample is
+// n on both channels.
+func wavData(frames int) []byte {
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(36+frames*4))
+	data = append(data, "WAVEfmt "...)
+	data = binary.LittleEndian.AppendUint32(data, 16)
+	data = binary.LittleEndian.AppendUint16(data, 1) // PCM
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, 44100)
+	data = binary.LittleEndian.AppendUint32(data, 44100*4)
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = binary.LittleEndian.AppendUint16(data, 16)
+	data = append(data, "data"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(frames*4))
+	for i := range frames {
+		data = binary.LittleEndian.AppendUint16(data, uint16(i))
+		data = binary.LittleEndian.AppendUint16(data, uint16(i))
+	}
+	return data
+}
+
+func TestDecodeFileSkipsID3v2(t *testing.T) {
+	// A 16-bit stereo WAV file whose n-th sample is n on both channels, after
+	// an ID3v2 tag.
+	const frames = 100
+	data := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00"), wavData(frames)...)
+	path := filepath.Join(t.TempDir(), "tagged.wav")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamer, _, err := DecodeFile(f)
+	if err != nil {
+		t.Fatalf("DecodeFile: %v", err)
+	}
+	defer streamer.Close()
+	if streamer.Len() != frames {
+		t.Errorf("length = %d, want %d", streamer.Len(), frames)
+	}
+	// Samples are read relative to the first one, whatever the scale.
+	sample := func(pos int) float64 {
+		if err := streamer.Seek(pos); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([][2]float64, 1)
+		if n, _ := streamer.Stream(buf); n != 1 {
+			t.Fatalf("nothing streamed at %d", pos)
+		}
+		return buf[0][0]
+	}
+	if unit, got := sample(1), sample(50); unit <= 0 || math.Abs(got/unit-50) > 1e-9 {
+		t.Errorf("after seeking to 50, streamed sample %v, want 50", got/unit)
+	}
+}
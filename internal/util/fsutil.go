@@ -0,0 +1,92 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never observe a partially written file even if the
+// process crashes mid-write. Missing parent directories are created.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file on any failure; after a successful rename
+	// this is a harmless no-op.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CacheDir returns muxic's cache directory, honouring $XDG_CACHE_HOME.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "muxic"), nil
+}
+
+// DataDir returns muxic's data directory for user data such as playlists:
+// $XDG_DATA_HOME/muxic, defaulting to ~/.local/share/muxic.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		if !filepath.IsAbs(dir) {
+			return "", errors.New("$XDG_DATA_HOME is not an absolute path")
+		}
+		return filepath.Join(dir, "muxic"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "muxic"), nil
+}
+
+// StateDir returns muxic's directory for state that should survive restarts
+// but isn't worth backing up, such as the last session:
+// $XDG_STATE_HOME/muxic, defaulting to ~/.local/state/muxic.
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		if !filepath.IsAbs(dir) {
+			return "", errors.New("$XDG_STATE_HOME is not an absolute path")
+		}
+		return filepath.Join(dir, "muxic"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "muxic"), nil
+}
+
+// ConfigDir returns muxic's config directory, honouring $XDG_CONFIG_HOME.
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "muxic"), nil
+}
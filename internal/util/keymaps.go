@@ -7,11 +7,15 @@ import (
 // KeyMap defines all key bindings for the application.
 type KeyMap struct {
 	// Navigation
-	Up    key.Binding
-	Down  key.Binding
-	Left  key.Binding
-	Right key.Binding
-	Back  key.Binding
+	Up           key.Binding
+	Down         key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	HalfPageUp   key.Binding
+	HalfPageDown key.Binding
+	GotoTop      key.Binding
+	GotoBottom   key.Binding
+	Back         key.Binding
 
 	// Playback controls
 	Play          key.Binding
@@ -21,12 +25,25 @@ type KeyMap struct {
 	SkipForward   key.Binding
 	NextTrack     key.Binding
 	PreviousTrack key.Binding
+	ToggleRepeat  key.Binding
+	ToggleShuffle key.Binding
+
+	// Seeking and looping
+	SkipBackwardLong key.Binding
+	SkipForwardLong  key.Binding
+	SeekTo           key.Binding
+	ABLoop           key.Binding
 
 	// Volume
 	VolumeUp   key.Binding
 	VolumeDown key.Binding
 	VolumeMute key.Binding
 
+	// Speed
+	SpeedUp    key.Binding
+	SpeedDown  key.Binding
+	SpeedReset key.Binding
+
 	// Application
 	Quit key.Binding
 
@@ -39,6 +56,8 @@ type KeyMap struct {
 	AddToPlaylist      key.Binding
 	RemoveFromPlaylist key.Binding
 	ShufflePlaylist    key.Binding
+	SortByAlbum        key.Binding
+	ExportPlaylist     key.Binding
 
 	// Queue controls
 	AddToQueue      key.Binding
@@ -47,8 +66,30 @@ type KeyMap struct {
 	PlayNext        key.Binding
 	PlayPrevious    key.Binding
 	ClearQueue      key.Binding
+
+	// Equalizer controls
+	ViewEqualizer key.Binding
+	EQBoost       key.Binding
+	EQCut         key.Binding
+	EQReset       key.Binding
+	EQNextPreset  key.Binding
+	EQToggle      key.Binding
+
+	// Bookmarks
+	AddBookmark      key.Binding
+	NextBookmark     key.Binding
+	PreviousBookmark key.Binding
+	ViewBookmarks    key.Binding
+	RemoveBookmark   key.Binding
+
+	// Chapters
+	NextChapter     key.Binding
+	PreviousChapter key.Binding
+	ViewChapters    key.Binding
 }
 
+// DefaultKeyMap holds the built-in bindings. A key may be a sequence of key
+// presses separated by spaces, such as "g g".
 var DefaultKeyMap = KeyMap{
 	// Navigation
 	Up: key.NewBinding(
@@ -59,27 +100,43 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("down", "j"),
 		key.WithHelp("↓/j", "move down"),
 	),
-	Left: key.NewBinding(
-		key.WithKeys("left", "h"),
-		key.WithHelp("←/h", "back"),
+	PageUp: key.NewBinding(
+		key.WithKeys("pgup", "b"),
+		key.WithHelp("pgup/b", "page up"),
 	),
-	Right: key.NewBinding(
-		key.WithKeys("right", "l"),
-		key.WithHelp("→/l", "select"),
+	PageDown: key.NewBinding(
+		key.WithKeys("pgdown", "f"),
+		key.WithHelp("pgdn/f", "page down"),
+	),
+	HalfPageUp: key.NewBinding(
+		key.WithKeys("ctrl+u", "u"),
+		key.WithHelp("ctrl+u/u", "half page up"),
+	),
+	HalfPageDown: key.NewBinding(
+		key.WithKeys("ctrl+d", "d"),
+		key.WithHelp("ctrl+d/d", "half page down"),
+	),
+	GotoTop: key.NewBinding(
+		key.WithKeys("home", "g g"),
+		key.WithHelp("home/g g", "go to top"),
+	),
+	GotoBottom: key.NewBinding(
+		key.WithKeys("end", "G"),
+		key.WithHelp("end/G", "go to bottom"),
 	),
 	Back: key.NewBinding(
-		key.WithKeys("esc", "backspace"),
-		key.WithHelp("esc/⌫", "back"),
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "stop typing"),
 	),
 
 	// Playback controls
 	Play: key.NewBinding(
-		key.WithKeys("space", "enter"),
-		key.WithHelp("space/enter", "play/pause"),
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "play"),
 	),
 	Pause: key.NewBinding(
 		key.WithKeys("space"),
-		key.WithHelp("space", "pause"),
+		key.WithHelp("space", "pause/resume"),
 	),
 	Stop: key.NewBinding(
 		key.WithKeys("x"),
@@ -87,11 +144,27 @@ var DefaultKeyMap = KeyMap{
 	),
 	SkipBackward: key.NewBinding(
 		key.WithKeys("left", "z"),
-		key.WithHelp("←/z", "rewind 5s"),
+		key.WithHelp("←/z", "rewind"),
 	),
 	SkipForward: key.NewBinding(
 		key.WithKeys("right", "c"),
-		key.WithHelp("→/c", "forward 5s"),
+		key.WithHelp("→/c", "fast forward"),
+	),
+	SkipBackwardLong: key.NewBinding(
+		key.WithKeys("ctrl+left", "Z"),
+		key.WithHelp("ctrl+←/Z", "rewind further"),
+	),
+	SkipForwardLong: key.NewBinding(
+		key.WithKeys("ctrl+right", "C"),
+		key.WithHelp("ctrl+→/C", "fast forward further"),
+	),
+	SeekTo: key.NewBinding(
+		key.WithKeys(":"),
+		key.WithHelp(":", "go to time"),
+	),
+	ABLoop: key.NewBinding(
+		key.WithKeys("L"),
+		key.WithHelp("L", "set loop start/end, or clear the loop"),
 	),
 	NextTrack: key.NewBinding(
 		key.WithKeys("n", "shift+right"),
@@ -101,6 +174,14 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("p", "shift+left"),
 		key.WithHelp("p/⇦", "previous track"),
 	),
+	ToggleRepeat: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "cycle repeat mode"),
+	),
+	ToggleShuffle: key.NewBinding(
+		key.WithKeys("S"),
+		key.WithHelp("S", "toggle shuffle"),
+	),
 
 	// Volume controls
 	VolumeUp: key.NewBinding(
@@ -116,6 +197,20 @@ var DefaultKeyMap = KeyMap{
 		key.WithHelp("m", "toggle mute"),
 	),
 
+	// Speed controls
+	SpeedUp: key.NewBinding(
+		key.WithKeys(">"),
+		key.WithHelp(">", "speed up"),
+	),
+	SpeedDown: key.NewBinding(
+		key.WithKeys("<"),
+		key.WithHelp("<", "slow down"),
+	),
+	SpeedReset: key.NewBinding(
+		key.WithKeys("."),
+		key.WithHelp(".", "normal speed"),
+	),
+
 	// Application
 	Quit: key.NewBinding(
 		key.WithKeys("ctrl+c", "q"),
@@ -125,7 +220,7 @@ var DefaultKeyMap = KeyMap{
 	// Search and navigation
 	Search: key.NewBinding(
 		key.WithKeys("/"),
-		key.WithHelp("/", "search"),
+		key.WithHelp("/", "type or browse search results"),
 	),
 	ToggleView: key.NewBinding(
 		key.WithKeys("tab"),
@@ -147,7 +242,15 @@ var DefaultKeyMap = KeyMap{
 	),
 	ShufflePlaylist: key.NewBinding(
 		key.WithKeys("ctrl+s"),
-		key.WithHelp("ctrl+s", "shuffle playlist"),
+		key.WithHelp("ctrl+s", "toggle playlist shuffle"),
+	),
+	SortByAlbum: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "sort by album and track"),
+	),
+	ExportPlaylist: key.NewBinding(
+		key.WithKeys("e"),
+		key.WithHelp("e", "export playlist as M3U8"),
 	),
 
 	// Queue controls
@@ -175,17 +278,85 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("ctrl+shift+d"),
 		key.WithHelp("ctrl+shift+d", "clear queue"),
 	),
+
+	// Equalizer controls
+	ViewEqualizer: key.NewBinding(
+		key.WithKeys("E"),
+		key.WithHelp("E", "view equalizer"),
+	),
+	EQBoost: key.NewBinding(
+		key.WithKeys("l"),
+		key.WithHelp("l", "boost band"),
+	),
+	EQCut: key.NewBinding(
+		key.WithKeys("h"),
+		key.WithHelp("h", "cut band"),
+	),
+	EQReset: key.NewBinding(
+		key.WithKeys("0"),
+		key.WithHelp("0", "reset equalizer"),
+	),
+	EQNextPreset: key.NewBinding(
+		key.WithKeys("ctrl+p"),
+		key.WithHelp("ctrl+p", "next preset"),
+	),
+	EQToggle: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "toggle equalizer"),
+	),
+
+	// Bookmarks
+	AddBookmark: key.NewBinding(
+		key.WithKeys("B"),
+		key.WithHelp("B", "bookmark this position"),
+	),
+	NextBookmark: key.NewBinding(
+		key.WithKeys("}"),
+		key.WithHelp("}", "next bookmark"),
+	),
+	PreviousBookmark: key.NewBinding(
+		key.WithKeys("{"),
+		key.WithHelp("{", "previous bookmark"),
+	),
+	ViewBookmarks: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "view bookmarks"),
+	),
+	RemoveBookmark: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "remove bookmark"),
+	),
+
+	// Chapters
+	NextChapter: key.NewBinding(
+		key.WithKeys(")"),
+		key.WithHelp(")", "next chapter"),
+	),
+	PreviousChapter: key.NewBinding(
+		key.WithKeys("("),
+		key.WithHelp("(", "previous chapter"),
+	),
+	ViewChapters: key.NewBinding(
+		key.WithKeys("T"),
+		key.WithHelp("T", "view chapters"),
+	),
 }
 
 // FullHelp returns a slice of key bindings for the help view
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down, k.Left, k.Right},            // Navigation
+		{k.Up, k.Down, k.GotoTop, k.GotoBottom},    // Navigation
 		{k.Play, k.Pause, k.Stop},                  // Playback
+		{k.SeekTo, k.ABLoop},                       // Seeking
+		{k.ToggleRepeat, k.ToggleShuffle},          // Play order
 		{k.PreviousTrack, k.NextTrack, k.PlayNext}, // Track navigation
 		{k.VolumeDown, k.VolumeUp, k.VolumeMute},   // Volume
+		{k.SpeedDown, k.SpeedUp, k.SpeedReset},     // Speed
 		{k.Search, k.ToggleView, k.ViewQueue},      // UI
 		{k.AddToQueue, k.ClearQueue},               // Queue controls
+		{k.ViewEqualizer, k.EQNextPreset},          // Equalizer
+		{k.AddBookmark, k.ViewBookmarks},           // Bookmarks
+		{k.PreviousChapter, k.NextChapter},         // Chapters
 		{k.Quit},                                   // Application
 	}
 }
@@ -0,0 +1,189 @@
+package util
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	// ReferenceLoudness is the loudness ReplayGain 2.0 normalises tracks to,
+	// in LUFS.
+	ReferenceLoudness = -18.0
+
+	// Gating of EBU R128 integrated loudness.
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the ungated loudness
+	// blockStep is the step between gating blocks, a quarter of their length.
+	blockStep = 100 * time.Millisecond
+)
+
+// Loudness is the loudness of a track measured by MeasureLoudness.
+type Loudness struct {
+	Integrated float64 // EBU R128 integrated loudness in LUFS
+	Peak       float64 // Loudest sample, 1 being full scale
+}
+
+// Gain returns the ReplayGain 2.0 gain, in dB, that brings the track to the
+// reference loudness.
+func (l Loudness) Gain() float64 {
+	return ReferenceLoudness - l.Integrated
+}
+
+// biquad is a second order IIR filter, applied to one channel.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64 // Filter state
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stage K-weighting filter of ITU-R BS.1770 at
+// rate: a high shelf modelling the head, followed by a high-pass filter. The
+// coefficients are derived for any rate, as in libebur128.
+func kWeighting(rate beep.SampleRate) (shelf, highPass biquad) {
+	const (
+		shelfFreq = 1681.974450955533
+		shelfGain = 3.999843853973347 // dB
+		shelfQ    = 0.7071752369554196
+		passFreq  = 38.13547087602444
+		passQ     = 0.5003270373238773
+	)
+	k := math.Tan(math.Pi * shelfFreq / float64(rate))
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * passFreq / float64(rate))
+	a0 = 1 + k/passQ + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/passQ + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// LoudnessMeter measures the EBU R128 integrated loudness of a stereo stream.
+// The stream is split into 100 ms steps, and the loudness is gated over the
+// 400 ms blocks made of four consecutive steps.
+type LoudnessMeter struct {
+	filters [2][2]biquad // K-weighting of each channel
+	stepLen int          // Samples in a step
+	sum     float64      // Sum of squares of the step so far
+	n       int          // Samples in the step so far
+	steps   []float64    // Mean square of each step
+	peak    float64
+}
+
+// NewLoudnessMeter returns a meter for a stream at rate.
+func NewLoudnessMeter(rate beep.SampleRate) *LoudnessMeter {
+	m := &LoudnessMeter{stepLen: rate.N(blockStep)}
+	for c := range m.filters {
+		m.filters[c][0], m.filters[c][1] = kWeighting(rate)
+	}
+	return m
+}
+
+// Write adds samples to the measurement.
+func (m *LoudnessMeter) Write(samples [][2]float64) {
+	for _, s := range samples {
+		for c, v := range s {
+			m.peak = max(m.peak, math.Abs(v))
+			y := m.filters[c][1].process(m.filters[c][0].process(v))
+			m.sum += y * y
+		}
+		m.n++
+		if m.n == m.stepLen {
+			m.steps = append(m.steps, m.sum/float64(m.stepLen))
+			m.sum, m.n = 0, 0
+		}
+	}
+}
+
+// Loudness returns the loudness of the samples written so far. A stream
+// shorter than one block, or with no block above the absolute gate, has no
+// loudness to speak of and isn't measured.
+func (m *LoudnessMeter) Loudness() (Loudness, bool) {
+	var blocks []float64
+	for i := 3; i < len(m.steps); i++ {
+		z := (m.steps[i-3] + m.steps[i-2] + m.steps[i-1] + m.steps[i]) / 4
+		if blockLoudness(z) > absoluteGate {
+			blocks = append(blocks, z)
+		}
+	}
+	if len(blocks) == 0 {
+		return Loudness{}, false
+	}
+	gate := blockLoudness(mean(blocks)) + relativeGate
+	var gated []float64
+	for _, z := range blocks {
+		if blockLoudness(z) > gate {
+			gated = append(gated, z)
+		}
+	}
+	// The loudest block always passes.
+	return Loudness{Integrated: blockLoudness(mean(gated)), Peak: m.peak}, true
+}
+
+// blockLoudness converts the summed mean square of the channels to LUFS.
+func blockLoudness(z float64) float64 {
+	return -0.691 + 10*math.Log10(z)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// MeasureLoudness decodes the audio of file to measure its loudness. It
+// returns nil for a file whose loudness can't be measured; see
+// LoudnessMeter.Loudness.
+func MeasureLoudness(file *AudioFile) (*Loudness, error) {
+	streamer, format, _, err := OpenTrack(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := streamer.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	m := NewLoudnessMeter(format.SampleRate)
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(buf)
+		m.Write(buf[:n])
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return nil, err
+	}
+	l, ok := m.Loudness()
+	if !ok {
+		return nil, nil
+	}
+	return &l, nil
+}
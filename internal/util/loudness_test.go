@@ -0,0 +1,56 @@
+package util
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep"
+)
+
+// sine returns d of a 1 kHz sine at level dBFS on both channels.
+func sine(rate beep.SampleRate, d time.Duration, level float64) [][2]float64 {
+	amp := math.Pow(10, level/20)
+	samples := make([][2]float64, rate.N(d))
+	for i := range samples {
+		v := amp * math.Sin(2*math.Pi*1000*float64(i)/float64(rate))
+		samples[i] = [2]float64{v, v}
+	}
+	return samples
+}
+
+func TestLoudnessMeter(t *testing.T) {
+	// EBU Tech 3341: a stereo 1 kHz sine at -23 dBFS measures -23 LUFS.
+	for _, rate := range []beep.SampleRate{44100, 48000} {
+		m := NewLoudnessMeter(rate)
+		m.Write(sine(rate, 20*time.Second, -23))
+		l, ok := m.Loudness()
+		if !ok || math.Abs(l.Integrated-(-23)) > 0.1 {
+			t.Errorf("at %d Hz, loudness = %.2f LUFS, %v; want -23 LUFS", rate, l.Integrated, ok)
+		}
+		if want := math.Pow(10, -23.0/20); math.Abs(l.Peak-want) > 1e-3 {
+			t.Errorf("at %d Hz, peak = %v, want %v", rate, l.Peak, want)
+		}
+	}
+
+	// Quiet passages are gated out rather than lowering the loudness.
+	m := NewLoudnessMeter(48000)
+	m.Write(sine(48000, 10*time.Second, -23))
+	m.Write(sine(48000, 10*time.Second, -50))
+	if l, ok := m.Loudness(); !ok || math.Abs(l.Integrated-(-23)) > 0.1 {
+		t.Errorf("with a quiet half, loudness = %.2f LUFS, %v; want -23 LUFS", l.Integrated, ok)
+	}
+
+	// Tracks too short for a block, or silent throughout, aren't measured.
+	for name, samples := range map[string][][2]float64{
+		"short":  sine(48000, 300*time.Millisecond, -23),
+		"silent": make([][2]float64, 48000*5),
+		"quiet":  sine(48000, 5*time.Second, -80),
+	} {
+		m := NewLoudnessMeter(48000)
+		m.Write(samples)
+		if l, ok := m.Loudness(); ok {
+			t.Errorf("%s track measured %.2f LUFS, want it unmeasured", name, l.Integrated)
+		}
+	}
+}
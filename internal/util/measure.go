@@ -0,0 +1,116 @@
+package util
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MeasureOptions selects what MeasureTracks measures.
+type MeasureOptions struct {
+	Durations bool // Measure tracks whose duration was only estimated
+	Loudness  bool // Measure the loudness of tracks without ReplayGain tags
+}
+
+// needs reports whether file has anything left to measure.
+func (o MeasureOptions) needs(file *AudioFile) (duration, loudness bool) {
+	duration = o.Durations && file.DurationEstimated
+	loudness = o.Loudness && file.Loudness == nil && !file.ReplayGain.HasTrack && !file.ReplayGain.HasAlbum
+	return duration, loudness
+}
+
+// TrackUpdate reports the measurements of a track.
+type TrackUpdate struct {
+	File     *AudioFile
+	Duration time.Duration // Measured duration; 0 if it wasn't measured
+	Loudness *Loudness     // Measured loudness; nil if it wasn't measured
+}
+
+// Apply copies the measurements to the track.
+func (u TrackUpdate) Apply(file *AudioFile) {
+	if u.Duration > 0 {
+		file.Duration = u.Duration
+		file.DurationEstimated = false
+	}
+	if u.Loudness != nil {
+		file.Loudness = u.Loudness
+	}
+}
+
+// MeasureTracks decodes every track with something to measure, as selected by
+// what, sending an update for each one as it finishes and closing updates
+// when done. The tracks themselves are not modified, so the receiver can apply
+// the updates on its own goroutine. Measurements are written back to the
+// metadata cache at opts.CacheFile.
+func MeasureTracks(files []*AudioFile, opts ScanOptions, what MeasureOptions, updates chan<- TrackUpdate) {
+	defer close(updates)
+
+	cache, err := LoadMetadataCache(opts.CacheFile)
+	if err != nil {
+		log.Printf("Metadata cache: %v", err)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan *AudioFile)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				u, err := measureTrack(file, what)
+				if err != nil {
+					log.Printf("Measuring %s: %v", file.Path, err)
+					continue
+				}
+
+				if info, err := os.Stat(file.SourcePath()); err == nil {
+					measured := *file
+					u.Apply(&measured)
+					cache.Store(file.Path, info, &measured)
+				}
+				updates <- u
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if duration, loudness := what.needs(file); duration || loudness {
+			jobs <- file
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := cache.Save(); err != nil {
+		log.Printf("Failed to save metadata cache: %v", err)
+	}
+}
+
+// measureTrack takes the measurements of file selected by what.
+func measureTrack(file *AudioFile, what MeasureOptions) (TrackUpdate, error) {
+	u := TrackUpdate{File: file}
+	duration, loudness := what.needs(file)
+	if duration {
+		d, err := MeasureDuration(file)
+		if err != nil {
+			return u, err
+		}
+		u.Duration = d
+	}
+	if loudness {
+		l, err := MeasureLoudness(file)
+		if err != nil {
+			return u, err
+		}
+		u.Loudness = l // Nil for tracks too short or quiet to measure, which play unchanged
+	}
+	return u, nil
+}
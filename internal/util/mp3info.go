@@ -0,0 +1,225 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// mp3ProbeLen is how much of the file after the ID3v2 tag is searched for the
+// first MPEG audio frame.
+const mp3ProbeLen = 64 * 1024
+
+// mpegFrame is a decoded MPEG audio frame header.
+type mpegFrame struct {
+	version    int // 1 for MPEG-1, 2 for MPEG-2 and MPEG-2.5
+	layer      int // 1, 2 or 3
+	bitrate    int // kbit/s
+	sampleRate int // Hz
+	mono       bool
+	size       int // Frame length in bytes, including the header
+}
+
+var (
+	// mpegBitrates is indexed by [MPEG-1?0:1][layer-1][bitrate index], in kbit/s.
+	mpegBitrates = [2][3][16]int{
+		{ // MPEG-1
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{ // MPEG-2 and MPEG-2.5
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+	// mpegSampleRates is indexed by version ID (as in the header) and sample rate index.
+	mpegSampleRates = map[byte][3]int{
+		0: {11025, 12000, 8000},  // MPEG-2.5
+		2: {22050, 24000, 16000}, // MPEG-2
+		3: {44100, 48000, 32000}, // MPEG-1
+	}
+)
+
+// samplesPerFrame returns the number of PCM samples a frame decodes to.
+func (f mpegFrame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// parseMPEGFrame decodes the 4-byte frame header at the start of b.
+func parseMPEGFrame(b []byte) (mpegFrame, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mpegFrame{}, false
+	}
+	versionID := (b[1] >> 3) & 0x03
+	layerID := (b[1] >> 1) & 0x03
+	bitrateIdx := b[2] >> 4
+	rateIdx := (b[2] >> 2) & 0x03
+	padding := int((b[2] >> 1) & 0x01)
+
+	rates, ok := mpegSampleRates[versionID]
+	if !ok || layerID == 0 || rateIdx == 3 || bitrateIdx == 0 || bitrateIdx == 15 {
+		return mpegFrame{}, false
+	}
+
+	f := mpegFrame{
+		version:    2,
+		layer:      4 - int(layerID),
+		sampleRate: rates[rateIdx],
+		mono:       b[3]>>6 == 0x03,
+	}
+	table := 1
+	if versionID == 3 {
+		f.version = 1
+		table = 0
+	}
+	f.bitrate = mpegBitrates[table][f.layer-1][bitrateIdx]
+
+	switch {
+	case f.layer == 1:
+		f.size = (12*f.bitrate*1000/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version != 1:
+		f.size = 72*f.bitrate*1000/f.sampleRate + padding
+	default:
+		f.size = 144*f.bitrate*1000/f.sampleRate + padding
+	}
+	return f, f.size > 4
+}
+
+// id3v2Size returns the total size of the ID3v2 tag at the start of b, or 0.
+func id3v2Size(b []byte) int {
+	if len(b) < 10 || !bytes.HasPrefix(b, []byte("ID3")) {
+		return 0
+	}
+	// The size is a 28-bit "syncsafe" integer excluding the 10-byte header.
+	size := int(b[6]&0x7F)<<21 | int(b[7]&0x7F)<<14 | int(b[8]&0x7F)<<7 | int(b[9]&0x7F)
+	size += 10
+	if b[5]&0x10 != 0 {
+		size += 10 // Footer present
+	}
+	return size
+}
+
+// readMP3Info determines an MP3 file's duration from its headers without decoding
+// any audio. VBR files carry the frame count in a Xing/Info or VBRI header; CBR
+// files without one are estimated from the bitrate and the size of the audio data.
+func readMP3Info(f *os.File, size int64) (StreamInfo, error) {
+	// Skip any ID3v2 tags (some files carry more than one).
+	var start int64
+	header := make([]byte, 10)
+	for {
+		if _, err := f.ReadAt(header, start); err != nil {
+			return StreamInfo{}, fmt.Errorf("%w: %s: %v", ErrInvalidFormat, f.Name(), err)
+		}
+		n := id3v2Size(header)
+		if n == 0 {
+			break
+		}
+		start += int64(n)
+	}
+
+	buf := make([]byte, mp3ProbeLen)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return StreamInfo{}, err
+	}
+	buf = buf[:n]
+
+	// Find the first frame, confirmed by a valid header where the next frame should start.
+	offset := -1
+	var frame mpegFrame
+	for i := 0; i+4 <= len(buf); i++ {
+		fr, ok := parseMPEGFrame(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + fr.size
+		if next+4 <= len(buf) {
+			if nf, ok := parseMPEGFrame(buf[next:]); !ok || nf.sampleRate != fr.sampleRate {
+				continue
+			}
+		}
+		offset, frame = i, fr
+		break
+	}
+	if offset < 0 {
+		return StreamInfo{}, fmt.Errorf("%w: %s: no MPEG audio frames found", ErrInvalidFormat, f.Name())
+	}
+
+	audioBytes := size - start - int64(offset)
+	if tail := make([]byte, 3); size >= 128 {
+		if _, err := f.ReadAt(tail, size-128); err == nil && string(tail) == "TAG" {
+			audioBytes -= 128 // ID3v1 tag
+		}
+	}
+
+	info := StreamInfo{SampleRate: frame.sampleRate}
+	if frames, bytesTotal, ok := vbrHeader(buf[offset:], frame); ok && frames > 0 {
+		samples := int64(frames) * int64(frame.samplesPerFrame())
+		info.Duration = time.Duration(samples) * time.Second / time.Duration(frame.sampleRate)
+		if bytesTotal > 0 {
+			audioBytes = int64(bytesTotal)
+		}
+	} else {
+		// Constant bitrate: every frame has the same size.
+		info.Duration = time.Duration(audioBytes*8*1000/int64(frame.bitrate)) * time.Microsecond
+		info.Estimated = true
+	}
+
+	if seconds := info.Duration.Seconds(); seconds > 0 {
+		info.Bitrate = int(math.Round(float64(audioBytes*8) / seconds / 1000))
+	}
+	return info, nil
+}
+
+// vbrHeader looks for a Xing/Info or VBRI header in the first frame and returns
+// the number of audio frames and bytes it declares (0 when absent).
+func vbrHeader(b []byte, f mpegFrame) (frames, size uint32, ok bool) {
+	// The Xing header follows the side information, whose size depends on the
+	// MPEG version and channel mode.
+	sideInfo := 32
+	switch {
+	case f.version == 1 && f.mono:
+		sideInfo = 17
+	case f.version != 1 && !f.mono:
+		sideInfo = 17
+	case f.version != 1 && f.mono:
+		sideInfo = 9
+	}
+	if x := 4 + sideInfo; len(b) >= x+16 {
+		tag := string(b[x : x+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(b[x+4:])
+			pos := x + 8
+			if flags&0x1 != 0 {
+				frames = binary.BigEndian.Uint32(b[pos:])
+				pos += 4
+			}
+			if flags&0x2 != 0 && len(b) >= pos+4 {
+				size = binary.BigEndian.Uint32(b[pos:])
+			}
+			return frames, size, true
+		}
+	}
+
+	// The VBRI header always sits 32 bytes after the frame header.
+	if x := 4 + 32; len(b) >= x+18 && string(b[x:x+4]) == "VBRI" {
+		size = binary.BigEndian.Uint32(b[x+10:])
+		frames = binary.BigEndian.Uint32(b[x+14:])
+		return frames, size, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Frame headers of the MPEG versions and layers, unpadded unless noted.
+var (
+	mpeg1Layer3  = []byte{0xFF, 0xFB, 0x90, 0x00} // 128 kbit/s, 44100 Hz, stereo
+	mpeg1Layer3M = []byte{0xFF, 0xFB, 0x90, 0xC0} // The same in mono
+	mpeg2Layer3  = []byte{0xFF, 0xF3, 0x80, 0x00} // 64 kbit/s, 22050 Hz
+	mpeg25Layer3 = []byte{0xFF, 0xE3, 0x48, 0x00} // 32 kbit/s, 8000 Hz
+	mpeg1Layer2  = []byte{0xFF, 0xFD, 0xA4, 0x00} // 192 kbit/s, 48000 Hz
+	mpeg1Layer1  = []byte{0xFF, 0xFF, 0x10, 0x00} // 32 kbit/s, 44100 Hz
+	mpeg2Layer3M = []byte{0xFF, 0xF3, 0x80, 0xC0} // 64 kbit/s, 22050 Hz, mono
+	mpeg1Layer3P = []byte{0xFF, 0xFB, 0x92, 0x00} // 128 kbit/s, 44100 Hz, padded
+)
+
+func TestParseMPEGFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    mpegFrame
+		samples int
+	}{
+		{"mpeg-1 layer iii", mpeg1Layer3, mpegFrame{version: 1, layer: 3, bitrate: 128, sampleRate: 44100, size: 417}, 1152},
+		{"mpeg-1 layer iii mono", mpeg1Layer3M, mpegFrame{version: 1, layer: 3, bitrate: 128, sampleRate: 44100, mono: true, size: 417}, 1152},
+		{"mpeg-1 layer iii padded", mpeg1Layer3P, mpegFrame{version: 1, layer: 3, bitrate: 128, sampleRate: 44100, size: 418}, 1152},
+		{"mpeg-2 layer iii", mpeg2Layer3, mpegFrame{version: 2, layer: 3, bitrate: 64, sampleRate: 22050, size: 208}, 576},
+		{"mpeg-2.5 layer iii", mpeg25Layer3, mpegFrame{version: 2, layer: 3, bitrate: 32, sampleRate: 8000, size: 288}, 576},
+		{"mpeg-1 layer ii", mpeg1Layer2, mpegFrame{version: 1, layer: 2, bitrate: 192, sampleRate: 48000, size: 576}, 1152},
+		{"mpeg-1 layer i", mpeg1Layer1, mpegFrame{version: 1, layer: 1, bitrate: 32, sampleRate: 44100, size: 32}, 384},
+	}
+	for _, tt := range tests {
+		got, ok := parseMPEGFrame(tt.header)
+		if !ok || got != tt.want {
+			t.Errorf("%s: parseMPEGFrame = %+v, %v; want %+v", tt.name, got, ok, tt.want)
+		}
+		if n := got.samplesPerFrame(); n != tt.samples {
+			t.Errorf("%s: %d samples per frame, want %d", tt.name, n, tt.samples)
+		}
+	}
+
+	for name, header := range map[string][]byte{
+		"no sync":          {0xFE, 0xFB, 0x90, 0x00},
+		"reserved version": {0xFF, 0xEB, 0x90, 0x00},
+		"reserved layer":   {0xFF, 0xF9, 0x90, 0x00},
+		"free bitrate":     {0xFF, 0xFB, 0x00, 0x00},
+		"bad bitrate":      {0xFF, 0xFB, 0xF0, 0x00},
+		"reserved rate":    {0xFF, 0xFB, 0x9C, 0x00},
+		"short":            {0xFF, 0xFB, 0x90},
+	} {
+		if f, ok := parseMPEGFrame(header); ok {
+			t.Errorf("%s: parseMPEGFrame = %+v, want it rejected", name, f)
+		}
+	}
+}
+
+// xingFrame returns a frame of size bytes after header, holding a Xing header
+// at offset that declares frames and bytes.
+func xingFrame(header []byte, size, offset int, frames, bytes uint32) []byte {
+	b := make([]byte, size)
+	copy(b, header)
+	copy(b[offset:], "Xing")
+	binary.BigEndian.PutUint32(b[offset+4:], 0x3)
+	binary.BigEndian.PutUint32(b[offset+8:], frames)
+	binary.BigEndian.PutUint32(b[offset+12:], bytes)
+	return b
+}
+
+func TestVBRHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		offset int // Of the Xing header, after the side information
+	}{
+		{"mpeg-1 stereo", mpeg1Layer3, 36},
+		{"mpeg-1 mono", mpeg1Layer3M, 21},
+		{"mpeg-2 stereo", mpeg2Layer3, 21},
+		{"mpeg-2 mono", mpeg2Layer3M, 13},
+	}
+	for _, tt := range tests {
+		f, _ := parseMPEGFrame(tt.header)
+		b := xingFrame(tt.header, f.size, tt.offset, 1000, 417000)
+		frames, size, ok := vbrHeader(b, f)
+		if !ok || frames != 1000 || size != 417000 {
+			t.Errorf("%s: vbrHeader = %d, %d, %v; want 1000, 417000", tt.name, frames, size, ok)
+		}
+	}
+
+	// An Info header declaring only the frame count.
+	f, _ := parseMPEGFrame(mpeg1Layer3)
+	b := xingFrame(mpeg1Layer3, f.size, 36, 1000, 0)
+	copy(b[36:], "Info")
+	binary.BigEndian.PutUint32(b[40:], 0x1)
+	if frames, size, ok := vbrHeader(b, f); !ok || frames != 1000 || size != 0 {
+		t.Errorf("Info: vbrHeader = %d, %d, %v; want 1000, 0", frames, size, ok)
+	}
+
+	// A VBRI header sits 32 bytes after the frame header, whatever the mode.
+	b = make([]byte, f.size)
+	copy(b, mpeg1Layer3M)
+	copy(b[36:], "VBRI")
+	binary.BigEndian.PutUint32(b[46:], 520000)
+	binary.BigEndian.PutUint32(b[50:], 2000)
+	fm, _ := parseMPEGFrame(mpeg1Layer3M)
+	if frames, size, ok := vbrHeader(b, fm); !ok || frames != 2000 || size != 520000 {
+		t.Errorf("VBRI: vbrHeader = %d, %d, %v; want 2000, 520000", frames, size, ok)
+	}
+
+	b = make([]byte, f.size)
+	copy(b, mpeg1Layer3)
+	if frames, size, ok := vbrHeader(b, f); ok {
+		t.Errorf("plain frame: vbrHeader = %d, %d, %v; want no header", frames, size, ok)
+	}
+}
+
+func TestReadMP3Info(t *testing.T) {
+	// An ID3v2 tag of 100 bytes, 10 of header and 90 of padding.
+	tag := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x5a"), make([]byte, 90)...)
+	frames := func(header []byte, n int) []byte {
+		f, _ := parseMPEGFrame(header)
+		frame := make([]byte, f.size)
+		copy(frame, header)
+		return bytes.Repeat(frame, n)
+	}
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	xing := xingFrame(mpeg1Layer3, 417, 36, 1000, 417000)
+	tests := []struct {
+		name string
+		data []byte
+		want StreamInfo
+	}{
+		{
+			// 100 frames of 417 bytes at 128 kbit/s: 41700 bytes last 2.60625 s.
+			name: "cbr after id3v2",
+			data: concat(tag, frames(mpeg1Layer3, 100)),
+			want: StreamInfo{Duration: 2606250 * time.Microsecond, SampleRate: 44100, Bitrate: 128, Estimated: true},
+		},
+		{
+			name: "cbr with id3v1",
+			data: concat(tag, tag, frames(mpeg1Layer3, 100), id3v1),
+			want: StreamInfo{Duration: 2606250 * time.Microsecond, SampleRate: 44100, Bitrate: 128, Estimated: true},
+		},
+		{
+			name: "mpeg-2 cbr",
+			data: frames(mpeg2Layer3, 50), // 10400 bytes at 64 kbit/s
+			want: StreamInfo{Duration: 1300 * time.Millisecond, SampleRate: 22050, Bitrate: 64, Estimated: true},
+		},
+		{
+			// 1000 frames of 1152 samples at 44100 Hz, whatever the file size.
+			name: "xing",
+			data: concat(tag, xing, frames(mpeg1Layer3, 10)),
+			want: StreamInfo{Duration: 1152000 * time.Second / 44100, SampleRate: 44100, Bitrate: 128},
+		},
+		{
+			name: "junk before the first frame",
+			data: concat([]byte{0xFF, 0xFB, 0x00, 0x01, 0x02}, frames(mpeg1Layer3, 10)),
+			want: StreamInfo{Duration: 260625 * time.Microsecond, SampleRate: 44100, Bitrate: 128, Estimated: true},
+		},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "song.mp3")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readMP3Info(f, int64(len(tt.data)))
+		f.Close()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: readMP3Info = %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+
+	path := filepath.Join(dir, "empty.mp3")
+	if err := os.WriteFile(path, concat(tag, make([]byte, 1000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if info, err := readMP3Info(f, 1100); err == nil {
+		t.Errorf("without frames, readMP3Info = %+v, want an error", info)
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// ReplayGain holds the ReplayGain tags of a track. Gains are in dB, relative
+// to the ReplayGain reference loudness; peaks are the loudest sample, 1 being
+// full scale, or 0 if not tagged.
+type ReplayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+	HasTrack  bool // Whether the track gain is tagged
+	HasAlbum  bool // Whether the album gain is tagged
+}
+
+// readReplayGain reads the ReplayGain tags from a file's raw tags: ID3 TXXX
+// frames and Vorbis comments, whose names are matched case-insensitively.
+func readReplayGain(raw map[string]interface{}) ReplayGain {
+	var rg ReplayGain
+	for key, value := range raw {
+		var name, text string
+		switch v := value.(type) {
+		case *tag.Comm: // ID3 TXXX frame
+			if !strings.HasPrefix(key, "TXX") { // TXXX, or TXX in ID3v2.2
+				continue
+			}
+			name, text = v.Description, v.Text
+		case string: // Vorbis comment
+			name, text = key, v
+		default:
+			continue
+		}
+
+		switch strings.ToLower(name) {
+		case "replaygain_track_gain":
+			rg.TrackGain, rg.HasTrack = parseGain(text)
+		case "replaygain_album_gain":
+			rg.AlbumGain, rg.HasAlbum = parseGain(text)
+		case "replaygain_track_peak":
+			rg.TrackPeak = parsePeak(text)
+		case "replaygain_album_peak":
+			rg.AlbumPeak = parsePeak(text)
+		}
+	}
+	return rg
+}
+
+// parseGain parses a gain such as "-6.48 dB".
+func parseGain(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && strings.EqualFold(s[len(s)-2:], "db") {
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	gain, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(gain) || math.IsInf(gain, 0) {
+		return 0, false
+	}
+	return gain, true
+}
+
+// parsePeak parses a peak such as "0.988", returning 0 if it is invalid.
+func parsePeak(s string) float64 {
+	peak, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || !(peak >= 0) || math.IsInf(peak, 0) {
+		return 0
+	}
+	return peak
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestParseGain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"-6.48 dB", -6.48, true},
+		{"+1.2dB", 1.2, true},
+		{" 3 DB ", 3, true},
+		{"-0.5", -0.5, true},
+		{"", 0, false},
+		{"dB", 0, false},
+		{"loud", 0, false},
+		{"NaN dB", 0, false},
+		{"Inf dB", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseGain(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("parseGain(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParsePeak(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"0.988", 0.988},
+		{" 1.05 ", 1.05},
+		{"-0.5", 0},
+		{"NaN", 0},
+		{"+Inf", 0},
+		{"peak", 0},
+	}
+	for _, tt := range tests {
+		if got := parsePeak(tt.in); got != tt.want {
+			t.Errorf("parsePeak(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadReplayGain(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		want ReplayGain
+	}{
+		{
+			"vorbis comments",
+			map[string]interface{}{
+				"replaygain_track_gain": "-6.48 dB",
+				"replaygain_track_peak": "0.988",
+				"replaygain_album_gain": "+1.2dB",
+				"replaygain_album_peak": "1.02",
+				"title":                 "Song",
+			},
+			ReplayGain{TrackGain: -6.48, TrackPeak: 0.988, AlbumGain: 1.2, AlbumPeak: 1.02, HasTrack: true, HasAlbum: true},
+		},
+		{
+			"id3 frames",
+			map[string]interface{}{
+				"TXXX":   &tag.Comm{Description: "REPLAYGAIN_TRACK_GAIN", Text: "-3.10 dB"},
+				"TXXX_0": &tag.Comm{Description: "ReplayGain_Track_Peak", Text: "0.5"},
+				"TXXX_1": &tag.Comm{Description: "replaygain_album_gain", Text: "-2 dB"},
+				"COMM":   &tag.Comm{Description: "replaygain_album_peak", Text: "0.9"}, // Not a TXXX frame
+			},
+			ReplayGain{TrackGain: -3.1, TrackPeak: 0.5, AlbumGain: -2, HasTrack: true, HasAlbum: true},
+		},
+		{
+			"id3v2.2 frames",
+			map[string]interface{}{
+				"TXX": &tag.Comm{Description: "replaygain_track_gain", Text: "1 dB"},
+			},
+			ReplayGain{TrackGain: 1, HasTrack: true},
+		},
+		{
+			"garbage",
+			map[string]interface{}{
+				"replaygain_track_gain": "loud",
+				"replaygain_track_peak": "-1",
+				"replaygain_album_gain": 6, // Not text
+			},
+			ReplayGain{},
+		},
+	}
+	for _, tt := range tests {
+		if got := readReplayGain(tt.raw); got != tt.want {
+			t.Errorf("%s: readReplayGain = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName is the name of the per-directory file listing glob patterns
+// to exclude from a library scan, one per line. Blank lines and lines starting
+// with '#' are ignored, and a trailing '/' restricts a pattern to directories.
+const IgnoreFileName = ".muxicignore"
+
+// ScanOptions configures a library scan.
+type ScanOptions struct {
+	Roots          []string // Library root directories to scan
+	FollowSymlinks bool     // Whether to follow symlinked files and directories
+	Exclude        []string // Glob patterns to skip, relative to each root
+	Workers        int      // Maximum files read concurrently; <= 0 uses the number of CPUs
+	CacheFile      string   // Persistent metadata cache; empty disables persistence
+	Rescan         bool     // Ignore the existing cache and re-read every file
+}
+
+// ignoreRule is a single exclude pattern, anchored at the directory it was declared in.
+type ignoreRule struct {
+	base    string // Directory the pattern is relative to
+	pattern string // Slash-separated glob pattern
+	dirOnly bool   // Whether the pattern only matches directories
+}
+
+// matches reports whether the rule excludes the given path. Patterns without a
+// slash match the base name at any depth; patterns with a slash match the path
+// relative to the rule's directory.
+func (r ignoreRule) matches(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !strings.Contains(r.pattern, "/") {
+		ok, _ := path.Match(r.pattern, filepath.Base(p))
+		return ok
+	}
+	rel, err := filepath.Rel(r.base, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	ok, _ := path.Match(r.pattern, filepath.ToSlash(rel))
+	return ok
+}
+
+// newIgnoreRule parses a single pattern, validating its glob syntax.
+func newIgnoreRule(base, pattern string) (ignoreRule, error) {
+	pattern = filepath.ToSlash(strings.TrimSpace(pattern))
+	rule := ignoreRule{base: base}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	rule.pattern = strings.TrimPrefix(pattern, "/")
+	if _, err := path.Match(rule.pattern, ""); err != nil {
+		return ignoreRule{}, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+	}
+	return rule, nil
+}
+
+// readIgnoreFile loads the rules from dir's ignore file, if it has one.
+func readIgnoreFile(dir string) ([]ignoreRule, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := newIgnoreRule(dir, text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", f.Name(), line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// libraryWalker collects the audio file paths below a set of roots, along
+// with the CUE sheets that split them into tracks.
+type libraryWalker struct {
+	opts     ScanOptions
+	visited  map[string]bool // Real paths of directories already walked, to break symlink loops
+	seen     map[string]bool // Paths already collected, so overlapping roots aren't scanned twice
+	paths    []string
+	cuePaths []string
+}
+
+// walk recursively collects audio files in dir, honouring the inherited rules
+// and any ignore file found in the directory itself.
+func (w *libraryWalker) walk(dir string, rules []ignoreRule) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.visited[realDir] {
+		return nil
+	}
+	w.visited[realDir] = true
+
+	local, err := readIgnoreFile(dir)
+	if err != nil {
+		log.Printf("Ignoring %s: %v", IgnoreFileName, err)
+	}
+	rules = append(rules[:len(rules):len(rules)], local...)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				continue // Dangling link
+			}
+			isDir = info.IsDir()
+		}
+
+		if excluded(rules, p, isDir) {
+			continue
+		}
+
+		if isDir {
+			if err := w.walk(p, rules); err != nil {
+				log.Printf("Skipping %s: %v", p, err)
+			}
+			continue
+		}
+		if w.seen[p] {
+			continue
+		}
+		if isAudioFile(entry.Name()) {
+			w.seen[p] = true
+			w.paths = append(w.paths, p)
+		} else if isCueSheet(entry.Name()) {
+			w.seen[p] = true
+			w.cuePaths = append(w.cuePaths, p)
+		}
+	}
+	return nil
+}
+
+// excluded reports whether any rule matches the path.
+func excluded(rules []ignoreRule, p string, isDir bool) bool {
+	for _, r := range rules {
+		if r.matches(p, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectAudioPaths walks every root and returns the paths of all supported audio
+// files, without reading them. Paths are sorted within each root.
+func CollectAudioPaths(opts ScanOptions) ([]string, error) {
+	w, err := collectPaths(opts)
+	if err != nil {
+		return nil, err
+	}
+	return w.paths, nil
+}
+
+// collectPaths walks every root, collecting the paths of audio files and CUE
+// sheets sorted within each root.
+func collectPaths(opts ScanOptions) (*libraryWalker, error) {
+	w := &libraryWalker{
+		opts:    opts,
+		visited: make(map[string]bool),
+		seen:    make(map[string]bool),
+	}
+
+	for _, root := range opts.Roots {
+		root = filepath.Clean(root)
+		var rules []ignoreRule
+		for _, pattern := range opts.Exclude {
+			rule, err := newIgnoreRule(root, pattern)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+
+		start, cueStart := len(w.paths), len(w.cuePaths)
+		if err := w.walk(root, rules); err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", root, err)
+		}
+		sort.Strings(w.paths[start:])
+		sort.Strings(w.cuePaths[cueStart:])
+	}
+	return w, nil
+}
+
+// ScanLibrary walks every library root and reads the metadata of each audio file
+// found, using at most opts.Workers concurrent readers. Unchanged files are served
+// from the metadata cache at opts.CacheFile, which is updated afterwards. Files
+// that fail to decode are logged and skipped. Files split by a CUE sheet are
+// replaced by their tracks.
+func ScanLibrary(opts ScanOptions) ([]*AudioFile, error) {
+	w, err := collectPaths(opts)
+	if err != nil {
+		return nil, err
+	}
+	paths := w.paths
+
+	cache := NewMetadataCache(opts.CacheFile)
+	if !opts.Rescan {
+		if cache, err = LoadMetadataCache(opts.CacheFile); err != nil {
+			log.Printf("Metadata cache: %v", err)
+		}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	files := make([]*AudioFile, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				path := paths[idx]
+				info, err := os.Stat(path)
+				if err != nil {
+					log.Printf("Skipping %s: %v", path, err)
+					continue
+				}
+				if cached, ok := cache.Lookup(path, info); ok {
+					files[idx] = cached
+					continue
+				}
+
+				file, err := ReadAudioMetadata(path, filepath.Base(path))
+				if err != nil {
+					log.Printf("Skipping %s: %v", path, err)
+					continue
+				}
+				files[idx] = file
+				cache.Store(path, info, file)
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Filter out files that failed to load
+	audioFiles := make([]*AudioFile, 0, len(files))
+	for _, file := range files {
+		if file != nil {
+			audioFiles = append(audioFiles, file)
+		}
+	}
+	audioFiles, partPaths := splitCueSheets(audioFiles, w.cuePaths, cache)
+
+	cache.Prune(append(paths, partPaths...))
+	if err := cache.Save(); err != nil {
+		log.Printf("Failed to save metadata cache: %v", err)
+	}
+	return audioFiles, nil
+}
@@ -0,0 +1,172 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates files below dir, their parent directories included.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relPaths returns paths relative to dir, slash-separated.
+func relPaths(t *testing.T, dir string, paths []string) []string {
+	t.Helper()
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		r, err := filepath.Rel(dir, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel[i] = filepath.ToSlash(r)
+	}
+	return rel
+}
+
+func TestCollectPathsHonoursIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".muxicignore":     "# Not wanted\n\n*.ogg\nskip/\n*.wav/\nsub/deep/x.flac\n",
+		"a.mp3":            "",
+		"b.ogg":            "",
+		"notes.txt":        "",
+		"album.cue":        "",
+		"skip/c.mp3":       "",
+		"kept.wav":         "",
+		"dir.wav/z.mp3":    "",
+		"sub/.muxicignore": "d.flac\n",
+		"sub/d.flac":       "",
+		"sub/deep/x.flac":  "",
+		"sub/deep/y.flac":  "",
+		"other/d.flac":     "",
+		"other/e.mp3":      "",
+	})
+
+	w, err := collectPaths(ScanOptions{Roots: []string{dir}, Exclude: []string{"other/*.flac"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.mp3", "kept.wav", "other/e.mp3", "sub/deep/y.flac"}
+	if got := relPaths(t, dir, w.paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %v, want %v", got, want)
+	}
+	if got := relPaths(t, dir, w.cuePaths); !reflect.DeepEqual(got, []string{"album.cue"}) {
+		t.Errorf("collected CUE sheets %v, want album.cue", got)
+	}
+
+	if _, err := collectPaths(ScanOptions{Roots: []string{dir}, Exclude: []string{"[bad"}}); err == nil {
+		t.Error("an invalid exclude pattern was accepted")
+	}
+}
+
+func TestCollectPathsOverlappingRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.mp3":     "",
+		"sub/b.mp3": "",
+		"sub/c.mp3": "",
+	})
+	sub := filepath.Join(dir, "sub")
+
+	for _, tt := range []struct {
+		roots []string
+		want  []string
+	}{
+		{[]string{dir, sub}, []string{"a.mp3", "sub/b.mp3", "sub/c.mp3"}},
+		{[]string{sub, dir}, []string{"sub/b.mp3", "sub/c.mp3", "a.mp3"}},
+		{[]string{dir, dir + string(filepath.Separator)}, []string{"a.mp3", "sub/b.mp3", "sub/c.mp3"}},
+	} {
+		paths, err := CollectAudioPaths(ScanOptions{Roots: tt.roots})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := relPaths(t, dir, paths); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("roots %v: collected %v, want %v", relPaths(t, dir, tt.roots), got, tt.want)
+		}
+	}
+}
+
+func TestCollectPathsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"music/song.mp3": "", "elsewhere/more.mp3": ""})
+	music := filepath.Join(dir, "music")
+	links := map[string]string{
+		"loop":      music, // Back to the root
+		"alias.mp3": filepath.Join(music, "song.mp3"),
+		"elsewhere": filepath.Join(dir, "elsewhere"),
+		"dangling":  filepath.Join(dir, "missing"),
+		"nested/up": music,
+	}
+	for name, target := range links {
+		p := filepath.Join(music, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, p); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	paths, err := CollectAudioPaths(ScanOptions{Roots: []string{music}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relPaths(t, music, paths); !reflect.DeepEqual(got, []string{"song.mp3"}) {
+		t.Errorf("without following symlinks, collected %v, want song.mp3", got)
+	}
+
+	// Followed, each directory is walked once however it is reached.
+	paths, err = CollectAudioPaths(ScanOptions{Roots: []string{music}, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"alias.mp3", "elsewhere/more.mp3", "song.mp3"}
+	if got := relPaths(t, music, paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("following symlinks, collected %v, want %v", got, want)
+	}
+}
+
+func TestScanLibrary(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"album/one.wav":   string(wavData(44100)),
+		"album/two.wav":   string(wavData(22050)),
+		"broken.mp3":      "not audio",
+		"album/album.cue": "FILE \"whole.wav\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n",
+		"album/whole.wav": string(wavData(88200)),
+	})
+	opts := ScanOptions{Roots: []string{dir}, CacheFile: filepath.Join(dir, "cache.gob"), Workers: 2}
+
+	// The second scan is served from the cache the first one saved.
+	for i := 1; i <= 2; i++ {
+		files, err := ScanLibrary(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range files {
+			got = append(got, fmt.Sprintf("%s %v", filepath.Base(f.Path), f.Duration))
+		}
+		// Broken files are skipped, and split ones replaced by their tracks.
+		want := []string{"one.wav 1s", "two.wav 500ms", "album.cue#01 2s"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("scan %d: read %v, want %v", i, got, want)
+		}
+		if _, err := os.Stat(opts.CacheFile); err != nil {
+			t.Fatalf("scan %d: the cache wasn't saved: %v", i, err)
+		}
+	}
+}
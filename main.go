@@ -1,29 +1,189 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"muxic/internal/player"
+	"muxic/internal/player/components"
+	"muxic/internal/util"
 	"os"
+	"strings"
 
 	"github.com/charmbracelet/log"
 )
 
+// stringList is a flag.Value that collects every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatal("Import failed:", "error", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			log.Fatal("Config failed:", "error", err)
+		}
+		return
+	}
+
+	configFile := flag.String("config", "", "config file to read (default: config.toml in muxic's config directory)")
+	var excludes stringList
+	flag.Var(&excludes, "exclude", "glob pattern to exclude from the library scan (repeatable)")
+	followSymlinks := flag.Bool("follow-symlinks", false, "follow symlinked files and directories while scanning")
+	scanWorkers := flag.Int("scan-workers", 0, "maximum files read concurrently while scanning (0 = number of CPUs)")
+	columns := flag.String("columns", "",
+		"comma-separated track columns to show, e.g. title,artist,album,track,year,duration (available: "+
+			strings.Join(components.TrackColumnNames(), ", ")+")")
+	rescan := flag.Bool("rescan", false, "ignore the metadata cache and re-read every file")
+	accurateDurations := flag.Bool("accurate-durations", false,
+		"decode tracks in the background to replace estimated durations with exact ones")
+	exportDir := flag.String("export-dir", "", "directory playlists are exported to (default: the first library root)")
+	exportAbsolute := flag.Bool("export-absolute", false, "write absolute instead of relative paths when exporting playlists")
+	noRestore := flag.Bool("no-restore", false, "start afresh instead of restoring the queue, track and position of the last session")
+	resampleQuality := flag.Int("resample-quality", components.DefaultResampleQuality,
+		"resampling quality (1-64) for tracks whose sample rate differs from the output")
+	output := flag.String("output", "speaker", "where to play audio: speaker, null (discard it) or wav:path (record it)")
+	outputSpeed := flag.Float64("output-speed", 1,
+		"how fast the null and wav outputs consume audio relative to real time (0 = as fast as possible)")
+	crossfade := flag.Duration("crossfade", 0, "how long each track fades into the next, up to 12s (0 = play them gaplessly)")
+	replayGain := flag.String("replaygain", "", "loudness normalization: off, track, album or auto (default from the config file)")
+	speed := flag.Float64("speed", 1, "playback speed, 0.5-3, keeping the pitch unless the config file says otherwise")
+	flag.Usage = func() {
+		_, _ = os.Stderr.WriteString("Usage: muxic [flags] [library-root ...]\n" +
+			"       muxic import [flags] playlist.m3u ...\n" +
+			"       muxic config init [flags]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// Set up logging
 	log.SetLevel(log.DebugLevel)
 	log.Info("Starting muxic player")
 
-	dir := "."
-	if len(os.Args) > 1 {
-		dir = os.Args[1]
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		// Print every problem on its own line, as path:line: message.
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Ensure the directory exists
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		log.Fatalf("Directory does not exist: %s", dir)
+	// Flags given on the command line take precedence over the config file.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "exclude":
+			cfg.Exclude = excludes
+		case "follow-symlinks":
+			cfg.FollowSymlinks = *followSymlinks
+		case "crossfade":
+			if *crossfade < 0 || *crossfade > components.MaxCrossfade {
+				log.Fatal("Invalid -crossfade:", "error", "out of range (0-12s)")
+			}
+			cfg.Crossfade.Duration = *crossfade
+		case "replaygain":
+			mode, ok := components.ParseReplayGainMode(*replayGain)
+			if !ok {
+				log.Fatal("Invalid -replaygain:", "error", fmt.Sprintf("unknown mode %q", *replayGain))
+			}
+			cfg.Normalization.Mode = mode
+		case "speed":
+			if !(*speed >= components.MinSpeed && *speed <= components.MaxSpeed) {
+				log.Fatal("Invalid -speed:", "error", "out of range (0.5-3)")
+			}
+			cfg.Speed.Speed = *speed
+		}
+	})
+
+	trackColumns := cfg.Columns
+	if *columns != "" {
+		if trackColumns, err = components.ParseTrackColumns(*columns); err != nil {
+			log.Fatal("Invalid -columns:", "error", err)
+		}
+	}
+
+	// Every positional argument is a library root; without any, the config
+	// file's roots are used, which default to ~/Music.
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = cfg.LibraryRoots
+	}
+	if len(roots) == 0 {
+		log.Fatal("No library roots given")
+	}
+
+	// Ensure the directories exist
+	for _, dir := range roots {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			log.Fatalf("Directory does not exist: %s", dir)
+		}
+	}
+
+	if *exportDir == "" {
+		*exportDir = roots[0]
+	}
+
+	cacheFile, err := util.DefaultMetadataCachePath()
+	if err != nil {
+		log.Warn("Metadata cache disabled:", "error", err)
+	}
+
+	playlistsFile, err := playlistsPath(cfg)
+	if err != nil {
+		log.Warn("Playlists won't be saved:", "error", err)
+	}
+
+	bookmarksFile, err := components.DefaultBookmarksPath()
+	if err != nil {
+		log.Warn("Bookmarks won't be saved:", "error", err)
+	}
+
+	// The last session's volume, play order and view take precedence over the
+	// config file; its queue is restored once the library has loaded.
+	sessionFile, err := components.DefaultSessionPath()
+	if err != nil {
+		log.Warn("Session won't be saved:", "error", err)
+	}
+	var session *components.Session
+	if sessionFile != "" && !*noRestore {
+		if session, err = components.LoadSession(sessionFile); err != nil {
+			log.Warn("Last session not restored:", "error", err)
+		} else if session != nil {
+			session.ApplyTo(&cfg)
+		}
 	}
 
 	// Initialize and run the player
-	mp, err := player.NewMusicPlayer(dir)
+	mp, err := player.NewMusicPlayer(player.Options{
+		Scan: util.ScanOptions{
+			Roots:          roots,
+			FollowSymlinks: cfg.FollowSymlinks,
+			Exclude:        cfg.Exclude,
+			Workers:        *scanWorkers,
+			CacheFile:      cacheFile,
+			Rescan:         *rescan,
+		},
+		ResampleQuality:   *resampleQuality,
+		Output:            *output,
+		OutputSpeed:       *outputSpeed,
+		Columns:           trackColumns,
+		AccurateDurations: *accurateDurations,
+		PlaylistsFile:     playlistsFile,
+		ExportDir:         *exportDir,
+		ExportRelative:    !*exportAbsolute,
+		BookmarksFile:     bookmarksFile,
+		SessionFile:       sessionFile,
+		Session:           session,
+		Config:            cfg,
+	})
 	if err != nil {
 		log.Fatal("Error initializing player:", "error", err)
 	}